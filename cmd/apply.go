@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/git"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+// readSyncPlan loads a plan written by plan --json
+func readSyncPlan(path string) (*syncPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	var plan syncPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan %s: %w", path, err)
+	}
+	if plan.Version != syncPlanVersion {
+		return nil, fmt.Errorf("unsupported plan version %d in %s, want %d", plan.Version, path, syncPlanVersion)
+	}
+	if plan.Fingerprint == "" {
+		return nil, fmt.Errorf("plan %s has no fingerprint", path)
+	}
+	return &plan, nil
+}
+
+// setPlanFlags makes the run use the options the plan was made with
+func setPlanFlags(cmd *cobra.Command, opts planOptions) error {
+	flags := map[string]string{
+		"link-mode":   opts.LinkMode,
+		"force":       strconv.FormatBool(opts.Force),
+		"ignore-case": strconv.FormatBool(opts.IgnoreCase),
+	}
+	for name, value := range flags {
+		if err := cmd.Flags().Set(name, value); err != nil {
+			return err
+		}
+	}
+	for _, only := range opts.Only {
+		if err := cmd.Flags().Set("only", only); err != nil {
+			return err
+		}
+	}
+	for _, component := range opts.Components {
+		if err := cmd.Flags().Set("component", component); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upstreamDrift explains how the configured upstreams differ from the ones
+// recorded in the plan, or returns "" when they are the same
+func upstreamDrift(recorded, now []upstreamStep) string {
+	if len(recorded) != len(now) {
+		return "the configured upstreams changed"
+	}
+	for i, u := range recorded {
+		n := now[i]
+		if n.Dir != u.Dir || n.Type != u.Type || n.Location != u.Location || n.Ref != u.Ref {
+			return "the configured upstreams changed"
+		}
+	}
+	return ""
+}
+
+// planDrift explains how the plan made now differs from the recorded one
+func planDrift(recorded, now *syncPlan) string {
+	if drift := upstreamDrift(recorded.Upstreams, now.Upstreams); drift != "" {
+		return drift
+	}
+	for i, u := range recorded.Upstreams {
+		if now.Upstreams[i].Commit != u.Commit {
+			return fmt.Sprintf("%s is checked out at a different commit", u.Dir)
+		}
+	}
+	if !sameLinkSteps(recorded.Links, now.Links) || len(recorded.Deletes) != len(now.Deletes) {
+		return "the planned links changed"
+	}
+	return "the config, the state, .gitignore, an upstream source or a target in overlay/ changed"
+}
+
+// sameLinkSteps reports whether two plans link the same files the same way
+func sameLinkSteps(a, b []linkStep) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// plannedCommits returns the commit recorded for each git upstream, by directory
+func plannedCommits(plan *syncPlan) map[string]string {
+	commits := make(map[string]string)
+	for _, u := range plan.Upstreams {
+		if u.Commit != "" {
+			commits[u.Dir] = u.Commit
+		}
+	}
+	return commits
+}
+
+// upstreamSnapshot is where apply found the upstreams, so they can be put
+// back when the plan no longer matches
+type upstreamSnapshot struct {
+	commits map[string]string // Checked out commit by git upstream directory
+	saved   map[string]string // Copy set aside by provider upstream directory
+}
+
+// snapshotUpstreams records the commit of every git upstream and sets every
+// provider upstream aside, as fetching one replaces it
+func snapshotUpstreams(cfg *config.Config) (*upstreamSnapshot, error) {
+	commits := plannedCommits(&syncPlan{Upstreams: planUpstreams(cfg)})
+	s := &upstreamSnapshot{saved: make(map[string]string)}
+	setAside := func(dir string) error {
+		if _, err := os.Lstat(dir); os.IsNotExist(err) {
+			return nil
+		}
+		tmpDir, err := os.MkdirTemp(filepath.Dir(dir), ".git-overlay-upstream-*")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		saved := filepath.Join(tmpDir, "upstream")
+		if err := os.Rename(dir, saved); err != nil {
+			os.RemoveAll(tmpDir)
+			return fmt.Errorf("failed to set %s aside: %w", dir, err)
+		}
+		s.saved[dir] = saved
+		return nil
+	}
+
+	if !cfg.Upstream.IsGit() {
+		dir := config.UpstreamDir("")
+		if cfg.UpstreamDir != "" {
+			dir = cfg.UpstreamDir
+		}
+		if err := setAside(dir); err != nil {
+			return nil, errors.Join(err, s.restore())
+		}
+	}
+	for _, named := range cfg.Upstreams {
+		if named.IsGit() {
+			continue
+		}
+		if err := setAside(config.UpstreamDir(named.Name)); err != nil {
+			return nil, errors.Join(err, s.restore())
+		}
+	}
+	s.commits = commits
+	return s, nil
+}
+
+// restore checks the git upstreams that moved out where they were and puts
+// the provider upstreams set aside back
+func (s *upstreamSnapshot) restore() error {
+	var errs []error
+	for dir, commit := range s.commits {
+		if head, err := git.HeadCommit(dir); err == nil && head == commit {
+			continue
+		}
+		if err := git.CheckoutCommit(dir, commit); err != nil {
+			errs = append(errs, fmt.Errorf("failed to put %s back at %s: %w", dir, commit[:7], err))
+		}
+	}
+	for dir, saved := range s.saved {
+		err := os.RemoveAll(dir)
+		if err == nil {
+			err = os.Rename(saved, dir)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to put %s back, it was left in %s: %w", dir, saved, err))
+			continue
+		}
+		os.RemoveAll(filepath.Dir(saved))
+	}
+	return errors.Join(errs...)
+}
+
+// discard drops the provider upstreams set aside
+func (s *upstreamSnapshot) discard() {
+	for _, saved := range s.saved {
+		os.RemoveAll(filepath.Dir(saved))
+	}
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply <plan.json>",
+	Short: "Run a plan saved with 'plan --json', refusing if anything changed since",
+	Long: `Run the sync recorded in a plan saved with 'plan --json', using the link mode,
+--force and --only it was made with.
+
+Each git upstream is checked out at exactly the commit the plan was made from,
+fetching it if needed, and apply refuses if that commit isn't the tip of the
+configured ref or in its history. Other upstreams are fetched at their ref. The
+plan is then made again, and apply refuses to touch overlay/ unless it matches
+the recorded one: the config, the state, .gitignore, the content of every
+upstream source and every target in overlay/ must be as they were. When apply
+refuses, the upstreams are put back where they were.`,
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{lockAnnotation: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		recorded, err := readSyncPlan(args[0])
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if err := setPlanFlags(cmd, recorded.Options); err != nil {
+			return err
+		}
+		if err := applyTransportOptions(cmd); err != nil {
+			return err
+		}
+
+		// Nothing is fetched from upstreams the plan doesn't name
+		if drift := upstreamDrift(recorded.Upstreams, planUpstreams(cfg)); drift != "" {
+			return fmt.Errorf("%w: %s", overlayerr.ErrPlanDrift, drift)
+		}
+		for _, l := range recorded.Links {
+			if l.Action == linkConflict {
+				return fmt.Errorf("%w: the plan stops at %s", overlayerr.ErrConflict, l.Target)
+			}
+		}
+
+		// An interrupt finishes the checkout or link in progress and records what was done
+		defer trapInterrupts()()
+
+		// Upstreams are only left moved once the plan is known to match
+		snapshot, err := snapshotUpstreams(cfg)
+		if err != nil {
+			return err
+		}
+		matched := false
+		defer func() {
+			if matched {
+				snapshot.discard()
+			} else if err := snapshot.restore(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}()
+
+		if err := syncAllUpstreams(cfg, syncOptions{jobs: defaultSyncJobs, commits: plannedCommits(recorded)}); err != nil {
+			return fmt.Errorf("failed to check out the planned upstream commits: %w", err)
+		}
+		if err := interrupted(); err != nil {
+			return err
+		}
+
+		now, err := buildSyncPlan(cmd, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to plan sync: %w", err)
+		}
+		if now.Fingerprint != recorded.Fingerprint {
+			return fmt.Errorf("%w: %s; overlay/ was left as it is", overlayerr.ErrPlanDrift, planDrift(recorded, now))
+		}
+		matched = true
+
+		if err := CreateLinks(cmd, cfg); err != nil {
+			return fmt.Errorf("failed to rebuild links: %w", err)
+		}
+
+		fmt.Printf("Applied plan %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+	addTransportFlags(applyCmd)
+	// Set from the plan rather than by hand
+	applyCmd.Flags().StringArray("only", nil, "")
+	applyCmd.Flags().Bool("ignore-case", false, "")
+	applyCmd.Flags().StringArray("component", nil, "")
+	applyCmd.Flags().MarkHidden("only")
+	applyCmd.Flags().MarkHidden("component")
+	applyCmd.Flags().MarkHidden("ignore-case")
+}
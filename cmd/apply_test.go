@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/git"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+	"github.com/spf13/cobra"
+)
+
+func TestApplyPlan(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script providers are not supported on windows")
+	}
+
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$1\" in\nresolve) echo \"$2\" ;;\nfetch) echo \"$2\" > \"$3/version.txt\" ;;\nesac\n"
+	if err := os.WriteFile(filepath.Join(binDir, "git-overlay-provider-fake"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write provider: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	configContent := `upstream:
+  type: fake
+  ref: v1
+link_mode: copy
+symlinks:
+  - version.txt
+`
+	if err := os.WriteFile(".git-overlay.yml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	newCmd := func(runE func(*cobra.Command, []string) error) *cobra.Command {
+		cmd := &cobra.Command{RunE: runE}
+		cmd.Flags().String("config", ".git-overlay.yml", "")
+		cmd.Flags().String("link-mode", "symlink", "")
+		cmd.Flags().Bool("force", false, "")
+		cmd.Flags().StringArray("only", nil, "")
+		cmd.Flags().Bool("ignore-case", false, "")
+		addTransportFlags(cmd)
+		return cmd
+	}
+
+	// makePlan saves a plan the way plan --json does
+	makePlan := func(t *testing.T, args ...string) string {
+		cmd := newCmd(nil)
+		if err := cmd.ParseFlags(args); err != nil {
+			t.Fatalf("Failed to parse flags: %v", err)
+		}
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			t.Fatalf("loadConfig() error = %v", err)
+		}
+		plan, err := buildSyncPlan(cmd, cfg)
+		if err != nil {
+			t.Fatalf("buildSyncPlan() error = %v", err)
+		}
+		data, err := json.Marshal(plan)
+		if err != nil {
+			t.Fatalf("Failed to marshal plan: %v", err)
+		}
+		path := filepath.Join(t.TempDir(), "plan.json")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("Failed to write plan: %v", err)
+		}
+		return path
+	}
+
+	cmd := newCmd(nil)
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if err := syncAllUpstreams(cfg, syncOptions{jobs: 1}); err != nil {
+		t.Fatalf("syncAllUpstreams() error = %v", err)
+	}
+
+	plan := makePlan(t)
+	apply := newCmd(applyCmd.RunE)
+	if err := apply.RunE(apply, []string{plan}); err != nil {
+		t.Fatalf("apply error = %v", err)
+	}
+	if data, err := os.ReadFile("overlay/version.txt"); err != nil || strings.TrimSpace(string(data)) != "v1" {
+		t.Errorf("overlay/version.txt = %q (%v), want v1", data, err)
+	}
+
+	// A local edit after planning changes a target the plan covers
+	plan = makePlan(t, "--force")
+	if err := os.WriteFile("overlay/version.txt", []byte("edited"), 0644); err != nil {
+		t.Fatalf("Failed to edit file: %v", err)
+	}
+	apply = newCmd(applyCmd.RunE)
+	if err := apply.RunE(apply, []string{plan}); !errors.Is(err, overlayerr.ErrPlanDrift) {
+		t.Errorf("apply after edit error = %v, want ErrPlanDrift", err)
+	}
+	if data, _ := os.ReadFile("overlay/version.txt"); string(data) != "edited" {
+		t.Errorf("overlay/version.txt = %q, want the edit left alone", data)
+	}
+
+	// The plan has to be one plan --json wrote
+	if err := os.WriteFile("bad.json", []byte(`{"version": 99}`), 0644); err != nil {
+		t.Fatalf("Failed to write plan: %v", err)
+	}
+	apply = newCmd(applyCmd.RunE)
+	if err := apply.RunE(apply, []string{"bad.json"}); err == nil || !strings.Contains(err.Error(), "unsupported plan version") {
+		t.Errorf("apply of a bad plan error = %v, want unsupported version", err)
+	}
+}
+
+func TestApplyPlanPinsCommits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script providers are not supported on windows")
+	}
+
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$1\" in\nresolve) echo \"$2\" ;;\nfetch) echo \"$2\" > \"$3/version.txt\" ;;\nesac\n"
+	if err := os.WriteFile(filepath.Join(binDir, "git-overlay-provider-fake"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write provider: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	docsRepo := filepath.Join(t.TempDir(), "docs")
+	if err := os.MkdirAll(docsRepo, 0755); err != nil {
+		t.Fatalf("Failed to create docs repo: %v", err)
+	}
+	commit := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(docsRepo, "guide.md"), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write docs file: %v", err)
+		}
+		for _, args := range [][]string{{"add", "guide.md"}, {"commit", "-m", content}} {
+			if err := runGitCommand(docsRepo, args); err != nil {
+				t.Fatalf("Failed to run git %v: %v", args, err)
+			}
+		}
+	}
+	if err := runGitCommand(docsRepo, []string{"init", "-b", "main"}); err != nil {
+		t.Fatalf("Failed to init docs repo: %v", err)
+	}
+	commit("reviewed")
+
+	configContent := `upstream:
+  type: fake
+  ref: v1
+upstreams:
+  - name: docs
+    url: ` + docsRepo + `
+    ref: main
+link_mode: copy
+symlinks:
+  - version.txt
+  - from: guide.md
+    to: guide.md
+    upstream: docs
+`
+	if err := os.WriteFile(".git-overlay.yml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	newCmd := func(runE func(*cobra.Command, []string) error) *cobra.Command {
+		cmd := &cobra.Command{RunE: runE}
+		cmd.Flags().String("config", ".git-overlay.yml", "")
+		cmd.Flags().String("link-mode", "symlink", "")
+		cmd.Flags().Bool("force", false, "")
+		cmd.Flags().StringArray("only", nil, "")
+		cmd.Flags().Bool("ignore-case", false, "")
+		addTransportFlags(cmd)
+		return cmd
+	}
+
+	cmd := newCmd(nil)
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if err := syncAllUpstreams(cfg, syncOptions{jobs: 1}); err != nil {
+		t.Fatalf("syncAllUpstreams() error = %v", err)
+	}
+	recorded, err := buildSyncPlan(cmd, cfg)
+	if err != nil {
+		t.Fatalf("buildSyncPlan() error = %v", err)
+	}
+	writePlan := func(plan *syncPlan) string {
+		t.Helper()
+		data, err := json.Marshal(plan)
+		if err != nil {
+			t.Fatalf("Failed to marshal plan: %v", err)
+		}
+		path := filepath.Join(t.TempDir(), "plan.json")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("Failed to write plan: %v", err)
+		}
+		return path
+	}
+
+	// A commit pushed after review is not what gets applied
+	commit("unreviewed")
+	apply := newCmd(applyCmd.RunE)
+	if err := apply.RunE(apply, []string{writePlan(recorded)}); err != nil {
+		t.Fatalf("apply error = %v", err)
+	}
+	if data, err := os.ReadFile("overlay/guide.md"); err != nil || string(data) != "reviewed" {
+		t.Errorf("overlay/guide.md = %q (%v), want the reviewed content", data, err)
+	}
+
+	// A planned commit the configured ref never led to is refused
+	head := func() string {
+		t.Helper()
+		commit, err := git.HeadCommit(".upstreams/docs")
+		if err != nil {
+			t.Fatalf("Failed to read docs head: %v", err)
+		}
+		return commit
+	}
+	reviewed := recorded.Upstreams[1].Commit
+	if err := runGitCommand(docsRepo, []string{"checkout", "-q", "-b", "side"}); err != nil {
+		t.Fatalf("Failed to create branch: %v", err)
+	}
+	commit("side")
+	side, err := git.HeadCommit(docsRepo)
+	if err != nil {
+		t.Fatalf("Failed to read docs head: %v", err)
+	}
+	for _, planned := range []string{side, strings.Repeat("1", 40)} {
+		recorded.Upstreams[1].Commit = planned
+		apply = newCmd(applyCmd.RunE)
+		if err := apply.RunE(apply, []string{writePlan(recorded)}); !errors.Is(err, overlayerr.ErrPlanDrift) {
+			t.Errorf("apply of commit %s error = %v, want ErrPlanDrift", planned, err)
+		}
+		if got := head(); got != reviewed {
+			t.Errorf("docs checked out at %s after a refused apply, want %s", got, reviewed)
+		}
+	}
+
+	// Upstreams moved for a plan that no longer matches are put back
+	if err := syncAllUpstreams(cfg, syncOptions{jobs: 1}); err != nil {
+		t.Fatalf("syncAllUpstreams() error = %v", err)
+	}
+	synced := head()
+	if err := os.WriteFile(".upstream/local.txt", []byte("local"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile("overlay/guide.md", []byte("edited"), 0644); err != nil {
+		t.Fatalf("Failed to edit file: %v", err)
+	}
+	recorded.Upstreams[1].Commit = reviewed
+	apply = newCmd(applyCmd.RunE)
+	if err := apply.RunE(apply, []string{writePlan(recorded)}); !errors.Is(err, overlayerr.ErrPlanDrift) {
+		t.Fatalf("apply after edit error = %v, want ErrPlanDrift", err)
+	}
+	if got := head(); got != synced {
+		t.Errorf("docs checked out at %s after drift, want it put back at %s", got, synced)
+	}
+	if _, err := os.Stat(".upstream/local.txt"); err != nil {
+		t.Errorf("Provider upstream was not put back: %v", err)
+	}
+	if matches, _ := filepath.Glob(".git-overlay-upstream-*"); len(matches) != 0 {
+		t.Errorf("Set-aside upstreams left behind: %v", matches)
+	}
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// autoLinkMode chooses the link mode of each file by its content and location
+const autoLinkMode = "auto"
+
+const (
+	autoHardlinkSize = 1 << 20 // Binary files from this size are hardlinked or copied
+	autoSniffSize    = 8000    // Bytes read to tell text from binary, as git does
+)
+
+// autoLinker picks the link mode of each file for link_mode: auto
+type autoLinker struct {
+	symlinks  bool   // Symlinks can be created from the upstream into overlay/
+	overlay   uint64 // Device overlay/ is on
+	hasDevice bool
+	modes     map[string]string // Mode already chosen per source
+}
+
+// newAutoLinker probes what the filesystem holding overlay/ supports. On a
+// network filesystem everything is copied.
+func newAutoLinker() *autoLinker {
+	a := &autoLinker{modes: make(map[string]string)}
+	if _, network := networkFilesystem("."); network {
+		return a
+	}
+	a.symlinks = probeLinkMode("symlink") == nil
+	a.overlay, a.hasDevice = deviceID("overlay")
+	return a
+}
+
+// mode returns the link mode for src. Text and small files are symlinked, and
+// large binaries hardlinked when they are on the same filesystem as overlay/.
+// Anything that can be neither is copied.
+func (a *autoLinker) mode(src string) string {
+	if mode, ok := a.modes[src]; ok {
+		return mode
+	}
+	mode := a.choose(src)
+	if a.modes != nil {
+		a.modes[src] = mode
+	}
+	return mode
+}
+
+// choose works out the link mode for src
+func (a *autoLinker) choose(src string) string {
+	if info, err := os.Stat(src); err == nil && info.Size() >= autoHardlinkSize && !isText(src) {
+		if dev, ok := deviceID(src); ok && a.hasDevice && dev == a.overlay {
+			return "hardlink"
+		}
+		return "copy"
+	}
+	if a.symlinks {
+		return "symlink"
+	}
+	return "copy"
+}
+
+// isText reports whether the file at path looks like text: no NUL byte in its
+// first autoSniffSize bytes
+func isText(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	buf := make([]byte, autoSniffSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false
+	}
+	return !bytes.Contains(buf[:n], []byte{0})
+}
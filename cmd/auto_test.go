@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestAutoLinkerMode(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"small.go":   []byte("package main\n"),
+		"large.json": bytes.Repeat([]byte("{}\n"), autoHardlinkSize),
+		"small.png":  {0x89, 'P', 'N', 'G', 0},
+		"large.bin":  append([]byte{0}, make([]byte, autoHardlinkSize)...),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	dev, hasDevice := deviceID(dir)
+
+	tests := []struct {
+		name     string
+		symlinks bool
+		sameFS   bool
+		file     string
+		want     string
+	}{
+		{name: "source file", symlinks: true, file: "small.go", want: "symlink"},
+		{name: "large text file", symlinks: true, file: "large.json", want: "symlink"},
+		{name: "small binary", symlinks: true, file: "small.png", want: "symlink"},
+		{name: "large binary on the same filesystem", symlinks: true, sameFS: true, file: "large.bin", want: "hardlink"},
+		{name: "large binary on another filesystem", symlinks: true, file: "large.bin", want: "copy"},
+		{name: "no symlink rights", file: "small.go", want: "copy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			linker := autoLinker{symlinks: tt.symlinks}
+			if tt.sameFS {
+				if !hasDevice {
+					t.Skip("devices are not known on this platform")
+				}
+				linker.overlay, linker.hasDevice = dev, true
+			}
+			if got := linker.mode(filepath.Join(dir, tt.file)); got != tt.want {
+				t.Errorf("mode(%s) = %s, want %s", tt.file, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateLinksAutoMode(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+	if err := os.WriteFile(".upstream/main.go", []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(".upstream/model.bin", make([]byte, autoHardlinkSize), 0644); err != nil {
+		t.Fatalf("Failed to create binary file: %v", err)
+	}
+
+	cfg := &config.Config{
+		LinkMode: autoLinkMode,
+		Symlinks: []config.SymlinkSpec{{String: "main.go"}, {String: "model.bin"}},
+	}
+	cmd := &cobra.Command{}
+	cmd.Flags().String("link-mode", "symlink", "")
+	cmd.Flags().Bool("force", false, "")
+
+	if err := CreateLinks(cmd, cfg); err != nil {
+		t.Fatalf("CreateLinks() error = %v", err)
+	}
+
+	state, err := config.LoadState()
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	modes := make(map[string]string)
+	for _, mf := range state.ManagedFiles {
+		modes[mf.Path] = mf.LinkMode
+	}
+	if modes["main.go"] != "symlink" {
+		t.Errorf("main.go recorded as %q, want symlink", modes["main.go"])
+	}
+	if info, err := os.Lstat("overlay/main.go"); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("overlay/main.go is not a symlink: %v", err)
+	}
+
+	// Whichever mode the binary got, the state must say what is on disk
+	info, err := os.Lstat("overlay/model.bin")
+	if err != nil {
+		t.Fatalf("overlay/model.bin was not created: %v", err)
+	}
+	src, _ := os.Stat(".upstream/model.bin")
+	switch modes["model.bin"] {
+	case "hardlink":
+		if !os.SameFile(info, src) {
+			t.Error("model.bin recorded as hardlink but is not one")
+		}
+	case "copy":
+		if !info.Mode().IsRegular() || os.SameFile(info, src) {
+			t.Error("model.bin recorded as copy but is not one")
+		}
+	default:
+		t.Errorf("model.bin recorded as %q, want hardlink or copy", modes["model.bin"])
+	}
+}
@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rjocoleman/git-overlay/internal/archive"
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// backupTimeFormat names backups by when they were taken, sorting
+// chronologically
+const backupTimeFormat = "20060102-150405.000000000"
+
+// createBackup writes a tarball of overlay/ and the state file into dir and returns its path
+func createBackup(dir, statePath string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	// Backups taken within the same second still get names of their own
+	path := filepath.Join(dir, time.Now().Format(backupTimeFormat)+".tar.gz")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	for _, root := range []string{"overlay", statePath} {
+		if _, err := os.Lstat(root); os.IsNotExist(err) {
+			continue
+		}
+		if err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return addToTar(tw, p, info)
+		}); err != nil {
+			return "", fmt.Errorf("failed to archive %s: %w", root, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", fmt.Errorf("failed to finish backup: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return "", fmt.Errorf("failed to finish backup: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to finish backup: %w", err)
+	}
+	return path, nil
+}
+
+// addToTar writes a single file, directory or symlink to the archive
+func addToTar(tw *tar.Writer, path string, info os.FileInfo) error {
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		link = target
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(path)
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// latestBackup returns the newest backup in dir
+func latestBackup(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tar.gz") {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("no backups found in %s", dir)
+	}
+
+	// Timestamped names sort chronologically
+	sort.Strings(names)
+	return filepath.Join(dir, names[len(names)-1]), nil
+}
+
+// checkBackup reads a backup through to the end, so a truncated or corrupt
+// one is caught before anything is touched, and makes sure it only holds
+// overlay/ and the state file
+func checkBackup(backup, statePath string) error {
+	f, err := os.Open(backup)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+		name := path.Clean(hdr.Name)
+		if name != "overlay" && !strings.HasPrefix(name, "overlay/") && name != filepath.ToSlash(statePath) {
+			return fmt.Errorf("unexpected path in backup: %s", hdr.Name)
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+	}
+}
+
+// restoreBackup replaces overlay/ and the state file with the contents of a
+// backup. The backup is checked and extracted next to overlay/ first, and
+// only swapped in once that has succeeded. The overlay/ it replaces may hold
+// files newer than the backup, so it is moved into trash, whether or not the
+// trash is enabled, and where it went is returned.
+func restoreBackup(backup, statePath string, trash *trash) (string, error) {
+	if err := checkBackup(backup, statePath); err != nil {
+		return "", err
+	}
+
+	staging, err := os.MkdirTemp(".", ".git-overlay.restore-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create restore directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	f, err := os.Open(backup)
+	if err != nil {
+		return "", fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup: %w", err)
+	}
+	defer gz.Close()
+	if err := archive.ExtractTar(gz, staging, 0); err != nil {
+		return "", fmt.Errorf("failed to extract backup: %w", err)
+	}
+
+	// Move the current overlay into the trash, from where it is put back if
+	// the swap fails
+	var old string
+	if _, err := os.Lstat("overlay"); err == nil {
+		if old, err = trash.put("overlay", "overlay"); err != nil {
+			return "", fmt.Errorf("failed to move overlay directory aside: %w", err)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(staging, "overlay")); err == nil {
+		if err := os.Rename(filepath.Join(staging, "overlay"), "overlay"); err != nil {
+			if old != "" {
+				os.Rename(old, "overlay")
+			}
+			return "", fmt.Errorf("failed to restore overlay directory: %w", err)
+		}
+	}
+
+	restored := filepath.Join(staging, statePath)
+	if _, err := os.Lstat(restored); err == nil {
+		if err := os.MkdirAll(filepath.Dir(statePath), 0755); err != nil {
+			return "", err
+		}
+		if err := os.Rename(restored, statePath); err != nil {
+			return "", fmt.Errorf("failed to restore state file: %w", err)
+		}
+	} else if err := os.Remove(statePath); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to remove state file: %w", err)
+	}
+	return old, nil
+}
+
+var restoreCmd = &cobra.Command{
+	Use:         "restore [backup]",
+	Short:       "Restore the overlay from a backup taken by sync --backup",
+	Args:        cobra.MaximumNArgs(1),
+	Annotations: map[string]string{lockAnnotation: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		last, err := cmd.Flags().GetBool("last")
+		if err != nil {
+			return err
+		}
+
+		var path string
+		switch {
+		case len(args) == 1:
+			path = args[0]
+		case last:
+			path, err = latestBackup(cfg.Backup.Path())
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("specify a backup file or --last")
+		}
+
+		statePath, err := config.StatePath(cfg.StateLocation)
+		if err != nil {
+			return err
+		}
+
+		replaced, err := restoreBackup(path, statePath, newTrash(cfg))
+		if err != nil {
+			return fmt.Errorf("failed to restore backup: %w", err)
+		}
+
+		fmt.Printf("Restored overlay from %s\n", path)
+		if replaced != "" {
+			fmt.Printf("The replaced overlay/ was moved to %s\n", replaced)
+		}
+		return nil
+	},
+}
+
+func init() {
+	restoreCmd.Flags().Bool("last", false, "Restore the most recent backup")
+	rootCmd.AddCommand(restoreCmd)
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+func TestBackupRestore(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	// Create an overlay with a file, a symlink and state
+	if err := os.MkdirAll("overlay/dir", 0755); err != nil {
+		t.Fatalf("Failed to create overlay directory: %v", err)
+	}
+	if err := os.WriteFile("overlay/dir/file.txt", []byte("original"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Symlink("file.txt", "overlay/dir/link.txt"); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	state := &config.State{}
+	state.AddManagedFile("dir/link.txt", "symlink", "dir/link.txt")
+	if err := state.SaveState(); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	if _, err := createBackup(config.DefaultBackupDir, config.StateFile); err != nil {
+		t.Fatalf("createBackup() error = %v", err)
+	}
+
+	// Mess up the overlay and state
+	if err := os.WriteFile("overlay/dir/file.txt", []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	if err := os.Remove("overlay/dir/link.txt"); err != nil {
+		t.Fatalf("Failed to remove symlink: %v", err)
+	}
+	if err := os.WriteFile("overlay/new.txt", []byte("new"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := (&config.State{}).SaveState(); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	path, err := latestBackup(config.DefaultBackupDir)
+	if err != nil {
+		t.Fatalf("latestBackup() error = %v", err)
+	}
+	replaced, err := restoreBackup(path, config.StateFile, newTrash(&config.Config{}))
+	if err != nil {
+		t.Fatalf("restoreBackup() error = %v", err)
+	}
+
+	content, err := os.ReadFile("overlay/dir/file.txt")
+	if err != nil || string(content) != "original" {
+		t.Errorf("File content = %q, %v, want %q", string(content), err, "original")
+	}
+	if target, err := os.Readlink("overlay/dir/link.txt"); err != nil || target != "file.txt" {
+		t.Errorf("Symlink target = %q, %v, want %q", target, err, "file.txt")
+	}
+	if _, err := os.Stat("overlay/new.txt"); !os.IsNotExist(err) {
+		t.Error("File created after backup was not removed")
+	}
+	// It can be recovered from the trash
+	if data, err := os.ReadFile(filepath.Join(replaced, "new.txt")); err != nil || string(data) != "new" {
+		t.Errorf("Replaced overlay new.txt = %q, %v, want it kept in the trash", data, err)
+	}
+	if !strings.HasPrefix(replaced, config.DefaultTrashDir) {
+		t.Errorf("Replaced overlay moved to %s, want it under %s", replaced, config.DefaultTrashDir)
+	}
+	restored, err := config.LoadState()
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if len(restored.ManagedFiles) != 1 {
+		t.Errorf("Restored state has %d files, want 1", len(restored.ManagedFiles))
+	}
+}
+
+func TestRestoreBackupRejects(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll("overlay", 0755); err != nil {
+		t.Fatalf("Failed to create overlay directory: %v", err)
+	}
+	if err := os.WriteFile("overlay/file.txt", []byte("original"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	// Two backups in the same second don't overwrite each other
+	first, err := createBackup(config.DefaultBackupDir, config.StateFile)
+	if err != nil {
+		t.Fatalf("createBackup() error = %v", err)
+	}
+	second, err := createBackup(config.DefaultBackupDir, config.StateFile)
+	if err != nil {
+		t.Fatalf("createBackup() error = %v", err)
+	}
+	if first == second {
+		t.Errorf("createBackup() reused %s", first)
+	}
+
+	data, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatalf("Failed to read backup: %v", err)
+	}
+	hostile := func(hdr tar.Header) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		tw.WriteHeader(&hdr)
+		tw.Close()
+		gz.Close()
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "truncated", data: data[:len(data)/2]},
+		{name: "path outside overlay", data: hostile(tar.Header{Name: ".git/hooks/pre-commit", Typeflag: tar.TypeReg, Mode: 0755})},
+		{name: "symlink escaping", data: hostile(tar.Header{Name: "overlay/evil", Typeflag: tar.TypeSymlink, Linkname: "/etc"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bad.tar.gz")
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatalf("Failed to write backup: %v", err)
+			}
+			if _, err := restoreBackup(path, config.StateFile, newTrash(&config.Config{})); err == nil {
+				t.Error("restoreBackup() accepted a bad backup")
+			}
+			content, err := os.ReadFile("overlay/file.txt")
+			if err != nil || string(content) != "original" {
+				t.Errorf("Overlay after a failed restore = %q, %v, want it untouched", content, err)
+			}
+		})
+	}
+}
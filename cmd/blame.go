@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/git"
+	"github.com/spf13/cobra"
+)
+
+// resolveUpstreamSource returns the upstream and upstream-relative source of
+// an overlay path, preferring the state file and falling back to the
+// configured specs
+func resolveUpstreamSource(cfg *config.Config, state *config.State, path string) (string, string, error) {
+	rel := overlayRelPath(path)
+
+	if managed, mf := state.IsManagedFile(rel); managed {
+		return mf.Upstream, mf.Source, nil
+	}
+
+	for _, link := range cfg.Symlinks {
+		from, to := specSource(link), specTarget(link)
+		if rel == to {
+			return link.Upstream, from, nil
+		}
+		if strings.HasPrefix(rel, to+"/") {
+			return link.Upstream, from + strings.TrimPrefix(rel, to), nil
+		}
+	}
+
+	return "", "", fmt.Errorf("%s is not managed by git-overlay", path)
+}
+
+var blameCmd = &cobra.Command{
+	Use:   "blame <overlay-path> [-- git blame options]",
+	Short: "Show upstream authorship of a managed file",
+	Long: `Resolve a managed overlay file to its upstream source and run git blame on
+it in its upstream checkout at the synced commit. Arguments after -- are passed to
+git blame, e.g. git-overlay blame overlay/src/x.c -- -L 10,20`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		state, err := loadState(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+
+		upstream, source, err := resolveUpstreamSource(cfg, state, overlayArg(args[0]))
+		if err != nil {
+			return err
+		}
+		dir, err := gitUpstreamDir(cfg, upstream, "blame")
+		if err != nil {
+			return err
+		}
+
+		// Blame on a shallow clone would credit everything to its oldest commit
+		if err := git.Unshallow(dir); err != nil {
+			return err
+		}
+
+		blameArgs := append([]string{"-C", dir, "blame"}, args[1:]...)
+		blameArgs = append(blameArgs, "HEAD", "--", source)
+		blame := exec.Command("git", blameArgs...)
+		blame.Env = git.UpstreamEnv()
+		blame.Stdin = os.Stdin
+		blame.Stdout = os.Stdout
+		blame.Stderr = os.Stderr
+		if err := blame.Run(); err != nil {
+			return fmt.Errorf("failed to blame %s: %w", source, err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(blameCmd)
+}
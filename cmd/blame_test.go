@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+func TestResolveUpstreamSource(t *testing.T) {
+	cfg := &config.Config{
+		Symlinks: []config.SymlinkSpec{
+			{String: "app"},
+			{From: "src/lib", To: "library"},
+			{String: "vendor", Upstream: "tools"},
+		},
+	}
+	state := &config.State{}
+	state.AddManagedFile("renamed.txt", "copy", "docs/original.txt")
+	state.AddUpstreamFile("tools", "tool.sh", "copy", "bin/tool.sh")
+
+	tests := []struct {
+		path         string
+		wantUpstream string
+		want         string
+		wantErr      bool
+	}{
+		{path: "overlay/renamed.txt", want: "docs/original.txt"},
+		{path: "overlay/app/main.go", want: "app/main.go"},
+		{path: "library/util.c", want: "src/lib/util.c"},
+		{path: "overlay/library", want: "src/lib"},
+		{path: "overlay/tool.sh", wantUpstream: "tools", want: "bin/tool.sh"},
+		{path: "overlay/vendor/lib.go", wantUpstream: "tools", want: "vendor/lib.go"},
+		{path: "overlay/librarian.c", wantErr: true},
+		{path: "overlay/custom.txt", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			upstream, got, err := resolveUpstreamSource(cfg, state, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveUpstreamSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if upstream != tt.wantUpstream || got != tt.want {
+				t.Errorf("resolveUpstreamSource() = %q, %q, want %q, %q", upstream, got, tt.wantUpstream, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+// blockedBy returns the blocked_paths entry a planned link matches, checking
+// both its upstream source and its overlay/ target since specs published by
+// the upstream choose targets too
+func blockedBy(p plannedLink, blocked []config.BlockedPath) (config.BlockedPath, bool) {
+	relSrc, _ := filepath.Rel(config.UpstreamDir(p.upstream), p.src)
+	relDst := overlayRelPath(p.dst)
+	for _, b := range blocked {
+		if !matchGlob(b.Path, relSrc) && !matchGlob(b.Path, relDst) {
+			continue
+		}
+		if b.Executable {
+			info, err := os.Stat(p.src)
+			if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+				continue
+			}
+		}
+		return b, true
+	}
+	return config.BlockedPath{}, false
+}
+
+// applyBlockedPaths leaves out planned links that blocked_paths forbids,
+// whatever spec they came from, or fails the run under policies.blocked_path:
+// error
+func applyBlockedPaths(plan []plannedLink, blocked []config.BlockedPath, policy string) ([]plannedLink, error) {
+	if len(blocked) == 0 {
+		return plan, nil
+	}
+	var kept []plannedLink
+	for _, p := range plan {
+		if b, ok := blockedBy(p, blocked); ok {
+			if err := enforce(policy, config.PolicyWarn, fmt.Errorf("not materializing %s, blocked by blocked_paths entry %s", p.dst, b.Path)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept, nil
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestBlockedPaths(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("execute bits are not meaningful on windows")
+	}
+
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	files := map[string]os.FileMode{
+		".upstream/ci/.github/workflows/release.yml": 0644,
+		".upstream/ci/scripts/build.sh":              0755,
+		".upstream/ci/scripts/lib.sh":                0644,
+		".upstream/ci/README.md":                     0644,
+		".upstream/hooks/pre-commit":                 0644,
+	}
+	for path, mode := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("content"), mode); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("link-mode", "symlink", "")
+	cmd.Flags().Bool("force", false, "")
+
+	cfg := &config.Config{
+		Symlinks: []config.SymlinkSpec{
+			{String: "ci"},
+			// Blocked by target as well as by source
+			{From: "hooks/pre-commit", To: ".git-hooks/pre-commit"},
+		},
+		BlockedPaths: []config.BlockedPath{
+			{Path: "**/.github/workflows/**"},
+			{Path: "**/*.sh", Executable: true},
+			{Path: ".git-hooks/**"},
+		},
+	}
+	if err := CreateLinks(cmd, cfg); err != nil {
+		t.Fatalf("CreateLinks() error = %v", err)
+	}
+
+	want := map[string]bool{
+		"overlay/ci/.github/workflows/release.yml": false,
+		"overlay/ci/scripts/build.sh":              false,
+		"overlay/ci/scripts/lib.sh":                true,
+		"overlay/ci/README.md":                     true,
+		"overlay/.git-hooks/pre-commit":            false,
+	}
+	for path, wantLinked := range want {
+		_, err := os.Lstat(path)
+		if linked := err == nil; linked != wantLinked {
+			t.Errorf("%s linked = %v, want %v", path, linked, wantLinked)
+		}
+	}
+}
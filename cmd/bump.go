@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/git"
+	"github.com/spf13/cobra"
+)
+
+// bumpChangelogLimit caps the upstream commits listed in a bump commit message
+const bumpChangelogLimit = 20
+
+// bumpMessage builds the commit message for moving the upstream from one
+// version to another, listing the upstream commits in between
+func bumpMessage(fromRef, toRef, to string, changes []string) string {
+	var b strings.Builder
+	if fromRef != toRef {
+		fmt.Fprintf(&b, "Bump upstream from %s to %s\n", fromRef, toRef)
+	} else {
+		fmt.Fprintf(&b, "Bump upstream %s to %s\n", toRef, shortID(to))
+	}
+	if len(changes) == 0 {
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "\nUpstream changes:\n\n")
+	for i, change := range changes {
+		if i == bumpChangelogLimit {
+			fmt.Fprintf(&b, "- and %d more\n", len(changes)-i)
+			break
+		}
+		fmt.Fprintf(&b, "- %s\n", change)
+	}
+	return b.String()
+}
+
+var bumpCmd = &cobra.Command{
+	Use:   "bump",
+	Short: "Move the upstream to its newest version and rebuild links",
+	Long: `Move the upstream to its newest version: a semver tag ref is raised to the
+latest release tag in the config, and a branch ref is synced to its remote tip.
+Links are rebuilt afterwards as with sync.
+
+With --commit, the config, the upstream submodule pin and the rebuilt overlay
+are committed with a message listing the upstream changes, ready to be pushed
+as an update pull request from a scheduled job.`,
+	Annotations: map[string]string{lockAnnotation: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if !cfg.Upstream.IsGit() {
+			return fmt.Errorf("bump only supports git upstreams, not %s", cfg.Upstream.Type)
+		}
+
+		if err := applyTransportOptions(cmd); err != nil {
+			return err
+		}
+
+		// Ctrl-C waits for the step in progress
+		defer trapInterrupts()()
+
+		commit, err := cmd.Flags().GetBool("commit")
+		if err != nil {
+			return err
+		}
+
+		report, err := checkOutdated(cfg.Upstream)
+		if err != nil {
+			return fmt.Errorf("failed to check upstream: %w", err)
+		}
+		if !report.Outdated {
+			fmt.Printf("Already up to date: %s at %s\n", report.Ref, shortID(report.Current))
+			return nil
+		}
+
+		fromRef, toRef := cfg.Upstream.Ref, cfg.Upstream.Ref
+		if len(report.NewerTags) > 0 {
+			toRef = report.LatestTag
+		}
+		// Checked before the config is edited to the new version
+		if err := checkRefAllowed(cfg.Policies, "", toRef); err != nil {
+			return err
+		}
+		if len(report.NewerTags) > 0 {
+			if err := editConfig(cmd, func(doc *config.Document) error {
+				return doc.SetString("upstream.ref", report.LatestTag)
+			}); err != nil {
+				return err
+			}
+			cfg.Upstream.Ref = report.LatestTag
+		}
+
+		acceptRewrite, err := cmd.Flags().GetBool("accept-rewrite")
+		if err != nil {
+			return err
+		}
+		if err := syncUpstreamSource(cfg, syncOptions{acceptRewrite: acceptRewrite}); err != nil {
+			return err
+		}
+		if err := interrupted(); err != nil {
+			return err
+		}
+		if err := CreateLinks(cmd, cfg); err != nil {
+			return fmt.Errorf("failed to rebuild links: %w", err)
+		}
+
+		changes, err := git.Changelog(config.UpstreamDir(""), report.Current, "HEAD")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Bumped upstream to %s (%d upstream commit(s))\n", cfg.Upstream.Ref, len(changes))
+
+		if !commit {
+			return nil
+		}
+		to, err := git.HeadCommit(config.UpstreamDir(""))
+		if err != nil {
+			return err
+		}
+		return commitBookkeeping(cmd, cfg, bumpMessage(fromRef, cfg.Upstream.Ref, to, changes))
+	},
+}
+
+func init() {
+	bumpCmd.Flags().Bool("commit", false, "Commit the bump with a message listing the upstream changes")
+	bumpCmd.Flags().Bool("accept-rewrite", false, "Follow an upstream branch that was force-pushed, dropping the synced commit's history")
+	bumpCmd.Flags().Bool("keep-going", false, "Link everything that can be linked and report all failures at the end")
+	addTransportFlags(bumpCmd)
+	rootCmd.AddCommand(bumpCmd)
+}
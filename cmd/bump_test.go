@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBumpMessage(t *testing.T) {
+	many := make([]string, bumpChangelogLimit+3)
+	for i := range many {
+		many[i] = fmt.Sprintf("abc%04d Change %d", i, i)
+	}
+
+	tests := []struct {
+		name    string
+		fromRef string
+		toRef   string
+		changes []string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "tag bump",
+			fromRef: "v1.0.0",
+			toRef:   "v1.2.0",
+			changes: []string{"1234567 Fix bug", "89abcde Add feature"},
+			want:    []string{"Bump upstream from v1.0.0 to v1.2.0\n", "\nUpstream changes:\n\n- 1234567 Fix bug\n- 89abcde Add feature\n"},
+		},
+		{
+			name:    "branch bump",
+			fromRef: "main",
+			toRef:   "main",
+			changes: []string{"1234567 Fix bug"},
+			want:    []string{"Bump upstream main to 0123456\n"},
+		},
+		{
+			name:    "no changes",
+			fromRef: "main",
+			toRef:   "main",
+			notWant: []string{"Upstream changes"},
+		},
+		{
+			name:    "long changelog",
+			fromRef: "main",
+			toRef:   "main",
+			changes: many,
+			want:    []string{fmt.Sprintf(" Change %d\n", bumpChangelogLimit-1), "- and 3 more\n"},
+			notWant: []string{fmt.Sprintf("Change %d\n", bumpChangelogLimit)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bumpMessage(tt.fromRef, tt.toRef, "0123456789abcdef0123456789abcdef01234567", tt.changes)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("bumpMessage() = %q, want it to contain %q", got, want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("bumpMessage() = %q, want it not to contain %q", got, notWant)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// linkModes lists every supported link mode in order of preference
+var linkModes = []string{"symlink", "reflink", "hardlink", "copy"}
+
+// isLinkMode reports whether mode is a built-in, registered or plugin link mode
+func isLinkMode(mode string) bool {
+	_, err := linkStrategyFor(mode)
+	return err == nil
+}
+
+// probeLinkMode checks that a link of the given mode can actually be created
+// from .upstream into overlay/, which fails on e.g. FAT32, some network mounts,
+// and Windows without symlink rights.
+func probeLinkMode(mode string) error {
+	srcDir := ".upstream"
+	if _, err := os.Stat(srcDir); err != nil {
+		srcDir = "."
+	}
+	if err := os.MkdirAll("overlay", 0755); err != nil {
+		return err
+	}
+
+	src, err := os.CreateTemp(srcDir, ".git-overlay-probe-*")
+	if err != nil {
+		return err
+	}
+	src.WriteString("probe")
+	src.Close()
+	defer os.Remove(src.Name())
+
+	dst := fmt.Sprintf("overlay/.git-overlay-probe-%d", os.Getpid())
+	os.Remove(dst)
+	defer os.Remove(dst)
+
+	strategy, err := linkStrategyFor(mode)
+	if err != nil {
+		return err
+	}
+	return strategy.Link(src.Name(), dst)
+}
+
+// selectLinkMode returns the first usable mode out of the requested mode and
+// the fallback chain. Without a fallback chain the requested mode is used as-is.
+func selectLinkMode(requested string, fallback []string) (string, error) {
+	if len(fallback) == 0 {
+		return requested, nil
+	}
+
+	candidates := append([]string{requested}, fallback...)
+	for _, mode := range candidates {
+		if !isLinkMode(mode) {
+			return "", fmt.Errorf("unsupported link mode: %s", mode)
+		}
+	}
+
+	for _, mode := range candidates {
+		err := probeLinkMode(mode)
+		if err == nil {
+			if mode != requested {
+				fmt.Printf("Link mode %s is not available here, using %s\n", requested, mode)
+			}
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("none of the link modes %v can be created on this filesystem", candidates)
+}
+
+var capabilitiesCmd = &cobra.Command{
+	Use:   "capabilities",
+	Short: "Report which link modes work on this filesystem",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, mode := range linkModes {
+			if err := probeLinkMode(mode); err != nil {
+				fmt.Printf("%-9s unavailable (%v)\n", mode, err)
+			} else {
+				fmt.Printf("%-9s ok\n", mode)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(capabilitiesCmd)
+}
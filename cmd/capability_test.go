@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestLinkModeMatrix(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream/dir/nested", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+	files := map[string]string{
+		".upstream/file.txt":          "file",
+		".upstream/.dotfile":          "dotfile",
+		".upstream/dir/nested/a.txt":  "a",
+		".upstream/dir/top-level.txt": "top",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+	}
+
+	sources := map[string][]string{
+		"file.txt": {"file.txt"},
+		".dotfile": {".dotfile"},
+		"dir":      {"dir/nested/a.txt", "dir/top-level.txt"},
+	}
+
+	for _, mode := range []string{"symlink", "hardlink", "copy"} {
+		for spec, targets := range sources {
+			t.Run(mode+"/"+spec, func(t *testing.T) {
+				os.RemoveAll("overlay")
+				os.Remove(config.StateFile)
+
+				cmd := &cobra.Command{}
+				cmd.Flags().String("link-mode", mode, "")
+				cmd.Flags().Bool("force", true, "")
+
+				cfg := &config.Config{
+					Symlinks: []config.SymlinkSpec{{String: spec}},
+				}
+				if err := CreateLinks(cmd, cfg); err != nil {
+					t.Fatalf("CreateLinks() error = %v", err)
+				}
+
+				state, err := config.LoadState()
+				if err != nil {
+					t.Fatalf("Failed to load state: %v", err)
+				}
+
+				for _, target := range targets {
+					path := filepath.Join("overlay", target)
+					info, err := os.Lstat(path)
+					if err != nil {
+						t.Fatalf("Target not created: %v", err)
+					}
+					if isSymlink := info.Mode()&os.ModeSymlink != 0; isSymlink != (mode == "symlink") {
+						t.Errorf("%s: symlink = %v in %s mode", target, isSymlink, mode)
+					}
+
+					content, err := os.ReadFile(path)
+					if err != nil || string(content) != files[filepath.Join(".upstream", target)] {
+						t.Errorf("%s: content = %q, %v", target, string(content), err)
+					}
+
+					ok, mf := state.IsManagedFile(target)
+					if !ok {
+						t.Errorf("%s: not recorded in state", target)
+					} else if mf.LinkMode != mode {
+						t.Errorf("%s: state link mode = %q, want %q", target, mf.LinkMode, mode)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSelectLinkMode(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+
+	// Without a fallback chain the requested mode is used untouched
+	mode, err := selectLinkMode("reflink", nil)
+	if err != nil || mode != "reflink" {
+		t.Errorf("selectLinkMode() = %q, %v, want reflink", mode, err)
+	}
+
+	// Copy always works, so the chain must settle on a usable mode
+	mode, err = selectLinkMode("reflink", []string{"hardlink", "copy"})
+	if err != nil {
+		t.Fatalf("selectLinkMode() error = %v", err)
+	}
+	if probeLinkMode(mode) != nil {
+		t.Errorf("selectLinkMode() chose unusable mode %q", mode)
+	}
+
+	// Unknown modes are rejected up front
+	if _, err := selectLinkMode("bogus", []string{"copy"}); err == nil {
+		t.Error("selectLinkMode() expected error for unknown mode")
+	}
+
+	// Probes clean up after themselves
+	entries, err := os.ReadDir("overlay")
+	if err != nil {
+		t.Fatalf("Failed to read overlay: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Probe left %d files behind in overlay", len(entries))
+	}
+}
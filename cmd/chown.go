@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+// owner is a numeric uid:gid given to copies, as container images built from
+// an overlay usually run as a non-root user. A gid of -1 leaves the group be.
+type owner struct {
+	uid, gid int
+}
+
+// parseOwner parses "uid:gid" or "uid". Names aren't looked up, since the
+// user often only exists in the image being built.
+func parseOwner(s string) (*owner, error) {
+	uidText, gidText, hasGID := strings.Cut(s, ":")
+	uid, err := strconv.Atoi(uidText)
+	if err != nil || uid < 0 {
+		return nil, fmt.Errorf("invalid owner %q: want a numeric uid or uid:gid", s)
+	}
+	gid := -1
+	if hasGID {
+		if gid, err = strconv.Atoi(gidText); err != nil || gid < 0 {
+			return nil, fmt.Errorf("invalid owner %q: want a numeric uid or uid:gid", s)
+		}
+	}
+	return &owner{uid: uid, gid: gid}, nil
+}
+
+// copyOwner works out who copies should belong to from --chown or
+// copy_owner. Only root can give files away, so anyone else gets a warning
+// and keeps their copies.
+func copyOwner(cmd *cobra.Command, cfg *config.Config) (*owner, error) {
+	spec := cfg.CopyOwner
+	if s := flagString(cmd, "chown"); s != "" {
+		spec = s
+	}
+	if spec == "" {
+		return nil, nil
+	}
+	o, err := parseOwner(spec)
+	if err != nil {
+		return nil, err
+	}
+	if os.Geteuid() != 0 {
+		fmt.Fprintf(os.Stderr, "Warning: not running as root, copies are left owned by the current user instead of %s\n", spec)
+		return nil, nil
+	}
+	return o, nil
+}
+
+// mkdirOwned creates dir and its missing parents like os.MkdirAll, giving
+// the directories it creates to o when set, so the owner of the copies can
+// add and remove entries in them
+func mkdirOwned(dir string, o *owner) error {
+	var missing []string
+	if o != nil {
+		for d := dir; ; d = filepath.Dir(d) {
+			if _, err := os.Lstat(d); err == nil || filepath.Dir(d) == d {
+				break
+			}
+			missing = append(missing, d)
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, d := range missing {
+		if err := os.Lchown(d, o.uid, o.gid); err != nil {
+			return fmt.Errorf("failed to change owner of %s: %w", d, err)
+		}
+	}
+	return nil
+}
+
+// settleCopy applies the ownership and protection of the run to a file
+// copied into overlay/, or to everything in a copied directory
+func (opts linkOptions) settleCopy(dst string) error {
+	if opts.owner != nil {
+		err := filepath.WalkDir(dst, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Lchown(path, opts.owner.uid, opts.owner.gid)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to change owner of %s: %w", dst, err)
+		}
+	}
+	if opts.protectCopies {
+		if err := setWritable(dst, false); err != nil {
+			return fmt.Errorf("failed to make %s read-only: %w", dst, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOwner(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    *owner
+		wantErr bool
+	}{
+		{spec: "1000:1000", want: &owner{uid: 1000, gid: 1000}},
+		{spec: "65532", want: &owner{uid: 65532, gid: -1}},
+		{spec: "0:10", want: &owner{uid: 0, gid: 10}},
+		{spec: "app:app", wantErr: true},
+		{spec: "1000:", wantErr: true},
+		{spec: "-1:0", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseOwner(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseOwner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseOwner() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
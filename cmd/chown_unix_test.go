@@ -0,0 +1,88 @@
+//go:build unix
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestCopyOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("giving files away needs root")
+	}
+
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+	if err := os.WriteFile(".upstream/file.txt", []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create upstream file: %v", err)
+	}
+	if err := os.MkdirAll(".upstream/tree/sub", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+	if err := os.WriteFile(".upstream/tree/sub/leaf.txt", []byte("leaf"), 0644); err != nil {
+		t.Fatalf("Failed to create upstream file: %v", err)
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("link-mode", "copy", "")
+	cmd.Flags().Bool("force", true, "")
+	cmd.Flags().String("chown", "", "")
+	if err := cmd.Flags().Set("chown", "1234:5678"); err != nil {
+		t.Fatalf("Failed to set --chown: %v", err)
+	}
+
+	cfg := &config.Config{
+		Symlinks: []config.SymlinkSpec{
+			{String: "file.txt"},
+			{From: "file.txt", To: "deep/er/file.txt"},
+			{String: "tree"},
+		},
+		Trash:     config.TrashConfig{Enabled: new(bool)},
+		CopyOwner: "1:1",
+	}
+	if err := CreateLinks(cmd, cfg); err != nil {
+		t.Fatalf("CreateLinks() error = %v", err)
+	}
+
+	// --chown wins over copy_owner, and directories git-overlay creates or
+	// copies are given away along with the files
+	for _, path := range []string{
+		"overlay/file.txt",
+		"overlay/deep", "overlay/deep/er", "overlay/deep/er/file.txt",
+		"overlay/tree", "overlay/tree/sub", "overlay/tree/sub/leaf.txt",
+	} {
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", path, err)
+		}
+		if st := info.Sys().(*syscall.Stat_t); st.Uid != 1234 || st.Gid != 5678 {
+			t.Errorf("%s owner = %d:%d, want 1234:5678", path, st.Uid, st.Gid)
+		}
+	}
+
+	// overlay/ itself is left as it was
+	info, err := os.Stat("overlay")
+	if err != nil {
+		t.Fatalf("Failed to stat overlay: %v", err)
+	}
+	if st := info.Sys().(*syscall.Stat_t); st.Uid == 1234 {
+		t.Error("overlay/ was given away")
+	}
+}
@@ -12,82 +12,155 @@ import (
 )
 
 var cleanCmd = &cobra.Command{
-	Use:   "clean",
+	Use:   "clean [path|spec]...",
 	Short: "Remove managed files and links",
 	Long: `Remove files and links managed by git-overlay in the overlay directory.
 This only removes files that are configured in .git-overlay.yml.
-Custom files and directories are preserved.`,
+Custom files and directories are preserved, as are any paths matching
+the clean.protect globs in the config file. Removed files are moved to the
+trash directory (default: .git-overlay.trash) unless trash.enabled is false.
+
+Given paths under overlay/, or the from path of a spec, only the managed files
+under those paths or linked by those specs are removed. With --component, only
+the files linked by the specs of that component are.
+
+When the config can't be loaded, clean refuses to run, as clean.protect would
+be ignored. With --force it cleans from the state file alone; --dry-run shows
+what that would remove.`,
+	Annotations: map[string]string{lockAnnotation: ""},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		// A broken or missing config must not strand the files the state
+		// records, but cleaning without it drops clean.protect, so it takes --force
+		cfg, cfgErr := loadConfig(cmd)
+		if cfgErr != nil {
+			if cmd.Flags().Changed("component") {
+				return fmt.Errorf("failed to load config: %w", cfgErr)
+			}
+			if !flagBool(cmd, "force") && !flagBool(cmd, "dry-run") {
+				return fmt.Errorf("failed to load config, so clean.protect can't be honoured; fix it or rerun with --force to clean from the state file alone: %w", cfgErr)
+			}
+			fmt.Fprintf(os.Stderr, "Warning: failed to load config, cleaning from the state file alone without clean.protect: %v\n", cfgErr)
+			cfg = stateOnlyConfig()
+		}
+
 		// Check if overlay directory exists
 		if _, err := os.Stat("overlay"); os.IsNotExist(err) {
 			return fmt.Errorf("overlay directory does not exist")
 		}
 
 		// Load state
-		state, err := config.LoadState()
+		state, err := loadState(cfg)
 		if err != nil {
 			return fmt.Errorf("failed to load state: %w", err)
 		}
 
-		// Create lookup map of managed paths
-		managedPaths := make(map[string]struct{})
-		for _, mf := range state.ManagedFiles {
-			managedPaths[mf.Path] = struct{}{}
+		// Limit the clean to the given components, then paths or specs
+		files := state.ManagedFiles
+		components, err := componentFlag(cmd, cfg)
+		if err != nil {
+			return err
+		}
+		if len(components) > 0 {
+			only := &onlyFilter{components: components}
+			if files = only.filterFiles(files); len(files) == 0 {
+				return fmt.Errorf("no managed files %s", only.describe())
+			}
+		}
+		selected, err := cleanScope(cfg, files, args)
+		if err != nil {
+			return err
+		}
+		var managed []string
+		for _, mf := range selected {
+			if !mf.Pinned {
+				managed = append(managed, mf.Path)
+			}
 		}
 
-		// Sort managed paths by depth (deepest first)
-		var sortedPaths []string
-		for path := range managedPaths {
-			sortedPaths = append(sortedPaths, path)
+		actions := planClean(cfg, selected, state.ManagedFiles)
+		removals := 0
+		for _, a := range actions {
+			if a.Remove && a.Reason != cleanReasonEmptyDir {
+				removals++
+			}
 		}
-		sort.Slice(sortedPaths, func(i, j int) bool {
-			iDepth := strings.Count(sortedPaths[i], "/")
-			jDepth := strings.Count(sortedPaths[j], "/")
-			if iDepth == jDepth {
-				return sortedPaths[i] > sortedPaths[j] // alphabetical fallback
+
+		dryRun := flagBool(cmd, "dry-run")
+		verbose := flagBool(cmd, "verbose") || dryRun
+		if dryRun {
+			for _, a := range actions {
+				fmt.Println(a)
 			}
-			return iDepth > jDepth
-		})
+			fmt.Printf("Would remove %d managed files and directories\n", removals)
+			return nil
+		}
 
-		removed := 0
+		// Guard against stale state wiping out a large part of the overlay
+		if limit := cfg.Clean.ConfirmLimit(); removals > limit && !flagBool(cmd, "yes") && !flagBool(cmd, "force") {
+			return fmt.Errorf("clean would remove %d paths (more than %d); review with --dry-run and rerun with --yes", removals, limit)
+		}
 
-		// Process each managed path
-		for _, relPath := range sortedPaths {
-			fullPath := filepath.Join("overlay", relPath)
+		// An interrupt records the removals made so far before exiting
+		defer trapInterrupts()()
 
-			// Check if path exists
-			info, err := os.Lstat(fullPath)
-			if os.IsNotExist(err) {
-				state.RemoveManagedFile(relPath)
-				continue
-			}
+		// Read-only copies must be writable to be removed on every platform
+		unlockCopies(selected)
+
+		removed := 0
+		trash := newTrash(cfg)
 
-			// Handle files and symlinks
-			if !info.IsDir() {
-				if err := os.Remove(fullPath); err == nil {
-					removed++
+		// Process each managed path, deepest first. A path that can't be
+		// removed stays tracked, so a later clean or sync still owns it.
+		var stopped error
+		failed := make(map[string]bool)
+		for _, a := range actions {
+			// An interrupt stops the run between paths
+			if stopped = interrupted(); stopped != nil {
+				break
+			}
+			if a.Reason == cleanReasonEmptyDir {
+				// Pruned once the removals are done, below
+				if verbose {
+					fmt.Println(a)
 				}
-				state.RemoveManagedFile(relPath)
 				continue
 			}
-
-			// Handle directories
-			if isFullyManaged(fullPath, managedPaths) {
-				if err := os.RemoveAll(fullPath); err == nil {
-					removed++
+			if a.Remove {
+				if err := trash.remove(filepath.Join("overlay", a.Path)); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: failed to remove %s: %v\n", filepath.Join("overlay", a.Path), err)
+					failed[a.Path] = true
+					continue
+				}
+				removed++
+				if verbose {
+					fmt.Println(a)
 				}
-				state.RemoveManagedFile(relPath)
+			} else if a.Reason == cleanReasonProtected || verbose {
+				fmt.Println(a)
+			}
+			if a.Reason != cleanReasonPinned {
+				state.RemoveManagedFile(a.Path)
 			}
 		}
 
-		// Final cleanup: ensure all managed paths are removed from state
-		for path := range managedPaths {
-			state.RemoveManagedFile(path)
+		// Final cleanup: ensure all managed paths are removed from state,
+		// unless an interrupt left some of them in place
+		if stopped == nil {
+			for _, path := range managed {
+				if !failed[path] {
+					state.RemoveManagedFile(path)
+				}
+			}
 		}
 
-		// Clean up any empty directories
-		if err := removeEmptyDirs("overlay"); err != nil {
-			return fmt.Errorf("failed to clean up empty directories: %w", err)
+		// Clean up the directories the removals left empty
+		for _, a := range actions {
+			if a.Reason != cleanReasonEmptyDir {
+				continue
+			}
+			if err := removeEmptyDir(filepath.Join("overlay", a.Path)); err != nil {
+				return fmt.Errorf("failed to clean up empty directories: %w", err)
+			}
 		}
 
 		// Save state and print results
@@ -95,12 +168,249 @@ Custom files and directories are preserved.`,
 			return fmt.Errorf("failed to save state: %w", err)
 		}
 		fmt.Printf("Removed %d managed files and directories\n", removed)
-		return nil
+		if stopped == nil && len(failed) > 0 {
+			return fmt.Errorf("failed to remove %d managed paths; they are still tracked", len(failed))
+		}
+		return stopped
 	},
 }
 
-// isFullyManaged checks if a directory and all its contents are managed
-func isFullyManaged(path string, managedPaths map[string]struct{}) bool {
+// stateOnlyConfig stands in for a config that can't be loaded. The state is
+// read from the git directory when a state file is kept there, and from the
+// worktree otherwise.
+func stateOnlyConfig() *config.Config {
+	cfg := &config.Config{}
+	if path, err := config.StatePath(config.StateLocationGitDir); err == nil {
+		if _, err := os.Stat(path); err == nil {
+			cfg.StateLocation = config.StateLocationGitDir
+		}
+	}
+	return cfg
+}
+
+// cleanScope selects the managed files clean works on: all of them without
+// args, otherwise those under the given overlay paths or linked by the spec
+// whose from path is given
+func cleanScope(cfg *config.Config, files []config.ManagedFile, args []string) ([]config.ManagedFile, error) {
+	if len(args) == 0 {
+		return files, nil
+	}
+
+	under := func(path, dir string) bool {
+		return dir == "." || path == dir || strings.HasPrefix(path, dir+"/")
+	}
+
+	var selected []config.ManagedFile
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		target := filepath.ToSlash(filepath.Clean(arg))
+		target = strings.TrimPrefix(strings.TrimPrefix(target, "overlay"), "/")
+		if target == "" {
+			target = "."
+		}
+
+		// A spec is named by its from path, as it appears in the config
+		var spec *config.SymlinkSpec
+		for i, link := range cfg.Symlinks {
+			from := link.From
+			if link.String != "" {
+				from = link.String
+			}
+			if strings.Trim(filepath.ToSlash(filepath.Clean(from)), "/") == target {
+				spec = &cfg.Symlinks[i]
+				break
+			}
+		}
+
+		matched := false
+		for _, mf := range files {
+			ok := under(mf.Path, target)
+			if !ok && spec != nil {
+				ok = mf.Upstream == spec.Upstream && under(filepath.ToSlash(mf.Source), target)
+			}
+			if !ok {
+				continue
+			}
+			matched = true
+			if !seen[mf.Path] {
+				seen[mf.Path] = true
+				selected = append(selected, mf)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no managed files under %s", arg)
+		}
+	}
+	return selected, nil
+}
+
+// Reasons reported by clean --dry-run and --verbose
+const (
+	cleanReasonFile      = "managed file"
+	cleanReasonDir       = "fully managed directory"
+	cleanReasonEmptyDir  = "empty directory"
+	cleanReasonMissing   = "missing, dropped from state"
+	cleanReasonProtected = "protected"
+	cleanReasonMixed     = "contains unmanaged files"
+	cleanReasonPinned    = "pinned"
+)
+
+// cleanAction is what clean does with one managed path
+type cleanAction struct {
+	Path     string // Relative to overlay/
+	LinkMode string
+	Reason   string
+	Remove   bool
+}
+
+// String formats the action for --dry-run and --verbose output
+func (a cleanAction) String() string {
+	verb := "remove"
+	if !a.Remove {
+		verb = "keep  "
+	}
+	if a.LinkMode == "" {
+		return fmt.Sprintf("%s overlay/%s (%s)", verb, a.Path, a.Reason)
+	}
+	return fmt.Sprintf("%s overlay/%s (%s, %s)", verb, a.Path, a.LinkMode, a.Reason)
+}
+
+// planClean decides, deepest path first, what clean does with each managed
+// path, followed by the directories that are left empty afterwards. recorded
+// is the whole state, whose dirs: entries are never pruned as empty.
+func planClean(cfg *config.Config, files, recorded []config.ManagedFile) []cleanAction {
+	// Create lookup map of managed paths
+	managedPaths := make(map[string]struct{})
+	modes := make(map[string]string)
+	pinned := make(map[string]bool)
+	for _, mf := range files {
+		modes[mf.Path] = mf.LinkMode
+		if mf.Pinned {
+			// Directories holding a pinned file are not fully managed
+			pinned[mf.Path] = true
+			continue
+		}
+		managedPaths[mf.Path] = struct{}{}
+	}
+
+	// Sort managed paths by depth (deepest first)
+	var sortedPaths []string
+	for path := range modes {
+		sortedPaths = append(sortedPaths, path)
+	}
+	sort.Slice(sortedPaths, func(i, j int) bool {
+		iDepth := strings.Count(sortedPaths[i], "/")
+		jDepth := strings.Count(sortedPaths[j], "/")
+		if iDepth == jDepth {
+			return sortedPaths[i] > sortedPaths[j] // alphabetical fallback
+		}
+		return iDepth > jDepth
+	})
+
+	var actions []cleanAction
+	removed := make(map[string]bool)
+	for _, relPath := range sortedPaths {
+		fullPath := filepath.Join("overlay", relPath)
+		a := cleanAction{Path: relPath, LinkMode: modes[relPath]}
+
+		info, err := os.Lstat(fullPath)
+		switch {
+		case os.IsNotExist(err):
+			a.Reason = cleanReasonMissing
+		case err != nil:
+			continue
+		// Pinned files are local content, kept along with their state entry
+		case pinned[relPath]:
+			a.Reason = cleanReasonPinned
+		// Never delete protected paths, even if state claims them
+		case matchAnyGlob(cfg.Clean.Protect, fullPath):
+			a.Reason = cleanReasonProtected
+		case !info.IsDir():
+			a.Reason, a.Remove = cleanReasonFile, true
+		case isFullyManaged(fullPath, managedPaths, cfg.Clean.Protect):
+			a.Reason, a.Remove = cleanReasonDir, true
+		default:
+			a.Reason = cleanReasonMixed
+		}
+		if a.Remove {
+			removed[fullPath] = true
+		}
+		actions = append(actions, a)
+	}
+
+	keep := make(map[string]bool)
+	for _, mf := range recorded {
+		if mf.LinkMode == dirLinkMode {
+			keep[filepath.Join("overlay", mf.Path)] = true
+		}
+	}
+	for _, dir := range emptyAfter(removed, keep) {
+		rel, _ := filepath.Rel("overlay", dir)
+		actions = append(actions, cleanAction{Path: filepath.ToSlash(rel), Reason: cleanReasonEmptyDir, Remove: true})
+	}
+	return actions
+}
+
+// emptyAfter lists, deepest first, the directories left empty once the
+// removed paths are gone. Only the directories holding a removed path are
+// pruned, along with empty directories inside them, so a scoped clean leaves
+// the rest of overlay/ alone; those in keep are never pruned.
+func emptyAfter(removed, keep map[string]bool) []string {
+	// The top-level directories under overlay/ holding a removed path
+	roots := make(map[string]bool)
+	for path := range removed {
+		rel, err := filepath.Rel("overlay", path)
+		if err != nil {
+			continue
+		}
+		if top, _, nested := strings.Cut(filepath.ToSlash(rel), "/"); nested {
+			roots[filepath.Join("overlay", top)] = true
+		}
+	}
+	var sorted []string
+	for root := range roots {
+		sorted = append(sorted, root)
+	}
+	sort.Strings(sorted)
+
+	var empty []string
+	var walk func(dir string) bool
+	walk = func(dir string) bool {
+		if overlayDepth(dir) > maxWalkDepth || keep[dir] {
+			return false
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return false
+		}
+		isEmpty := true
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if removed[path] {
+				continue
+			}
+			if !entry.IsDir() || !walk(path) {
+				isEmpty = false
+			}
+		}
+		if isEmpty {
+			empty = append(empty, dir)
+		}
+		return isEmpty
+	}
+	for _, root := range sorted {
+		if !removed[root] {
+			walk(root)
+		}
+	}
+	return empty
+}
+
+// isFullyManaged checks if a directory and all its contents are managed and unprotected
+func isFullyManaged(path string, managedPaths map[string]struct{}, protect []string) bool {
+	if overlayDepth(path) > maxWalkDepth {
+		return false
+	}
 	entries, err := os.ReadDir(path)
 	if err != nil {
 		return false
@@ -112,15 +422,21 @@ func isFullyManaged(path string, managedPaths map[string]struct{}) bool {
 		if err != nil {
 			return false
 		}
+		relPath = filepath.ToSlash(relPath)
 
 		// Check if this entry is managed
 		if _, ok := managedPaths[relPath]; !ok {
 			return false
 		}
 
+		// Protected entries keep their directory alive
+		if matchAnyGlob(protect, entryPath) {
+			return false
+		}
+
 		// Recursively check directories
 		if entry.IsDir() {
-			if !isFullyManaged(entryPath, managedPaths) {
+			if !isFullyManaged(entryPath, managedPaths, protect) {
 				return false
 			}
 		}
@@ -128,41 +444,26 @@ func isFullyManaged(path string, managedPaths map[string]struct{}) bool {
 	return true
 }
 
-// removeEmptyDirs recursively traverses the directory tree starting at 'dir'.
-// After processing children, it checks if the directory is empty and removes it.
-func removeEmptyDirs(dir string) error {
-	// List directory entries
+// removeEmptyDir removes dir unless something was left in it, as when
+// removing a path in it failed
+func removeEmptyDir(dir string) error {
 	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return fmt.Errorf("reading directory %q: %w", dir, err)
-	}
-
-	// Process subdirectories recursively
-	for _, entry := range entries {
-		if entry.IsDir() {
-			subdir := filepath.Join(dir, entry.Name())
-			if err := removeEmptyDirs(subdir); err != nil {
-				return err
-			}
-		}
+	if os.IsNotExist(err) || (err == nil && len(entries) > 0) {
+		return nil
 	}
-
-	// Re-read directory entries after possibly removing subdirectories
-	entries, err = os.ReadDir(dir)
 	if err != nil {
-		return fmt.Errorf("re-reading directory %q: %w", dir, err)
+		return fmt.Errorf("reading directory %q: %w", dir, err)
 	}
-
-	// If the directory is empty and not the root overlay directory, remove it
-	if len(entries) == 0 && dir != "overlay" {
-		if err := os.Remove(dir); err != nil {
-			return fmt.Errorf("removing directory %q: %w", dir, err)
-		}
+	if err := os.Remove(dir); err != nil {
+		return fmt.Errorf("removing directory %q: %w", dir, err)
 	}
-
 	return nil
 }
 
 func init() {
+	cleanCmd.Flags().Bool("dry-run", false, "List what would be removed without removing anything")
+	cleanCmd.Flags().BoolP("verbose", "v", false, "Print each path as it is removed or kept, with its link mode and reason")
+	cleanCmd.Flags().BoolP("yes", "y", false, "Confirm removing more paths than clean.confirm_above")
+	cleanCmd.Flags().StringArray("component", nil, "Only remove the files linked by this component (repeatable)")
 	rootCmd.AddCommand(cleanCmd)
 }
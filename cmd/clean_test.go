@@ -211,6 +211,47 @@ func TestCleanCommand(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "clean skips protected paths",
+			config: &config.Config{
+				Symlinks: []config.SymlinkSpec{
+					{String: "dir"},
+				},
+				Clean: config.CleanConfig{
+					Protect: []string{"overlay/**/local.*"},
+				},
+			},
+			setup: testSetup{
+				managedFiles: []config.ManagedFile{
+					{Path: "dir/managed.txt", LinkMode: "copy", Source: "dir/managed.txt"},
+					{Path: "dir/sub/local.env", LinkMode: "copy", Source: "dir/sub/local.env"},
+					{Path: "dir/sub", LinkMode: "copy", Source: "dir/sub"},
+				},
+				setupFunc: func(t *testing.T) {
+					if err := os.MkdirAll("overlay/dir/sub", 0755); err != nil {
+						t.Fatalf("Failed to create overlay directory: %v", err)
+					}
+					if err := os.WriteFile("overlay/dir/managed.txt", []byte("managed"), 0644); err != nil {
+						t.Fatalf("Failed to create managed file: %v", err)
+					}
+					if err := os.WriteFile("overlay/dir/sub/local.env", []byte("local"), 0644); err != nil {
+						t.Fatalf("Failed to create protected file: %v", err)
+					}
+				},
+			},
+			wantError: false,
+			verifyPreserved: func(t *testing.T) {
+				// Verify managed file was removed
+				if _, err := os.Stat("overlay/dir/managed.txt"); !os.IsNotExist(err) {
+					t.Error("Managed file was not removed")
+				}
+
+				// Verify protected file survived even though state claims it
+				if _, err := os.Stat("overlay/dir/sub/local.env"); os.IsNotExist(err) {
+					t.Error("Protected file was removed")
+				}
+			},
+		},
 		{
 			name: "clean non-existent overlay directory",
 			config: &config.Config{
@@ -609,6 +650,12 @@ func TestCleanCommand(t *testing.T) {
 symlinks:
   - %s
 `, tt.config.Symlinks[0].String)
+			if len(tt.config.Clean.Protect) > 0 {
+				configContent += "clean:\n  protect:\n"
+				for _, pattern := range tt.config.Clean.Protect {
+					configContent += fmt.Sprintf("    - %q\n", pattern)
+				}
+			}
 			if err := os.WriteFile(".git-overlay.yml", []byte(configContent), 0644); err != nil {
 				t.Fatalf("Failed to create config file: %v", err)
 			}
@@ -647,3 +694,380 @@ symlinks:
 		})
 	}
 }
+
+func TestPlanClean(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	for _, dir := range []string{"overlay/dir/sub", "overlay/mixed", "overlay/keep"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	files := []string{"overlay/dir/sub/a.txt", "overlay/mixed/b.txt", "overlay/mixed/custom.txt", "overlay/keep/local.env"}
+	for _, name := range files {
+		if err := os.WriteFile(name, []byte("x"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	cfg := &config.Config{Clean: config.CleanConfig{Protect: []string{"overlay/keep/*"}}}
+	state := &config.State{}
+	state.AddManagedFile("dir/sub/a.txt", "copy", "dir/sub/a.txt")
+	state.AddManagedFile("mixed/b.txt", "symlink", "mixed/b.txt")
+	state.AddManagedFile("mixed", "symlink", "mixed")
+	state.AddManagedFile("keep/local.env", "copy", "keep/local.env")
+	state.AddManagedFile("gone.txt", "symlink", "gone.txt")
+
+	want := map[string]cleanAction{
+		"dir/sub/a.txt":  {LinkMode: "copy", Reason: cleanReasonFile, Remove: true},
+		"mixed/b.txt":    {LinkMode: "symlink", Reason: cleanReasonFile, Remove: true},
+		"mixed":          {LinkMode: "symlink", Reason: cleanReasonMixed},
+		"keep/local.env": {LinkMode: "copy", Reason: cleanReasonProtected},
+		"gone.txt":       {LinkMode: "symlink", Reason: cleanReasonMissing},
+		"dir/sub":        {Reason: cleanReasonEmptyDir, Remove: true},
+		"dir":            {Reason: cleanReasonEmptyDir, Remove: true},
+	}
+
+	actions := planClean(cfg, state.ManagedFiles, state.ManagedFiles)
+	if len(actions) != len(want) {
+		t.Fatalf("planClean() returned %d actions, want %d: %v", len(actions), len(want), actions)
+	}
+	for _, a := range actions {
+		w, ok := want[a.Path]
+		if !ok {
+			t.Errorf("Unexpected action %v", a)
+			continue
+		}
+		w.Path = a.Path
+		if a != w {
+			t.Errorf("Action for %s = %v, want %v", a.Path, a, w)
+		}
+	}
+}
+
+func TestCleanRequiresConfirmation(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	configContent := `upstream:
+  url: "https://example.com/repo.git"
+  ref: "main"
+symlinks:
+  - dir
+clean:
+  confirm_above: 2
+`
+	if err := os.WriteFile(".git-overlay.yml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+	if err := os.MkdirAll("overlay/dir", 0755); err != nil {
+		t.Fatalf("Failed to create overlay directory: %v", err)
+	}
+	state := &config.State{}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile("overlay/dir/"+name, []byte("x"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		state.AddManagedFile("dir/"+name, "copy", "dir/"+name)
+	}
+	if err := state.SaveState(); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	newCmd := func() *cobra.Command {
+		cmd := &cobra.Command{Use: "clean", RunE: cleanCmd.RunE}
+		cmd.Flags().String("config", ".git-overlay.yml", "")
+		cmd.Flags().Bool("dry-run", false, "")
+		cmd.Flags().Bool("yes", false, "")
+		return cmd
+	}
+
+	// A dry run never needs confirmation and removes nothing
+	cmd := newCmd()
+	cmd.Flags().Set("dry-run", "true")
+	if err := cmd.RunE(cmd, nil); err != nil {
+		t.Fatalf("clean --dry-run error = %v", err)
+	}
+	if _, err := os.Stat("overlay/dir/a.txt"); err != nil {
+		t.Errorf("Dry run removed a file: %v", err)
+	}
+
+	cmd = newCmd()
+	if err := cmd.RunE(cmd, nil); err == nil {
+		t.Fatal("clean removed more than confirm_above paths without --yes")
+	}
+	if _, err := os.Stat("overlay/dir/a.txt"); err != nil {
+		t.Errorf("Refused clean removed a file: %v", err)
+	}
+
+	cmd = newCmd()
+	cmd.Flags().Set("yes", "true")
+	if err := cmd.RunE(cmd, nil); err != nil {
+		t.Fatalf("clean --yes error = %v", err)
+	}
+	if _, err := os.Stat("overlay/dir"); !os.IsNotExist(err) {
+		t.Error("clean --yes did not remove the managed directory")
+	}
+}
+
+func TestCleanWithoutConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string // Empty for no config file
+	}{
+		{name: "invalid config", config: "upstream: [\n"},
+		{name: "missing config"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+
+			originalDir, err := os.Getwd()
+			if err != nil {
+				t.Fatalf("Failed to get current directory: %v", err)
+			}
+			if err := os.Chdir(tmpDir); err != nil {
+				t.Fatalf("Failed to change to temp directory: %v", err)
+			}
+			defer os.Chdir(originalDir)
+
+			if tt.config != "" {
+				if err := os.WriteFile(".git-overlay.yml", []byte(tt.config), 0644); err != nil {
+					t.Fatalf("Failed to create config file: %v", err)
+				}
+			}
+			if err := os.MkdirAll("overlay/dir", 0755); err != nil {
+				t.Fatalf("Failed to create overlay directory: %v", err)
+			}
+			state := &config.State{}
+			for _, name := range []string{"a.txt", "pinned.txt", "custom.txt"} {
+				if err := os.WriteFile("overlay/dir/"+name, []byte("x"), 0644); err != nil {
+					t.Fatalf("Failed to create file: %v", err)
+				}
+			}
+			state.AddManagedFile("dir/a.txt", "copy", "dir/a.txt")
+			state.AddManagedFile("dir/pinned.txt", "copy", "dir/pinned.txt")
+			state.SetPinned("dir/pinned.txt", true)
+			if err := state.SaveState(); err != nil {
+				t.Fatalf("Failed to save state: %v", err)
+			}
+
+			newCmd := func() *cobra.Command {
+				cmd := &cobra.Command{Use: "clean", RunE: cleanCmd.RunE}
+				cmd.Flags().String("config", ".git-overlay.yml", "")
+				cmd.Flags().Bool("force", false, "")
+				return cmd
+			}
+
+			// Without the config clean.protect is unknown, so nothing goes unasked
+			cmd := newCmd()
+			if err := cmd.RunE(cmd, nil); err == nil {
+				t.Fatal("clean without a config succeeded without --force")
+			}
+			if _, err := os.Stat("overlay/dir/a.txt"); err != nil {
+				t.Errorf("Refused clean removed a file: %v", err)
+			}
+
+			cmd = newCmd()
+			cmd.Flags().Set("force", "true")
+			if err := cmd.RunE(cmd, nil); err != nil {
+				t.Fatalf("clean --force error = %v", err)
+			}
+
+			if _, err := os.Stat("overlay/dir/a.txt"); !os.IsNotExist(err) {
+				t.Error("clean did not remove the managed file")
+			}
+			for _, name := range []string{"pinned.txt", "custom.txt"} {
+				if _, err := os.Stat("overlay/dir/" + name); err != nil {
+					t.Errorf("clean removed %s: %v", name, err)
+				}
+			}
+			saved, err := config.LoadState()
+			if err != nil {
+				t.Fatalf("Failed to load state: %v", err)
+			}
+			if len(saved.ManagedFiles) != 1 || saved.ManagedFiles[0].Path != "dir/pinned.txt" {
+				t.Errorf("ManagedFiles = %v, want only the pinned file", saved.ManagedFiles)
+			}
+		})
+	}
+}
+
+func TestCleanScope(t *testing.T) {
+	cfg := &config.Config{
+		Symlinks: []config.SymlinkSpec{
+			{String: "docs"},
+			{From: "src/lib", To: "vendor/lib"},
+			{From: "tools", To: "tools", Upstream: "extra"},
+		},
+	}
+	files := []config.ManagedFile{
+		{Path: "docs/a.md", Source: "docs/a.md"},
+		{Path: "docs/guide/b.md", Source: "docs/guide/b.md"},
+		{Path: "docsite/index.html", Source: "docsite/index.html"},
+		{Path: "vendor/lib/x.go", Source: "src/lib/x.go"},
+		{Path: "tools/run.sh", Source: "tools/run.sh", Upstream: "extra"},
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "no args selects everything", args: nil, want: []string{"docs/a.md", "docs/guide/b.md", "docsite/index.html", "vendor/lib/x.go", "tools/run.sh"}},
+		{name: "overlay path", args: []string{"overlay/docs/guide"}, want: []string{"docs/guide/b.md"}},
+		{name: "path without overlay prefix", args: []string{"docs"}, want: []string{"docs/a.md", "docs/guide/b.md"}},
+		{name: "spec by from path", args: []string{"src/lib"}, want: []string{"vendor/lib/x.go"}},
+		{name: "several args", args: []string{"tools", "docsite/"}, want: []string{"tools/run.sh", "docsite/index.html"}},
+		{name: "nothing managed", args: []string{"missing"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cleanScope(cfg, files, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("cleanScope() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var paths []string
+			for _, mf := range got {
+				paths = append(paths, mf.Path)
+			}
+			if fmt.Sprint(paths) != fmt.Sprint(tt.want) {
+				t.Errorf("cleanScope() = %v, want %v", paths, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanKeepsFailedRemovals(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	configContent := `upstream:
+  url: "https://example.com/repo.git"
+  ref: "main"
+symlinks:
+  - dir
+`
+	if err := os.WriteFile(".git-overlay.yml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+	if err := os.MkdirAll("overlay/dir", 0755); err != nil {
+		t.Fatalf("Failed to create overlay directory: %v", err)
+	}
+	if err := os.WriteFile("overlay/dir/a.txt", []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	state := &config.State{}
+	state.AddManagedFile("dir/a.txt", "copy", "dir/a.txt")
+	if err := state.SaveState(); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	// A file where the trash directory should be makes every move fail
+	if err := os.WriteFile(".git-overlay.trash", nil, 0644); err != nil {
+		t.Fatalf("Failed to block the trash: %v", err)
+	}
+
+	cmd := &cobra.Command{Use: "clean", RunE: cleanCmd.RunE}
+	cmd.Flags().String("config", ".git-overlay.yml", "")
+	if err := cmd.RunE(cmd, nil); err == nil {
+		t.Fatal("clean succeeded though a file couldn't be removed")
+	}
+
+	if _, err := os.Stat("overlay/dir/a.txt"); err != nil {
+		t.Errorf("overlay/dir/a.txt = %v, want it left in place", err)
+	}
+	saved, err := config.LoadState()
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if len(saved.ManagedFiles) != 1 || saved.ManagedFiles[0].Path != "dir/a.txt" {
+		t.Errorf("ManagedFiles = %v, want dir/a.txt still tracked", saved.ManagedFiles)
+	}
+}
+
+func TestCleanScopedKeepsOtherDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	configContent := `upstream:
+  url: "https://example.com/repo.git"
+  ref: "main"
+symlinks:
+  - docs
+  - src
+dirs:
+  - path: cache
+`
+	if err := os.WriteFile(".git-overlay.yml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+	for _, dir := range []string{"overlay/docs", "overlay/src", "overlay/cache", "overlay/stray"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	state := &config.State{}
+	for _, name := range []string{"docs/a.md", "src/b.go"} {
+		if err := os.WriteFile("overlay/"+name, []byte("x"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		state.AddManagedFile(name, "copy", name)
+	}
+	state.AddManagedFile("cache", dirLinkMode, "")
+	if err := state.SaveState(); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	cmd := &cobra.Command{Use: "clean", RunE: cleanCmd.RunE}
+	cmd.Flags().String("config", ".git-overlay.yml", "")
+	if err := cmd.RunE(cmd, []string{"overlay/docs"}); err != nil {
+		t.Fatalf("clean overlay/docs error = %v", err)
+	}
+
+	if _, err := os.Stat("overlay/docs"); !os.IsNotExist(err) {
+		t.Error("clean left the emptied overlay/docs behind")
+	}
+	// Empty directories outside the scope are left alone, dirs: entries above all
+	for _, kept := range []string{"overlay/src/b.go", "overlay/cache", "overlay/stray"} {
+		if _, err := os.Stat(kept); err != nil {
+			t.Errorf("Scoped clean removed %s: %v", kept, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// defaultCommitMessage is the --commit message template used unless
+// commit.message is configured
+const defaultCommitMessage = "Update overlay to upstream {{ .UpstreamRef }}{{ with .UpstreamSHA }} ({{ slice . 0 7 }}){{ end }}"
+
+// commitData is what commit message templates are rendered with
+type commitData struct {
+	generateData
+	Command string // init or sync
+}
+
+// commitMessage renders the commit message template for a run of command
+func commitMessage(cfg *config.Config, command string) (string, error) {
+	text := cfg.Commit.Message
+	if text == "" {
+		text = defaultCommitMessage
+	}
+	data := commitData{generateData: newGenerateData(cfg), Command: command}
+	data.deepen = true
+	data.SyncTime = time.Now().UTC().Truncate(time.Second)
+	tmpl, err := template.New("commit.message").Funcs(data.funcs()).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid commit.message template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render commit.message: %w", err)
+	}
+	return strings.TrimSpace(buf.String()) + "\n", nil
+}
+
+// bookkeepingPaths lists the files git-overlay maintains in the parent
+// repository that exist and can be committed
+func bookkeepingPaths(cmd *cobra.Command, cfg *config.Config) ([]string, error) {
+	statePath, err := config.StatePath(cfg.StateLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []string{".gitmodules", ".gitignore", "overlay", config.SumsFile}
+	if configPath := flagString(cmd, "config"); configPath != "" && !isRemoteConfig(configPath) {
+		candidates = append(candidates, configPath)
+	}
+	// Non-git and external upstreams are ignored rather than tracked as a gitlink
+	if cfg.Upstream.IsGit() && cfg.UpstreamDir == "" {
+		candidates = append(candidates, ".upstream")
+	}
+	// A state file inside the git directory is never committed
+	if statePath == config.StateFile {
+		candidates = append(candidates, statePath)
+	}
+
+	var paths []string
+	for _, p := range candidates {
+		if _, err := os.Lstat(p); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// commitBookkeeping stages the bookkeeping files and commits them with
+// message. Other changes already staged are left out of the commit.
+func commitBookkeeping(cmd *cobra.Command, cfg *config.Config, message string) error {
+	paths, err := bookkeepingPaths(cmd, cfg)
+	if err != nil {
+		return err
+	}
+
+	add := exec.Command("git", append([]string{"add", "-A", "--"}, paths...)...)
+	add.Stderr = os.Stderr
+	if err := add.Run(); err != nil {
+		return fmt.Errorf("failed to stage overlay changes: %w", err)
+	}
+
+	// Commit exactly the staged changes under the bookkeeping paths
+	out, err := exec.Command("git", append([]string{"diff", "--cached", "--name-only", "--no-renames", "-z", "--"}, paths...)...).Output()
+	if err != nil {
+		return fmt.Errorf("failed to list staged overlay changes: %w", err)
+	}
+	changed := strings.Split(strings.TrimRight(string(out), "\x00"), "\x00")
+	if len(out) == 0 {
+		fmt.Println("Nothing to commit")
+		return nil
+	}
+
+	commit := exec.Command("git", append([]string{"commit", "--quiet", "-m", message, "--"}, changed...)...)
+	commit.Stdout = os.Stdout
+	commit.Stderr = os.Stderr
+	if err := commit.Run(); err != nil {
+		return fmt.Errorf("failed to commit overlay changes: %w", err)
+	}
+	fmt.Printf("Committed: %s\n", strings.SplitN(message, "\n", 2)[0])
+	return nil
+}
+
+// commitRun commits the bookkeeping files after command when --commit is set
+func commitRun(cmd *cobra.Command, cfg *config.Config, command string) error {
+	if !flagBool(cmd, "commit") {
+		return nil
+	}
+	message, err := commitMessage(cfg, command)
+	if err != nil {
+		return err
+	}
+	return commitBookkeeping(cmd, cfg, message)
+}
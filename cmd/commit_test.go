@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestCommitMessage(t *testing.T) {
+	tmpDir := t.TempDir()
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	defer os.Chdir(origDir)
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{name: "default", want: "Update overlay to upstream v1.2.0\n"},
+		{name: "custom", template: "chore(overlay): {{ .Command }} {{ .UpstreamRef }}", want: "chore(overlay): sync v1.2.0\n"},
+		{name: "unknown field", template: "{{ .Nope }}", wantErr: true},
+		{name: "invalid template", template: "{{ .UpstreamRef", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Upstream: config.UpstreamConfig{URL: "https://example.com/repo.git", Ref: "v1.2.0"},
+				Commit:   config.CommitConfig{Message: tt.template},
+			}
+			got, err := commitMessage(cfg, "sync")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("commitMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("commitMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommitBookkeeping(t *testing.T) {
+	tmpDir := t.TempDir()
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	defer os.Chdir(origDir)
+
+	for _, env := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(env, "test")
+	}
+	for _, env := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(env, "test@example.com")
+	}
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	if err := runGitCommand(".", []string{"init", "-b", "main"}); err != nil {
+		t.Fatalf("Failed to init repository: %v", err)
+	}
+	files := map[string]string{
+		".git-overlay.yml":     "upstream:\n  url: https://example.com/repo.git\n  ref: main\n",
+		".gitignore":           "# BEGIN GIT-OVERLAY MANAGED BLOCK - DO NOT EDIT\noverlay/linked.txt\n# END GIT-OVERLAY MANAGED BLOCK",
+		config.StateFile:       "{}\n",
+		"overlay/linked.txt":   "ignored link",
+		"overlay/custom.txt":   "custom",
+		"unrelated/staged.txt": "not bookkeeping",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", path, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	if err := runGitCommand(".", []string{"add", "unrelated/staged.txt"}); err != nil {
+		t.Fatalf("Failed to stage unrelated file: %v", err)
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("config", ".git-overlay.yml", "")
+	cfg := &config.Config{Upstream: config.UpstreamConfig{Type: "release", Ref: "v1"}}
+
+	if err := commitBookkeeping(cmd, cfg, "Update overlay\n"); err != nil {
+		t.Fatalf("commitBookkeeping() error = %v", err)
+	}
+
+	out, err := exec.Command("git", "show", "--name-only", "--format=%s", "HEAD").Output()
+	if err != nil {
+		t.Fatalf("Failed to read commit: %v", err)
+	}
+	lines := strings.Fields(string(out))
+	want := []string{"Update", "overlay", ".git-overlay.state.json", ".git-overlay.yml", ".gitignore", "overlay/custom.txt"}
+	if strings.Join(lines, " ") != strings.Join(want, " ") {
+		t.Errorf("commit = %q, want %q", lines, want)
+	}
+
+	// The unrelated change stays staged but uncommitted
+	staged, err := exec.Command("git", "diff", "--cached", "--name-only").Output()
+	if err != nil {
+		t.Fatalf("Failed to list staged files: %v", err)
+	}
+	if strings.TrimSpace(string(staged)) != "unrelated/staged.txt" {
+		t.Errorf("staged after commit = %q, want unrelated/staged.txt", staged)
+	}
+
+	// A second run has nothing left to commit
+	if err := commitBookkeeping(cmd, cfg, "Update overlay\n"); err != nil {
+		t.Fatalf("second commitBookkeeping() error = %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+// maxCommittedShown bounds how many committed paths the warning names
+const maxCommittedShown = 5
+
+// committedManagedFiles lists the paths git tracks in the parent repository
+// that git-overlay materializes and gitignores, usually committed by a
+// `git add -f` or before the gitignore was written. Pinned files are meant
+// to be committed and are left out. Outside a git repository there are none.
+func committedManagedFiles(state *config.State) ([]string, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, nil
+	}
+	out, err := exec.Command("git", "ls-files", "-z", "--", "overlay").Output()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			// Not a git repository
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list tracked files: %w", err)
+	}
+
+	// Files inside a linked directory are materialized with it, unlike
+	// files inside a dirs: directory
+	managed := make(map[string]bool)
+	linkedDirs := make(map[string]bool)
+	for _, mf := range state.ManagedFiles {
+		if mf.Pinned {
+			continue
+		}
+		managed[mf.Path] = true
+		if mf.LinkMode != dirLinkMode {
+			linkedDirs[mf.Path] = true
+		}
+	}
+
+	var committed []string
+	for _, tracked := range strings.Split(strings.TrimRight(string(out), "\x00"), "\x00") {
+		rel := strings.TrimPrefix(tracked, "overlay/")
+		if rel == tracked || rel == "" {
+			continue
+		}
+		found := managed[rel]
+		for dir := path.Dir(rel); !found && dir != "."; dir = path.Dir(dir) {
+			found = linkedDirs[dir]
+		}
+		if found {
+			committed = append(committed, tracked)
+		}
+	}
+	return committed, nil
+}
+
+// committedWarning describes managed files committed to the repository
+func committedWarning(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	shown := paths
+	if len(shown) > maxCommittedShown {
+		shown = append(shown[:maxCommittedShown:maxCommittedShown], fmt.Sprintf("and %d more", len(paths)-maxCommittedShown))
+	}
+	return fmt.Sprintf("warning: %d managed files are committed to the repository, though git-overlay materializes them (%s); run 'git-overlay status --fix' to untrack them",
+		len(paths), strings.Join(shown, ", "))
+}
+
+// untrackFiles removes paths from the parent repository's index, leaving
+// them in place on disk
+func untrackFiles(paths []string) error {
+	args := append([]string{"rm", "-r", "--cached", "--quiet", "--"}, paths...)
+	git := exec.Command("git", args...)
+	git.Stderr = os.Stderr
+	if err := git.Run(); err != nil {
+		return fmt.Errorf("failed to untrack managed files: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// expandComponents appends the specs of every components: group to
+// symlinks, in name order, marking each with its component
+func expandComponents(cfg *config.Config) error {
+	names := make([]string, 0, len(cfg.Components))
+	for name := range cfg.Components {
+		if name == "" || strings.ContainsAny(name, `/\, `) {
+			return fmt.Errorf("invalid component name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, link := range cfg.Components[name] {
+			link.Component = name
+			cfg.Symlinks = append(cfg.Symlinks, link)
+		}
+	}
+	return nil
+}
+
+// componentFlag reads --component, checking every name is a configured
+// component
+func componentFlag(cmd *cobra.Command, cfg *config.Config) (map[string]bool, error) {
+	if cmd.Flags().Lookup("component") == nil {
+		return nil, nil
+	}
+	names, err := cmd.Flags().GetStringArray("component")
+	if err != nil || len(names) == 0 {
+		return nil, err
+	}
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, ok := cfg.Components[name]; !ok {
+			return nil, fmt.Errorf("unknown component %q", name)
+		}
+		selected[name] = true
+	}
+	return selected, nil
+}
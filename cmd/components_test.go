@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestExpandComponents(t *testing.T) {
+	cfg := &config.Config{
+		Symlinks: []config.SymlinkSpec{{String: "README.md"}},
+		Components: map[string][]config.SymlinkSpec{
+			"proto": {{String: "proto"}},
+			"docs":  {{From: "docs", To: "site/docs"}},
+		},
+	}
+	if err := expandComponents(cfg); err != nil {
+		t.Fatalf("expandComponents() error = %v", err)
+	}
+
+	want := []struct{ source, component string }{
+		{"README.md", ""}, {"docs", "docs"}, {"proto", "proto"},
+	}
+	if len(cfg.Symlinks) != len(want) {
+		t.Fatalf("expandComponents() gave %d specs, want %d", len(cfg.Symlinks), len(want))
+	}
+	for i, w := range want {
+		if got := cfg.Symlinks[i]; specSource(got) != w.source || got.Component != w.component {
+			t.Errorf("spec %d = %s in %q, want %s in %q", i, specSource(got), got.Component, w.source, w.component)
+		}
+	}
+
+	bad := &config.Config{Components: map[string][]config.SymlinkSpec{"a/b": nil}}
+	if err := expandComponents(bad); err == nil {
+		t.Error("expandComponents() accepted a component name with a slash")
+	}
+}
+
+func TestComponents(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	for _, name := range []string{"a.txt", "proto/api.proto", "docs/guide.md"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(".upstream", name)), 0755); err != nil {
+			t.Fatalf("Failed to create upstream directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(".upstream", name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+	}
+
+	configContent := `upstream:
+  url: "https://example.com/repo.git"
+  ref: "main"
+symlinks:
+  - a.txt
+components:
+  proto:
+    - proto
+  docs:
+    - docs
+`
+	if err := os.WriteFile(".git-overlay.yml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+
+	newCmd := func(components ...string) *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("config", ".git-overlay.yml", "")
+		cmd.Flags().String("link-mode", "symlink", "")
+		cmd.Flags().Bool("force", false, "")
+		cmd.Flags().StringArray("component", nil, "")
+		for _, c := range components {
+			cmd.Flags().Set("component", c)
+		}
+		return cmd
+	}
+	sync := func(cmd *cobra.Command) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		return CreateLinks(cmd, cfg)
+	}
+
+	// A full sync links every component and records which linked what
+	if err := sync(newCmd()); err != nil {
+		t.Fatalf("sync error = %v", err)
+	}
+	state, err := config.LoadState()
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	for path, want := range map[string]string{"a.txt": "", "proto/api.proto": "proto", "docs/guide.md": "docs"} {
+		managed, mf := state.IsManagedFile(path)
+		if !managed {
+			t.Errorf("%s is not managed", path)
+		} else if mf.Component != want {
+			t.Errorf("%s component = %q, want %q", path, mf.Component, want)
+		}
+	}
+
+	// Syncing one component leaves the others alone
+	for _, path := range []string{"overlay/a.txt", "overlay/proto/api.proto", "overlay/docs/guide.md"} {
+		if err := os.Remove(path); err != nil {
+			t.Fatalf("Failed to remove %s: %v", path, err)
+		}
+	}
+	if err := sync(newCmd("docs")); err != nil {
+		t.Fatalf("sync --component docs error = %v", err)
+	}
+	if _, err := os.Lstat("overlay/docs/guide.md"); err != nil {
+		t.Errorf("docs were not relinked: %v", err)
+	}
+	for _, path := range []string{"overlay/a.txt", "overlay/proto/api.proto"} {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("%s outside the component was relinked: %v", path, err)
+		}
+	}
+	if err := sync(newCmd("missing")); err == nil {
+		t.Error("sync with an unknown component succeeded")
+	}
+
+	// Clean removes only the files of the given component
+	relink := newCmd()
+	relink.Flags().Set("force", "true")
+	if err := sync(relink); err != nil {
+		t.Fatalf("sync error = %v", err)
+	}
+	clean := &cobra.Command{Use: "clean", RunE: cleanCmd.RunE}
+	clean.Flags().String("config", ".git-overlay.yml", "")
+	clean.Flags().StringArray("component", nil, "")
+	clean.Flags().Set("component", "proto")
+	if err := clean.RunE(clean, nil); err != nil {
+		t.Fatalf("clean --component proto error = %v", err)
+	}
+	if _, err := os.Lstat("overlay/proto/api.proto"); !os.IsNotExist(err) {
+		t.Errorf("clean --component proto left the proto files: %v", err)
+	}
+	for _, path := range []string{"overlay/a.txt", "overlay/docs/guide.md"} {
+		if _, err := os.Lstat(path); err != nil {
+			t.Errorf("clean --component proto removed %s: %v", path, err)
+		}
+	}
+	state, err = config.LoadState()
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if managed, _ := state.IsManagedFile("proto/api.proto"); managed {
+		t.Error("clean --component proto kept the proto files in the state")
+	}
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+// sniffLength is how much of a file is read to detect its type, as
+// http.DetectContentType considers
+const sniffLength = 512
+
+// executableMagic maps the leading bytes of executable formats, which
+// http.DetectContentType reports as application/octet-stream, to MIME types
+var executableMagic = []struct {
+	magic    []byte
+	mimeType string
+}{
+	{[]byte("\x7fELF"), "application/x-executable"},
+	{[]byte{0xcf, 0xfa, 0xed, 0xfe}, "application/x-mach-binary"},
+	{[]byte{0xce, 0xfa, 0xed, 0xfe}, "application/x-mach-binary"},
+	{[]byte{0xca, 0xfe, 0xba, 0xbe}, "application/x-mach-binary"}, // Universal binary
+	{[]byte("MZ"), "application/vnd.microsoft.portable-executable"},
+	{[]byte("#!"), "text/x-script"},
+}
+
+// extensionTypes covers source formats missing from the mime package's
+// built-in table and often from the system's
+var extensionTypes = map[string]string{
+	".md":       "text/markdown",
+	".markdown": "text/markdown",
+	".yaml":     "application/yaml",
+	".yml":      "application/yaml",
+	".toml":     "application/toml",
+	".go":       "text/x-go",
+	".sh":       "text/x-shellscript",
+}
+
+// contentType detects the MIME type of the file at p without parameters:
+// executables by their magic bytes, then the extension, then the content as
+// http.DetectContentType sees it
+func contentType(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+
+	for _, m := range executableMagic {
+		if bytes.HasPrefix(head, m.magic) {
+			return m.mimeType, nil
+		}
+	}
+	ext := strings.ToLower(filepath.Ext(p))
+	t, ok := extensionTypes[ext]
+	if !ok {
+		t = mime.TypeByExtension(ext)
+	}
+	if t == "" {
+		t = http.DetectContentType(head)
+	}
+	t, _, _ = strings.Cut(t, ";")
+	return strings.TrimSpace(t), nil
+}
+
+// contentTypeRule returns the first content_types rule matching a planned
+// link, with the detected type
+func contentTypeRule(p plannedLink, rules []config.ContentTypeRule) (config.ContentTypeRule, string, bool, error) {
+	relSrc, _ := filepath.Rel(config.UpstreamDir(p.upstream), p.src)
+	relDst := overlayRelPath(p.dst)
+	var detected string
+	for _, rule := range rules {
+		if rule.Path != "" && !matchGlob(rule.Path, relSrc) && !matchGlob(rule.Path, relDst) {
+			continue
+		}
+		if detected == "" {
+			t, err := contentType(p.src)
+			if err != nil {
+				return rule, "", false, fmt.Errorf("failed to detect the type of %s: %w", p.src, err)
+			}
+			detected = t
+		}
+		if ok, _ := path.Match(rule.Type, detected); ok {
+			return rule, detected, true, nil
+		}
+	}
+	return config.ContentTypeRule{}, detected, false, nil
+}
+
+// applyContentTypes leaves out or moves planned links by the MIME type of
+// their source, as the content_types rules say. Recreated upstream symlinks
+// have no content of their own and are left alone. Like a rename, a move
+// onto another planned target fails the run.
+func applyContentTypes(plan []plannedLink, rules []config.ContentTypeRule) ([]plannedLink, error) {
+	if len(rules) == 0 {
+		return plan, nil
+	}
+	for _, rule := range rules {
+		if _, err := path.Match(rule.Type, ""); err != nil {
+			return nil, fmt.Errorf("invalid content_types type %q: %w", rule.Type, err)
+		}
+		if rule.Skip == (rule.To != "") {
+			return nil, fmt.Errorf("content_types rule for %s needs exactly one of skip and to", rule.Type)
+		}
+		if err := validatePath("overlay", rule.To); err != nil {
+			return nil, fmt.Errorf("invalid content_types to %q: %w", rule.To, err)
+		}
+	}
+
+	var kept []plannedLink
+	targets := newMovedTargets(len(plan))
+	for _, p := range plan {
+		rel := filepath.ToSlash(overlayRelPath(p.dst))
+		if p.preserve {
+			targets.add(rel, rel, false)
+			kept = append(kept, p)
+			continue
+		}
+		rule, detected, ok, err := contentTypeRule(p, rules)
+		if err != nil {
+			return nil, err
+		}
+		moved := false
+		switch {
+		case !ok:
+		case rule.Skip:
+			// On stderr, so plan --json stays a valid document
+			fmt.Fprintf(os.Stderr, "Content types: skipping %s (%s)\n", p.dst, detected)
+			continue
+		default:
+			p.dst = filepath.Join("overlay", rule.To, overlayRelPath(p.dst))
+			moved = true
+		}
+		target := filepath.ToSlash(overlayRelPath(p.dst))
+		if other, taken := targets.add(rel, target, moved); taken {
+			return nil, fmt.Errorf("content_types rules move %s and %s to the same target %s", other, rel, target)
+		}
+		kept = append(kept, p)
+	}
+	return kept, nil
+}
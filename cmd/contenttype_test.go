@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+func TestApplyContentTypes(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	files := map[string]string{
+		"bin/tool":        "\x7fELF\x02\x01\x01\x00",
+		"lib/tool.exe":    "MZ\x90\x00",
+		"src/README.md":   "# Readme\n",
+		"src/logo.png":    "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR",
+		"src/main.c":      "int main(void) { return 0; }\n",
+		"scripts/run":     "#!/bin/sh\necho hi\n",
+		"share/notes.txt": "plain text\n",
+	}
+	var plan []plannedLink
+	for name, content := range files {
+		src := filepath.Join(".upstream", name)
+		if err := os.MkdirAll(filepath.Dir(src), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(src, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		plan = append(plan, plannedLink{src: src, dst: filepath.Join("overlay", name)})
+	}
+
+	wantTypes := map[string]string{
+		"bin/tool":        "application/x-executable",
+		"lib/tool.exe":    "application/vnd.microsoft.portable-executable",
+		"src/README.md":   "text/markdown",
+		"src/logo.png":    "image/png",
+		"scripts/run":     "text/x-script",
+		"share/notes.txt": "text/plain",
+	}
+	for name, want := range wantTypes {
+		if got, err := contentType(filepath.Join(".upstream", name)); err != nil || got != want {
+			t.Errorf("contentType(%s) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		rules   []config.ContentTypeRule
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "skip binaries and move markdown",
+			rules: []config.ContentTypeRule{
+				{Type: "application/x-executable", Skip: true},
+				{Type: "application/vnd.microsoft.portable-executable", Skip: true},
+				{Type: "text/markdown", To: "docs"},
+			},
+			want: []string{"docs/src/README.md", "scripts/run", "share/notes.txt", "src/logo.png", "src/main.c"},
+		},
+		{
+			name:  "type glob limited by path",
+			rules: []config.ContentTypeRule{{Type: "image/*", Path: "src/**", Skip: true}, {Type: "text/*", Path: "share/**", To: "doc"}},
+			want:  []string{"bin/tool", "doc/share/notes.txt", "lib/tool.exe", "scripts/run", "src/README.md", "src/main.c"},
+		},
+		{
+			name:    "neither skip nor to",
+			rules:   []config.ContentTypeRule{{Type: "image/png"}},
+			wantErr: "exactly one of skip and to",
+		},
+		{
+			name:    "bad glob",
+			rules:   []config.ContentTypeRule{{Type: "image/[", Skip: true}},
+			wantErr: "invalid content_types type",
+		},
+		{
+			name:    "escape",
+			rules:   []config.ContentTypeRule{{Type: "text/*", To: "../out"}},
+			wantErr: "invalid content_types to",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyContentTypes(append([]plannedLink(nil), plan...), tt.rules)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("applyContentTypes() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyContentTypes() error = %v", err)
+			}
+			var targets []string
+			for _, p := range got {
+				targets = append(targets, overlayRelPath(p.dst))
+			}
+			sort.Strings(targets)
+			if !reflect.DeepEqual(targets, tt.want) {
+				t.Errorf("targets = %v, want %v", targets, tt.want)
+			}
+		})
+	}
+
+	// A move onto another planned target fails like a rename would
+	if err := os.MkdirAll(".upstream/more", 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(".upstream/more/notes.txt", []byte("other notes\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	collide := []plannedLink{
+		{src: ".upstream/share/notes.txt", dst: "overlay/share/notes.txt"},
+		{src: ".upstream/more/notes.txt", dst: "overlay/other/share/notes.txt"},
+	}
+	rules := []config.ContentTypeRule{{Type: "text/plain", Path: "share/**", To: "other"}}
+	if _, err := applyContentTypes(collide, rules); err == nil || !strings.Contains(err.Error(), "to the same target") {
+		t.Errorf("applyContentTypes() onto another target error = %v, want a collision", err)
+	}
+}
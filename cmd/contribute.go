@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/git"
+	"github.com/spf13/cobra"
+)
+
+// namedUpstream returns the config of a named upstream, empty for the main one
+func namedUpstream(cfg *config.Config, name string) (config.UpstreamConfig, error) {
+	if name == "" {
+		return cfg.Upstream, nil
+	}
+	for _, named := range cfg.Upstreams {
+		if named.Name == name {
+			return named.UpstreamConfig, nil
+		}
+	}
+	return config.UpstreamConfig{}, fmt.Errorf("unknown upstream %s", name)
+}
+
+// gitUpstreamDir returns the checkout of a named git upstream, empty for the
+// main one, for commands that only work with git
+func gitUpstreamDir(cfg *config.Config, name, command string) (string, error) {
+	upstream, err := namedUpstream(cfg, name)
+	if err != nil {
+		return "", err
+	}
+	dir := config.UpstreamDir(name)
+	if !upstream.IsGit() {
+		return "", fmt.Errorf("%s requires a git upstream, but %s is %s", command, dir, upstream.Type)
+	}
+	return dir, nil
+}
+
+var contributeCmd = &cobra.Command{
+	Use:   "contribute <overlay-path>...",
+	Short: "Commit local changes to managed files onto a branch of the upstream",
+	Long: `Commit the current content of managed overlay files, such as edited copies
+or pinned files, onto a new branch in the upstream checkout, off the synced
+commit. The checkout itself is left as it is, so the overlay keeps working and
+the parent repository still records the synced commit.
+
+The command to push the branch is printed, or run with --push.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		state, err := loadState(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+
+		// Map each upstream source to the overlay file holding its new content
+		files := make(map[string]string)
+		var sources []string
+		upstream := ""
+		for i, arg := range args {
+			rel := overlayArg(arg)
+			managed, mf := state.IsManagedFile(rel)
+			if !managed {
+				return fmt.Errorf("overlay/%s is not managed by git-overlay", rel)
+			}
+			if mf.Source == "" {
+				return fmt.Errorf("overlay/%s has no upstream source", rel)
+			}
+			if i > 0 && mf.Upstream != upstream {
+				return fmt.Errorf("overlay/%s comes from a different upstream than overlay/%s", rel, overlayArg(args[0]))
+			}
+			upstream = mf.Upstream
+
+			dst := filepath.Join("overlay", rel)
+			info, err := os.Stat(dst)
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return fmt.Errorf("%s is a directory; name the files to contribute", dst)
+			}
+			files[mf.Source] = dst
+			sources = append(sources, filepath.ToSlash(mf.Source))
+		}
+
+		dir, err := gitUpstreamDir(cfg, upstream, "contribute")
+		if err != nil {
+			return err
+		}
+
+		branch := flagString(cmd, "branch")
+		if branch == "" {
+			branch = "git-overlay/" + path.Base(sources[0])
+		}
+		message := flagString(cmd, "message")
+		if message == "" {
+			message = "Update " + strings.Join(sources, ", ")
+		}
+
+		commit, err := git.ContributeBranch(dir, branch, message, files)
+		if err != nil {
+			return fmt.Errorf("failed to commit to %s: %w", dir, err)
+		}
+		fmt.Printf("Committed %s to branch %s in %s\n", commit[:7], branch, dir)
+
+		push := []string{"-C", dir, "push", flagString(cmd, "remote"), branch}
+		if !flagBool(cmd, "push") {
+			fmt.Printf("Push it with:\n  git %s\n", strings.Join(push, " "))
+			return nil
+		}
+		if err := fetchCredentials(); err != nil {
+			return err
+		}
+		pushCmd := exec.Command("git", push...)
+		pushCmd.Env = git.UpstreamEnv()
+		pushCmd.Stdout = os.Stdout
+		pushCmd.Stderr = os.Stderr
+		if err := pushCmd.Run(); err != nil {
+			return fmt.Errorf("failed to push %s: %w", branch, err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	contributeCmd.Flags().StringP("branch", "b", "", "Branch to create in the upstream (default git-overlay/<file name>)")
+	contributeCmd.Flags().StringP("message", "m", "", "Commit message (default Update <paths>)")
+	contributeCmd.Flags().String("remote", "origin", "Remote of the upstream checkout to push to")
+	contributeCmd.Flags().Bool("push", false, "Push the branch instead of printing the push command")
+	rootCmd.AddCommand(contributeCmd)
+}
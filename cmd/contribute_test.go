@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestContribute(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	for _, env := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(env, "test")
+	}
+	for _, env := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(env, "test@example.com")
+	}
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	configContent := `upstream:
+  url: "https://example.com/repo.git"
+  ref: "main"
+symlinks:
+  - app.yml
+  - db.yml
+`
+	if err := os.WriteFile(".git-overlay.yml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+
+	// An upstream checkout with a remote to push to
+	if err := runGitCommand(".", []string{"init", "--bare", "-b", "main", "remote.git"}); err != nil {
+		t.Fatalf("Failed to init remote: %v", err)
+	}
+	if err := os.MkdirAll(".upstream", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+	if err := runGitCommand(".upstream", []string{"init", "-b", "main"}); err != nil {
+		t.Fatalf("Failed to init upstream: %v", err)
+	}
+	for _, name := range []string{"app.yml", "db.yml"} {
+		if err := os.WriteFile(".upstream/"+name, []byte("upstream"), 0644); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+	}
+	for _, args := range [][]string{{"add", "."}, {"commit", "-m", "Initial"}, {"remote", "add", "origin", "../remote.git"}} {
+		if err := runGitCommand(".upstream", args); err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+	}
+	head, _ := exec.Command("git", "-C", ".upstream", "rev-parse", "HEAD").Output()
+
+	// An edited copy and an untouched one
+	if err := os.MkdirAll("overlay", 0755); err != nil {
+		t.Fatalf("Failed to create overlay: %v", err)
+	}
+	if err := os.WriteFile("overlay/app.yml", []byte("fixed"), 0644); err != nil {
+		t.Fatalf("Failed to create copy: %v", err)
+	}
+	if err := os.WriteFile("overlay/db.yml", []byte("upstream"), 0644); err != nil {
+		t.Fatalf("Failed to create copy: %v", err)
+	}
+	state := &config.State{}
+	state.AddManagedFile("app.yml", "copy", "app.yml")
+	state.AddManagedFile("db.yml", "copy", "db.yml")
+	if err := state.SaveState(); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	newCmd := func(push bool) *cobra.Command {
+		cmd := &cobra.Command{RunE: contributeCmd.RunE}
+		cmd.Flags().String("config", ".git-overlay.yml", "")
+		cmd.Flags().String("branch", "", "")
+		cmd.Flags().String("message", "", "")
+		cmd.Flags().String("remote", "origin", "")
+		cmd.Flags().Bool("push", push, "")
+		return cmd
+	}
+
+	cmd := newCmd(false)
+	if err := cmd.RunE(cmd, []string{"overlay/db.yml"}); err == nil {
+		t.Error("contribute of an unchanged file succeeded")
+	}
+	if err := cmd.RunE(cmd, []string{"overlay/missing.yml"}); err == nil {
+		t.Error("contribute of an unmanaged file succeeded")
+	}
+
+	cmd = newCmd(true)
+	if err := cmd.RunE(cmd, []string{"overlay/app.yml", "overlay/db.yml"}); err != nil {
+		t.Fatalf("contribute error = %v", err)
+	}
+
+	// The branch holds the change and was pushed
+	for _, dir := range []string{".upstream", "remote.git"} {
+		out, err := exec.Command("git", "-C", dir, "show", "git-overlay/app.yml:app.yml").Output()
+		if err != nil || string(out) != "fixed" {
+			t.Errorf("app.yml on the branch in %s = %q, %v, want %q", dir, out, err, "fixed")
+		}
+	}
+	out, _ := exec.Command("git", "-C", ".upstream", "log", "-1", "--format=%s", "git-overlay/app.yml").Output()
+	if got := strings.TrimSpace(string(out)); got != "Update app.yml, db.yml" {
+		t.Errorf("commit message = %q", got)
+	}
+
+	// The checkout still has the synced commit and content
+	if now, _ := exec.Command("git", "-C", ".upstream", "rev-parse", "HEAD").Output(); string(now) != string(head) {
+		t.Errorf("HEAD moved from %s to %s", head, now)
+	}
+	if data, _ := os.ReadFile(".upstream/app.yml"); string(data) != "upstream" {
+		t.Errorf("upstream working tree changed: %q", data)
+	}
+
+	cmd = newCmd(false)
+	if err := cmd.RunE(cmd, []string{"overlay/app.yml"}); err == nil {
+		t.Error("contribute onto an existing branch succeeded")
+	}
+}
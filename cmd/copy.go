@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// copyBufferSize is the size of the buffers copies stream through
+const copyBufferSize = 256 * 1024
+
+// copyBuffers holds reusable copy buffers so large trees don't allocate one per file
+var copyBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, copyBufferSize)
+		return &buf
+	},
+}
+
+// deltaCopyMinSize is the size from which a refreshed copy is compared and
+// rewritten block by block; smaller copies that changed size are simply
+// written again
+const deltaCopyMinSize = 4 * copyBufferSize
+
+// refreshCopy brings the existing copy dst up to date with src in place,
+// writing only the blocks whose content differs and truncating what src no
+// longer has. An identical copy is not written at all, and a read-only one
+// stays read-only. It returns the number of bytes written.
+func refreshCopy(src, dst string) (int64, error) {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer srcFile.Close()
+	srcInfo, err := srcFile.Stat()
+	if err != nil {
+		return 0, err
+	}
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		return 0, err
+	}
+
+	// A copy protect_copies made read-only is opened for writing for the
+	// refresh and left read-only again
+	want := srcInfo.Mode().Perm()
+	if locked := dstInfo.Mode().Perm()&0200 == 0; locked {
+		if err := os.Chmod(dst, dstInfo.Mode().Perm()|0200); err != nil {
+			return 0, err
+		}
+		want &^= 0222
+		defer os.Chmod(dst, want)
+	}
+
+	if dstInfo.Size() != srcInfo.Size() && dstInfo.Size() < deltaCopyMinSize {
+		srcFile.Close()
+		if err := copyFile(src, dst); err != nil {
+			return 0, err
+		}
+		return srcInfo.Size(), os.Chmod(dst, want)
+	}
+
+	dstFile, err := os.OpenFile(dst, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer dstFile.Close()
+
+	srcBuf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(srcBuf)
+	dstBuf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(dstBuf)
+
+	var offset, written int64
+	for {
+		n, err := io.ReadFull(srcFile, *srcBuf)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return written, err
+		}
+		if n == 0 {
+			break
+		}
+		m, err := io.ReadFull(dstFile, (*dstBuf)[:n])
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return written, err
+		}
+		if m != n || !bytes.Equal((*srcBuf)[:n], (*dstBuf)[:n]) {
+			if _, err := dstFile.WriteAt((*srcBuf)[:n], offset); err != nil {
+				return written, err
+			}
+			written += int64(n)
+		}
+		offset += int64(n)
+		if _, err := dstFile.Seek(offset, io.SeekStart); err != nil {
+			return written, err
+		}
+	}
+	if dstInfo.Size() > offset {
+		if err := dstFile.Truncate(offset); err != nil {
+			return written, err
+		}
+	}
+	if dstInfo.Mode().Perm() != want {
+		return written, os.Chmod(dst, want)
+	}
+	return written, nil
+}
+
+// copyWorkers is how many files are copied at once
+var copyWorkers = runtime.GOMAXPROCS(0)
+
+// copyQueue runs copy jobs on a fixed number of workers, collecting errors
+// so one failed file doesn't hide the others
+type copyQueue struct {
+	jobs    chan func() error
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	errs    []error
+	pending map[string]bool
+	workers int
+}
+
+// newCopyQueue starts a queue with the given number of workers
+func newCopyQueue(workers int) *copyQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	q := &copyQueue{workers: workers}
+	q.start()
+	return q
+}
+
+// start launches the workers
+func (q *copyQueue) start() {
+	q.jobs = make(chan func() error)
+	q.pending = make(map[string]bool)
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for job := range q.jobs {
+				if err := job(); err != nil {
+					q.mu.Lock()
+					q.errs = append(q.errs, err)
+					q.mu.Unlock()
+				}
+			}
+		}()
+	}
+}
+
+// add queues a job writing dst
+func (q *copyQueue) add(dst string, job func() error) {
+	q.pending[dst] = true
+	q.jobs <- job
+}
+
+// queued reports whether a job writing dst hasn't been waited for yet
+func (q *copyQueue) queued(dst string) bool {
+	return q.pending[dst]
+}
+
+// wait blocks until every queued job has finished and returns their errors.
+// The queue can be used again afterwards.
+func (q *copyQueue) wait() error {
+	close(q.jobs)
+	q.wg.Wait()
+	err := errors.Join(q.errs...)
+	q.errs = nil
+	q.start()
+	return err
+}
+
+// close waits for the queued jobs and stops the workers
+func (q *copyQueue) close() error {
+	close(q.jobs)
+	q.wg.Wait()
+	return errors.Join(q.errs...)
+}
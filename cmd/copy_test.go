@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestCopyDir(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	dst := filepath.Join(t.TempDir(), "dst")
+
+	files := map[string]string{
+		"a.txt":         "a",
+		"sub/b.txt":     "b",
+		"sub/deep/c.sh": strings.Repeat("c", 3*copyBufferSize+7),
+	}
+	for name, content := range files {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(src, "sub/deep/c.sh"), 0755); err != nil {
+		t.Fatalf("Failed to chmod: %v", err)
+	}
+
+	if err := copyDir(src, dst); err != nil {
+		t.Fatalf("copyDir() error = %v", err)
+	}
+
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Errorf("Failed to read copied %s: %v", name, err)
+			continue
+		}
+		if string(got) != content {
+			t.Errorf("Copied %s has %d bytes, want %d", name, len(got), len(content))
+		}
+	}
+	info, err := os.Stat(filepath.Join(dst, "sub/deep/c.sh"))
+	if err != nil {
+		t.Fatalf("Failed to stat copy: %v", err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("Copied mode = %v, want 0755", info.Mode().Perm())
+	}
+}
+
+func TestCopyQueue(t *testing.T) {
+	q := newCopyQueue(3)
+
+	fail := errors.New("copy failed")
+	for i := 0; i < 10; i++ {
+		i := i
+		q.add(fmt.Sprint(i), func() error {
+			if i%4 == 0 {
+				return fail
+			}
+			return nil
+		})
+	}
+	if !q.queued("3") {
+		t.Error("queued() = false for a job not waited for")
+	}
+
+	err := q.wait()
+	if !errors.Is(err, fail) {
+		t.Fatalf("wait() error = %v, want the job errors", err)
+	}
+	if got := len(err.(interface{ Unwrap() []error }).Unwrap()); got != 3 {
+		t.Errorf("wait() collected %d errors, want 3", got)
+	}
+	if q.queued("3") {
+		t.Error("queued() = true after wait")
+	}
+
+	// The queue keeps working after a wait
+	q.add("next", func() error { return nil })
+	if err := q.close(); err != nil {
+		t.Errorf("close() error = %v", err)
+	}
+}
+
+func TestRefreshCopy(t *testing.T) {
+	large := strings.Repeat("a", deltaCopyMinSize+copyBufferSize/2)
+	changed := large[:copyBufferSize] + "b" + large[copyBufferSize+1:]
+
+	tests := []struct {
+		name        string
+		old         string
+		new         string
+		wantWritten int64
+	}{
+		{name: "identical", old: large, new: large, wantWritten: 0},
+		{name: "one block changed", old: large, new: changed, wantWritten: copyBufferSize},
+		{name: "grown", old: large, new: large + "tail", wantWritten: copyBufferSize/2 + 4},
+		{name: "shrunk", old: large, new: large[:deltaCopyMinSize], wantWritten: 0},
+		{name: "small file resized", old: "short", new: "longer", wantWritten: 6},
+		{name: "small file edited", old: "abc", new: "abd", wantWritten: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+			if err := os.WriteFile(src, []byte(tt.new), 0755); err != nil {
+				t.Fatalf("Failed to write source: %v", err)
+			}
+			if err := os.WriteFile(dst, []byte(tt.old), 0644); err != nil {
+				t.Fatalf("Failed to write copy: %v", err)
+			}
+
+			written, err := refreshCopy(src, dst)
+			if err != nil {
+				t.Fatalf("refreshCopy() error = %v", err)
+			}
+			if written != tt.wantWritten {
+				t.Errorf("refreshCopy() wrote %d bytes, want %d", written, tt.wantWritten)
+			}
+			got, err := os.ReadFile(dst)
+			if err != nil {
+				t.Fatalf("Failed to read copy: %v", err)
+			}
+			if string(got) != tt.new {
+				t.Errorf("Refreshed copy has %d bytes, want %d matching the source", len(got), len(tt.new))
+			}
+			info, err := os.Stat(dst)
+			if err != nil {
+				t.Fatalf("Failed to stat copy: %v", err)
+			}
+			if info.Mode().Perm() != 0755 {
+				t.Errorf("Refreshed mode = %v, want 0755", info.Mode().Perm())
+			}
+		})
+	}
+
+	// A copy protect_copies made read-only is refreshed and stays read-only
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	if err := os.WriteFile(src, []byte(changed), 0644); err != nil {
+		t.Fatalf("Failed to write source: %v", err)
+	}
+	if err := os.WriteFile(dst, []byte(large), 0444); err != nil {
+		t.Fatalf("Failed to write copy: %v", err)
+	}
+	if _, err := refreshCopy(src, dst); err != nil {
+		t.Fatalf("refreshCopy() of a read-only copy error = %v", err)
+	}
+	if got, _ := os.ReadFile(dst); string(got) != changed {
+		t.Error("Read-only copy was not refreshed")
+	}
+	if info, err := os.Stat(dst); err != nil || info.Mode().Perm() != 0444 {
+		t.Errorf("Read-only copy mode after refresh = %v, %v, want 0444", info.Mode().Perm(), err)
+	}
+}
+
+func TestRefreshManagedCopies(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+	cmd := &cobra.Command{}
+	cmd.Flags().String("link-mode", "copy", "")
+	cmd.Flags().Bool("force", true, "")
+	cfg := &config.Config{
+		Symlinks:  []config.SymlinkSpec{{String: "file.txt"}},
+		Checksums: true,
+	}
+	sync := func(upstream string) {
+		t.Helper()
+		if err := os.WriteFile(".upstream/file.txt", []byte(upstream), 0644); err != nil {
+			t.Fatalf("Failed to write upstream file: %v", err)
+		}
+		if err := CreateLinks(cmd, cfg); err != nil {
+			t.Fatalf("CreateLinks() error = %v", err)
+		}
+		if got, _ := os.ReadFile("overlay/file.txt"); string(got) != upstream {
+			t.Fatalf("overlay/file.txt = %q, want %q", got, upstream)
+		}
+	}
+	trashed := func() []string {
+		var contents []string
+		filepath.WalkDir(config.DefaultTrashDir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				data, _ := os.ReadFile(path)
+				contents = append(contents, string(data))
+			}
+			return nil
+		})
+		return contents
+	}
+
+	sync("v1")
+
+	// An untouched copy is refreshed in place and nothing is trashed
+	before, err := os.Stat("overlay/file.txt")
+	if err != nil {
+		t.Fatalf("Failed to stat copy: %v", err)
+	}
+	sync("v2")
+	after, err := os.Stat("overlay/file.txt")
+	if err != nil {
+		t.Fatalf("Failed to stat copy: %v", err)
+	}
+	if !os.SameFile(before, after) {
+		t.Error("Untouched copy was replaced instead of refreshed in place")
+	}
+	if got := trashed(); len(got) != 0 {
+		t.Errorf("Trash holds %q after refreshing an untouched copy", got)
+	}
+
+	// A copy edited locally goes to the trash before it is replaced
+	if err := os.WriteFile("overlay/file.txt", []byte("local edit"), 0644); err != nil {
+		t.Fatalf("Failed to edit copy: %v", err)
+	}
+	sync("v3")
+	if got := trashed(); len(got) != 1 || got[0] != "local edit" {
+		t.Errorf("Trash holds %q, want the local edit", got)
+	}
+}
@@ -0,0 +1,463 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+// defaultDaemonInterval is how often the daemon fetches the upstream
+const defaultDaemonInterval = 15 * time.Minute
+
+// Limits on how long a client may take to send a request, so slow or stalled
+// connections can't pile up
+const (
+	daemonReadHeaderTimeout = 10 * time.Second
+	daemonReadTimeout       = 30 * time.Second
+)
+
+// daemon keeps the upstream fetched and answers requests about the overlay.
+// The config and state are read again for every request on the socket, so
+// edits are picked up without a restart. The TCP listener serves a status
+// cached after each fetch and sync instead.
+type daemon struct {
+	cmd    *cobra.Command
+	listen bool       // Whether the status is cached for --listen
+	work   sync.Mutex // Held while fetching or syncing, which both use .upstream
+
+	mu        sync.Mutex // Guards the fields below
+	fetchedAt time.Time
+	report    *outdatedReport
+	fetchErr  error
+	public    *daemonStatus // Status served over --listen
+	publicErr error         // Why the status couldn't be refreshed
+}
+
+// daemonFile is a managed file that needs attention, with its status code
+type daemonFile struct {
+	Path string `json:"path"`
+	Code string `json:"code"`
+}
+
+// daemonStatus is the body of GET /status
+type daemonStatus struct {
+	Pin        string          `json:"pin"`       // Ref the upstream is synced to, including a sync --ref override
+	Commit     string          `json:"commit"`    // Commit the upstream is checked out at, as of the last fetch
+	BehindBy   int             `json:"behind_by"` // Commits the remote ref is ahead, as of the last fetch
+	FetchedAt  *time.Time      `json:"fetched_at,omitempty"`
+	FetchError string          `json:"fetch_error,omitempty"`
+	Upstream   *outdatedReport `json:"upstream,omitempty"`
+	Managed    int             `json:"managed"`
+	Drift      map[string]int  `json:"drift"` // Managed files needing attention, by status
+	Files      []daemonFile    `json:"files"`
+}
+
+// driftNames key the drift summary of GET /status by status code
+var driftNames = map[string]string{
+	statusMissing:   "missing",
+	statusModified:  "modified",
+	statusBroken:    "broken",
+	statusUntracked: "untracked",
+	statusPinned:    "pinned",
+}
+
+// fetch compares the upstream with its remote, which fetches the objects a
+// later sync needs without moving the checkout
+func (d *daemon) fetch() {
+	d.work.Lock()
+	defer d.work.Unlock()
+	d.fetchLocked()
+}
+
+// fetchLocked is fetch for callers already holding work
+func (d *daemon) fetchLocked() {
+	cfg, err := loadConfig(d.cmd)
+	var report *outdatedReport
+	if err == nil {
+		report, err = checkOutdated(cfg.Upstream)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to fetch upstream: %v\n", err)
+	}
+
+	d.mu.Lock()
+	d.fetchedAt = time.Now()
+	d.report = report
+	d.fetchErr = err
+	d.mu.Unlock()
+	d.refreshPublic()
+}
+
+// refreshPublic caches the status served over --listen, so requests from the
+// network never read the config or state. Fetch errors, which can hold URLs
+// and local paths, are reduced to the fact that the fetch failed.
+func (d *daemon) refreshPublic() {
+	if !d.listen {
+		return
+	}
+	st, err := d.status()
+	if err == nil && st.FetchError != "" {
+		st.FetchError = "failed to fetch upstream"
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.public, d.publicErr = st, err
+}
+
+// sync brings the upstreams to their configured refs and relinks overlay/,
+// as the sync command does
+func (d *daemon) sync() error {
+	d.work.Lock()
+	defer d.work.Unlock()
+
+	cfg, err := loadConfig(d.cmd)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	// Each sync takes the repository lock so it can't run under a manual one
+	lock, err := acquireRepoLock("daemon sync")
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	if err := checkDirty(d.cmd, cfg); err != nil {
+		return err
+	}
+	if err := syncAllUpstreams(cfg, syncOptions{jobs: defaultSyncJobs}); err != nil {
+		return err
+	}
+	if err := CreateLinks(d.cmd, cfg); err != nil {
+		return fmt.Errorf("failed to rebuild links: %w", err)
+	}
+	if err := recordRefOverride(cfg, ""); err != nil {
+		return err
+	}
+	// The synced commit is now the current one
+	d.fetchLocked()
+	return nil
+}
+
+// status reports the last fetch and the managed files that need attention
+func (d *daemon) status() (*daemonStatus, error) {
+	cfg, err := loadConfig(d.cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	state, err := loadState(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+
+	st := &daemonStatus{Pin: cfg.Upstream.Ref, Drift: make(map[string]int), Files: []daemonFile{}}
+	if state.RefOverride != "" {
+		st.Pin = state.RefOverride
+	}
+	for _, name := range driftNames {
+		st.Drift[name] = 0
+	}
+	for _, fs := range collectStatus(cfg, state) {
+		st.Managed++
+		if fs.Code != statusOK {
+			st.Drift[driftNames[fs.Code]]++
+			st.Files = append(st.Files, daemonFile{Path: fs.Path, Code: fs.Code})
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.fetchedAt.IsZero() {
+		fetchedAt := d.fetchedAt
+		st.FetchedAt = &fetchedAt
+	}
+	if d.fetchErr != nil {
+		st.FetchError = d.fetchErr.Error()
+	}
+	if d.report != nil {
+		st.Upstream = d.report
+		st.Commit = d.report.Current
+		st.BehindBy = d.report.CommitsBehind
+	}
+	return st, nil
+}
+
+// health reports whether the config loads and the last fetch worked
+func (d *daemon) health() error {
+	if _, err := loadConfig(d.cmd); err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fetchErr != nil {
+		return fmt.Errorf("failed to fetch upstream: %w", d.fetchErr)
+	}
+	return nil
+}
+
+// manifest describes the upstreams and managed files as the manifest command does
+func (d *daemon) manifest() (*overlayManifest, error) {
+	cfg, err := loadConfig(d.cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	state, err := loadState(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+	return buildManifest(cfg, state)
+}
+
+// handler routes the daemon's API. Without control, only the read-only
+// /healthz and /status are served, from the cached status and without error
+// details, for dashboards polling over the network.
+func (d *daemon) handler(control bool) http.Handler {
+	mux := http.NewServeMux()
+	if !control {
+		mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+			d.mu.Lock()
+			healthy := d.public != nil && d.publicErr == nil && d.fetchErr == nil
+			d.mu.Unlock()
+			if !healthy {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				json.NewEncoder(w).Encode(map[string]string{"status": "unhealthy"})
+				return
+			}
+			writeDaemonResponse(w, map[string]string{"status": "ok"}, nil)
+		})
+		mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+			d.mu.Lock()
+			st := d.public
+			d.mu.Unlock()
+			if st == nil {
+				writeDaemonResponse(w, nil, errors.New("status unavailable"))
+				return
+			}
+			writeDaemonResponse(w, st, nil)
+		})
+		return mux
+	}
+
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := d.health(); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"status": "unhealthy", "error": err.Error()})
+			return
+		}
+		writeDaemonResponse(w, map[string]string{"status": "ok"}, nil)
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		st, err := d.status()
+		writeDaemonResponse(w, st, err)
+	})
+	mux.HandleFunc("GET /manifest", func(w http.ResponseWriter, r *http.Request) {
+		m, err := d.manifest()
+		writeDaemonResponse(w, m, err)
+	})
+	mux.HandleFunc("POST /sync", func(w http.ResponseWriter, r *http.Request) {
+		err := d.sync()
+		writeDaemonResponse(w, map[string]bool{"synced": err == nil}, err)
+	})
+	return mux
+}
+
+// writeDaemonResponse writes v as JSON, or err as {"error": ...} with a
+// status that tells a refused sync from a failed one
+func writeDaemonResponse(w http.ResponseWriter, v interface{}, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, overlayerr.ErrConflict) || errors.Is(err, overlayerr.ErrLocked) {
+			code = http.StatusConflict
+		}
+		w.WriteHeader(code)
+		v = map[string]string{"error": err.Error()}
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+// defaultDaemonSocket is the socket path inside the git directory, which
+// keeps it out of the worktree
+func defaultDaemonSocket() (string, error) {
+	dir, err := config.GitDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "git-overlay", "daemon.sock"), nil
+}
+
+// listenAddress fills in 127.0.0.1 for a --listen address without a host, so
+// the status is only served beyond this machine when asked for explicitly
+func listenAddress(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid --listen address %s: %w", addr, err)
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// listenSocket listens on a Unix socket, replacing one left behind by a
+// daemon that did not shut down but refusing to take over a running one
+func listenSocket(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a daemon is already listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	// Only the user running the daemon may trigger syncs
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	l, err := listenUnix(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to restrict socket: %w", err)
+	}
+	return l, nil
+}
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Keep the upstream fetched and serve overlay state on a local socket",
+	Long: `Run in the foreground, fetching the upstream every --interval and serving a
+JSON API over HTTP on a Unix socket, so editors and build servers can query the
+overlay without starting the CLI for every question:
+
+  GET  /healthz    200 while the config loads and fetching works, else 503
+  GET  /status     the pinned ref and commit, how far the upstream is behind,
+                   a count of drifted managed files by status and the files
+                   themselves (codes as in status --porcelain)
+  GET  /manifest   the provenance manifest, as 'manifest' prints it
+  POST /sync       sync the upstreams and relink overlay/
+
+Fetching only downloads objects; overlay/ changes only on POST /sync. The
+socket defaults to git-overlay/daemon.sock in the git directory and is
+readable by the current user only. An interval of 0 disables fetching.
+
+With --listen, /healthz and /status are also served over TCP for dashboards
+that aggregate many repositories; /manifest and /sync stay on the socket. An
+address without a host, such as :8080, listens on 127.0.0.1 only; give
+0.0.0.0:8080 to serve other machines. The TCP status is the one cached at the
+last fetch or sync, with fetch errors reduced to a note that the fetch failed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := loadConfig(cmd); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if err := applyTransportOptions(cmd); err != nil {
+			return err
+		}
+
+		interval, err := cmd.Flags().GetDuration("interval")
+		if err != nil {
+			return err
+		}
+		socket := flagString(cmd, "socket")
+		if socket == "" {
+			if socket, err = defaultDaemonSocket(); err != nil {
+				return err
+			}
+		}
+
+		l, err := listenSocket(socket)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(socket)
+
+		d := &daemon{cmd: cmd}
+		newServer := func(h http.Handler) *http.Server {
+			return &http.Server{Handler: h, ReadHeaderTimeout: daemonReadHeaderTimeout, ReadTimeout: daemonReadTimeout}
+		}
+		servers := []*http.Server{newServer(d.handler(true))}
+		listeners := []net.Listener{l}
+		if listen := flagString(cmd, "listen"); listen != "" {
+			addr, err := listenAddress(listen)
+			if err != nil {
+				return err
+			}
+			tcp, err := net.Listen("tcp", addr)
+			if err != nil {
+				return fmt.Errorf("failed to listen on %s: %w", addr, err)
+			}
+			// Served until the first fetch replaces it
+			d.listen = true
+			d.refreshPublic()
+			servers = append(servers, newServer(d.handler(false)))
+			listeners = append(listeners, tcp)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if interval > 0 {
+			go func() {
+				ticker := time.NewTicker(interval)
+				defer ticker.Stop()
+				for {
+					d.fetch()
+					select {
+					case <-ctx.Done():
+						return
+					case <-ticker.C:
+					}
+				}
+			}()
+		}
+
+		go func() {
+			<-ctx.Done()
+			shutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			for _, server := range servers {
+				server.Shutdown(shutdown)
+			}
+		}()
+
+		errs := make(chan error, len(servers))
+		for i, server := range servers {
+			fmt.Printf("Serving on %s\n", listeners[i].Addr())
+			go func() { errs <- server.Serve(listeners[i]) }()
+		}
+		// One server failing stops the other
+		var serveErr error
+		for range servers {
+			if err := <-errs; err != nil && err != http.ErrServerClosed && serveErr == nil {
+				serveErr = fmt.Errorf("daemon stopped: %w", err)
+				stop()
+			}
+		}
+		return serveErr
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	daemonCmd.Flags().Duration("interval", defaultDaemonInterval, "How often to fetch the upstream (0 to never fetch)")
+	daemonCmd.Flags().String("listen", "", "Also serve the read-only /healthz and /status on this TCP address, e.g. 127.0.0.1:8080 (a bare :port listens on 127.0.0.1)")
+	daemonCmd.Flags().String("socket", "", "Unix socket to serve on (default git-overlay/daemon.sock in the git directory)")
+	daemonCmd.Flags().Bool("allow-dirty", false, "Let POST /sync run with uncommitted changes under overlay/ or to the bookkeeping files")
+	addTransportFlags(daemonCmd)
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestDaemonHandler(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script providers are not supported on windows")
+	}
+
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$1\" in\nresolve) echo \"$2\" ;;\nfetch) echo \"$2\" > \"$3/version.txt\" ;;\nesac\n"
+	if err := os.WriteFile(filepath.Join(binDir, "git-overlay-provider-fake"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write provider: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	configContent := `upstream:
+  type: fake
+  ref: v1
+link_mode: copy
+symlinks:
+  - version.txt
+`
+	if err := os.WriteFile(".git-overlay.yml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("config", ".git-overlay.yml", "")
+	cmd.Flags().String("link-mode", "symlink", "")
+	cmd.Flags().Bool("force", false, "")
+	d := &daemon{cmd: cmd, listen: true}
+	server := httptest.NewServer(d.handler(true))
+	defer server.Close()
+	public := httptest.NewServer(d.handler(false))
+	defer public.Close()
+
+	// get decodes the JSON body of a request, checking its status code
+	get := func(t *testing.T, method, url string, wantCode int, v interface{}) {
+		t.Helper()
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s error = %v", method, url, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != wantCode {
+			t.Fatalf("%s %s status = %d, want %d", method, url, resp.StatusCode, wantCode)
+		}
+		if v != nil {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatalf("Failed to decode %s: %v", url, err)
+			}
+		}
+	}
+
+	var before daemonStatus
+	get(t, http.MethodGet, server.URL+"/status", http.StatusOK, &before)
+	if before.Managed != 0 || before.FetchedAt != nil || before.Upstream != nil || before.Pin != "v1" {
+		t.Errorf("status before sync = %+v, want v1 pinned and nothing managed or fetched", before)
+	}
+	get(t, http.MethodGet, server.URL+"/healthz", http.StatusOK, nil)
+
+	get(t, http.MethodGet, server.URL+"/sync", http.StatusMethodNotAllowed, nil)
+
+	var synced map[string]bool
+	get(t, http.MethodPost, server.URL+"/sync", http.StatusOK, &synced)
+	if !synced["synced"] {
+		t.Errorf("sync = %v, want synced", synced)
+	}
+	data, err := os.ReadFile("overlay/version.txt")
+	if err != nil || string(data) != "v1\n" {
+		t.Errorf("overlay/version.txt = %q, %v; want v1", data, err)
+	}
+
+	var after daemonStatus
+	get(t, http.MethodGet, server.URL+"/status", http.StatusOK, &after)
+	if after.Managed != 1 || len(after.Files) != 0 {
+		t.Errorf("status after sync = %+v, want one clean managed file", after)
+	}
+	if after.FetchedAt == nil || after.Upstream == nil || after.Commit != "v1" || !after.Upstream.Outdated {
+		t.Errorf("upstream after sync = %+v, want v1 compared with latest", after.Upstream)
+	}
+	if after.Drift["modified"] != 0 || len(after.Drift) != len(driftNames) {
+		t.Errorf("drift after sync = %v, want every status at zero", after.Drift)
+	}
+
+	if err := os.WriteFile("overlay/version.txt", []byte("edited\n"), 0644); err != nil {
+		t.Fatalf("Failed to edit overlay file: %v", err)
+	}
+	var edited daemonStatus
+	get(t, http.MethodGet, server.URL+"/status", http.StatusOK, &edited)
+	if len(edited.Files) != 1 || edited.Files[0].Path != "version.txt" || edited.Files[0].Code != statusModified {
+		t.Errorf("files after edit = %+v, want version.txt modified", edited.Files)
+	}
+	if edited.Drift["modified"] != 1 {
+		t.Errorf("drift after edit = %v, want one modified", edited.Drift)
+	}
+
+	// The network listener only reports, from the status cached at the
+	// last fetch or sync
+	get(t, http.MethodGet, public.URL+"/healthz", http.StatusOK, nil)
+	var publicStatus daemonStatus
+	get(t, http.MethodGet, public.URL+"/status", http.StatusOK, &publicStatus)
+	if publicStatus.Drift["modified"] != 0 {
+		t.Errorf("public drift before refresh = %v, want the cached status", publicStatus.Drift)
+	}
+	d.refreshPublic()
+	get(t, http.MethodGet, public.URL+"/status", http.StatusOK, &publicStatus)
+	if publicStatus.Drift["modified"] != 1 {
+		t.Errorf("public drift = %v, want one modified", publicStatus.Drift)
+	}
+	get(t, http.MethodPost, public.URL+"/sync", http.StatusNotFound, nil)
+	get(t, http.MethodGet, public.URL+"/manifest", http.StatusNotFound, nil)
+
+	// A failed fetch makes the daemon unhealthy, without its details leaving
+	// the machine
+	d.fetchErr = errors.New("remote /home/me/upstream unreachable")
+	get(t, http.MethodGet, public.URL+"/healthz", http.StatusServiceUnavailable, nil)
+	d.refreshPublic()
+	get(t, http.MethodGet, public.URL+"/status", http.StatusOK, &publicStatus)
+	if publicStatus.FetchError != "failed to fetch upstream" {
+		t.Errorf("public fetch_error = %q, want it without details", publicStatus.FetchError)
+	}
+	d.fetchErr = nil
+
+	var m overlayManifest
+	get(t, http.MethodGet, server.URL+"/manifest", http.StatusOK, &m)
+	if len(m.Files) != 1 || m.Files[0].Path != "overlay/version.txt" {
+		t.Errorf("manifest files = %+v, want overlay/version.txt", m.Files)
+	}
+}
+
+func TestListenSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not tested on windows")
+	}
+
+	// Unix socket paths are limited to about 100 bytes, shorter than some temp dirs
+	dir, err := os.MkdirTemp("", "gov")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sub", "d.sock")
+
+	l, err := listenSocket(path)
+	if err != nil {
+		t.Fatalf("listenSocket() error = %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, %v; want 0600", info, err)
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("socket directory mode = %v, %v; want 0700", info, err)
+	}
+
+	if _, err := listenSocket(path); err == nil {
+		t.Error("listenSocket() on a socket in use succeeded, want error")
+	}
+
+	// A socket left behind by a daemon that died is replaced
+	l.(interface{ SetUnlinkOnClose(bool) }).SetUnlinkOnClose(false)
+	l.Close()
+	l, err = listenSocket(path)
+	if err != nil {
+		t.Fatalf("listenSocket() over a stale socket error = %v", err)
+	}
+	l.Close()
+}
+
+func TestListenAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{addr: ":8080", want: "127.0.0.1:8080"},
+		{addr: "0.0.0.0:8080", want: "0.0.0.0:8080"},
+		{addr: "[::1]:8080", want: "[::1]:8080"},
+		{addr: "8080", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := listenAddress(tt.addr)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("listenAddress(%q) = %q, %v, want %q", tt.addr, got, err, tt.want)
+		}
+	}
+}
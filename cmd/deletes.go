@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/git"
+)
+
+// specForSource returns the spec that links a managed file's source
+func specForSource(specs []config.SymlinkSpec, mf config.ManagedFile) *config.SymlinkSpec {
+	source := filepath.ToSlash(mf.Source)
+	for i, link := range specs {
+		from := specSource(link)
+		if link.Upstream == mf.Upstream && (source == from || strings.HasPrefix(source, from+"/")) {
+			return &specs[i]
+		}
+	}
+	return nil
+}
+
+// upstreamDelete is a managed file whose upstream source is gone, with the
+// on_upstream_delete policy of the spec that linked it
+type upstreamDelete struct {
+	file   config.ManagedFile
+	src    string
+	policy string
+}
+
+// upstreamDeletes finds the managed files whose upstream source is gone and
+// that nothing links anymore
+func upstreamDeletes(specs []config.SymlinkSpec, plan []plannedLink, state *config.State, only *onlyFilter) ([]upstreamDelete, error) {
+	planned := make(map[string]bool, len(plan))
+	for _, p := range plan {
+		planned[overlayRelPath(p.dst)] = true
+	}
+
+	var deletes []upstreamDelete
+	for _, mf := range state.ManagedFiles {
+		// Entries from dirs:, generate: and meta_file have no upstream source
+		if mf.Pinned || mf.Source == "" || planned[mf.Path] {
+			continue
+		}
+		// A run limited with --only or --component leaves the rest of the
+		// overlay alone
+		if only != nil && !only.matchFile(mf) {
+			continue
+		}
+		src := filepath.Join(config.UpstreamDir(mf.Upstream), mf.Source)
+		if _, err := os.Lstat(src); err == nil {
+			continue
+		}
+		spec := specForSource(specs, mf)
+		if spec == nil {
+			// No longer configured, which status reports
+			continue
+		}
+
+		policy := spec.OnUpstreamDelete
+		switch policy {
+		case "":
+			policy = OnUpstreamDeleteWarn
+		case OnUpstreamDeleteWarn, OnUpstreamDeleteKeep, OnUpstreamDeleteRemove:
+		default:
+			return nil, fmt.Errorf("unknown on_upstream_delete policy: %s", policy)
+		}
+		deletes = append(deletes, upstreamDelete{file: mf, src: src, policy: policy})
+	}
+	return deletes, nil
+}
+
+// applyUpstreamDeletes applies each spec's on_upstream_delete policy to
+// managed files whose upstream source is gone and that nothing links anymore
+func applyUpstreamDeletes(specs []config.SymlinkSpec, plan []plannedLink, state *config.State, opts linkOptions) error {
+	deletes, err := upstreamDeletes(specs, plan, state, opts.only)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deletes {
+		mf, src := d.file, d.src
+		dst := filepath.Join("overlay", mf.Path)
+		switch d.policy {
+		case OnUpstreamDeleteWarn:
+			fmt.Fprintf(os.Stderr, "Warning: %s was deleted upstream, leaving %s as it is\n", src, dst)
+		case OnUpstreamDeleteKeep:
+			if err := keepDeleted(state, mf); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %s was deleted upstream and %s can't be kept: %v\n", src, dst, err)
+				continue
+			}
+			fmt.Printf("Keeping %s as a pinned copy, %s was deleted upstream\n", dst, src)
+		case OnUpstreamDeleteRemove:
+			if matchAnyGlob(opts.protect, dst) {
+				fmt.Printf("Skipping protected path: %s\n", dst)
+				continue
+			}
+			if _, err := os.Lstat(dst); err == nil {
+				setWritable(dst, true)
+				if err := opts.trash.remove(dst); err != nil {
+					return fmt.Errorf("failed to remove %s: %w", dst, err)
+				}
+			}
+			state.RemoveManagedFile(mf.Path)
+			fmt.Printf("Removed %s, %s was deleted upstream\n", dst, src)
+		}
+	}
+	return nil
+}
+
+// keepDeleted pins the last materialized content of a file deleted upstream.
+// Symlinks have nothing left to point to, so their content is recovered from
+// the upstream history.
+func keepDeleted(state *config.State, mf config.ManagedFile) error {
+	dst := filepath.Join("overlay", mf.Path)
+	if info, err := os.Stat(dst); err == nil && info.Mode().IsRegular() {
+		return pinFile(state, mf.Path)
+	}
+
+	content, err := git.DeletedFileContent(config.UpstreamDir(mf.Upstream), mf.Source)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", dst, err)
+	}
+	if err := os.WriteFile(dst, content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+	state.SetPinned(mf.Path, true)
+	return nil
+}
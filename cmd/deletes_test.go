@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestApplyUpstreamDeletes(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		protect    []string
+		wantFile   bool
+		wantPinned bool
+		wantState  bool
+	}{
+		{name: "warn by default", policy: "", wantFile: true, wantState: true},
+		{name: "keep", policy: OnUpstreamDeleteKeep, wantFile: true, wantPinned: true, wantState: true},
+		{name: "remove", policy: OnUpstreamDeleteRemove},
+		{name: "remove protected", policy: OnUpstreamDeleteRemove, protect: []string{"overlay/config/old.yml"}, wantFile: true, wantState: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+			originalDir, err := os.Getwd()
+			if err != nil {
+				t.Fatalf("Failed to get current directory: %v", err)
+			}
+			if err := os.Chdir(tmpDir); err != nil {
+				t.Fatalf("Failed to change to temp directory: %v", err)
+			}
+			defer os.Chdir(originalDir)
+
+			if err := os.MkdirAll(".upstream/config", 0755); err != nil {
+				t.Fatalf("Failed to create upstream directory: %v", err)
+			}
+			for _, name := range []string{"app.yml", "old.yml"} {
+				if err := os.WriteFile(".upstream/config/"+name, []byte(name), 0644); err != nil {
+					t.Fatalf("Failed to create source file: %v", err)
+				}
+			}
+
+			cfg := &config.Config{
+				Symlinks: []config.SymlinkSpec{{From: "config", To: "config", OnUpstreamDelete: tt.policy}},
+				Trash:    config.TrashConfig{Enabled: new(bool)},
+				Clean:    config.CleanConfig{Protect: tt.protect},
+			}
+			cmd := &cobra.Command{}
+			cmd.Flags().String("link-mode", "copy", "")
+			cmd.Flags().Bool("force", true, "")
+			if err := CreateLinks(cmd, cfg); err != nil {
+				t.Fatalf("CreateLinks() error = %v", err)
+			}
+
+			if err := os.Remove(".upstream/config/old.yml"); err != nil {
+				t.Fatalf("Failed to delete source file: %v", err)
+			}
+			if err := CreateLinks(cmd, cfg); err != nil {
+				t.Fatalf("CreateLinks() after deletion error = %v", err)
+			}
+
+			data, err := os.ReadFile("overlay/config/old.yml")
+			if tt.wantFile && (err != nil || string(data) != "old.yml") {
+				t.Errorf("overlay/config/old.yml = %q, %v, want the last content", data, err)
+			}
+			if !tt.wantFile && err == nil {
+				t.Error("overlay/config/old.yml was not removed")
+			}
+
+			state, err := config.LoadState()
+			if err != nil {
+				t.Fatalf("Failed to load state: %v", err)
+			}
+			if managed, _ := state.IsManagedFile("config/old.yml"); managed != tt.wantState {
+				t.Errorf("managed = %v, want %v", managed, tt.wantState)
+			}
+			if got := state.IsPinned("config/old.yml"); got != tt.wantPinned {
+				t.Errorf("pinned = %v, want %v", got, tt.wantPinned)
+			}
+		})
+	}
+}
+
+func TestKeepDeletedSymlink(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream/docs", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+	if err := runGitCommand(".upstream", []string{"init", "-b", "main"}); err != nil {
+		t.Fatalf("Failed to init upstream: %v", err)
+	}
+	if err := os.WriteFile(".upstream/docs/guide.md", []byte("guide"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := runGitCommand(".upstream", []string{"add", "."}); err != nil {
+		t.Fatalf("Failed to add file: %v", err)
+	}
+	if err := runGitCommand(".upstream", []string{"commit", "-m", "Add guide"}); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	cfg := &config.Config{
+		Symlinks: []config.SymlinkSpec{{From: "docs/guide.md", To: "docs/guide.md", OnUpstreamDelete: OnUpstreamDeleteKeep}},
+	}
+	cmd := &cobra.Command{}
+	cmd.Flags().String("link-mode", "symlink", "")
+	cmd.Flags().Bool("force", true, "")
+	if err := CreateLinks(cmd, cfg); err != nil {
+		t.Fatalf("CreateLinks() error = %v", err)
+	}
+
+	// The upstream drops the file, leaving the symlink dangling
+	if err := runGitCommand(".upstream", []string{"rm", "-q", "docs/guide.md"}); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if err := runGitCommand(".upstream", []string{"commit", "-m", "Remove guide"}); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if err := CreateLinks(cmd, cfg); err != nil {
+		t.Fatalf("CreateLinks() after deletion error = %v", err)
+	}
+
+	info, err := os.Lstat("overlay/docs/guide.md")
+	if err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("overlay/docs/guide.md is not a regular file: %v", err)
+	}
+	if data, _ := os.ReadFile("overlay/docs/guide.md"); string(data) != "guide" {
+		t.Errorf("overlay/docs/guide.md = %q, want %q", data, "guide")
+	}
+	state, err := config.LoadState()
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if !state.IsPinned("docs/guide.md") {
+		t.Error("kept file is not pinned")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package cmd
+
+// deviceID is not implemented outside Unix, so files are never known to share
+// a device
+func deviceID(path string) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/git"
+)
+
+// overlayChange is a target in overlay/ that a change of upstream ref would affect
+type overlayChange struct {
+	Target string `json:"target"`
+	Source string `json:"source"`
+	Action string `json:"action"`           // added, removed or changed
+	Pinned bool   `json:"pinned,omitempty"` // Kept as it is by sync
+}
+
+// specTargets returns the overlay/ targets the specs of an upstream would
+// link a source path to
+func specTargets(specs []config.SymlinkSpec, upstream, source string) []string {
+	var targets []string
+	for _, link := range specs {
+		if link.Upstream != upstream {
+			continue
+		}
+		from, to := specSource(link), specTarget(link)
+		switch {
+		case source == from:
+			targets = append(targets, filepath.Join("overlay", to))
+		case strings.HasPrefix(source, from+"/"):
+			targets = append(targets, filepath.Join("overlay", to, strings.TrimPrefix(source, from+"/")))
+		}
+	}
+	return targets
+}
+
+// overlayImpact filters upstream changes through the specs, keeping those
+// that would change a file in overlay/
+func overlayImpact(cfg *config.Config, specs []config.SymlinkSpec, state *config.State, upstream string, changes []git.TreeChange) []overlayChange {
+	// Invalid rename rules fail the plan of a sync; here they rename nothing
+	renames, err := newRenamer(cfg.Rename)
+	if err != nil {
+		renames = &renamer{}
+	}
+	var impact []overlayChange
+	for _, c := range changes {
+		src := filepath.Join(config.UpstreamDir(upstream), c.Path)
+		for _, dst := range specTargets(specs, upstream, c.Path) {
+			if renamed, ok := renames.target(overlayRelPath(dst)); ok {
+				dst = filepath.Join("overlay", filepath.FromSlash(renamed))
+			}
+			p := plannedLink{src: src, dst: dst, upstream: upstream}
+			if _, blocked := blockedBy(p, cfg.BlockedPaths); blocked {
+				continue
+			}
+			change := overlayChange{Target: filepath.ToSlash(dst), Source: c.Path, Action: c.Action}
+			if managed, mf := state.IsManagedFile(overlayRelPath(dst)); managed && mf.Pinned {
+				change.Pinned = true
+			}
+			impact = append(impact, change)
+		}
+	}
+	sort.Slice(impact, func(i, j int) bool { return impact[i].Target < impact[j].Target })
+	return impact
+}
+
+// changeCodes are the letters diff-ref prints for each kind of change, as in git status
+var changeCodes = map[string]string{
+	git.ChangeAdded:   "A",
+	git.ChangeChanged: "M",
+	git.ChangeRemoved: "D",
+}
+
+var diffRefCmd = &cobra.Command{
+	Use:   "diff-ref <from> <to>",
+	Short: "Show which overlay files would change between two upstream refs",
+	Long: `Compare two refs of a git upstream and report the files in overlay/ that would
+be added, removed or changed by moving from one to the other, as the specs in
+the config link them. Nothing is checked out or linked; the refs must already
+be in the upstream clone unless --fetch is given, which fetches origin's
+branches and tags into it.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if err := applyTransportOptions(cmd); err != nil {
+			return err
+		}
+
+		name := flagString(cmd, "upstream")
+		dir, err := gitUpstreamDir(cfg, name, "diff-ref")
+		if err != nil {
+			return err
+		}
+
+		changes, err := git.DiffRefs(dir, args[0], args[1], flagBool(cmd, "fetch"))
+		if err != nil {
+			return err
+		}
+
+		specs, err := applyConditions(cmd, cfg, cfg.Symlinks)
+		if err != nil {
+			return err
+		}
+		state, err := loadState(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+		impact := overlayImpact(cfg, specs, state, name, changes)
+
+		if flagBool(cmd, "json") {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if impact == nil {
+				impact = []overlayChange{}
+			}
+			return enc.Encode(impact)
+		}
+
+		counts := make(map[string]int)
+		for _, c := range impact {
+			counts[c.Action]++
+			note := ""
+			if c.Pinned {
+				note = " (pinned, kept as it is)"
+			}
+			fmt.Printf("%s %s%s\n", changeCodes[c.Action], c.Target, note)
+		}
+		fmt.Printf("%d overlay files affected between %s and %s (%d added, %d changed, %d removed); %d upstream files changed\n",
+			len(impact), args[0], args[1], counts[git.ChangeAdded], counts[git.ChangeChanged], counts[git.ChangeRemoved], len(changes))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffRefCmd)
+	diffRefCmd.Flags().String("upstream", "", "Named upstream to compare (default the main upstream)")
+	diffRefCmd.Flags().Bool("fetch", false, "Fetch origin's branches and tags into the upstream clone first")
+	diffRefCmd.Flags().Bool("json", false, "Print the affected files as JSON")
+	addTransportFlags(diffRefCmd)
+}
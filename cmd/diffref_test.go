@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/git"
+)
+
+func TestOverlayImpact(t *testing.T) {
+	cfg := &config.Config{
+		BlockedPaths: []config.BlockedPath{{Path: "**/.github/**"}},
+	}
+	specs := []config.SymlinkSpec{
+		{String: "src"},
+		{From: "docs/guide.md", To: "guide.md"},
+		{String: "lib", Upstream: "vendor"},
+	}
+	state := &config.State{}
+	state.AddManagedFile("src/pinned.go", "copy", "src/pinned.go")
+	state.SetPinned("src/pinned.go", true)
+
+	changes := []git.TreeChange{
+		{Path: "README.md", Action: git.ChangeChanged},
+		{Path: "docs/guide.md", Action: git.ChangeChanged},
+		{Path: "lib/util.go", Action: git.ChangeChanged},
+		{Path: "src/.github/ci.yml", Action: git.ChangeAdded},
+		{Path: "src/main.go", Action: git.ChangeAdded},
+		{Path: "src/old.go", Action: git.ChangeRemoved},
+		{Path: "src/pinned.go", Action: git.ChangeChanged},
+		{Path: "srcs/other.go", Action: git.ChangeAdded},
+	}
+
+	got := overlayImpact(cfg, specs, state, "", changes)
+	want := []overlayChange{
+		{Target: "overlay/guide.md", Source: "docs/guide.md", Action: git.ChangeChanged},
+		{Target: "overlay/src/main.go", Source: "src/main.go", Action: git.ChangeAdded},
+		{Target: "overlay/src/old.go", Source: "src/old.go", Action: git.ChangeRemoved},
+		{Target: "overlay/src/pinned.go", Source: "src/pinned.go", Action: git.ChangeChanged, Pinned: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("overlayImpact() = %+v, want %+v", got, want)
+	}
+}
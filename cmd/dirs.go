@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+// Link modes recorded for entries that don't come from an upstream file
+const (
+	dirLinkMode  = "dir"  // Empty directory from dirs:
+	keepLinkMode = "keep" // .keep file inside a dirs: directory
+)
+
+// keepFile is the placeholder created in dirs with keep: true
+const keepFile = ".keep"
+
+// createDirs creates the directories listed in dirs:, with their .keep
+// files, and records them in the state. Directories it creates are given to
+// o when set.
+func createDirs(cfg *config.Config, state *config.State, o *owner, createdLinks *[]string) error {
+	for _, d := range cfg.Dirs {
+		rel := strings.Trim(filepath.ToSlash(filepath.Clean(d.Path)), "/")
+		if rel == "." {
+			return fmt.Errorf("invalid dir %q: overlay/ itself can't be listed", d.Path)
+		}
+		if err := validatePath("overlay", rel); err != nil {
+			return fmt.Errorf("invalid dir %q: %w", d.Path, err)
+		}
+		dir := filepath.Join("overlay", rel)
+
+		if info, err := os.Lstat(dir); err == nil && !info.IsDir() {
+			if err := enforce(cfg.Policies.Conflict, config.PolicyError, fmt.Errorf("%w: %s", overlayerr.ErrConflict, dir)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := mkdirOwned(dir, o); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+		if err := validateWithin(".", dir); err != nil {
+			return fmt.Errorf("invalid dir %q: %w", d.Path, err)
+		}
+		state.AddManagedFile(rel, dirLinkMode, "")
+
+		if !d.Keep {
+			continue
+		}
+		keep := filepath.Join(dir, keepFile)
+		if _, err := os.Lstat(keep); os.IsNotExist(err) {
+			if err := os.WriteFile(keep, nil, 0644); err != nil {
+				return fmt.Errorf("failed to create %s: %w", keep, err)
+			}
+		}
+		*createdLinks = append(*createdLinks, keep)
+		state.AddManagedFile(rel+"/"+keepFile, keepLinkMode, "")
+	}
+	return nil
+}
+
+// isCoveredByDir reports whether an overlay-relative path is a dirs: entry or its .keep file
+func isCoveredByDir(cfg *config.Config, path string) bool {
+	for _, d := range cfg.Dirs {
+		rel := strings.Trim(filepath.ToSlash(filepath.Clean(d.Path)), "/")
+		if path == rel || (d.Keep && path == rel+"/"+keepFile) {
+			return true
+		}
+	}
+	return false
+}
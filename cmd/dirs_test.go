@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+func TestCreateDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	cfg := &config.Config{
+		Dirs: []config.DirSpec{
+			{Path: "var/cache"},
+			{Path: "tmp/uploads/", Keep: true},
+		},
+	}
+	state := &config.State{}
+	var created []string
+
+	if err := createDirs(cfg, state, nil, &created); err != nil {
+		t.Fatalf("createDirs() error = %v", err)
+	}
+	// Running again over existing directories is fine
+	if err := createDirs(cfg, state, nil, &created); err != nil {
+		t.Fatalf("createDirs() second run error = %v", err)
+	}
+
+	if info, err := os.Stat("overlay/var/cache"); err != nil || !info.IsDir() {
+		t.Errorf("overlay/var/cache was not created: %v", err)
+	}
+	if _, err := os.Stat("overlay/tmp/uploads/.keep"); err != nil {
+		t.Errorf(".keep was not created: %v", err)
+	}
+
+	want := map[string]string{
+		"var/cache":         dirLinkMode,
+		"tmp/uploads":       dirLinkMode,
+		"tmp/uploads/.keep": keepLinkMode,
+	}
+	if len(state.ManagedFiles) != len(want) {
+		t.Errorf("State has %d entries, want %d", len(state.ManagedFiles), len(want))
+	}
+	for _, mf := range state.ManagedFiles {
+		if want[mf.Path] != mf.LinkMode {
+			t.Errorf("%s: link mode %q, want %q", mf.Path, mf.LinkMode, want[mf.Path])
+		}
+	}
+
+	for _, st := range collectStatus(cfg, state) {
+		if st.Code != statusOK {
+			t.Errorf("%s: status %q, want OK", st.Path, st.Code)
+		}
+	}
+
+	// A file in the way is not replaced
+	bad := &config.Config{Dirs: []config.DirSpec{{Path: "var/cache/file"}}}
+	if err := os.WriteFile("overlay/var/cache/file", []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := createDirs(bad, state, nil, &created); err == nil {
+		t.Error("createDirs() replaced an existing file")
+	}
+	if err := createDirs(&config.Config{Dirs: []config.DirSpec{{Path: "../outside"}}}, state, nil, &created); err == nil {
+		t.Error("createDirs() accepted a path outside overlay/")
+	}
+}
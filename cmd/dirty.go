@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+	"github.com/spf13/cobra"
+)
+
+// maxDirtyShown bounds how many changed paths the dirty check names
+const maxDirtyShown = 5
+
+// dirtyPaths lists the uncommitted changes under overlay/, untracked files
+// included, and to the tracked bookkeeping files a run rewrites. The config,
+// which a run is usually made to apply, and the upstream checkout, which it
+// moves, are left out. Outside a git repository there are none.
+func dirtyPaths(cmd *cobra.Command, cfg *config.Config) ([]string, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, nil
+	}
+	paths, err := bookkeepingPaths(cmd, cfg)
+	if err != nil {
+		return nil, err
+	}
+	var checked []string
+	for _, p := range paths {
+		if p != ".upstream" && p != flagString(cmd, "config") {
+			checked = append(checked, p)
+		}
+	}
+	if len(checked) == 0 {
+		return nil, nil
+	}
+
+	args := append([]string{"status", "--porcelain", "-z", "--untracked-files=all", "--"}, checked...)
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr := strings.TrimSpace(string(exitErr.Stderr))
+			if exitErr.ExitCode() == 128 && strings.Contains(stderr, "not a git repository") {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to check for uncommitted changes: git status: %s", stderr)
+		}
+		return nil, fmt.Errorf("failed to check for uncommitted changes: %w", err)
+	}
+
+	// Each entry is a two-letter status, a space and the path; renames are
+	// followed by their original path as a separate entry
+	var dirty []string
+	entries := strings.Split(strings.TrimRight(string(out), "\x00"), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		if entry[0] == 'R' || entry[0] == 'C' {
+			i++
+		}
+		// A new bookkeeping file, as in a fresh repository, has no work to lose
+		path := entry[3:]
+		if entry[:2] == "??" && !strings.HasPrefix(path, "overlay/") {
+			continue
+		}
+		dirty = append(dirty, path)
+	}
+	return dirty, nil
+}
+
+// checkDirty refuses to run when overlay/ or the bookkeeping files have
+// uncommitted changes a run could overwrite, unless --allow-dirty or
+// allow_dirty is set
+func checkDirty(cmd *cobra.Command, cfg *config.Config) error {
+	if cfg.AllowDirty || flagBool(cmd, "allow-dirty") {
+		return nil
+	}
+	dirty, err := dirtyPaths(cmd, cfg)
+	if err != nil || len(dirty) == 0 {
+		return err
+	}
+	shown := dirty
+	if len(shown) > maxDirtyShown {
+		shown = shown[:maxDirtyShown]
+	}
+	for _, p := range shown {
+		fmt.Fprintf(os.Stderr, "  %s\n", p)
+	}
+	if len(dirty) > len(shown) {
+		fmt.Fprintf(os.Stderr, "  and %d more\n", len(dirty)-len(shown))
+	}
+	return fmt.Errorf("%w: %d paths under overlay/ or in the bookkeeping files", overlayerr.ErrDirty, len(dirty))
+}
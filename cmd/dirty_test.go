@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+	"github.com/spf13/cobra"
+)
+
+func TestCheckDirty(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	cfg := &config.Config{Upstream: config.UpstreamConfig{URL: "https://example.com/repo.git", Ref: "main"}}
+	newCmd := func(allowDirty bool) *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("config", ".git-overlay.yml", "")
+		cmd.Flags().Bool("allow-dirty", allowDirty, "")
+		return cmd
+	}
+
+	// Outside a git repository there is nothing to check
+	if err := checkDirty(newCmd(false), cfg); err != nil {
+		t.Fatalf("checkDirty() outside a repository error = %v", err)
+	}
+
+	if err := runGitCommand(".", []string{"init", "-b", "main"}); err != nil {
+		t.Fatalf("Failed to init repository: %v", err)
+	}
+	if err := os.MkdirAll("overlay", 0755); err != nil {
+		t.Fatalf("Failed to create overlay directory: %v", err)
+	}
+	files := map[string]string{
+		".git-overlay.yml":   "upstream: {}\n",
+		".gitignore":         "*.log\n",
+		"overlay/custom.txt": "custom\n",
+		config.StateFile:     "{}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	// Untracked bookkeeping files in a fresh repository have nothing to lose
+	if err := os.Remove("overlay/custom.txt"); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if err := checkDirty(newCmd(false), cfg); err != nil {
+		t.Errorf("checkDirty() with new bookkeeping files error = %v", err)
+	}
+	if err := os.WriteFile("overlay/custom.txt", []byte("custom\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	for _, args := range [][]string{{"add", "-A"}, {"commit", "-m", "Initial commit"}} {
+		if err := runGitCommand(".", args); err != nil {
+			t.Fatalf("Failed to run git %v: %v", args, err)
+		}
+	}
+	if err := checkDirty(newCmd(false), cfg); err != nil {
+		t.Fatalf("checkDirty() in a clean repository error = %v", err)
+	}
+
+	// Editing the config is what a sync is for
+	if err := os.WriteFile(".git-overlay.yml", []byte("upstream: {url: x}\n"), 0644); err != nil {
+		t.Fatalf("Failed to edit config: %v", err)
+	}
+	if err := checkDirty(newCmd(false), cfg); err != nil {
+		t.Errorf("checkDirty() with an edited config error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		write string
+	}{
+		{name: "modified overlay file", path: "overlay/custom.txt", write: "edited\n"},
+		{name: "untracked overlay file", path: "overlay/new.txt", write: "new\n"},
+		{name: "modified state", path: config.StateFile, write: `{"managed_files": []}`},
+		{name: "modified gitignore", path: ".gitignore", write: "*.tmp\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original, _ := os.ReadFile(tt.path)
+			if err := os.WriteFile(tt.path, []byte(tt.write), 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", tt.path, err)
+			}
+			defer func() {
+				if original == nil {
+					os.Remove(tt.path)
+				} else {
+					os.WriteFile(tt.path, original, 0644)
+				}
+			}()
+
+			if err := checkDirty(newCmd(false), cfg); !errors.Is(err, overlayerr.ErrDirty) {
+				t.Errorf("checkDirty() error = %v, want overlayerr.ErrDirty", err)
+			}
+			if err := checkDirty(newCmd(true), cfg); err != nil {
+				t.Errorf("checkDirty() with --allow-dirty error = %v", err)
+			}
+			allow := *cfg
+			allow.AllowDirty = true
+			if err := checkDirty(newCmd(false), &allow); err != nil {
+				t.Errorf("checkDirty() with allow_dirty error = %v", err)
+			}
+		})
+	}
+
+	// A repository git can't read is an error, not a clean one
+	if err := os.WriteFile(".git/index", []byte("garbage"), 0644); err != nil {
+		t.Fatalf("Failed to corrupt index: %v", err)
+	}
+	if err := checkDirty(newCmd(false), cfg); err == nil || errors.Is(err, overlayerr.ErrDirty) {
+		t.Errorf("checkDirty() with a corrupt index error = %v, want a git error", err)
+	}
+}
+
+func TestDaemonSyncChecksDirty(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script providers are not supported on windows")
+	}
+
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$1\" in\nresolve) echo \"$2\" ;;\nfetch) echo \"$2\" > \"$3/version.txt\" ;;\nesac\n"
+	if err := os.WriteFile(filepath.Join(binDir, "git-overlay-provider-fake"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write provider: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	configContent := "upstream:\n  type: fake\n  ref: v1\nlink_mode: copy\nsymlinks:\n  - version.txt\n"
+	if err := os.WriteFile(".git-overlay.yml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	for _, args := range [][]string{{"init", "-b", "main"}, {"add", "-A"}, {"commit", "-m", "Initial commit"}} {
+		if err := runGitCommand(".", args); err != nil {
+			t.Fatalf("Failed to run git %v: %v", args, err)
+		}
+	}
+	if err := os.MkdirAll("overlay", 0755); err != nil {
+		t.Fatalf("Failed to create overlay directory: %v", err)
+	}
+	if err := os.WriteFile("overlay/notes.txt", []byte("uncommitted\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("config", ".git-overlay.yml", "")
+	cmd.Flags().String("link-mode", "symlink", "")
+	cmd.Flags().Bool("force", false, "")
+	d := &daemon{cmd: cmd}
+
+	// POST /sync and watch --auto-sync refuse like sync does
+	if err := d.sync(); !errors.Is(err, overlayerr.ErrDirty) {
+		t.Fatalf("sync() error = %v, want overlayerr.ErrDirty", err)
+	}
+	if _, err := os.Stat("overlay/version.txt"); err == nil {
+		t.Error("sync() linked files into a dirty overlay")
+	}
+
+	// allow_dirty in the config lets them run
+	if err := os.WriteFile(".git-overlay.yml", []byte(configContent+"allow_dirty: true\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if err := d.sync(); err != nil {
+		t.Fatalf("sync() with allow_dirty error = %v", err)
+	}
+	if _, err := os.Stat("overlay/version.txt"); err != nil {
+		t.Errorf("sync() with allow_dirty didn't link: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// editConfig applies edit to the config file in place, preserving comments,
+// key order and anchors
+func editConfig(cmd *cobra.Command, edit func(doc *config.Document) error) error {
+	configPath, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return err
+	}
+	if isRemoteConfig(configPath) {
+		return fmt.Errorf("cannot edit remote config %s", configPath)
+	}
+
+	doc, err := config.OpenDocument(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	if err := edit(doc); err != nil {
+		return err
+	}
+	if err := doc.Save(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// checkEditedRef refuses to write an upstream ref outside policies.allowed_refs
+// into the config, where every later sync would stop at it
+func checkEditedRef(cmd *cobra.Command, ref string) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	return checkRefAllowed(cfg.Policies, "", ref)
+}
+
+var addCmd = &cobra.Command{
+	Use:   "add <upstream-path>",
+	Short: "Add a symlink spec to the config",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		to, err := cmd.Flags().GetString("to")
+		if err != nil {
+			return err
+		}
+		if err := editConfig(cmd, func(doc *config.Document) error {
+			return doc.AddSymlink(args[0], to)
+		}); err != nil {
+			return err
+		}
+		fmt.Printf("Added %s; run git-overlay sync to link it\n", args[0])
+		return nil
+	},
+}
+
+var removeCmd = &cobra.Command{
+	Use:   "remove <overlay-path>",
+	Short: "Remove a symlink spec from the config",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		target := overlayArg(args[0])
+		if err := editConfig(cmd, func(doc *config.Document) error {
+			removed, err := doc.RemoveSymlink(target)
+			if err != nil {
+				return err
+			}
+			if !removed {
+				return fmt.Errorf("no spec links to %s", target)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s; run git-overlay clean and sync to unlink it\n", target)
+		return nil
+	},
+}
+
+var switchRefCmd = &cobra.Command{
+	Use:   "switch-ref <ref>",
+	Short: "Change the upstream ref in the config",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := editConfig(cmd, func(doc *config.Document) error {
+			if err := checkEditedRef(cmd, args[0]); err != nil {
+				return err
+			}
+			return doc.SetString("upstream.ref", args[0])
+		}); err != nil {
+			return err
+		}
+		fmt.Printf("Upstream ref set to %s; run git-overlay sync to check it out\n", args[0])
+		return nil
+	},
+}
+
+var setUpstreamCmd = &cobra.Command{
+	Use:   "set-upstream <url>",
+	Short: "Change the upstream repository URL in the config",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ref, err := cmd.Flags().GetString("ref")
+		if err != nil {
+			return err
+		}
+		if err := editConfig(cmd, func(doc *config.Document) error {
+			if err := doc.SetString("upstream.url", args[0]); err != nil {
+				return err
+			}
+			if ref != "" {
+				if err := checkEditedRef(cmd, ref); err != nil {
+					return err
+				}
+				return doc.SetString("upstream.ref", ref)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		fmt.Printf("Upstream set to %s; run git-overlay sync to fetch it\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	addCmd.Flags().String("to", "", "Target path in overlay/ (default same as the upstream path)")
+	setUpstreamCmd.Flags().String("ref", "", "Also change the upstream ref")
+	rootCmd.AddCommand(addCmd, removeCmd, switchRefCmd, setUpstreamCmd)
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+	"gopkg.in/yaml.v3"
+)
+
+// maxExtendsDepth bounds how many configs can be chained through extends
+const maxExtendsDepth = 10
+
+// isRemoteConfig reports whether a config location is an http(s) URL
+func isRemoteConfig(location string) bool {
+	scheme := strings.ToLower(location)
+	return strings.HasPrefix(scheme, "https://") || strings.HasPrefix(scheme, "http://")
+}
+
+// readConfigSource reads a config file from a local path or an https URL.
+// Configs decide what gets linked and run, so they are never fetched over
+// plain http.
+func readConfigSource(location string) ([]byte, error) {
+	if !isRemoteConfig(location) {
+		return os.ReadFile(location)
+	}
+	if !strings.HasPrefix(strings.ToLower(location), "https://") {
+		return nil, fmt.Errorf("refusing to fetch %s over plain http; use an https:// URL", location)
+	}
+
+	if err := fetchCredentials(); err != nil {
+		return nil, err
+	}
+
+	// Fall back to the last fetched copy when the URL can't be reached
+	cachePath, cacheErr := configCachePath(location)
+	data, err := fetchConfig(location)
+	if err != nil {
+		if cacheErr != nil {
+			return nil, err
+		}
+		info, statErr := os.Stat(cachePath)
+		cached, readErr := os.ReadFile(cachePath)
+		if statErr != nil || readErr != nil {
+			return nil, err
+		}
+		age := time.Since(info.ModTime()).Round(time.Second)
+		fmt.Fprintf(os.Stderr, "Warning: using cached copy of %s fetched %s ago, which may be out of date: %v\n", location, age, err)
+		return cached, nil
+	}
+
+	if cacheErr == nil {
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+			os.WriteFile(cachePath, data, 0644)
+		}
+	}
+	return data, nil
+}
+
+// configClient fetches remote configs, following redirects only to https
+var configClient = &http.Client{
+	Timeout: 30 * time.Second,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("refusing redirect to %s over plain http", req.URL)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	},
+}
+
+// fetchConfig downloads a remote config
+func fetchConfig(location string) ([]byte, error) {
+	resp, err := configClient.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", location, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// resolveExtends resolves an extends location relative to the config that declared it
+func resolveExtends(parent, location string) (string, error) {
+	if isRemoteConfig(location) || filepath.IsAbs(location) {
+		return location, nil
+	}
+
+	if isRemoteConfig(parent) {
+		base, err := url.Parse(parent)
+		if err != nil {
+			return "", fmt.Errorf("invalid config URL %s: %w", parent, err)
+		}
+		base.Path = path.Join(path.Dir(base.Path), location)
+		return base.String(), nil
+	}
+
+	return filepath.Join(filepath.Dir(parent), location), nil
+}
+
+// checkPinnedInclude refuses a remote extends or symlinks_file when the config
+// was pinned with --config-sha256, since the pin only covers the top-level bytes
+func checkPinnedInclude(pinned bool, location string) error {
+	if pinned && isRemoteConfig(location) {
+		return fmt.Errorf("%w: %s is fetched separately and not covered by --config-sha256; inline it into the pinned config", overlayerr.ErrChecksumMismatch, location)
+	}
+	return nil
+}
+
+// loadConfigTree parses the config at location and merges any extended configs
+// under it. A pinned config may only pull in local files.
+func loadConfigTree(location string, data []byte, seen map[string]bool, pinned bool) (map[string]interface{}, error) {
+	if seen[location] {
+		return nil, fmt.Errorf("extends cycle detected at %s", location)
+	}
+	if len(seen) >= maxExtendsDepth {
+		return nil, fmt.Errorf("extends chain is deeper than %d configs", maxExtendsDepth)
+	}
+	seen[location] = true
+	defer delete(seen, location)
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", location, err)
+	}
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+
+	// Paths listed in a symlinks_file count as specs of this config
+	if err := loadSymlinksFile(location, values, pinned); err != nil {
+		return nil, err
+	}
+
+	extends, ok := values["extends"]
+	if !ok {
+		return values, nil
+	}
+	delete(values, "extends")
+
+	parentLocation, ok := extends.(string)
+	if !ok || parentLocation == "" {
+		return nil, fmt.Errorf("extends in %s must be a path or URL", location)
+	}
+	resolved, err := resolveExtends(location, parentLocation)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPinnedInclude(pinned, resolved); err != nil {
+		return nil, err
+	}
+
+	parentData, err := readConfigSource(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read extended config %s: %w", resolved, err)
+	}
+	base, err := loadConfigTree(resolved, parentData, seen, pinned)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeConfigValues(base, values), nil
+}
+
+// mergeConfigValues merges override on top of base. Maps are merged recursively,
+// lists are concatenated (base first) and other values are replaced.
+func mergeConfigValues(base, override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+
+	for k, v := range override {
+		existing, ok := merged[k]
+		if !ok {
+			merged[k] = v
+			continue
+		}
+
+		switch ov := v.(type) {
+		case map[string]interface{}:
+			if bv, ok := existing.(map[string]interface{}); ok {
+				merged[k] = mergeConfigValues(bv, ov)
+				continue
+			}
+		case []interface{}:
+			if bv, ok := existing.([]interface{}); ok {
+				list := make([]interface{}, 0, len(bv)+len(ov))
+				merged[k] = append(append(list, bv...), ov...)
+				continue
+			}
+		}
+		merged[k] = v
+	}
+
+	return merged
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestLoadConfigExtends(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll("common", 0755); err != nil {
+		t.Fatalf("Failed to create common directory: %v", err)
+	}
+	base := `upstream:
+  url: "https://github.com/acme/base.git"
+  ref: "main"
+symlinks:
+  - src
+  - configs
+link_mode: copy
+`
+	if err := os.WriteFile(filepath.Join("common", "base.yml"), []byte(base), 0644); err != nil {
+		t.Fatalf("Failed to write base config: %v", err)
+	}
+
+	local := `extends: common/base.yml
+upstream:
+  ref: "v2.0.0"
+symlinks:
+  - docs
+`
+	if err := os.WriteFile(".git-overlay.yml", []byte(local), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("config", ".git-overlay.yml", "")
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	if cfg.Upstream.URL != "https://github.com/acme/base.git" {
+		t.Errorf("Upstream.URL = %q, want value from base", cfg.Upstream.URL)
+	}
+	if cfg.Upstream.Ref != "v2.0.0" {
+		t.Errorf("Upstream.Ref = %q, want local override", cfg.Upstream.Ref)
+	}
+	if cfg.LinkMode != "copy" {
+		t.Errorf("LinkMode = %q, want value from base", cfg.LinkMode)
+	}
+
+	var got []string
+	for _, link := range cfg.Symlinks {
+		got = append(got, link.String)
+	}
+	want := []string{"src", "configs", "docs"}
+	if len(got) != len(want) {
+		t.Fatalf("Symlinks = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Symlinks = %v, want %v", got, want)
+			break
+		}
+	}
+
+	// A config extending itself is rejected
+	if err := os.WriteFile(".git-overlay.yml", []byte("extends: .git-overlay.yml\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := loadConfig(cmd); err == nil {
+		t.Error("loadConfig() expected error for extends cycle")
+	}
+}
+
+func TestLoadRemoteConfig(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	content := `upstream:
+  url: "https://github.com/acme/base.git"
+  ref: "main"
+symlinks:
+  - src
+`
+	files := map[string]string{
+		"/overlay.yml": content,
+		"/extends.yml": "extends: overlay.yml\n",
+		"/listed.yml":  "upstream: {url: \"https://github.com/acme/base.git\", ref: main}\nsymlinks_file: paths.txt\n",
+		"/paths.txt":   "src\n",
+	}
+	server := newConfigServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect.yml" {
+			http.Redirect(w, r, "http://"+r.Host+"/overlay.yml", http.StatusFound)
+			return
+		}
+		w.Write([]byte(files[r.URL.Path]))
+	}))
+
+	sum := sha256.Sum256([]byte(content))
+	checksum := func(name string) string {
+		sum := sha256.Sum256([]byte(files[name]))
+		return hex.EncodeToString(sum[:])
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		checksum string
+		wantErr  bool
+	}{
+		{
+			name: "no checksum",
+		},
+		{
+			name:     "matching checksum",
+			checksum: hex.EncodeToString(sum[:]),
+		},
+		{
+			name:     "mismatched checksum",
+			checksum: "0000000000000000000000000000000000000000000000000000000000000000",
+			wantErr:  true,
+		},
+		{
+			name: "unpinned remote extends",
+			path: "/extends.yml",
+		},
+		{
+			name:    "redirect to plain http",
+			path:    "/redirect.yml",
+			wantErr: true,
+		},
+		{
+			// The pin can't vouch for what the extended config holds
+			name:     "pinned remote extends",
+			path:     "/extends.yml",
+			checksum: checksum("/extends.yml"),
+			wantErr:  true,
+		},
+		{
+			name:     "pinned remote symlinks file",
+			path:     "/listed.yml",
+			checksum: checksum("/listed.yml"),
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.path == "" {
+				tt.path = "/overlay.yml"
+			}
+			cmd := &cobra.Command{}
+			cmd.Flags().String("config", server.URL+tt.path, "")
+			cmd.Flags().String("config-sha256", tt.checksum, "")
+
+			cfg, err := loadConfig(cmd)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.Upstream.URL != "https://github.com/acme/base.git" {
+				t.Errorf("Upstream.URL = %q", cfg.Upstream.URL)
+			}
+		})
+	}
+}
+
+func TestLoadRemoteConfigFromCache(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	content := `upstream:
+  url: "https://github.com/acme/base.git"
+  ref: "main"
+symlinks:
+  - src
+`
+	online := true
+	server := newConfigServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !online {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("config", server.URL+"/overlay.yml", "")
+
+	if _, err := loadConfig(cmd); err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	// Once fetched, the config still loads while the server is down
+	online = false
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		t.Fatalf("loadConfig() from cache error = %v", err)
+	}
+	if cfg.Upstream.URL != "https://github.com/acme/base.git" {
+		t.Errorf("Upstream.URL = %q", cfg.Upstream.URL)
+	}
+}
+
+// newConfigServer starts an https server for remote configs and makes
+// fetchConfig trust its certificate
+func newConfigServer(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Helper()
+	server := httptest.NewTLSServer(handler)
+	transport := configClient.Transport
+	configClient.Transport = server.Client().Transport
+	t.Cleanup(func() {
+		configClient.Transport = transport
+		server.Close()
+	})
+	return server
+}
+
+func TestLoadRemoteConfigRefusesPlainHTTP(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	for _, location := range []string{"http://example.com/overlay.yml", "HTTP://example.com/overlay.yml"} {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("config", location, "")
+		_, err := loadConfig(cmd)
+		if err == nil || !strings.Contains(err.Error(), "https") {
+			t.Errorf("loadConfig(%s) error = %v, want a refusal to use plain http", location, err)
+		}
+	}
+}
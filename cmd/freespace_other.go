@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package cmd
+
+// freeSpace is not implemented on this platform, so free space is never
+// checked
+func freeSpace(dir string) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/git"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+// generatedLinkMode is recorded for files rendered from generate:
+const generatedLinkMode = "generate"
+
+// generateUpstream is the sync metadata of one upstream available to templates
+type generateUpstream struct {
+	URL string `json:"url"`           // Where the upstream comes from: repository URL, release repo, module or image
+	Ref string `json:"ref"`           // Configured ref
+	SHA string `json:"sha,omitempty"` // Commit checked out, for git upstreams
+}
+
+// generateData is what generate templates are rendered with
+type generateData struct {
+	UpstreamURL      string
+	UpstreamRef      string
+	UpstreamSHA      string
+	UpstreamShortSHA string                      // UpstreamSHA abbreviated to 7 characters
+	UpstreamTag      string                      // Newest tag reachable from the upstream commit, for git upstreams
+	SyncTime         time.Time                   // Sync that last changed the rendering, in UTC
+	Upstreams        map[string]generateUpstream // Named upstreams by name
+	Version          string                      // git-overlay version
+
+	gitDir string // Checkout gitLog reads, empty for upstreams that aren't git
+	deepen bool   // gitLog fetches history a shallow checkout lacks; set by renders that write
+}
+
+// newGenerateData collects the sync metadata of the configured upstreams
+func newGenerateData(cfg *config.Config) generateData {
+	dir := config.UpstreamDir("")
+	main := describeUpstream("", cfg.Upstream, dir)
+	data := generateData{
+		UpstreamURL: main.Location,
+		UpstreamRef: main.Ref,
+		UpstreamSHA: main.Commit,
+		Upstreams:   make(map[string]generateUpstream),
+		Version:     version,
+	}
+	if main.Commit != "" {
+		data.UpstreamShortSHA = shortID(main.Commit)
+		data.UpstreamTag = git.NearestTag(dir)
+		data.gitDir = dir
+	}
+	for _, named := range cfg.Upstreams {
+		u := describeUpstream(named.Name, named.UpstreamConfig, config.UpstreamDir(named.Name))
+		data.Upstreams[named.Name] = generateUpstream{URL: u.Location, Ref: u.Ref, SHA: u.Commit}
+	}
+	return data
+}
+
+// generatePath returns a generate spec's path relative to overlay/
+func generatePath(spec config.GenerateSpec) string {
+	return overlayRelPath(spec.Path)
+}
+
+// funcs returns the template functions reading the upstream history:
+// gitLog n lists the last n upstream commits as abbreviated hash and subject.
+// Read-only renders list only the history the checkout already has.
+func (d generateData) funcs() template.FuncMap {
+	return template.FuncMap{
+		"gitLog": func(n int) ([]string, error) {
+			if d.gitDir == "" {
+				return nil, nil
+			}
+			if !d.deepen {
+				return git.LocalLog(d.gitDir, n)
+			}
+			return git.Log(d.gitDir, n)
+		},
+	}
+}
+
+// renderGenerate renders a generate spec's content
+func renderGenerate(spec config.GenerateSpec, data generateData) ([]byte, error) {
+	tmpl, err := template.New(spec.Path).Funcs(data.funcs()).Option("missingkey=error").Parse(spec.Content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template for %s: %w", spec.Path, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", spec.Path, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// generateFiles renders the generate: specs into overlay/ and records them
+// in the state. Files whose content is unchanged are left alone, keeping the
+// sync time they were rendered with.
+func generateFiles(cfg *config.Config, state *config.State, opts linkOptions, syncedAt time.Time, createdLinks *[]string) error {
+	if len(cfg.Generate) == 0 {
+		return nil
+	}
+	data := newGenerateData(cfg)
+	data.deepen = true
+	syncedAt = syncedAt.UTC().Truncate(time.Second)
+
+	for _, spec := range cfg.Generate {
+		rel := generatePath(spec)
+		if err := validatePath("overlay", rel); err != nil {
+			return fmt.Errorf("invalid generate path %q: %w", spec.Path, err)
+		}
+		if state.IsPinned(rel) {
+			continue
+		}
+		dst := filepath.Join("overlay", rel)
+
+		// A file is only re-rendered with this sync's time when something
+		// else about it changed, so .SyncTime alone never rewrites it
+		data.SyncTime = syncedAt
+		if managed, mf := state.IsManagedFile(rel); managed && mf.SyncedAt != nil {
+			data.SyncTime = *mf.SyncedAt
+		}
+		content, err := renderGenerate(spec, data)
+		if err != nil {
+			return err
+		}
+		if current, err := os.ReadFile(dst); (err != nil || !bytes.Equal(current, content)) && !data.SyncTime.Equal(syncedAt) {
+			data.SyncTime = syncedAt
+			if content, err = renderGenerate(spec, data); err != nil {
+				return err
+			}
+		}
+
+		if err := mkdirOwned(filepath.Dir(dst), opts.owner); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", dst, err)
+		}
+		if err := validateWithin(".", filepath.Dir(dst)); err != nil {
+			return fmt.Errorf("invalid generate path %q: %w", spec.Path, err)
+		}
+
+		current, err := os.ReadFile(dst)
+		switch {
+		case err == nil && bytes.Equal(current, content):
+			// Up to date
+		case err == nil || !os.IsNotExist(err):
+			managed, _ := state.IsManagedFile(rel)
+			if matchAnyGlob(opts.protect, dst) {
+				fmt.Printf("Skipping protected path: %s\n", dst)
+				continue
+			}
+			if !managed && !opts.force {
+				if err := enforce(cfg.Policies.Conflict, config.PolicyError, fmt.Errorf("%w: %s", overlayerr.ErrConflict, dst)); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := opts.trash.remove(dst); err != nil {
+				return fmt.Errorf("failed to remove existing target %s: %w", dst, err)
+			}
+			fallthrough
+		default:
+			if err := os.WriteFile(dst, content, 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", dst, err)
+			}
+		}
+
+		*createdLinks = append(*createdLinks, dst)
+		state.AddGeneratedFile(rel, generatedLinkMode, data.SyncTime)
+	}
+	return nil
+}
+
+// generatedFileStatus compares a generated file with what its spec renders now
+func generatedFileStatus(cfg *config.Config, data generateData, mf config.ManagedFile) string {
+	current, err := os.ReadFile(filepath.Join("overlay", mf.Path))
+	if err != nil {
+		return statusMissing
+	}
+	if mf.SyncedAt != nil {
+		data.SyncTime = *mf.SyncedAt
+	}
+	for _, spec := range cfg.Generate {
+		if generatePath(spec) != mf.Path {
+			continue
+		}
+		want, err := renderGenerate(spec, data)
+		if err != nil || !bytes.Equal(current, want) {
+			return statusModified
+		}
+		return statusOK
+	}
+	return statusUntracked
+}
+
+// isCoveredByGenerate reports whether an overlay-relative path is a generate: target
+func isCoveredByGenerate(cfg *config.Config, path string) bool {
+	for _, spec := range cfg.Generate {
+		if generatePath(spec) == path {
+			return true
+		}
+	}
+	return false
+}
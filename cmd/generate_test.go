@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+func TestGenerateFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	cfg := &config.Config{
+		Upstream: config.UpstreamConfig{URL: "https://example.com/repo.git", Ref: "v1.2.3"},
+		Generate: []config.GenerateSpec{
+			{Path: "overlay/VERSION", Content: "{{ .UpstreamRef }}\n"},
+			{Path: "meta/source.txt", Content: "from {{ .UpstreamURL }}"},
+		},
+	}
+	state := &config.State{}
+	var created []string
+
+	if err := generateFiles(cfg, state, linkOptions{}, time.Now(), &created); err != nil {
+		t.Fatalf("generateFiles() error = %v", err)
+	}
+
+	tests := map[string]string{
+		"overlay/VERSION":         "v1.2.3\n",
+		"overlay/meta/source.txt": "from https://example.com/repo.git",
+	}
+	for path, want := range tests {
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, want %q", path, data, err, want)
+		}
+	}
+	if len(created) != 2 {
+		t.Errorf("createdLinks = %v, want 2 entries", created)
+	}
+	if managed, mf := state.IsManagedFile("VERSION"); !managed || mf.LinkMode != generatedLinkMode {
+		t.Errorf("VERSION managed = %v, %+v, want link mode %q", managed, mf, generatedLinkMode)
+	}
+
+	// Local edits show up as modified and are replaced on the next sync
+	if err := os.WriteFile("overlay/VERSION", []byte("edited"), 0644); err != nil {
+		t.Fatalf("Failed to edit generated file: %v", err)
+	}
+	for _, st := range collectStatus(cfg, state) {
+		want := statusOK
+		if st.Path == "VERSION" {
+			want = statusModified
+		}
+		if st.Code != want {
+			t.Errorf("status of %s = %q, want %q", st.Path, st.Code, want)
+		}
+	}
+	if err := generateFiles(cfg, state, linkOptions{}, time.Now(), &created); err != nil {
+		t.Fatalf("generateFiles() second run error = %v", err)
+	}
+	if data, _ := os.ReadFile("overlay/VERSION"); string(data) != "v1.2.3\n" {
+		t.Errorf("overlay/VERSION = %q after resync, want %q", data, "v1.2.3\n")
+	}
+	if len(state.ManagedFiles) != 2 {
+		t.Errorf("State has %d entries, want 2", len(state.ManagedFiles))
+	}
+
+	// Unmanaged files are not overwritten without force
+	if err := os.WriteFile("overlay/NOTICE", []byte("mine"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	cfg.Generate = append(cfg.Generate, config.GenerateSpec{Path: "NOTICE", Content: "generated"})
+	if err := generateFiles(cfg, state, linkOptions{}, time.Now(), &created); err == nil {
+		t.Error("generateFiles() overwrote an unmanaged file without force")
+	}
+	if err := generateFiles(cfg, state, linkOptions{force: true}, time.Now(), &created); err != nil {
+		t.Fatalf("generateFiles() with force error = %v", err)
+	}
+}
+
+func TestGenerateSyncTime(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	cfg := &config.Config{
+		Upstream: config.UpstreamConfig{URL: "https://example.com/repo.git", Ref: "v1"},
+		Generate: []config.GenerateSpec{{Path: "BUILD", Content: "{{ .UpstreamRef }} synced {{ .SyncTime.Unix }}"}},
+	}
+	state := &config.State{}
+	var created []string
+	first := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	if err := generateFiles(cfg, state, linkOptions{}, first, &created); err != nil {
+		t.Fatalf("generateFiles() error = %v", err)
+	}
+	want := fmt.Sprintf("v1 synced %d", first.Unix())
+
+	// A later sync that changes nothing else keeps the file and its time
+	if err := generateFiles(cfg, state, linkOptions{}, first.Add(time.Hour), &created); err != nil {
+		t.Fatalf("generateFiles() second run error = %v", err)
+	}
+	if data, _ := os.ReadFile("overlay/BUILD"); string(data) != want {
+		t.Errorf("overlay/BUILD = %q, want %q", data, want)
+	}
+	if st := collectStatus(cfg, state); len(st) != 1 || st[0].Code != statusOK {
+		t.Errorf("status = %+v, want BUILD clean", st)
+	}
+
+	// Moving the upstream renders the file with the new sync's time
+	later := first.Add(2 * time.Hour)
+	cfg.Upstream.Ref = "v2"
+	if err := generateFiles(cfg, state, linkOptions{}, later, &created); err != nil {
+		t.Fatalf("generateFiles() after a ref change error = %v", err)
+	}
+	want = fmt.Sprintf("v2 synced %d", later.Unix())
+	if data, _ := os.ReadFile("overlay/BUILD"); string(data) != want {
+		t.Errorf("overlay/BUILD = %q, want %q", data, want)
+	}
+	if _, mf := state.IsManagedFile("BUILD"); mf == nil || mf.SyncedAt == nil || !mf.SyncedAt.Equal(later) {
+		t.Errorf("BUILD state = %+v, want synced at %v", mf, later)
+	}
+}
+
+func TestRenderGenerate(t *testing.T) {
+	data := generateData{
+		UpstreamSHA:      "abc123",
+		UpstreamShortSHA: "abc1234",
+		UpstreamTag:      "v1.0.0",
+		SyncTime:         time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Upstreams:        map[string]generateUpstream{"docs": {Ref: "main"}},
+		Version:          "1.0.0",
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr string
+	}{
+		{name: "sha", content: "{{ .UpstreamSHA }}", want: "abc123"},
+		{name: "named upstream", content: `{{ (index .Upstreams "docs").Ref }}`, want: "main"},
+		{name: "version", content: "git-overlay {{ .Version }}", want: "git-overlay 1.0.0"},
+		{name: "short sha and tag", content: "{{ .UpstreamTag }}-{{ .UpstreamShortSHA }}", want: "v1.0.0-abc1234"},
+		{name: "sync time", content: `{{ .SyncTime.Format "2006-01-02" }}`, want: "2024-05-01"},
+		{name: "git log without a git upstream", content: "{{ range gitLog 3 }}{{ . }}{{ end }}", want: ""},
+		{name: "static", content: "plain text", want: "plain text"},
+		{name: "unknown field", content: "{{ .Nope }}", wantErr: "failed to render"},
+		{name: "bad syntax", content: "{{ .UpstreamSHA", wantErr: "invalid template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderGenerate(config.GenerateSpec{Path: "VERSION", Content: tt.content}, data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("renderGenerate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("renderGenerate() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("renderGenerate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitLogDeepensOnlyWhenWriting(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	upstreamDir := filepath.Join(tmpDir, "upstream")
+	if err := runGitCommand(tmpDir, []string{"init", "-q", "-b", "main", upstreamDir}); err != nil {
+		t.Fatalf("Failed to init upstream: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		name := fmt.Sprintf("file%d.txt", i)
+		if err := os.WriteFile(filepath.Join(upstreamDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		for _, args := range [][]string{{"add", name}, {"commit", "-q", "-m", "Add " + name}} {
+			if err := runGitCommand(upstreamDir, args); err != nil {
+				t.Fatalf("git %v failed: %v", args, err)
+			}
+		}
+	}
+
+	// Depth only applies to clones over a transport, not local paths
+	cloneDir := filepath.Join(tmpDir, "clone")
+	if err := runGitCommand(tmpDir, []string{"clone", "-q", "--depth", "1", "file://" + filepath.ToSlash(upstreamDir), cloneDir}); err != nil {
+		t.Fatalf("Failed to clone upstream: %v", err)
+	}
+
+	spec := config.GenerateSpec{Path: "CHANGES", Content: "{{ range gitLog 3 }}{{ . }}\n{{ end }}"}
+	data := generateData{gitDir: cloneDir}
+
+	// Status and other read-only renders use the history already there
+	got, err := renderGenerate(spec, data)
+	if err != nil {
+		t.Fatalf("renderGenerate() error = %v", err)
+	}
+	if lines := strings.Count(string(got), "\n"); lines != 1 {
+		t.Errorf("read-only render listed %d commits, want the 1 in the shallow clone:\n%s", lines, got)
+	}
+
+	data.deepen = true
+	if got, err = renderGenerate(spec, data); err != nil {
+		t.Fatalf("renderGenerate() error = %v", err)
+	}
+	if lines := strings.Count(string(got), "\n"); lines != 3 {
+		t.Errorf("writing render listed %d commits, want 3:\n%s", lines, got)
+	}
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		want    bool
+	}{
+		{
+			name:    "exact match",
+			pattern: "overlay/config.yml",
+			path:    "overlay/config.yml",
+			want:    true,
+		},
+		{
+			name:    "single segment wildcard",
+			pattern: "overlay/*.yml",
+			path:    "overlay/config.yml",
+			want:    true,
+		},
+		{
+			name:    "wildcard does not cross directories",
+			pattern: "overlay/*.yml",
+			path:    "overlay/dir/config.yml",
+			want:    false,
+		},
+		{
+			name:    "double star matches nested directories",
+			pattern: "overlay/**/local.*",
+			path:    "overlay/a/b/local.env",
+			want:    true,
+		},
+		{
+			name:    "double star matches no directories",
+			pattern: "overlay/**/local.*",
+			path:    "overlay/local.env",
+			want:    true,
+		},
+		{
+			name:    "trailing double star matches everything below",
+			pattern: ".github/workflows/**",
+			path:    ".github/workflows/ci.yml",
+			want:    true,
+		},
+		{
+			name:    "leading double star",
+			pattern: "**/*.sh",
+			path:    "scripts/build.sh",
+			want:    true,
+		},
+		{
+			name:    "no match",
+			pattern: "overlay/**/local.*",
+			path:    "overlay/a/remote.env",
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchGlob(tt.pattern, tt.path); got != tt.want {
+				t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+			}
+		})
+	}
+}
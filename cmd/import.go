@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/git"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+// legacySource is a submodule or subtree to turn into an upstream
+type legacySource struct {
+	path string // Directory in the repository, and under overlay/
+	url  string
+	ref  string
+}
+
+// upstreamNameChars are the characters kept in upstream names made from paths
+var upstreamNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// legacySources collects the submodules, and the subtrees with a URL in
+// subtreeURLs, that can become upstreams. Relative submodule URLs are
+// resolved against remote, the superproject's remote URL. What can't become
+// an upstream is explained in warnings.
+func legacySources(subs []git.Submodule, subtrees []git.Subtree, subtreeURLs map[string]string, remote string) ([]legacySource, []string) {
+	var sources []legacySource
+	var warnings []string
+	for _, sub := range subs {
+		// git-overlay's own submodule
+		if sub.Path == config.UpstreamDir("") {
+			continue
+		}
+		url := sub.URL
+		if git.IsRelativeURL(url) {
+			if remote == "" {
+				warnings = append(warnings, fmt.Sprintf("submodule %s skipped: its URL %s is relative and the repository has no remote to resolve it against", sub.Path, url))
+				continue
+			}
+			resolved, err := git.ResolveSubmoduleURL(remote, url)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("submodule %s skipped: %v", sub.Path, err))
+				continue
+			}
+			url = resolved
+		}
+		ref := sub.Branch
+		if ref == "" || ref == "." {
+			ref = sub.Commit
+		}
+		if ref == "" {
+			warnings = append(warnings, fmt.Sprintf("submodule %s has no branch and no committed commit; set its ref by hand", sub.Path))
+			ref = "main"
+		}
+		sources = append(sources, legacySource{path: sub.Path, url: url, ref: ref})
+	}
+	for _, st := range subtrees {
+		url, ok := subtreeURLs[st.Dir]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("subtree %s (at %s) skipped: git subtree does not record its URL; pass --subtree-url %s=<url>", st.Dir, shortID(st.Commit), st.Dir))
+			continue
+		}
+		sources = append(sources, legacySource{path: st.Dir, url: url, ref: st.Commit})
+	}
+	return sources, warnings
+}
+
+// importedConfig builds a starter config from legacy sources. The first
+// becomes the main upstream and the rest named upstreams; each top-level
+// entry of a source's directory becomes a spec linking it to the same place
+// under overlay/.
+func importedConfig(sources []legacySource) (*config.Config, []string, error) {
+	cfg := &config.Config{}
+	var warnings []string
+	names := make(map[string]bool)
+	for i, src := range sources {
+		name := ""
+		upstream := config.UpstreamConfig{URL: src.url, Ref: src.ref}
+		if i == 0 {
+			cfg.Upstream = upstream
+		} else {
+			base := strings.Trim(upstreamNameChars.ReplaceAllString(path.Base(src.path), "-"), "-")
+			if base == "" {
+				base = "upstream"
+			}
+			name = base
+			for n := 2; names[name]; n++ {
+				name = fmt.Sprintf("%s-%d", base, n)
+			}
+			names[name] = true
+			cfg.Upstreams = append(cfg.Upstreams, config.NamedUpstream{Name: name, UpstreamConfig: upstream})
+		}
+
+		entries, err := os.ReadDir(filepath.FromSlash(src.path))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", src.path, err)
+		}
+		linked := 0
+		for _, entry := range entries {
+			if entry.Name() == ".git" {
+				continue
+			}
+			cfg.Symlinks = append(cfg.Symlinks, config.SymlinkSpec{
+				From:     entry.Name(),
+				To:       path.Join(src.path, entry.Name()),
+				Upstream: name,
+			})
+			linked++
+		}
+		if linked == 0 {
+			warnings = append(warnings, fmt.Sprintf("%s is not checked out, so no specs were made for it; run 'git submodule update --init' first or add them by hand", src.path))
+		}
+	}
+	return cfg, warnings, nil
+}
+
+var importSubmodulesCmd = &cobra.Command{
+	Use:   "import-submodules",
+	Short: "Write a starter config from the repository's submodules and subtrees",
+	Long: `Scan .gitmodules and the history of git subtree for vendored repositories and
+write a starter .git-overlay.yml for them. The first becomes the upstream and
+the rest named upstreams, each at the branch its submodule tracks or else the
+commit the repository records. Every top-level file and directory of a
+checked-out submodule or subtree gets a spec linking it to the same path under
+overlay/.
+
+git subtree does not record where a subtree came from, so subtrees are only
+imported when given with --subtree-url <dir>=<url>.
+
+Nothing else changes: review the config, remove the submodules or subtrees
+and run 'git-overlay init'. With --dry-run the config is printed instead.`,
+	// Like init, this starts a project in the current directory
+	Annotations: map[string]string{skipProjectAnnotation: ""},
+	Args:        cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configPath, err := cmd.Flags().GetString("config")
+		if err != nil {
+			return err
+		}
+		dryRun := flagBool(cmd, "dry-run")
+		if _, err := os.Stat(configPath); err == nil && !dryRun && !flagBool(cmd, "force") {
+			return fmt.Errorf("%w: config file %s (use --force to overwrite)", overlayerr.ErrConflict, configPath)
+		}
+
+		subtreeURLs := make(map[string]string)
+		flagURLs, err := cmd.Flags().GetStringArray("subtree-url")
+		if err != nil {
+			return err
+		}
+		for _, s := range flagURLs {
+			dir, url, ok := strings.Cut(s, "=")
+			if !ok || dir == "" || url == "" {
+				return fmt.Errorf("invalid --subtree-url %q, want <dir>=<url>", s)
+			}
+			subtreeURLs[strings.Trim(filepath.ToSlash(dir), "/")] = url
+		}
+
+		subs, err := git.ListSubmodules()
+		if err != nil {
+			return err
+		}
+		subtrees, err := git.ListSubtrees()
+		if err != nil {
+			return err
+		}
+		sources, warnings := legacySources(subs, subtrees, subtreeURLs, git.SuperprojectRemoteURL())
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+		}
+		if len(sources) == 0 {
+			return fmt.Errorf("no submodules or subtrees to import")
+		}
+
+		cfg, warnings, err := importedConfig(sources)
+		if err != nil {
+			return err
+		}
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+		}
+
+		data, err := yaml.Marshal(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to marshal config: %w", err)
+		}
+		if dryRun {
+			_, err := os.Stdout.Write(data)
+			return err
+		}
+		if err := os.WriteFile(configPath, data, 0644); err != nil {
+			return fmt.Errorf("failed to write config: %w", err)
+		}
+
+		fmt.Printf("Wrote %s with %d upstreams and %d specs\n", configPath, len(sources), len(cfg.Symlinks))
+		fmt.Println("Review it, remove the imported submodules or subtrees, then run 'git-overlay init'")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importSubmodulesCmd)
+	importSubmodulesCmd.Flags().StringArray("subtree-url", nil, "URL of a subtree, as <dir>=<url> (repeatable)")
+	importSubmodulesCmd.Flags().Bool("dry-run", false, "Print the config instead of writing it")
+}
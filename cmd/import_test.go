@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/git"
+)
+
+func TestLegacySources(t *testing.T) {
+	subs := []git.Submodule{
+		{Path: ".upstream", URL: "https://example.com/overlaid.git", Branch: "main"},
+		{Path: "vendor/lib", URL: "https://example.com/lib.git", Branch: "stable", Commit: "abc"},
+		{Path: "vendor/pinned", URL: "https://example.com/pinned.git", Branch: ".", Commit: "def"},
+		{Path: "vendor/sibling", URL: "../sibling.git", Branch: "main"},
+		{Path: "vendor/outside", URL: "../../../outside.git", Branch: "main"},
+	}
+	subtrees := []git.Subtree{
+		{Dir: "third/tool", Commit: "0123456789012345678901234567890123456789"},
+		{Dir: "third/other", Commit: "9876543210987654321098765432109876543210"},
+	}
+
+	sources, warnings := legacySources(subs, subtrees, map[string]string{"third/tool": "https://example.com/tool.git"}, "https://example.com/org/app.git")
+
+	want := []legacySource{
+		{path: "vendor/lib", url: "https://example.com/lib.git", ref: "stable"},
+		{path: "vendor/pinned", url: "https://example.com/pinned.git", ref: "def"},
+		{path: "vendor/sibling", url: "https://example.com/org/sibling.git", ref: "main"},
+		{path: "third/tool", url: "https://example.com/tool.git", ref: "0123456789012345678901234567890123456789"},
+	}
+	if !reflect.DeepEqual(sources, want) {
+		t.Errorf("legacySources() = %+v, want %+v", sources, want)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "vendor/outside skipped") || !strings.Contains(warnings[1], "--subtree-url third/other=") {
+		t.Errorf("warnings = %v, want vendor/outside and third/other skipped", warnings)
+	}
+
+	// Without a remote, relative URLs can't be resolved
+	sources, warnings = legacySources(subs[3:4], nil, nil, "")
+	if len(sources) != 0 || len(warnings) != 1 || !strings.Contains(warnings[0], "no remote") {
+		t.Errorf("legacySources() without a remote = %+v, %v", sources, warnings)
+	}
+}
+
+func TestImportedConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	for _, dir := range []string{"vendor/lib/.git", "vendor/lib/src", "other/lib"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	if err := os.WriteFile("vendor/lib/README", []byte("lib"), 0644); err != nil {
+		t.Fatalf("Failed to create README: %v", err)
+	}
+	if err := os.WriteFile("other/lib/x.c", []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create x.c: %v", err)
+	}
+
+	cfg, warnings, err := importedConfig([]legacySource{
+		{path: "vendor/lib", url: "https://example.com/lib.git", ref: "main"},
+		{path: "other/lib", url: "https://example.com/other.git", ref: "v1"},
+		{path: "missing/lib", url: "https://example.com/missing.git", ref: "v2"},
+	})
+	if err != nil {
+		t.Fatalf("importedConfig() error = %v", err)
+	}
+
+	if cfg.Upstream.URL != "https://example.com/lib.git" || cfg.Upstream.Ref != "main" {
+		t.Errorf("Upstream = %+v, want the first source", cfg.Upstream)
+	}
+	var names []string
+	for _, u := range cfg.Upstreams {
+		names = append(names, u.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"lib", "lib-2"}) {
+		t.Errorf("upstream names = %v, want lib and lib-2", names)
+	}
+
+	wantSpecs := []config.SymlinkSpec{
+		{From: "README", To: "vendor/lib/README"},
+		{From: "src", To: "vendor/lib/src"},
+		{From: "x.c", To: "other/lib/x.c", Upstream: "lib"},
+	}
+	if !reflect.DeepEqual(cfg.Symlinks, wantSpecs) {
+		t.Errorf("Symlinks = %+v, want %+v", cfg.Symlinks, wantSpecs)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "missing/lib") {
+		t.Errorf("warnings = %v, want missing/lib not checked out", warnings)
+	}
+}
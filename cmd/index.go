@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/git"
+)
+
+// upstreamIndexes loads the tree index of every git upstream checkout, keyed
+// by upstream name. Upstreams without an index are left out so callers fall
+// back to reading the checkout.
+func upstreamIndexes(cfg *config.Config) map[string]*git.TreeIndex {
+	indexes := make(map[string]*git.TreeIndex)
+	cache, err := userSettings().Cache()
+	if err != nil {
+		return indexes
+	}
+	cache = filepath.Join(cache, "index")
+
+	upstreams := map[string]config.UpstreamConfig{"": cfg.Upstream}
+	for _, named := range cfg.Upstreams {
+		upstreams[named.Name] = named.UpstreamConfig
+	}
+	for name, upstream := range upstreams {
+		if !upstream.IsGit() {
+			continue
+		}
+		if idx, err := git.LoadTreeIndex(config.UpstreamDir(name), cache); err == nil {
+			indexes[name] = idx
+		}
+	}
+	return indexes
+}
+
+// indexEntry looks up the upstream source of a managed file in its tree index
+func indexEntry(indexes map[string]*git.TreeIndex, upstream, source string) (git.TreeEntry, bool) {
+	idx := indexes[upstream]
+	if idx == nil {
+		return git.TreeEntry{}, false
+	}
+	e, ok := idx.Lookup(source)
+	// Symlinks in the tree hold a target, not the content a copy would have
+	return e, ok && e.Mode != "120000"
+}
+
+// syncedCopies tells whether managed copies still hold the content they were
+// last synced with, from the upstream tree at the commit recorded for them or
+// from the recorded checksums
+type syncedCopies struct {
+	cache   string
+	sums    config.Sums
+	indexes map[string]*git.TreeIndex // By upstream name and commit
+}
+
+// newSyncedCopies prepares the checks for a run, reading the checksums when
+// they are kept
+func newSyncedCopies(cfg *config.Config) *syncedCopies {
+	s := &syncedCopies{indexes: make(map[string]*git.TreeIndex)}
+	if cache, err := userSettings().Cache(); err == nil {
+		s.cache = filepath.Join(cache, "index")
+	}
+	if cfg.Checksums {
+		if sums, err := config.LoadSums(); err == nil {
+			s.sums = sums
+		}
+	}
+	return s
+}
+
+// unchanged reports whether the copy at dst is what mf was last synced as.
+// Without a recorded commit or checksum it can't tell, and reports false.
+func (s *syncedCopies) unchanged(mf *config.ManagedFile, dst string) bool {
+	if s == nil {
+		return false
+	}
+	if sum, ok := s.sums[mf.Path]; ok {
+		got, err := fileSHA256(dst)
+		return err == nil && got == sum
+	}
+	if mf.UpstreamSHA == "" || s.cache == "" {
+		return false
+	}
+	key := mf.Upstream + "@" + mf.UpstreamSHA
+	idx, ok := s.indexes[key]
+	if !ok {
+		idx, _ = git.LoadCommitIndex(config.UpstreamDir(mf.Upstream), mf.UpstreamSHA, s.cache)
+		s.indexes[key] = idx
+	}
+	if idx == nil {
+		return false
+	}
+	entry, ok := idx.Lookup(mf.Source)
+	if !ok {
+		return false
+	}
+	same, err := entry.Matches(dst)
+	return err == nil && same
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestCreateLinksKeepsUpToDateCopies(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream", 0755); err != nil {
+		t.Fatalf("Failed to create upstream: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(".upstream/"+name, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	for _, args := range [][]string{{"init", "-b", "main"}, {"add", "."}, {"commit", "-m", "Initial commit"}} {
+		if err := runGitCommand(".upstream", args); err != nil {
+			t.Fatalf("Failed to run git %v: %v", args, err)
+		}
+	}
+
+	cfg := &config.Config{
+		Upstream: config.UpstreamConfig{URL: "https://example.com/repo.git", Ref: "main"},
+		Symlinks: []config.SymlinkSpec{{String: "a.txt"}, {String: "b.txt"}},
+		LinkMode: "copy",
+	}
+	newCmd := func() *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("link-mode", "copy", "")
+		cmd.Flags().Bool("force", false, "")
+		return cmd
+	}
+
+	if err := CreateLinks(newCmd(), cfg); err != nil {
+		t.Fatalf("CreateLinks() error = %v", err)
+	}
+
+	// Unchanged copies don't count as existing targets on the next run
+	if err := CreateLinks(newCmd(), cfg); err != nil {
+		t.Fatalf("CreateLinks() on an up-to-date overlay error = %v", err)
+	}
+
+	// An edited copy still needs --force to be replaced
+	if err := os.WriteFile("overlay/b.txt", []byte("local edit"), 0644); err != nil {
+		t.Fatalf("Failed to edit copy: %v", err)
+	}
+	if err := CreateLinks(newCmd(), cfg); err == nil {
+		t.Error("CreateLinks() replaced an edited copy without --force")
+	}
+
+	// A source edited in the upstream checkout no longer matches its commit,
+	// so a copy of the committed content is out of date
+	if err := os.WriteFile(".upstream/a.txt", []byte("uncommitted"), 0644); err != nil {
+		t.Fatalf("Failed to edit source: %v", err)
+	}
+	if err := CreateLinks(newCmd(), cfg); err == nil {
+		t.Error("CreateLinks() kept a copy of content the checkout no longer has")
+	}
+	force := newCmd()
+	force.Flags().Set("force", "true")
+	if err := CreateLinks(force, cfg); err != nil {
+		t.Fatalf("CreateLinks() with --force error = %v", err)
+	}
+	if data, _ := os.ReadFile("overlay/a.txt"); string(data) != "uncommitted" {
+		t.Errorf("overlay/a.txt = %q, want the checked out content", data)
+	}
+}
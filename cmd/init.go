@@ -1,24 +1,61 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/rjocoleman/git-overlay/internal/config"
-	"github.com/rjocoleman/git-overlay/internal/git"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize a new overlay repository",
+	Long: `Initialize a new overlay repository from .git-overlay.yml.
+
+With --from, the config file is first written from the --from, --ref and
+--link flags, so a new overlay can be bootstrapped without writing it by hand.`,
+	// A new project starts in the current directory, never in one above it
+	Annotations: map[string]string{skipProjectAnnotation: "", lockAnnotation: ""},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		// A config written from flags is taken back if init fails, so a retry
+		// doesn't need --force
+		initialized := false
+		if cmd.Flags().Changed("from") {
+			undo, err := writeConfigFromFlags(cmd)
+			if err != nil {
+				return fmt.Errorf("failed to write config: %w", err)
+			}
+			defer func() {
+				if !initialized {
+					undo()
+				}
+			}()
+		}
+
 		cfg, err := loadConfig(cmd)
 		if err != nil {
 			return fmt.Errorf("failed to load config: %w", err)
 		}
 
+		// Work not yet committed could be overwritten halfway through
+		if err := checkDirty(cmd, cfg); err != nil {
+			return err
+		}
+
+		if err := applyTransportOptions(cmd); err != nil {
+			return err
+		}
+
+		// Ctrl-C stops init between steps rather than mid-checkout
+		defer trapInterrupts()()
+
 		// Remove existing .upstream directory if it exists
 		if err := os.RemoveAll(".upstream"); err != nil {
 			return fmt.Errorf("failed to remove existing .upstream directory: %w", err)
@@ -29,55 +66,167 @@ var initCmd = &cobra.Command{
 			return fmt.Errorf("failed to create overlay directory: %w", err)
 		}
 
-		// Initialize Git repository and add upstream submodule
-		repo, err := git.InitMainRepository()
-		if err != nil {
-			return fmt.Errorf("failed to initialize repository: %w", err)
-		}
-
-		if err := repo.AddUpstreamSubmodule(cfg.Upstream.URL); err != nil {
-			return fmt.Errorf("failed to add upstream submodule: %w", err)
+		// Fetch the upstream and check out the specified ref
+		if err := syncAllUpstreams(cfg, syncOptions{initialize: true, jobs: defaultSyncJobs}); err != nil {
+			return err
 		}
-
-		// Sync to the specified ref
-		if err := repo.SyncUpstream(cfg.Upstream.Ref); err != nil {
-			return fmt.Errorf("failed to sync upstream: %w", err)
+		if err := interrupted(); err != nil {
+			return err
 		}
 
 		// Create initial links
 		if err := CreateLinks(cmd, cfg); err != nil {
 			return fmt.Errorf("failed to create links: %w", err)
 		}
+		initialized = true
 
 		fmt.Println("Git overlay repository initialized successfully")
-		return nil
+		return commitRun(cmd, cfg, "init")
 	},
 }
 
 func init() {
+	initCmd.Flags().String("from", "", "Upstream repository URL to write a new config file for")
+	initCmd.Flags().String("ref", "main", "Upstream ref to track when using --from")
+	initCmd.Flags().StringArray("link", nil, "Path to link from upstream when using --from (repeatable)")
+	initCmd.Flags().Bool("commit", false, "Commit the new submodule, config, gitignore, state and overlay files")
+	initCmd.Flags().Bool("allow-dirty", false, "Run even with uncommitted changes under overlay/ or to the bookkeeping files")
+	addTransportFlags(initCmd)
 	rootCmd.AddCommand(initCmd)
 }
 
+// writeConfigFromFlags writes a new config file from the --from, --ref and
+// --link flags. The returned undo removes it again, or puts back the config
+// --force replaced.
+func writeConfigFromFlags(cmd *cobra.Command) (func(), error) {
+	configPath, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return nil, err
+	}
+	url, err := cmd.Flags().GetString("from")
+	if err != nil {
+		return nil, err
+	}
+	ref, err := cmd.Flags().GetString("ref")
+	if err != nil {
+		return nil, err
+	}
+	links, err := cmd.Flags().GetStringArray("link")
+	if err != nil {
+		return nil, err
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return nil, err
+	}
+
+	if url == "" {
+		return nil, config.ErrMissingURL
+	}
+	if ref == "" {
+		return nil, config.ErrMissingRef
+	}
+
+	// Never clobber an existing config unless forced
+	previous, err := os.ReadFile(configPath)
+	if err == nil && !force {
+		return nil, fmt.Errorf("%w: config file %s (use --force to overwrite)", overlayerr.ErrConflict, configPath)
+	}
+	undo := func() { os.Remove(configPath) }
+	if err == nil {
+		undo = func() { os.WriteFile(configPath, previous, 0644) }
+	}
+
+	cfg := config.Config{
+		Upstream: config.UpstreamConfig{
+			URL: url,
+			Ref: ref,
+		},
+	}
+	for _, link := range links {
+		cfg.Symlinks = append(cfg.Symlinks, config.SymlinkSpec{String: link})
+	}
+
+	data, err := yaml.Marshal(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		return nil, err
+	}
+	return undo, nil
+}
+
+// updateGitignore rewrites the managed block of .gitignore with the upstream
+// directories and the created links. Links are deduplicated and sorted, and
+// the file is left untouched when its content would not change.
 func updateGitignore(cfg *config.Config, createdLinks []string) error {
+	existing, updated, err := renderGitignore(cfg, createdLinks)
+	if err != nil {
+		return err
+	}
+
+	// Avoid needless rewrites so the file's mtime only changes with its content
+	if existing != nil && bytes.Equal(existing, updated) {
+		return nil
+	}
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(".gitignore"); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return config.WriteFileAtomic(".gitignore", updated, perm)
+}
+
+// renderGitignore returns the current .gitignore, nil when there is none,
+// and its content with the managed block replaced
+func renderGitignore(cfg *config.Config, createdLinks []string) ([]byte, []byte, error) {
 	// Create initial gitignore content
 	content := "# BEGIN GIT-OVERLAY MANAGED BLOCK - DO NOT EDIT\n"
 
-	// Add each created link to gitignore
+	// Keep the trash out of the parent repository
+	if cfg != nil && cfg.Trash.IsEnabled() {
+		content += "/" + filepath.ToSlash(cfg.Trash.Path()) + "/\n"
+	}
+	if cfg != nil {
+		content += "/" + filepath.ToSlash(cfg.Backup.Path()) + "/\n"
+	}
+
+	// Only git upstreams are tracked as a submodule; with upstream_dir,
+	// .upstream is a symlink, which a trailing slash wouldn't match
+	if cfg != nil && cfg.UpstreamDir != "" {
+		content += "/.upstream\n"
+	} else if cfg != nil && !cfg.Upstream.IsGit() {
+		content += "/.upstream/\n"
+	}
+	if cfg != nil && len(cfg.Upstreams) > 0 {
+		content += "/" + config.UpstreamsDir + "/\n"
+	}
+
+	// Add each created link to gitignore once, in a stable order
+	links := make([]string, 0, len(createdLinks))
+	seen := make(map[string]bool, len(createdLinks))
 	for _, link := range createdLinks {
+		link = filepath.ToSlash(link)
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	sort.Strings(links)
+	for _, link := range links {
 		content += link + "\n"
 	}
 
 	content += "# END GIT-OVERLAY MANAGED BLOCK"
 
-	// Check if .gitignore exists
-	if _, err := os.Stat(".gitignore"); os.IsNotExist(err) {
-		return os.WriteFile(".gitignore", []byte(content), 0644)
-	}
-
 	// Read existing .gitignore
 	existing, err := os.ReadFile(".gitignore")
+	if os.IsNotExist(err) {
+		return nil, []byte(content), nil
+	}
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	// Remove old managed block if it exists
@@ -103,7 +252,5 @@ func updateGitignore(cfg *config.Config, createdLinks []string) error {
 		newLines = append(newLines, "")
 	}
 	newLines = append(newLines, content)
-
-	// Write back to file
-	return os.WriteFile(".gitignore", []byte(strings.Join(newLines, "\n")), 0644)
+	return existing, []byte(strings.Join(newLines, "\n")), nil
 }
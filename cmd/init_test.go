@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestInitFromRemovesConfigOnFailure(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := runGitCommand(tmpDir, []string{"init", "-b", "main"}); err != nil {
+		t.Fatalf("Failed to init repository: %v", err)
+	}
+
+	newCmd := func(args ...string) *cobra.Command {
+		cmd := &cobra.Command{Use: "init", RunE: initCmd.RunE}
+		cmd.Flags().String("config", ".git-overlay.yml", "")
+		cmd.Flags().Bool("force", false, "")
+		cmd.Flags().String("from", "", "")
+		cmd.Flags().String("ref", "main", "")
+		cmd.Flags().StringArray("link", nil, "")
+		cmd.Flags().Bool("commit", false, "")
+		cmd.Flags().Bool("allow-dirty", true, "")
+		addTransportFlags(cmd)
+		if err := cmd.ParseFlags(args); err != nil {
+			t.Fatalf("Failed to parse flags: %v", err)
+		}
+		return cmd
+	}
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	// An upstream that can't be fetched leaves no config behind
+	cmd := newCmd("--from", missing)
+	if err := cmd.RunE(cmd, nil); err == nil {
+		t.Fatal("init --from succeeded against a missing upstream")
+	}
+	if _, err := os.Stat(".git-overlay.yml"); !os.IsNotExist(err) {
+		t.Errorf("Config left behind after a failed init: %v", err)
+	}
+
+	// A config replaced with --force is put back
+	if err := os.WriteFile(".git-overlay.yml", []byte("# mine\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cmd = newCmd("--from", missing, "--force")
+	if err := cmd.RunE(cmd, nil); err == nil {
+		t.Fatal("init --from --force succeeded against a missing upstream")
+	}
+	if data, err := os.ReadFile(".git-overlay.yml"); err != nil || string(data) != "# mine\n" {
+		t.Errorf("Config = %q, %v, want the replaced one put back", data, err)
+	}
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+// interruptExitCode is the exit status of a run stopped by a signal, as
+// shells report for Ctrl-C
+const interruptExitCode = 130
+
+// interruptSignal holds the signal received while interrupts are trapped
+var interruptSignal atomic.Pointer[os.Signal]
+
+// trapInterrupts defers Ctrl-C and SIGTERM while a command changes the
+// repository. The first signal is recorded for interrupted to report at the
+// next point where the run can stop cleanly; a second one exits at once. The
+// returned function restores the default handling.
+func trapInterrupts() func() {
+	signals := make(chan os.Signal, 2)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if interruptSignal.Swap(&sig) != nil {
+					fmt.Fprintln(os.Stderr, "Interrupted again, exiting without cleaning up")
+					os.Exit(interruptExitCode)
+				}
+				fmt.Fprintln(os.Stderr, "\nInterrupted, stopping after the current step (interrupt again to exit now)")
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+		interruptSignal.Store(nil)
+	}
+}
+
+// interrupted returns an error wrapping overlayerr.ErrInterrupted once a
+// trapped signal has been received, and nil before
+func interrupted() error {
+	if sig := interruptSignal.Load(); sig != nil {
+		return fmt.Errorf("%w (%v)", overlayerr.ErrInterrupted, *sig)
+	}
+	return nil
+}
+
+// ExitCode returns the exit status for an error returned by Execute
+func ExitCode(err error) int {
+	if errors.Is(err, overlayerr.ErrInterrupted) {
+		return interruptExitCode
+	}
+	return 1
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+	"github.com/spf13/cobra"
+)
+
+func TestTrapInterrupts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals can't be sent to the own process on windows")
+	}
+
+	stop := trapInterrupts()
+	if err := interrupted(); err != nil {
+		t.Fatalf("interrupted() before a signal = %v", err)
+	}
+
+	self, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("Failed to find own process: %v", err)
+	}
+	if err := self.Signal(os.Interrupt); err != nil {
+		t.Fatalf("Failed to send interrupt: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for interrupted() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	err = interrupted()
+	if !errors.Is(err, overlayerr.ErrInterrupted) {
+		t.Fatalf("interrupted() after a signal = %v, want %v", err, overlayerr.ErrInterrupted)
+	}
+	if code := ExitCode(err); code != interruptExitCode {
+		t.Errorf("ExitCode() = %d, want %d", code, interruptExitCode)
+	}
+
+	stop()
+	if err := interrupted(); err != nil {
+		t.Errorf("interrupted() after stop = %v", err)
+	}
+	if code := ExitCode(errors.New("boom")); code != 1 {
+		t.Errorf("ExitCode() for other errors = %d, want 1", code)
+	}
+}
+
+func TestCreateLinksInterrupted(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(".upstream/"+name, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("link-mode", "symlink", "")
+	cmd.Flags().Bool("force", true, "")
+
+	// A first run links a.txt
+	cfg := &config.Config{Symlinks: []config.SymlinkSpec{{String: "a.txt"}}}
+	if err := CreateLinks(cmd, cfg); err != nil {
+		t.Fatalf("CreateLinks() error = %v", err)
+	}
+
+	// The next one is interrupted before its first link
+	sig := os.Interrupt
+	interruptSignal.Store(&sig)
+	defer interruptSignal.Store(nil)
+
+	cfg.Symlinks = append(cfg.Symlinks, config.SymlinkSpec{String: "b.txt"})
+	if err := CreateLinks(cmd, cfg); !errors.Is(err, overlayerr.ErrInterrupted) {
+		t.Fatalf("CreateLinks() error = %v, want %v", err, overlayerr.ErrInterrupted)
+	}
+	if _, err := os.Lstat("overlay/b.txt"); err == nil {
+		t.Error("overlay/b.txt was linked after the interrupt")
+	}
+
+	// What is on disk is still recorded
+	state, err := config.LoadState()
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if managed, _ := state.IsManagedFile("a.txt"); !managed {
+		t.Error("a.txt was dropped from the state")
+	}
+	if managed, _ := state.IsManagedFile("b.txt"); managed {
+		t.Error("b.txt is in the state but was never linked")
+	}
+	gitignore, err := os.ReadFile(".gitignore")
+	if err != nil {
+		t.Fatalf("Failed to read .gitignore: %v", err)
+	}
+	if !strings.Contains(string(gitignore), "overlay/a.txt") {
+		t.Errorf("overlay/a.txt is no longer ignored:\n%s", gitignore)
+	}
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+)
+
+// specError is the failure of one spec, collected under --keep-going
+type specError struct {
+	spec string // Source path of the spec, as in the config
+	err  error
+}
+
+func (e *specError) Error() string {
+	return fmt.Sprintf("%s: %v", e.spec, e.err)
+}
+
+func (e *specError) Unwrap() error {
+	return e.err
+}
+
+// keepGoingError reports every failure collected under --keep-going, one
+// per line, after everything else has been applied
+func keepGoingError(failed []error) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d link errors, everything else was applied:\n%w", len(failed), errors.Join(failed...))
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestCreateLinksKeepGoing(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+	for _, name := range []string{"a.txt", "c.txt"} {
+		if err := os.WriteFile(".upstream/"+name, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+	}
+
+	cfg := &config.Config{
+		Symlinks: []config.SymlinkSpec{{String: "a.txt"}, {String: "missing.txt"}, {String: "gone/b.txt"}, {String: "c.txt"}},
+	}
+	newCmd := func(keepGoing bool) *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("link-mode", "symlink", "")
+		cmd.Flags().Bool("force", true, "")
+		cmd.Flags().Bool("keep-going", keepGoing, "")
+		return cmd
+	}
+
+	// Without --keep-going the first failing spec stops the run
+	if err := CreateLinks(newCmd(false), cfg); err == nil {
+		t.Fatal("CreateLinks() succeeded with a missing source")
+	}
+	if _, err := os.Lstat("overlay/a.txt"); err == nil {
+		t.Error("overlay/a.txt was linked although the run stopped")
+	}
+
+	err = CreateLinks(newCmd(true), cfg)
+	if err == nil {
+		t.Fatal("CreateLinks() with --keep-going did not report the failures")
+	}
+	for _, want := range []string{"2 link errors", "missing.txt: source does not exist", "gone/b.txt: source does not exist"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error = %v, want it to contain %q", err, want)
+		}
+	}
+	var specErr *specError
+	if !errors.As(err, &specErr) {
+		t.Errorf("error = %v, want a *specError", err)
+	}
+
+	for _, path := range []string{"overlay/a.txt", "overlay/c.txt"} {
+		if _, err := os.Lstat(path); err != nil {
+			t.Errorf("%s was not linked: %v", path, err)
+		}
+	}
+	state, err := config.LoadState()
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if len(state.ManagedFiles) != 2 {
+		t.Errorf("State has %d entries, want 2", len(state.ManagedFiles))
+	}
+}
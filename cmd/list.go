@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// syncedTimeFormat is how sync times are shown, in local time
+const syncedTimeFormat = "2006-01-02 15:04"
+
+// syncedNote describes when a managed file was last materialized and from
+// which upstream commit, or "" when the state predates recording it
+func syncedNote(mf config.ManagedFile) string {
+	if mf.SyncedAt == nil {
+		return ""
+	}
+	note := "synced " + mf.SyncedAt.Local().Format(syncedTimeFormat)
+	if mf.UpstreamSHA != "" {
+		note += " from " + shortID(mf.UpstreamSHA)
+	}
+	return note
+}
+
+// sortManagedFiles orders managed files by path, or by sync time with the
+// longest unsynced first and files without a recorded time before those
+func sortManagedFiles(files []config.ManagedFile, bySync bool) {
+	sort.SliceStable(files, func(i, j int) bool {
+		if bySync {
+			a, b := files[i].SyncedAt, files[j].SyncedAt
+			switch {
+			case a == nil && b != nil:
+				return true
+			case a != nil && b == nil:
+				return false
+			case a != nil && !a.Equal(*b):
+				return a.Before(*b)
+			}
+		}
+		return files[i].Path < files[j].Path
+	})
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List managed files with when and from which commit they were synced",
+	Long: `List every file git-overlay manages in overlay/ with its link mode, when it
+was last materialized and the upstream commit it came from. Files synced long
+before the rest, by a run limited with --only or one that failed partway,
+stand out with --sort synced, which lists the longest unsynced first.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		sortBy, err := cmd.Flags().GetString("sort")
+		if err != nil {
+			return err
+		}
+		if sortBy != "path" && sortBy != "synced" {
+			return fmt.Errorf("invalid --sort %q, want path or synced", sortBy)
+		}
+
+		state, err := loadState(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+
+		files := append([]config.ManagedFile(nil), state.ManagedFiles...)
+		sortManagedFiles(files, sortBy == "synced")
+
+		if flagBool(cmd, "json") {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(files)
+		}
+
+		for _, mf := range files {
+			synced, commit := "-", "-"
+			if mf.SyncedAt != nil {
+				synced = mf.SyncedAt.Local().Format(syncedTimeFormat)
+			}
+			if mf.UpstreamSHA != "" {
+				commit = shortID(mf.UpstreamSHA)
+			}
+			fmt.Printf("%-10s %-16s %-7s overlay/%s\n", mf.LinkMode, synced, commit, mf.Path)
+		}
+		return nil
+	},
+}
+
+func init() {
+	listCmd.Flags().String("sort", "path", "Order by path or synced (longest unsynced first)")
+	listCmd.Flags().Bool("json", false, "Print the managed files as JSON")
+	rootCmd.AddCommand(listCmd)
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestCreateLinksRecordsSync(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream", 0755); err != nil {
+		t.Fatalf("Failed to create upstream: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(".upstream/"+name, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	for _, args := range [][]string{{"init", "-b", "main"}, {"add", "."}, {"commit", "-m", "Initial commit"}} {
+		if err := runGitCommand(".upstream", args); err != nil {
+			t.Fatalf("Failed to run git %v: %v", args, err)
+		}
+	}
+	out, err := exec.Command("git", "-C", ".upstream", "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatalf("Failed to read upstream HEAD: %v", err)
+	}
+	head := strings.TrimSpace(string(out))
+
+	cfg := &config.Config{
+		Upstream: config.UpstreamConfig{URL: "https://example.com/repo.git", Ref: "main"},
+		Symlinks: []config.SymlinkSpec{{String: "a.txt"}, {String: "b.txt"}},
+	}
+	cmd := &cobra.Command{}
+	cmd.Flags().String("link-mode", "symlink", "")
+	cmd.Flags().Bool("force", false, "")
+
+	before := time.Now()
+	if err := CreateLinks(cmd, cfg); err != nil {
+		t.Fatalf("CreateLinks() error = %v", err)
+	}
+
+	state, err := config.LoadState()
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if len(state.ManagedFiles) != 2 {
+		t.Fatalf("State has %d files, want 2", len(state.ManagedFiles))
+	}
+	for _, mf := range state.ManagedFiles {
+		if mf.SyncedAt == nil || mf.SyncedAt.Before(before.Truncate(time.Second)) {
+			t.Errorf("%s synced_at = %v, want the time of the run", mf.Path, mf.SyncedAt)
+		}
+		if mf.UpstreamSHA != head {
+			t.Errorf("%s upstream_sha = %q, want %q", mf.Path, mf.UpstreamSHA, head)
+		}
+		if note := syncedNote(mf); !strings.HasSuffix(note, "from "+head[:7]) {
+			t.Errorf("syncedNote() = %q, want the short commit", note)
+		}
+	}
+
+	// Linking the same commit again keeps when each file was synced
+	earlier := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := range state.ManagedFiles {
+		state.ManagedFiles[i].SyncedAt = &earlier
+	}
+	if err := state.SaveState(); err != nil {
+		t.Fatalf("SaveState() error = %v", err)
+	}
+	if err := cmd.Flags().Set("force", "true"); err != nil {
+		t.Fatalf("Failed to set --force: %v", err)
+	}
+	if err := os.Remove("overlay/b.txt"); err != nil {
+		t.Fatalf("Failed to remove b.txt: %v", err)
+	}
+	if err := CreateLinks(cmd, cfg); err != nil {
+		t.Fatalf("CreateLinks() error = %v", err)
+	}
+	state, err = config.LoadState()
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if _, mf := state.IsManagedFile("a.txt"); mf == nil || mf.SyncedAt == nil || !mf.SyncedAt.Equal(earlier) {
+		t.Errorf("a.txt synced_at = %v, want %v kept", mf.SyncedAt, earlier)
+	}
+	// A file whose content came back is synced again
+	if _, mf := state.IsManagedFile("b.txt"); mf == nil || mf.SyncedAt == nil || mf.SyncedAt.Equal(earlier) {
+		t.Errorf("b.txt synced_at = %v, want the time of the run", mf.SyncedAt)
+	}
+}
+
+func TestSortManagedFiles(t *testing.T) {
+	day := func(d int) *time.Time {
+		at := time.Date(2026, 1, d, 0, 0, 0, 0, time.UTC)
+		return &at
+	}
+	files := []config.ManagedFile{
+		{Path: "c.txt", SyncedAt: day(1)},
+		{Path: "a.txt", SyncedAt: day(3)},
+		{Path: "b.txt", SyncedAt: day(1)},
+		{Path: "d.txt"},
+	}
+
+	sortManagedFiles(files, false)
+	if got := managedPaths(files); got != "a.txt b.txt c.txt d.txt" {
+		t.Errorf("sortManagedFiles() by path = %s", got)
+	}
+
+	// Never recorded first, then the longest unsynced, ties by path
+	sortManagedFiles(files, true)
+	if got := managedPaths(files); got != "d.txt b.txt c.txt a.txt" {
+		t.Errorf("sortManagedFiles() by sync = %s", got)
+	}
+
+	if note := syncedNote(config.ManagedFile{Path: "d.txt"}); note != "" {
+		t.Errorf("syncedNote() without a sync time = %q, want none", note)
+	}
+}
+
+func managedPaths(files []config.ManagedFile) string {
+	var paths []string
+	for _, mf := range files {
+		paths = append(paths, mf.Path)
+	}
+	return strings.Join(paths, " ")
+}
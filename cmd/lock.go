@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+// lockAnnotation marks commands that change overlay/ or the state, which
+// hold the repository lock while they run. A value names a flag the command
+// only changes anything with, and only takes the lock when set.
+const lockAnnotation = "git-overlay/lock"
+
+const (
+	lockHeartbeat  = 30 * time.Second // How often a held lock file is touched
+	lockStaleAfter = 5 * time.Minute  // A lock file untouched this long was left by a run that died
+)
+
+// lockOwner is written to the lock file to say who holds it
+type lockOwner struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Command string    `json:"command"`
+	Started time.Time `json:"started"`
+}
+
+// repoLock is a held repository lock
+type repoLock struct {
+	path string
+	data []byte // What was written to the lock file, to tell it is still ours
+	stop chan struct{}
+	done chan struct{}
+}
+
+// heldLock is the lock taken for the command being run, released by Execute
+var heldLock *repoLock
+
+// lockCommand takes the repository lock for commands annotated with
+// lockAnnotation
+func lockCommand(cmd *cobra.Command) error {
+	flag, ok := cmd.Annotations[lockAnnotation]
+	if !ok || (flag != "" && !flagBool(cmd, flag)) {
+		return nil
+	}
+	lock, err := acquireRepoLock(cmd.Name())
+	if err != nil {
+		return err
+	}
+	heldLock = lock
+	return nil
+}
+
+// acquireRepoLock takes the repository lock by creating a lock file in the
+// git directory exclusively, which works on NFS where flock doesn't. A lock
+// whose holder has exited on this host, or that hasn't been touched for
+// lockStaleAfter, is broken. Outside a git repository there is nothing to
+// lock and nil is returned.
+func acquireRepoLock(command string) (*repoLock, error) {
+	dir, err := config.GitDir()
+	if err != nil {
+		return nil, nil
+	}
+	path := filepath.Join(dir, "git-overlay", "lock")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+
+	host, _ := os.Hostname()
+	data, err := json.Marshal(lockOwner{PID: os.Getpid(), Host: host, Command: command, Started: time.Now().UTC()})
+	if err != nil {
+		return nil, err
+	}
+
+	// A second attempt follows breaking a stale lock
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.Write(data)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock %s: %w", path, err)
+			}
+			return startLockHeartbeat(path, data), nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create lock %s: %w", path, err)
+		}
+
+		held, owner, stale := readLock(path, host)
+		if !stale || attempt > 0 {
+			return nil, fmt.Errorf("%w: %s (lock file %s)", overlayerr.ErrLocked, describeLockOwner(owner), path)
+		}
+		if err := breakStaleLock(path, held); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: removed stale lock left by %s\n", describeLockOwner(owner))
+	}
+}
+
+// readLock reads the lock file at path and works out whether it is stale. A
+// lock file removed in the meantime counts as stale, so the caller retries.
+func readLock(path, host string) ([]byte, lockOwner, bool) {
+	var owner lockOwner
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, owner, os.IsNotExist(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, owner, os.IsNotExist(err)
+	}
+	// A lock file being written may not parse yet; it is only stale by age
+	parsed := json.Unmarshal(data, &owner) == nil
+	if time.Since(info.ModTime()) > lockStaleAfter {
+		return data, owner, true
+	}
+	return data, owner, parsed && owner.Host == host && owner.PID > 0 && !processAlive(owner.PID)
+}
+
+// breakStaleLock removes a stale lock file whose content was held. It is
+// renamed aside first, and put back if another run replaced it since it was
+// read, so two runs breaking the same lock can't remove a fresh one.
+func breakStaleLock(path string, held []byte) error {
+	aside := path + ".stale." + strconv.Itoa(os.Getpid())
+	if err := os.Rename(path, aside); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to break stale lock %s: %w", path, err)
+	}
+	if data, err := os.ReadFile(aside); err == nil && held != nil && !bytes.Equal(data, held) {
+		os.Rename(aside, path)
+		return fmt.Errorf("%w: another run took the lock (lock file %s)", overlayerr.ErrLocked, path)
+	}
+	return os.Remove(aside)
+}
+
+// describeLockOwner names the run holding a lock for messages
+func describeLockOwner(owner lockOwner) string {
+	if owner.PID == 0 {
+		return "an unknown run"
+	}
+	return fmt.Sprintf("'%s' (pid %d on %s, since %s)", owner.Command, owner.PID, owner.Host, owner.Started.Local().Format(time.DateTime))
+}
+
+// startLockHeartbeat touches the lock file while it is held, so other hosts
+// can tell a live lock from one left by a run that died
+func startLockHeartbeat(path string, data []byte) *repoLock {
+	l := &repoLock{path: path, data: data, stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(l.done)
+		ticker := time.NewTicker(lockHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.stop:
+				return
+			case now := <-ticker.C:
+				os.Chtimes(path, now, now)
+			}
+		}
+	}()
+	return l
+}
+
+// release gives the lock up, leaving the lock file alone if another run
+// broke the lock in the meantime. A nil lock is a no-op.
+func (l *repoLock) release() {
+	if l == nil {
+		return
+	}
+	close(l.stop)
+	<-l.done
+	if data, err := os.ReadFile(l.path); err == nil && bytes.Equal(data, l.data) {
+		os.Remove(l.path)
+	}
+}
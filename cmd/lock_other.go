@@ -0,0 +1,16 @@
+//go:build !unix
+
+package cmd
+
+import "os"
+
+// processAlive reports whether a process with pid runs on this host. Finding
+// a process fails once it has exited on Windows.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
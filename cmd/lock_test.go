@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+	"github.com/spf13/cobra"
+)
+
+func TestAcquireRepoLock(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	// Outside a git repository there is nothing to lock
+	if lock, err := acquireRepoLock("sync"); lock != nil || err != nil {
+		t.Fatalf("acquireRepoLock() outside a repository = %v, %v", lock, err)
+	}
+
+	if err := os.Mkdir(".git", 0755); err != nil {
+		t.Fatalf("Failed to create .git: %v", err)
+	}
+	lockFile := filepath.Join(".git", "git-overlay", "lock")
+
+	lock, err := acquireRepoLock("sync")
+	if err != nil {
+		t.Fatalf("acquireRepoLock() error = %v", err)
+	}
+	if _, err := acquireRepoLock("relink"); !errors.Is(err, overlayerr.ErrLocked) {
+		t.Errorf("acquireRepoLock() while held = %v, want %v", err, overlayerr.ErrLocked)
+	}
+	lock.release()
+	if _, err := os.Stat(lockFile); !os.IsNotExist(err) {
+		t.Fatalf("Expected release() to remove the lock file, got %v", err)
+	}
+
+	host, _ := os.Hostname()
+	exited := exec.Command("git", "--version")
+	if err := exited.Run(); err != nil {
+		t.Fatalf("Failed to run git: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		owner     lockOwner
+		age       time.Duration
+		wantTaken bool
+	}{
+		{
+			name:  "live holder",
+			owner: lockOwner{PID: os.Getpid(), Host: host, Command: "sync"},
+		},
+		{
+			name:      "holder exited on this host",
+			owner:     lockOwner{PID: exited.Process.Pid, Host: host, Command: "sync"},
+			wantTaken: true,
+		},
+		{
+			name:  "holder on another host",
+			owner: lockOwner{PID: exited.Process.Pid, Host: "elsewhere.invalid", Command: "sync"},
+		},
+		{
+			name:      "lock not touched for too long",
+			owner:     lockOwner{PID: os.Getpid(), Host: "elsewhere.invalid", Command: "sync"},
+			age:       2 * lockStaleAfter,
+			wantTaken: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.owner)
+			if err != nil {
+				t.Fatalf("Failed to encode lock owner: %v", err)
+			}
+			if err := os.WriteFile(lockFile, data, 0644); err != nil {
+				t.Fatalf("Failed to write lock file: %v", err)
+			}
+			defer os.Remove(lockFile)
+			if tt.age > 0 {
+				old := time.Now().Add(-tt.age)
+				if err := os.Chtimes(lockFile, old, old); err != nil {
+					t.Fatalf("Failed to age lock file: %v", err)
+				}
+			}
+
+			lock, err := acquireRepoLock("relink")
+			if !tt.wantTaken {
+				if !errors.Is(err, overlayerr.ErrLocked) {
+					t.Errorf("acquireRepoLock() = %v, want %v", err, overlayerr.ErrLocked)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("acquireRepoLock() error = %v, want the stale lock broken", err)
+			}
+			lock.release()
+		})
+	}
+}
+
+func TestLockCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+	defer func() { heldLock.release(); heldLock = nil }()
+
+	if err := os.Mkdir(".git", 0755); err != nil {
+		t.Fatalf("Failed to create .git: %v", err)
+	}
+	lockFile := filepath.Join(".git", "git-overlay", "lock")
+
+	// status only takes the lock when --fix is given
+	cmd := &cobra.Command{Use: "status", Annotations: statusCmd.Annotations}
+	cmd.Flags().Bool("fix", false, "")
+	if err := lockCommand(cmd); err != nil {
+		t.Fatalf("lockCommand() error = %v", err)
+	}
+	if _, err := os.Stat(lockFile); !os.IsNotExist(err) {
+		t.Fatalf("status without --fix took the lock: %v", err)
+	}
+
+	cmd.Flags().Set("fix", "true")
+	if err := lockCommand(cmd); err != nil {
+		t.Fatalf("lockCommand() with --fix error = %v", err)
+	}
+	if _, err := os.Stat(lockFile); err != nil {
+		t.Fatalf("status --fix did not take the lock: %v", err)
+	}
+}
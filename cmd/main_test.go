@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// TestMain points the user settings at an empty directory, so settings and
+// auth helpers of the machine running the tests don't leak into them
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "git-overlay-config")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// manPageName returns the man page name of a command, git-overlay-sync for
+// git-overlay sync, as git help looks them up
+func manPageName(cmd *cobra.Command) string {
+	return strings.ReplaceAll(cmd.CommandPath(), " ", "-")
+}
+
+// roffEscape escapes text for use in a roff document
+func roffEscape(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\e`)
+	text = strings.ReplaceAll(text, "-", `\-`)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		// Lines starting with a control character would be read as requests
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderManPage renders the man page of a command in section 1
+func renderManPage(cmd *cobra.Command) []byte {
+	var b bytes.Buffer
+	name := manPageName(cmd)
+
+	fmt.Fprintf(&b, ".TH %s 1 \"\" \"git-overlay %s\" \"Git Overlay Manual\"\n", strings.ToUpper(name), version)
+	fmt.Fprintf(&b, ".SH NAME\n%s \\- %s\n", roffEscape(name), roffEscape(cmd.Short))
+	fmt.Fprintf(&b, ".SH SYNOPSIS\n.B %s\n", roffEscape(cmd.UseLine()))
+
+	description := cmd.Long
+	if description == "" {
+		description = cmd.Short
+	}
+	b.WriteString(".SH DESCRIPTION\n")
+	for i, para := range strings.Split(strings.TrimSpace(description), "\n\n") {
+		if i > 0 {
+			b.WriteString(".PP\n")
+		}
+		b.WriteString(roffEscape(para) + "\n")
+	}
+
+	writeFlags := func(title string, flags *pflag.FlagSet) {
+		if !flags.HasAvailableFlags() {
+			return
+		}
+		fmt.Fprintf(&b, ".SH %s\n", title)
+		flags.VisitAll(func(f *pflag.Flag) {
+			if f.Hidden {
+				return
+			}
+			b.WriteString(".TP\n")
+			if f.Shorthand != "" {
+				fmt.Fprintf(&b, "\\fB\\-%s\\fR, ", f.Shorthand)
+			}
+			fmt.Fprintf(&b, "\\fB\\-\\-%s\\fR", roffEscape(f.Name))
+			if f.Value.Type() != "bool" {
+				fmt.Fprintf(&b, " \\fI%s\\fR", f.Value.Type())
+			}
+			b.WriteString("\n" + roffEscape(f.Usage) + "\n")
+		})
+	}
+	writeFlags("OPTIONS", cmd.NonInheritedFlags())
+	writeFlags("GLOBAL OPTIONS", cmd.InheritedFlags())
+
+	var related []string
+	if cmd.HasParent() {
+		related = append(related, manPageName(cmd.Parent()))
+	}
+	for _, sub := range cmd.Commands() {
+		if sub.IsAvailableCommand() {
+			related = append(related, manPageName(sub))
+		}
+	}
+	if len(related) > 0 {
+		b.WriteString(".SH SEE ALSO\n")
+		for i, page := range related {
+			sep := ","
+			if i == len(related)-1 {
+				sep = ""
+			}
+			fmt.Fprintf(&b, ".BR %s (1)%s\n", roffEscape(page), sep)
+		}
+	}
+	return b.Bytes()
+}
+
+// writeManPages writes the man pages of cmd and its available subcommands
+// into dir, returning how many were written
+func writeManPages(cmd *cobra.Command, dir string) (int, error) {
+	path := filepath.Join(dir, manPageName(cmd)+".1")
+	if err := os.WriteFile(path, renderManPage(cmd), 0644); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	written := 1
+	for _, sub := range cmd.Commands() {
+		if !sub.IsAvailableCommand() || sub.IsAdditionalHelpTopicCommand() {
+			continue
+		}
+		n, err := writeManPages(sub, dir)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+var manCmd = &cobra.Command{
+	Use:   "man [dir]",
+	Short: "Write man pages for git-overlay and its commands",
+	Long: `Write a man page for git-overlay and one per command (git-overlay-sync.1 and
+so on) into dir, the current directory by default. Installed on the man path,
+they make "git overlay --help" and "git help overlay" work like they do for
+git's own commands.`,
+	Args:        cobra.MaximumNArgs(1),
+	Annotations: map[string]string{skipProjectAnnotation: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := "."
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+		n, err := writeManPages(cmd.Root(), dir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %d man pages to %s\n", n, dir)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(manCmd)
+}
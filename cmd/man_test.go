@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestWriteManPages(t *testing.T) {
+	root := &cobra.Command{Use: "git-overlay", Short: "Manage overlays"}
+	root.PersistentFlags().BoolP("force", "f", false, "Force overwrite")
+	sub := &cobra.Command{
+		Use:   "sync",
+		Short: "Update upstream code",
+		Long:  "Update the upstream.\n\n.upstream is fetched first; see C:\\path for -x.",
+		Run:   func(cmd *cobra.Command, args []string) {},
+	}
+	sub.Flags().Int("jobs", 4, "Number of upstreams")
+	root.AddCommand(sub)
+	root.AddCommand(&cobra.Command{Use: "hidden", Hidden: true, Run: func(cmd *cobra.Command, args []string) {}})
+
+	dir := t.TempDir()
+	n, err := writeManPages(root, dir)
+	if err != nil {
+		t.Fatalf("writeManPages() error = %v", err)
+	}
+	if n != 2 {
+		t.Errorf("writeManPages() wrote %d pages, want 2", n)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "git-overlay-hidden.1")); err == nil {
+		t.Error("Expected no man page for a hidden command")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "git-overlay-sync.1"))
+	if err != nil {
+		t.Fatalf("Failed to read man page: %v", err)
+	}
+	page := string(data)
+	for _, want := range []string{
+		".TH GIT-OVERLAY-SYNC 1",
+		"git\\-overlay\\-sync \\- Update upstream code",
+		".PP\n\\&.upstream is fetched first; see C:\\epath for \\-x.",
+		"\\fB\\-\\-jobs\\fR \\fIint\\fR\nNumber of upstreams",
+		".SH GLOBAL OPTIONS",
+		"\\fB\\-f\\fR, \\fB\\-\\-force\\fR\nForce overwrite",
+		".BR git\\-overlay (1)",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("man page missing %q:\n%s", want, page)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// overlayManifest records which third-party content is embedded in overlay/
+type overlayManifest struct {
+	Upstreams []manifestUpstream `json:"upstreams"`
+	Files     []manifestFile     `json:"files"`
+}
+
+// manifestUpstream describes one upstream and the version that was synced
+type manifestUpstream struct {
+	Name     string           `json:"name,omitempty"`
+	Type     string           `json:"type"`
+	Location string           `json:"location"`
+	Ref      string           `json:"ref"`
+	Commit   string           `json:"commit,omitempty"`
+	License  *manifestLicense `json:"license,omitempty"`
+}
+
+// manifestLicense identifies the license file shipped with an upstream
+type manifestLicense struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// manifestFile is a file materialized in overlay/
+type manifestFile struct {
+	Path     string `json:"path"`
+	Source   string `json:"source"`
+	Upstream string `json:"upstream,omitempty"`
+	SHA256   string `json:"sha256"`
+}
+
+// upstreamLocation returns where an upstream's content comes from
+func upstreamLocation(u config.UpstreamConfig) string {
+	switch u.Type {
+	case config.UpstreamTypeRelease:
+		if u.Host == "gitlab" {
+			return "https://gitlab.com/" + u.Repo
+		}
+		return "https://github.com/" + u.Repo
+	case config.UpstreamTypeGoMod:
+		return u.Module
+	case config.UpstreamTypeOCI:
+		return u.Image
+	}
+	if u.URL != "" {
+		return u.URL
+	}
+	return u.Type
+}
+
+// licenseNames are upstream root files recognized as the license
+var licenseNames = []string{"LICENSE", "LICENSE.md", "LICENSE.txt", "LICENCE", "COPYING", "COPYING.md", "COPYING.txt"}
+
+// describeUpstream collects the manifest entry for the upstream checked out in dir
+func describeUpstream(name string, u config.UpstreamConfig, dir string) manifestUpstream {
+	entry := manifestUpstream{
+		Name:     name,
+		Type:     u.Type,
+		Location: upstreamLocation(u),
+		Ref:      u.Ref,
+	}
+	if entry.Type == "" {
+		entry.Type = config.UpstreamTypeGit
+	}
+
+	if u.IsGit() {
+		if repo, err := gogit.PlainOpen(dir); err == nil {
+			if head, err := repo.Head(); err == nil {
+				entry.Commit = head.Hash().String()
+			}
+		}
+	}
+
+	for _, license := range licenseNames {
+		if sum, err := fileSHA256(filepath.Join(dir, license)); err == nil {
+			entry.License = &manifestLicense{Path: license, SHA256: sum}
+			break
+		}
+	}
+	return entry
+}
+
+// upstreamCommits returns the commit checked out for each git upstream, by
+// upstream name with "" for .upstream
+func upstreamCommits(cfg *config.Config) map[string]string {
+	commits := make(map[string]string)
+	add := func(name string, u config.UpstreamConfig) {
+		if !u.IsGit() {
+			return
+		}
+		if repo, err := gogit.PlainOpen(config.UpstreamDir(name)); err == nil {
+			if head, err := repo.Head(); err == nil {
+				commits[name] = head.Hash().String()
+			}
+		}
+	}
+	add("", cfg.Upstream)
+	for _, named := range cfg.Upstreams {
+		add(named.Name, named.UpstreamConfig)
+	}
+	return commits
+}
+
+// buildManifest describes the configured upstreams and the managed files
+func buildManifest(cfg *config.Config, state *config.State) (*overlayManifest, error) {
+	m := &overlayManifest{
+		Upstreams: []manifestUpstream{describeUpstream("", cfg.Upstream, config.UpstreamDir(""))},
+		Files:     []manifestFile{},
+	}
+	for _, named := range cfg.Upstreams {
+		m.Upstreams = append(m.Upstreams, describeUpstream(named.Name, named.UpstreamConfig, config.UpstreamDir(named.Name)))
+	}
+
+	for _, mf := range state.ManagedFiles {
+		// Directories from dirs: have no upstream source
+		if mf.Source == "" {
+			continue
+		}
+		sum, err := fileSHA256(filepath.Join(config.UpstreamDir(mf.Upstream), mf.Source))
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash source of overlay/%s: %w", mf.Path, err)
+		}
+		m.Files = append(m.Files, manifestFile{
+			Path:     "overlay/" + mf.Path,
+			Source:   mf.Source,
+			Upstream: mf.Upstream,
+			SHA256:   sum,
+		})
+	}
+	return m, nil
+}
+
+// manifestPaths lists the files materialized in overlay/, relative to it and
+// sorted. Directories from dirs: are left out so archivers don't pull in
+// everything below them, as are entries missing from overlay/.
+func manifestPaths(state *config.State) []string {
+	var paths []string
+	for _, mf := range state.ManagedFiles {
+		if mf.LinkMode == dirLinkMode {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join("overlay", mf.Path)); err != nil {
+			continue
+		}
+		paths = append(paths, filepath.ToSlash(mf.Path))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// fileSHA256 returns the hex SHA-256 of a file's content
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+var spdxIDUnsafe = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// spdxID builds an SPDX element identifier from arbitrary text
+func spdxID(kind, name string) string {
+	return "SPDXRef-" + kind + "-" + strings.Trim(spdxIDUnsafe.ReplaceAllString(name, "-"), "-")
+}
+
+// upstreamKey identifies an upstream in generated documents
+func upstreamKey(name string) string {
+	if name == "" {
+		return "upstream"
+	}
+	return name
+}
+
+// toSPDX renders the manifest as an SPDX 2.3 JSON document
+func (m *overlayManifest) toSPDX(created time.Time) map[string]interface{} {
+	var packages, files, relationships []interface{}
+	contents, _ := json.Marshal(m)
+	sum := sha256.Sum256(contents)
+
+	for _, u := range m.Upstreams {
+		id := spdxID("Package", upstreamKey(u.Name))
+		pkg := map[string]interface{}{
+			"name":             u.Location,
+			"SPDXID":           id,
+			"versionInfo":      u.Ref,
+			"downloadLocation": u.Location,
+			"filesAnalyzed":    false,
+			"licenseConcluded": "NOASSERTION",
+			"licenseDeclared":  "NOASSERTION",
+			"copyrightText":    "NOASSERTION",
+		}
+		if u.Commit != "" {
+			pkg["versionInfo"] = u.Commit
+			pkg["downloadLocation"] = "git+" + u.Location + "@" + u.Commit
+		}
+		if u.License != nil {
+			pkg["comment"] = fmt.Sprintf("License file %s sha256:%s", u.License.Path, u.License.SHA256)
+		}
+		packages = append(packages, pkg)
+		relationships = append(relationships, map[string]interface{}{
+			"spdxElementId":      "SPDXRef-DOCUMENT",
+			"relationshipType":   "DESCRIBES",
+			"relatedSpdxElement": id,
+		})
+	}
+
+	for i, f := range m.Files {
+		id := spdxID("File", fmt.Sprintf("%d-%s", i, f.Path))
+		files = append(files, map[string]interface{}{
+			"fileName": "./" + f.Path,
+			"SPDXID":   id,
+			"checksums": []interface{}{
+				map[string]interface{}{"algorithm": "SHA256", "checksumValue": f.SHA256},
+			},
+			"licenseConcluded": "NOASSERTION",
+			"copyrightText":    "NOASSERTION",
+			"comment":          "From " + f.Source,
+		})
+		relationships = append(relationships, map[string]interface{}{
+			"spdxElementId":      spdxID("Package", upstreamKey(f.Upstream)),
+			"relationshipType":   "CONTAINS",
+			"relatedSpdxElement": id,
+		})
+	}
+
+	return map[string]interface{}{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              "git-overlay",
+		"documentNamespace": "https://spdx.org/spdxdocs/git-overlay-" + hex.EncodeToString(sum[:8]),
+		"creationInfo": map[string]interface{}{
+			"created":  created.UTC().Format(time.RFC3339),
+			"creators": []string{"Tool: git-overlay"},
+		},
+		"packages":      packages,
+		"files":         files,
+		"relationships": relationships,
+	}
+}
+
+// toCycloneDX renders the manifest as a CycloneDX 1.5 JSON BOM
+func (m *overlayManifest) toCycloneDX(created time.Time) map[string]interface{} {
+	var components []interface{}
+	for _, u := range m.Upstreams {
+		key := upstreamKey(u.Name)
+		version := u.Ref
+		if u.Commit != "" {
+			version = u.Commit
+		}
+
+		properties := []interface{}{
+			map[string]interface{}{"name": "git-overlay:type", "value": u.Type},
+			map[string]interface{}{"name": "git-overlay:ref", "value": u.Ref},
+		}
+		if u.License != nil {
+			properties = append(properties,
+				map[string]interface{}{"name": "git-overlay:license-file", "value": u.License.Path},
+				map[string]interface{}{"name": "git-overlay:license-sha256", "value": u.License.SHA256},
+			)
+		}
+
+		var files []interface{}
+		for _, f := range m.Files {
+			if upstreamKey(f.Upstream) != key {
+				continue
+			}
+			files = append(files, map[string]interface{}{
+				"type":     "file",
+				"bom-ref":  key + ":" + f.Path,
+				"name":     f.Path,
+				"hashes":   []interface{}{map[string]interface{}{"alg": "SHA-256", "content": f.SHA256}},
+				"evidence": map[string]interface{}{"occurrences": []interface{}{map[string]interface{}{"location": f.Source}}},
+			})
+		}
+
+		component := map[string]interface{}{
+			"type":       "library",
+			"bom-ref":    key,
+			"name":       u.Location,
+			"version":    version,
+			"properties": properties,
+		}
+		if u.Type == config.UpstreamTypeGit {
+			component["externalReferences"] = []interface{}{map[string]interface{}{"type": "vcs", "url": u.Location}}
+		}
+		if len(files) > 0 {
+			component["components"] = files
+		}
+		components = append(components, component)
+	}
+
+	return map[string]interface{}{
+		"bomFormat":   "CycloneDX",
+		"specVersion": "1.5",
+		"version":     1,
+		"metadata": map[string]interface{}{
+			"timestamp": created.UTC().Format(time.RFC3339),
+			"tools": map[string]interface{}{
+				"components": []interface{}{map[string]interface{}{"type": "application", "name": "git-overlay"}},
+			},
+		},
+		"components": components,
+	}
+}
+
+var manifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Print the provenance of overlaid upstream content",
+	Long: `Print the upstreams (location, ref, resolved commit and license file hash)
+and the files materialized from them in overlay/, for SBOM and security tooling.
+Formats are json (default), spdx (SPDX 2.3 JSON) and cyclonedx (CycloneDX 1.5 JSON).
+
+With --paths, print only the files materialized in overlay/, one per line and
+relative to overlay/, for tar, rsync and other build tools. Add -z to separate
+them with NUL characters instead.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+		pathsOnly, err := cmd.Flags().GetBool("paths")
+		if err != nil {
+			return err
+		}
+		null, err := cmd.Flags().GetBool("null")
+		if err != nil {
+			return err
+		}
+		if null && !pathsOnly {
+			return fmt.Errorf("--null can only be used with --paths")
+		}
+
+		state, err := loadState(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+
+		if pathsOnly {
+			sep := "\n"
+			if null {
+				sep = "\x00"
+			}
+			for _, p := range manifestPaths(state) {
+				fmt.Print(p + sep)
+			}
+			return nil
+		}
+
+		m, err := buildManifest(cfg, state)
+		if err != nil {
+			return err
+		}
+
+		var doc interface{}
+		switch format {
+		case "json":
+			doc = m
+		case "spdx":
+			doc = m.toSPDX(time.Now())
+		case "cyclonedx":
+			doc = m.toCycloneDX(time.Now())
+		default:
+			return fmt.Errorf("unsupported manifest format: %s", format)
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	},
+}
+
+func init() {
+	manifestCmd.Flags().String("format", "json", "Output format (json|spdx|cyclonedx)")
+	manifestCmd.Flags().Bool("paths", false, "Print only the materialized overlay paths, relative to overlay/")
+	manifestCmd.Flags().BoolP("null", "z", false, "Separate --paths output with NUL characters")
+	rootCmd.AddCommand(manifestCmd)
+}
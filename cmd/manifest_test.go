@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+func TestBuildManifest(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream/app", 0755); err != nil {
+		t.Fatalf("Failed to create upstream: %v", err)
+	}
+	files := map[string]string{
+		".upstream/LICENSE":     "MIT",
+		".upstream/app/main.go": "package main",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+	}
+
+	cfg := &config.Config{
+		Upstream: config.UpstreamConfig{URL: "https://github.com/example/repo.git", Ref: "main"},
+	}
+	state := &config.State{}
+	state.AddManagedFile("app/main.go", "symlink", "app/main.go")
+
+	m, err := buildManifest(cfg, state)
+	if err != nil {
+		t.Fatalf("buildManifest() error = %v", err)
+	}
+
+	if len(m.Upstreams) != 1 {
+		t.Fatalf("Upstreams = %+v, want 1", m.Upstreams)
+	}
+	u := m.Upstreams[0]
+	if u.Location != cfg.Upstream.URL || u.Type != "git" || u.Ref != "main" {
+		t.Errorf("upstream = %+v", u)
+	}
+	// sha256("MIT")
+	if u.License == nil || u.License.Path != "LICENSE" || u.License.SHA256 != "e5dcffe836b6ec8a58e492419b550e65fb8cbdc308503979e5dacb33ac7ea3b7" {
+		t.Errorf("license = %+v", u.License)
+	}
+	if len(m.Files) != 1 || m.Files[0].Path != "overlay/app/main.go" || len(m.Files[0].SHA256) != 64 {
+		t.Errorf("Files = %+v", m.Files)
+	}
+
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for format, doc := range map[string]interface{}{
+		"spdx":      m.toSPDX(created),
+		"cyclonedx": m.toCycloneDX(created),
+	} {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			t.Fatalf("%s: failed to marshal: %v", format, err)
+		}
+		for _, want := range []string{m.Files[0].SHA256, u.License.SHA256, "2024-01-02T03:04:05Z", "overlay/app/main.go"} {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("%s document is missing %q", format, want)
+			}
+		}
+	}
+}
+
+func TestManifestPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	for _, dir := range []string{"overlay/app", "overlay/var/cache"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	for _, path := range []string{"overlay/app/main.go", "overlay/README.md", "overlay/VERSION"} {
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+	}
+
+	state := &config.State{}
+	state.AddManagedFile("app/main.go", "symlink", "app/main.go")
+	state.AddManagedFile("README.md", "copy", "README.md")
+	state.AddManagedFile("VERSION", generatedLinkMode, "")
+	state.AddManagedFile("var/cache", dirLinkMode, "")
+	state.AddManagedFile("gone.txt", "copy", "gone.txt")
+
+	got := manifestPaths(state)
+	want := []string{"README.md", "VERSION", "app/main.go"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("manifestPaths() = %q, want %q", got, want)
+	}
+}
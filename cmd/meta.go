@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+// metaFile is where meta_file writes the sync metadata, relative to overlay/
+const metaFile = ".git-overlay.meta.json"
+
+// metaLinkMode is recorded for the sync metadata file
+const metaLinkMode = "meta"
+
+// syncMeta is the provenance written to overlay/.git-overlay.meta.json for
+// build systems that embed it without running git-overlay
+type syncMeta struct {
+	Upstream  generateUpstream            `json:"upstream"`
+	Upstreams map[string]generateUpstream `json:"upstreams,omitempty"`
+	SyncedAt  time.Time                   `json:"synced_at"`
+	Version   string                      `json:"version"`
+}
+
+// writeMetaFile writes the sync metadata to overlay/ when meta_file is set
+func writeMetaFile(cfg *config.Config, state *config.State, opts linkOptions, syncedAt time.Time, createdLinks *[]string) error {
+	if !cfg.MetaFile {
+		return nil
+	}
+	data := newGenerateData(cfg)
+	meta := syncMeta{
+		Upstream:  generateUpstream{URL: data.UpstreamURL, Ref: data.UpstreamRef, SHA: data.UpstreamSHA},
+		Upstreams: data.Upstreams,
+		SyncedAt:  syncedAt.UTC(),
+		Version:   data.Version,
+	}
+	content, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode sync metadata: %w", err)
+	}
+
+	dst := filepath.Join("overlay", metaFile)
+	if err := os.MkdirAll("overlay", 0755); err != nil {
+		return fmt.Errorf("failed to create overlay directory: %w", err)
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		if managed, _ := state.IsManagedFile(metaFile); !managed && !opts.force {
+			return fmt.Errorf("%w: %s", overlayerr.ErrConflict, dst)
+		}
+		if err := opts.trash.remove(dst); err != nil {
+			return fmt.Errorf("failed to remove existing target %s: %w", dst, err)
+		}
+	}
+	if err := os.WriteFile(dst, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+
+	*createdLinks = append(*createdLinks, dst)
+	state.AddManagedFile(metaFile, metaLinkMode, "")
+	return nil
+}
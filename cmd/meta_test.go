@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+func TestWriteMetaFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	cfg := &config.Config{
+		Upstream: config.UpstreamConfig{URL: "https://example.com/repo.git", Ref: "v1.2.3"},
+	}
+	state := &config.State{}
+	var created []string
+	syncedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// Nothing is written unless meta_file is set
+	if err := writeMetaFile(cfg, state, linkOptions{}, syncedAt, &created); err != nil {
+		t.Fatalf("writeMetaFile() error = %v", err)
+	}
+	if _, err := os.Stat("overlay/" + metaFile); !os.IsNotExist(err) {
+		t.Fatalf("meta file written without meta_file: %v", err)
+	}
+
+	cfg.MetaFile = true
+	for i := 0; i < 2; i++ {
+		if err := writeMetaFile(cfg, state, linkOptions{}, syncedAt, &created); err != nil {
+			t.Fatalf("writeMetaFile() run %d error = %v", i+1, err)
+		}
+	}
+
+	data, err := os.ReadFile("overlay/" + metaFile)
+	if err != nil {
+		t.Fatalf("Failed to read meta file: %v", err)
+	}
+	var meta syncMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatalf("Failed to parse meta file: %v", err)
+	}
+	if meta.Upstream.URL != cfg.Upstream.URL || meta.Upstream.Ref != "v1.2.3" {
+		t.Errorf("upstream = %+v, want url %s ref v1.2.3", meta.Upstream, cfg.Upstream.URL)
+	}
+	if !meta.SyncedAt.Equal(syncedAt) {
+		t.Errorf("synced_at = %v, want %v", meta.SyncedAt, syncedAt)
+	}
+
+	if len(state.ManagedFiles) != 1 || state.ManagedFiles[0].LinkMode != metaLinkMode {
+		t.Errorf("State = %+v, want one %s entry", state.ManagedFiles, metaLinkMode)
+	}
+	for _, st := range collectStatus(cfg, state) {
+		if st.Code != statusOK {
+			t.Errorf("status of %s = %q, want OK", st.Path, st.Code)
+		}
+	}
+
+	// An unmanaged file in the way is only replaced with force
+	state = &config.State{}
+	if err := writeMetaFile(cfg, state, linkOptions{}, syncedAt, &created); err == nil {
+		t.Error("writeMetaFile() replaced an unmanaged file without force")
+	}
+	if err := writeMetaFile(cfg, state, linkOptions{force: true}, syncedAt, &created); err != nil {
+		t.Errorf("writeMetaFile() with force error = %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build darwin || freebsd
+
+package cmd
+
+import "syscall"
+
+// networkFilesystemTypes are the filesystem type names of network filesystems
+var networkFilesystemTypes = map[string]bool{
+	"nfs":    true,
+	"smbfs":  true,
+	"afpfs":  true,
+	"webdav": true,
+	"cifs":   true,
+}
+
+// networkFilesystem reports the type of the filesystem holding dir when it
+// is a network one
+func networkFilesystem(dir string) (string, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return "", false
+	}
+	var name []byte
+	for _, c := range st.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	return string(name), networkFilesystemTypes[string(name)]
+}
@@ -0,0 +1,31 @@
+//go:build linux
+
+package cmd
+
+import "syscall"
+
+// networkFilesystemTypes names the statfs magic numbers of network and
+// cluster filesystems
+var networkFilesystemTypes = map[int64]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xfe534d42: "smb2",
+	0xff534d42: "cifs",
+	0x5346414f: "afs",
+	0x73757245: "coda",
+	0x01021997: "9p",
+	0x00c36400: "ceph",
+	0x0bd00bd0: "lustre",
+	0x47504653: "gpfs",
+}
+
+// networkFilesystem reports the type of the filesystem holding dir when it
+// is a network one
+func networkFilesystem(dir string) (string, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return "", false
+	}
+	name, ok := networkFilesystemTypes[int64(st.Type)&0xffffffff]
+	return name, ok
+}
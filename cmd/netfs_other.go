@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package cmd
+
+// networkFilesystem is not implemented on this platform, so filesystems are
+// never treated as network ones
+func networkFilesystem(dir string) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package cmd
+
+import (
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// networkFilesystem reports whether dir is on a network share, mapped to a
+// drive letter or reached by UNC path
+func networkFilesystem(dir string) (string, bool) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	root, err := windows.UTF16PtrFromString(filepath.VolumeName(abs) + `\`)
+	if err != nil {
+		return "", false
+	}
+	if windows.GetDriveType(root) != windows.DRIVE_REMOTE {
+		return "", false
+	}
+	return "smb", true
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// onlyFilter limits a run to the links under some overlay paths, given with
+// --only, and to the specs of some components, given with --component
+type onlyFilter struct {
+	prefixes   []string // Relative to overlay/, "." for all of it
+	ignoreCase bool
+	components map[string]bool // Any component when empty
+}
+
+// newOnlyFilter reads --only and --ignore-case, returning nil when the run
+// isn't limited
+func newOnlyFilter(cmd *cobra.Command) (*onlyFilter, error) {
+	if cmd.Flags().Lookup("only") == nil {
+		return nil, nil
+	}
+	args, err := cmd.Flags().GetStringArray("only")
+	if err != nil || len(args) == 0 {
+		return nil, err
+	}
+
+	f := &onlyFilter{ignoreCase: flagBool(cmd, "ignore-case")}
+	for _, arg := range args {
+		prefix := filepath.ToSlash(filepath.Clean(arg))
+		if prefix == "overlay" {
+			prefix = "."
+		}
+		prefix = strings.TrimPrefix(prefix, "overlay/")
+		if prefix == ".." || strings.HasPrefix(prefix, "../") || filepath.IsAbs(arg) {
+			return nil, fmt.Errorf("--only %s is not a path under overlay/", arg)
+		}
+		f.prefixes = append(f.prefixes, prefix)
+	}
+	return f, nil
+}
+
+// match reports whether rel, relative to overlay/, is one of the prefixes or
+// below one of them. Prefixes match whole path elements, so src doesn't match
+// srcgen. Without prefixes every path matches.
+func (f *onlyFilter) match(rel string) bool {
+	if len(f.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range f.prefixes {
+		path := rel
+		if f.ignoreCase {
+			path, prefix = strings.ToLower(path), strings.ToLower(prefix)
+		}
+		if prefix == "." || path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// inComponent reports whether a link of the given component is selected
+func (f *onlyFilter) inComponent(component string) bool {
+	return len(f.components) == 0 || f.components[component]
+}
+
+// matchFile reports whether a managed file is selected, by its path and the
+// component that linked it
+func (f *onlyFilter) matchFile(mf config.ManagedFile) bool {
+	return f.match(mf.Path) && f.inComponent(mf.Component)
+}
+
+// filterPlan keeps the planned links whose target and component match
+func (f *onlyFilter) filterPlan(plan []plannedLink) ([]plannedLink, error) {
+	kept := plan[:0]
+	for _, p := range plan {
+		if f.match(overlayRelPath(p.dst)) && f.inComponent(p.component) {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("no links %s", f.describe())
+	}
+	return kept, nil
+}
+
+// describe names what the filter selects, for errors
+func (f *onlyFilter) describe() string {
+	var parts []string
+	if len(f.prefixes) > 0 {
+		parts = append(parts, "under overlay/"+strings.Join(f.prefixes, ", overlay/"))
+	}
+	if len(f.components) > 0 {
+		names := make([]string, 0, len(f.components))
+		for name := range f.components {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		parts = append(parts, "in component "+strings.Join(names, ", "))
+	}
+	return strings.Join(parts, " ")
+}
+
+// filterFiles returns the managed files that match
+func (f *onlyFilter) filterFiles(files []config.ManagedFile) []config.ManagedFile {
+	var kept []config.ManagedFile
+	for _, mf := range files {
+		if f.matchFile(mf) {
+			kept = append(kept, mf)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestOnlyFilterMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		only       []string
+		ignoreCase bool
+		path       string
+		want       bool
+	}{
+		{name: "exact", only: []string{"src/api"}, path: "src/api", want: true},
+		{name: "below", only: []string{"src"}, path: "src/api/main.go", want: true},
+		{name: "partial element", only: []string{"src"}, path: "srcgen/main.go", want: false},
+		{name: "overlay prefix", only: []string{"overlay/src/"}, path: "src/main.go", want: true},
+		{name: "whole overlay", only: []string{"overlay"}, path: "main.go", want: true},
+		{name: "second prefix", only: []string{"docs", "src"}, path: "src/main.go", want: true},
+		{name: "other case", only: []string{"SRC"}, path: "src/main.go", want: false},
+		{name: "ignore case", only: []string{"SRC"}, ignoreCase: true, path: "src/main.go", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().StringArray("only", nil, "")
+			cmd.Flags().Bool("ignore-case", tt.ignoreCase, "")
+			for _, only := range tt.only {
+				cmd.Flags().Set("only", only)
+			}
+			f, err := newOnlyFilter(cmd)
+			if err != nil {
+				t.Fatalf("newOnlyFilter() error = %v", err)
+			}
+			if got := f.match(tt.path); got != tt.want {
+				t.Errorf("match(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().StringArray("only", nil, "")
+	cmd.Flags().Set("only", "../outside")
+	if _, err := newOnlyFilter(cmd); err == nil {
+		t.Error("newOnlyFilter() accepted a path outside overlay/")
+	}
+}
+
+func TestCreateLinksOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	for _, name := range []string{"a.txt", "dir/b.txt"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(".upstream", name)), 0755); err != nil {
+			t.Fatalf("Failed to create upstream directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(".upstream", name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+	}
+
+	cfg := &config.Config{
+		Symlinks: []config.SymlinkSpec{{String: "a.txt"}, {String: "dir/b.txt"}},
+	}
+	cmd := &cobra.Command{}
+	cmd.Flags().String("link-mode", "symlink", "")
+	cmd.Flags().Bool("force", false, "")
+	cmd.Flags().Bool("assume-clean", false, "")
+	cmd.Flags().StringArray("only", nil, "")
+	cmd.Flags().Bool("ignore-case", true, "")
+
+	if err := CreateLinks(cmd, cfg); err != nil {
+		t.Fatalf("CreateLinks() error = %v", err)
+	}
+
+	// Links outside the subtree are left as they are, even when broken
+	if err := os.Remove("overlay/a.txt"); err != nil {
+		t.Fatalf("Failed to remove link: %v", err)
+	}
+	if err := os.Remove("overlay/dir/b.txt"); err != nil {
+		t.Fatalf("Failed to remove link: %v", err)
+	}
+	cmd.Flags().Set("only", "overlay/DIR")
+	if err := CreateLinks(cmd, cfg); err != nil {
+		t.Fatalf("CreateLinks() with --only error = %v", err)
+	}
+	if _, err := os.Lstat("overlay/dir/b.txt"); err != nil {
+		t.Errorf("overlay/dir/b.txt was not relinked: %v", err)
+	}
+	if _, err := os.Lstat("overlay/a.txt"); !os.IsNotExist(err) {
+		t.Errorf("overlay/a.txt outside --only was relinked: %v", err)
+	}
+
+	// The rest of the state and gitignore are kept
+	state, err := config.LoadState()
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if managed, _ := state.IsManagedFile("a.txt"); !managed {
+		t.Error("a.txt was dropped from the state")
+	}
+	gitignore, err := os.ReadFile(".gitignore")
+	if err != nil {
+		t.Fatalf("Failed to read gitignore: %v", err)
+	}
+	if !strings.Contains(string(gitignore), "overlay/a.txt") {
+		t.Errorf("gitignore lost overlay/a.txt:\n%s", gitignore)
+	}
+
+	for _, flags := range []map[string]string{
+		{"only": "missing"},
+		{"only": "dir", "assume-clean": "true"},
+	} {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("link-mode", "symlink", "")
+		cmd.Flags().Bool("force", true, "")
+		cmd.Flags().Bool("assume-clean", false, "")
+		cmd.Flags().StringArray("only", nil, "")
+		for name, value := range flags {
+			cmd.Flags().Set(name, value)
+		}
+		if err := CreateLinks(cmd, cfg); err == nil {
+			t.Errorf("CreateLinks() with %v succeeded", flags)
+		}
+	}
+}
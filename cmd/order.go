@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+// specTarget returns a spec's overlay-relative target, which identifies it in after:
+func specTarget(link config.SymlinkSpec) string {
+	target := link.To
+	if link.String != "" {
+		target = link.String
+	}
+	return strings.Trim(filepath.ToSlash(filepath.Clean(target)), "/")
+}
+
+// specSource returns a spec's upstream-relative source, which names it in errors
+func specSource(link config.SymlinkSpec) string {
+	source := link.From
+	if link.String != "" {
+		source = link.String
+	}
+	return strings.Trim(filepath.ToSlash(filepath.Clean(source)), "/")
+}
+
+// orderSpecs sorts specs so each comes after the specs named in its after:
+// list. Specs without dependencies keep their configured order.
+func orderSpecs(specs []config.SymlinkSpec) ([]config.SymlinkSpec, error) {
+	index := make(map[string]int, len(specs))
+	for i, link := range specs {
+		index[specTarget(link)] = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	marks := make([]int, len(specs))
+	ordered := make([]config.SymlinkSpec, 0, len(specs))
+
+	var visit func(i int, path []string) error
+	visit = func(i int, path []string) error {
+		target := specTarget(specs[i])
+		switch marks[i] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("specs depend on each other in a cycle: %s", strings.Join(append(path, target), " -> "))
+		}
+
+		marks[i] = visiting
+		for _, dep := range specs[i].After {
+			j, ok := index[strings.Trim(filepath.ToSlash(filepath.Clean(dep)), "/")]
+			if !ok {
+				return fmt.Errorf("spec %s is after unknown spec %s", target, dep)
+			}
+			if err := visit(j, append(path, target)); err != nil {
+				return err
+			}
+		}
+		marks[i] = done
+		ordered = append(ordered, specs[i])
+		return nil
+	}
+
+	for i := range specs {
+		if err := visit(i, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
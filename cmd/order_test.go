@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+func TestOrderSpecs(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []config.SymlinkSpec
+		want    []string
+		wantErr string
+	}{
+		{
+			name:  "no dependencies keeps order",
+			specs: []config.SymlinkSpec{{String: "b"}, {String: "a"}},
+			want:  []string{"b", "a"},
+		},
+		{
+			name: "after moves spec later",
+			specs: []config.SymlinkSpec{
+				{From: "tmpl", To: "rendered", After: []string{"settings.yml"}},
+				{String: "app"},
+				{From: "config/settings.yml", To: "settings.yml"},
+			},
+			want: []string{"settings.yml", "rendered", "app"},
+		},
+		{
+			name: "chained",
+			specs: []config.SymlinkSpec{
+				{From: "c", To: "c", After: []string{"b"}},
+				{From: "b", To: "b", After: []string{"a"}},
+				{String: "a"},
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "cycle",
+			specs: []config.SymlinkSpec{
+				{From: "a", To: "a", After: []string{"b"}},
+				{From: "b", To: "b", After: []string{"a"}},
+			},
+			wantErr: "cycle: a -> b -> a",
+		},
+		{
+			name:    "unknown",
+			specs:   []config.SymlinkSpec{{From: "a", To: "a", After: []string{"missing"}}},
+			wantErr: "unknown spec missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := orderSpecs(tt.specs)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("orderSpecs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("orderSpecs() error = %v", err)
+			}
+			var targets []string
+			for _, link := range got {
+				targets = append(targets, specTarget(link))
+			}
+			if strings.Join(targets, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("orderSpecs() = %v, want %v", targets, tt.want)
+			}
+		})
+	}
+}
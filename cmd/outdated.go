@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/git"
+	"github.com/rjocoleman/git-overlay/internal/provider"
+	"github.com/spf13/cobra"
+)
+
+// outdatedReport is the result of comparing the synced upstream with its remote
+type outdatedReport struct {
+	Type     string `json:"type"`
+	Ref      string `json:"ref"`
+	Outdated bool   `json:"outdated"`
+	*git.Comparison
+}
+
+// checkOutdated compares the synced upstream with the latest remote version
+// without changing .upstream
+func checkOutdated(upstream config.UpstreamConfig) (*outdatedReport, error) {
+	report := &outdatedReport{Type: upstream.Type, Ref: upstream.Ref}
+	if report.Type == "" {
+		report.Type = config.UpstreamTypeGit
+	}
+
+	if upstream.IsGit() {
+		comparison, err := git.CompareUpstream(".upstream", upstream.Ref)
+		if err != nil {
+			return nil, err
+		}
+		report.Comparison = comparison
+	} else {
+		if err := fetchCredentials(); err != nil {
+			return nil, err
+		}
+		p, err := provider.New(upstream)
+		if err != nil {
+			return nil, err
+		}
+		current, err := p.Resolve(upstream.Ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", upstream.Ref, err)
+		}
+		latest, err := p.Resolve("latest")
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve latest: %w", err)
+		}
+		report.Comparison = &git.Comparison{Current: current, Latest: latest}
+	}
+
+	report.Outdated = report.Comparison.Outdated()
+	return report, nil
+}
+
+// shortID abbreviates commit hashes and digests for display
+func shortID(id string) string {
+	if algo, hex, ok := strings.Cut(id, ":"); ok && len(hex) > 12 {
+		return algo + ":" + hex[:12]
+	}
+	if len(id) == 40 {
+		return id[:7]
+	}
+	return id
+}
+
+var outdatedCmd = &cobra.Command{
+	Use:   "outdated",
+	Short: "Check whether the upstream has new commits or releases",
+	Long: `Compare the synced upstream with the remote tip of the configured ref and
+its latest release tags, without modifying anything. With --json, print a
+machine-readable report for scheduled jobs.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		jsonOutput, err := cmd.Flags().GetBool("json")
+		if err != nil {
+			return err
+		}
+
+		report, err := checkOutdated(cfg.Upstream)
+		if err != nil {
+			return fmt.Errorf("failed to check upstream: %w", err)
+		}
+
+		if jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		}
+
+		if !report.Outdated {
+			fmt.Printf("Up to date: %s at %s\n", report.Ref, shortID(report.Current))
+			return nil
+		}
+		if report.CommitsBehind > 0 {
+			fmt.Printf("%s is %d commit(s) behind (%s -> %s)\n", report.Ref, report.CommitsBehind, shortID(report.Current), shortID(report.Latest))
+		}
+		if len(report.NewerTags) > 0 {
+			fmt.Printf("%d newer release(s): %s\n", len(report.NewerTags), strings.Join(report.NewerTags, ", "))
+		}
+		if report.CommitsBehind == 0 && len(report.NewerTags) == 0 {
+			fmt.Printf("%s is at %s, latest is %s\n", report.Ref, shortID(report.Current), shortID(report.Latest))
+		}
+		return nil
+	},
+}
+
+func init() {
+	outdatedCmd.Flags().Bool("json", false, "Print the report as JSON")
+	rootCmd.AddCommand(outdatedCmd)
+}
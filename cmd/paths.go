@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// specSources returns the upstream-relative source of every spec
+func specSources(cfg *config.Config) []string {
+	var sources []string
+	for _, link := range cfg.Symlinks {
+		sources = append(sources, specSource(link))
+	}
+	return sources
+}
+
+// uncoveredPaths lists upstream paths under prefix that no spec links.
+// Directories are only listed when nothing inside them is linked either, so
+// every listed path can be added as a spec as-is.
+func uncoveredPaths(cfg *config.Config, dirs, files bool, prefix string) ([]string, error) {
+	sources := specSources(cfg)
+	prefix = strings.Trim(filepath.ToSlash(prefix), "/")
+
+	var paths []string
+	root := upstreamRoot(config.UpstreamDir(""))
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		// Git metadata, including the .git file of a submodule, is never linkable
+		if info.Name() == ".git" {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		covered, partial := false, false
+		for _, source := range sources {
+			if rel == source || strings.HasPrefix(rel, source+"/") {
+				covered = true
+				break
+			}
+			if strings.HasPrefix(source, rel+"/") {
+				partial = true
+			}
+		}
+		if covered {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if prefix != "" && rel != prefix && !strings.HasPrefix(rel, prefix+"/") {
+			// Keep descending towards the prefix, but don't list anything outside it
+			if info.IsDir() && strings.HasPrefix(prefix, rel+"/") {
+				return nil
+			}
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			if dirs && !partial {
+				paths = append(paths, rel)
+			}
+			return nil
+		}
+		if files {
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk .upstream: %w", err)
+	}
+	return paths, nil
+}
+
+var pathsCmd = &cobra.Command{
+	Use:   "paths [prefix]",
+	Short: "List upstream paths not yet linked by any spec",
+	Long: `List paths in .upstream that are not covered by any spec in
+.git-overlay.yml, one per line, to discover what is available to add or to
+generate config in bulk. Directories are listed only when nothing inside them
+is linked yet.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		dirs, err := cmd.Flags().GetBool("dirs")
+		if err != nil {
+			return err
+		}
+		files, err := cmd.Flags().GetBool("files")
+		if err != nil {
+			return err
+		}
+		if !dirs && !files {
+			dirs, files = true, true
+		}
+
+		var prefix string
+		if len(args) == 1 {
+			prefix = args[0]
+		}
+
+		paths, err := uncoveredPaths(cfg, dirs, files, prefix)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			fmt.Println(path)
+		}
+		return nil
+	},
+}
+
+func init() {
+	pathsCmd.Flags().Bool("dirs", false, "Only list directories")
+	pathsCmd.Flags().Bool("files", false, "Only list files")
+	pathsCmd.MarkFlagsMutuallyExclusive("dirs", "files")
+	rootCmd.AddCommand(pathsCmd)
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+func TestUncoveredPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	for _, dir := range []string{".upstream/.git", ".upstream/app", ".upstream/src/lib", ".upstream/src/cmd", ".upstream/docs", ".upstream/vendor/mod/.git/objects", ".upstream/vendor/lib"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	for _, file := range []string{".upstream/.git/HEAD", ".upstream/README.md", ".upstream/app/main.go", ".upstream/src/lib/lib.go", ".upstream/src/cmd/cmd.go", ".upstream/docs/index.md", ".upstream/vendor/mod/mod.go", ".upstream/vendor/mod/.git/HEAD", ".upstream/vendor/lib/.git", ".upstream/vendor/lib/lib.go"} {
+		if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", file, err)
+		}
+	}
+
+	cfg := &config.Config{
+		Symlinks: []config.SymlinkSpec{
+			{String: "app"},
+			{From: "src/lib", To: "library"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		dirs   bool
+		files  bool
+		prefix string
+		want   []string
+	}{
+		{
+			name:  "all",
+			dirs:  true,
+			files: true,
+			want: []string{"README.md", "docs", "docs/index.md", "src/cmd", "src/cmd/cmd.go",
+				"vendor", "vendor/lib", "vendor/lib/lib.go", "vendor/mod", "vendor/mod/mod.go"},
+		},
+		{
+			name: "dirs",
+			dirs: true,
+			want: []string{"docs", "src/cmd", "vendor", "vendor/lib", "vendor/mod"},
+		},
+		{
+			name:  "files",
+			files: true,
+			want:  []string{"README.md", "docs/index.md", "src/cmd/cmd.go", "vendor/lib/lib.go", "vendor/mod/mod.go"},
+		},
+		{
+			name:   "prefix",
+			dirs:   true,
+			files:  true,
+			prefix: "src",
+			want:   []string{"src/cmd", "src/cmd/cmd.go"},
+		},
+		{
+			name:   "submodules",
+			files:  true,
+			prefix: "vendor",
+			want:   []string{"vendor/lib/lib.go", "vendor/mod/mod.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := uncoveredPaths(cfg, tt.dirs, tt.files, tt.prefix)
+			if err != nil {
+				t.Fatalf("uncoveredPaths() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("uncoveredPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
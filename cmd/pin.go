@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// skipPinned drops planned links whose target has been pinned
+func skipPinned(plan []plannedLink, state *config.State) []plannedLink {
+	kept := plan[:0]
+	for _, p := range plan {
+		if state.IsPinned(overlayRelPath(p.dst)) {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// pinnedFiles returns the pinned entries of files
+func pinnedFiles(files []config.ManagedFile) []config.ManagedFile {
+	var pinned []config.ManagedFile
+	for _, mf := range files {
+		if mf.Pinned {
+			pinned = append(pinned, mf)
+		}
+	}
+	return pinned
+}
+
+// managedIgnores lists the overlay paths git should ignore: every managed
+// path except pinned files, which are committed with the repository
+func managedIgnores(state *config.State) []string {
+	var paths []string
+	for _, mf := range state.ManagedFiles {
+		if !mf.Pinned {
+			paths = append(paths, "overlay/"+mf.Path)
+		}
+	}
+	return paths
+}
+
+// pinFile replaces a managed file with a regular local copy of its current
+// content, so edits no longer reach the upstream and sync leaves it alone
+func pinFile(state *config.State, rel string) error {
+	managed, mf := state.IsManagedFile(rel)
+	if !managed {
+		return fmt.Errorf("not a managed file: overlay/%s", rel)
+	}
+	if mf.Source == "" {
+		return fmt.Errorf("only files linked from upstream can be pinned: overlay/%s", rel)
+	}
+
+	dst := filepath.Join("overlay", rel)
+	info, err := os.Lstat(dst)
+	if err != nil {
+		return fmt.Errorf("failed to pin %s: %w", dst, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("cannot pin directory %s", dst)
+	}
+
+	// Preserved upstream symlinks are already independent of the upstream
+	if mf.LinkMode != preservedLinkMode {
+		tmp := dst + ".git-overlay-pin"
+		if err := copyFile(dst, tmp); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to copy %s: %w", dst, err)
+		}
+		if err := os.Rename(tmp, dst); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to replace %s: %w", dst, err)
+		}
+		if err := setWritable(dst, true); err != nil {
+			return fmt.Errorf("failed to make %s writable: %w", dst, err)
+		}
+	}
+
+	state.SetPinned(rel, true)
+	return nil
+}
+
+var pinCmd = &cobra.Command{
+	Use:   "pin <path>...",
+	Short: "Freeze managed files as local copies",
+	Long: `Replace managed files with local copies that sync and relink leave alone,
+for files that must diverge from upstream long-term. Pinned files are dropped
+from the managed .gitignore block so they can be committed, and are reported
+as pinned by status. Use unpin to link them from upstream again.`,
+	Args:        cobra.MinimumNArgs(1),
+	Annotations: map[string]string{lockAnnotation: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		state, err := loadState(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+
+		for _, arg := range args {
+			rel := overlayArg(arg)
+			if state.IsPinned(rel) {
+				fmt.Printf("Already pinned: overlay/%s\n", rel)
+				continue
+			}
+			if err := pinFile(state, rel); err != nil {
+				return err
+			}
+			fmt.Printf("Pinned overlay/%s\n", rel)
+		}
+
+		if err := updateGitignore(cfg, managedIgnores(state)); err != nil {
+			return fmt.Errorf("failed to update gitignore: %w", err)
+		}
+		if err := state.SaveState(); err != nil {
+			return fmt.Errorf("failed to save state: %w", err)
+		}
+		return nil
+	},
+}
+
+var unpinCmd = &cobra.Command{
+	Use:   "unpin <path>...",
+	Short: "Link pinned files from upstream again",
+	Long: `Return pinned files to being managed: the local copy is moved to the trash
+and the file is linked from the upstream checkout again.`,
+	Args:        cobra.MinimumNArgs(1),
+	Annotations: map[string]string{lockAnnotation: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		state, err := loadState(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+
+		opts, err := newLinkOptions(cmd, cfg)
+		if err != nil {
+			return err
+		}
+
+		var created []string
+		for _, arg := range args {
+			rel := overlayArg(arg)
+			managed, mf := state.IsManagedFile(rel)
+			if !managed || !mf.Pinned {
+				return fmt.Errorf("not a pinned file: overlay/%s", rel)
+			}
+
+			dst := filepath.Join("overlay", rel)
+			if _, err := os.Lstat(dst); err == nil {
+				if err := opts.trash.remove(dst); err != nil {
+					return fmt.Errorf("failed to remove local copy %s: %w", dst, err)
+				}
+			}
+
+			fileOpts := opts
+			fileOpts.upstream = mf.Upstream
+			fileOpts.component = mf.Component
+			fileOpts.preserve = mf.LinkMode == preservedLinkMode
+			src := filepath.Join(config.UpstreamDir(mf.Upstream), mf.Source)
+			if err := createLink(src, dst, fileOpts, &created, state); err != nil {
+				return fmt.Errorf("failed to relink %s: %w", dst, err)
+			}
+			fmt.Printf("Unpinned overlay/%s\n", rel)
+		}
+
+		if err := updateGitignore(cfg, managedIgnores(state)); err != nil {
+			return fmt.Errorf("failed to update gitignore: %w", err)
+		}
+		if err := state.SaveState(); err != nil {
+			return fmt.Errorf("failed to save state: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pinCmd)
+	rootCmd.AddCommand(unpinCmd)
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestPinAndUnpin(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	configContent := `upstream:
+  url: "https://example.com/repo.git"
+  ref: "main"
+symlinks:
+  - config
+trash:
+  enabled: false
+`
+	if err := os.WriteFile(".git-overlay.yml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+	if err := os.MkdirAll(".upstream/config", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+	for _, name := range []string{"app.yml", "db.yml"} {
+		if err := os.WriteFile(".upstream/config/"+name, []byte("upstream"), 0644); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+	}
+
+	newCmd := func(run func(*cobra.Command, []string) error) *cobra.Command {
+		cmd := &cobra.Command{RunE: run}
+		cmd.Flags().String("config", ".git-overlay.yml", "")
+		cmd.Flags().String("link-mode", "symlink", "")
+		cmd.Flags().Bool("force", true, "")
+		return cmd
+	}
+	relink := func() {
+		t.Helper()
+		cmd := newCmd(relinkCmd.RunE)
+		if err := cmd.RunE(cmd, nil); err != nil {
+			t.Fatalf("relink error = %v", err)
+		}
+	}
+	relink()
+
+	cmd := newCmd(pinCmd.RunE)
+	if err := cmd.RunE(cmd, []string{"overlay/config/app.yml"}); err != nil {
+		t.Fatalf("pin error = %v", err)
+	}
+	if err := cmd.RunE(cmd, []string{"config/missing.yml"}); err == nil {
+		t.Error("pin of an unmanaged path succeeded")
+	}
+
+	info, err := os.Lstat("overlay/config/app.yml")
+	if err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("pinned file is not a regular file: %v", err)
+	}
+
+	// Local edits survive a relink and never reach the upstream
+	if err := os.WriteFile("overlay/config/app.yml", []byte("local"), 0644); err != nil {
+		t.Fatalf("Failed to edit pinned file: %v", err)
+	}
+	relink()
+	if data, _ := os.ReadFile("overlay/config/app.yml"); string(data) != "local" {
+		t.Errorf("pinned file = %q after relink, want %q", data, "local")
+	}
+	if data, _ := os.ReadFile(".upstream/config/app.yml"); string(data) != "upstream" {
+		t.Errorf("upstream file = %q, want %q", data, "upstream")
+	}
+
+	gitignore, err := os.ReadFile(".gitignore")
+	if err != nil {
+		t.Fatalf("Failed to read .gitignore: %v", err)
+	}
+	if strings.Contains(string(gitignore), "overlay/config/app.yml") {
+		t.Error(".gitignore still ignores the pinned file")
+	}
+	if !strings.Contains(string(gitignore), "overlay/config/db.yml") {
+		t.Error(".gitignore no longer ignores the linked file")
+	}
+
+	cfg := &config.Config{Symlinks: []config.SymlinkSpec{{String: "config"}}}
+	state, err := config.LoadState()
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	for _, st := range collectStatus(cfg, state) {
+		want := statusOK
+		if st.Path == "config/app.yml" {
+			want = statusPinned
+		}
+		if st.Code != want {
+			t.Errorf("status of %s = %q, want %q", st.Path, st.Code, want)
+		}
+	}
+
+	// Clean keeps the pinned file and the directory holding it
+	for _, a := range planClean(cfg, state.ManagedFiles, state.ManagedFiles) {
+		if a.Remove && (a.Path == "config/app.yml" || a.Path == "config") {
+			t.Errorf("clean would remove %s", a.Path)
+		}
+	}
+
+	cmd = newCmd(unpinCmd.RunE)
+	if err := cmd.RunE(cmd, []string{"overlay/config/db.yml"}); err == nil {
+		t.Error("unpin of a file that is not pinned succeeded")
+	}
+	if err := cmd.RunE(cmd, []string{"overlay/config/app.yml"}); err != nil {
+		t.Fatalf("unpin error = %v", err)
+	}
+	if info, err := os.Lstat("overlay/config/app.yml"); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("unpinned file is not linked again: %v", err)
+	}
+	if state, _ := config.LoadState(); state.IsPinned("config/app.yml") {
+		t.Error("state still marks the file pinned")
+	}
+}
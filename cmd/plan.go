@@ -0,0 +1,322 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+// plannedLink is a single file to materialize, worked out before anything
+// in overlay/ is touched
+type plannedLink struct {
+	src       string // Source path including the upstream directory
+	dst       string // Target path including overlay/
+	upstream  string // Named upstream, empty for .upstream
+	spec      string // Spec the link came from, for error messages
+	component string // components: group of the spec, empty for symlinks
+	preserve  bool   // Recreate the upstream symlink at dst instead of linking src
+}
+
+// planLinks expands specs into one planned link per file. Symlinked
+// directories are only expanded when upstream symlinks are followed.
+func planLinks(specs []config.SymlinkSpec, symlinks string) ([]plannedLink, error) {
+	var plan []plannedLink
+	for _, link := range specs {
+		links, err := planSpec(link, symlinks)
+		if link.Optional && errors.Is(err, overlayerr.ErrSourceMissing) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, links...)
+	}
+	return plan, nil
+}
+
+// planSpec expands a single spec into one planned link per file
+func planSpec(link config.SymlinkSpec, symlinks string) ([]plannedLink, error) {
+	var plan []plannedLink
+	var pattern, targetBase string
+	if link.String != "" {
+		pattern = link.String
+		targetBase = link.String
+	} else {
+		pattern = link.From
+		targetBase = link.To
+	}
+
+	// Calculate source and target paths
+	from := filepath.Join(config.UpstreamDir(link.Upstream), pattern)
+	to := filepath.Join("overlay", targetBase)
+
+	// Check if source exists
+	info, err := os.Stat(from)
+	if err != nil {
+		// Deletions are handled by applyUpstreamDeletes when the spec has a policy
+		if link.OnUpstreamDelete != "" && os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: %s", overlayerr.ErrSourceMissing, from)
+	}
+
+	// Links in a crafted upstream must not expose files outside it
+	if err := validateWithin(config.UpstreamDir(link.Upstream), from); err != nil {
+		return nil, fmt.Errorf("refusing spec %s: %w", pattern, err)
+	}
+
+	if !info.IsDir() {
+		return []plannedLink{{src: from, dst: to, upstream: link.Upstream, spec: pattern, component: link.Component}}, nil
+	}
+
+	// Walk the directory and plan a link for each file
+	within := config.UpstreamDir(link.Upstream)
+	if symlinks == UpstreamSymlinksPreserve || symlinks == UpstreamSymlinksSkip {
+		within = ""
+	}
+	err = walkFiles(from, within, func(path string) error {
+		if err := validateWithin(config.UpstreamDir(link.Upstream), path); err != nil {
+			return fmt.Errorf("refusing spec %s: %w", pattern, err)
+		}
+
+		// Calculate relative path from source base
+		relPath, err := filepath.Rel(from, path)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %w", err)
+		}
+
+		// Calculate target path preserving directory structure
+		plan = append(plan, plannedLink{
+			src:       path,
+			dst:       filepath.Join("overlay", targetBase, relPath),
+			upstream:  link.Upstream,
+			spec:      pattern,
+			component: link.Component,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to process directory %s: %w", pattern, err)
+	}
+	return plan, nil
+}
+
+// Policies for symlinks inside the upstream, set with upstream_symlinks
+const (
+	UpstreamSymlinksFollow   = "follow"   // Materialize what the symlink points to (default)
+	UpstreamSymlinksPreserve = "preserve" // Recreate the symlink itself in overlay/
+	UpstreamSymlinksSkip     = "skip"     // Leave symlinks out
+)
+
+// preservedLinkMode is recorded for upstream symlinks recreated as symlinks
+// under upstream_symlinks: preserve, whatever the link mode
+const preservedLinkMode = "preserve"
+
+// preservedTarget returns the target for the symlink recreated at dst from
+// the upstream symlink src. A link still at its upstream path keeps its
+// target, as does one moved by to: whose target is in its own directory,
+// which moves with it. Any other target is rebased onto the upstream file it
+// names, since the link's new depth would make it resolve somewhere else.
+func preservedTarget(src, dst, upstream string) (string, error) {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to read upstream symlink %s: %w", src, err)
+	}
+	root := config.UpstreamDir(upstream)
+	resolved := target
+	if !filepath.IsAbs(target) {
+		resolved = filepath.Join(filepath.Dir(src), target)
+	}
+	if !lexicallyWithin(resolved, root) {
+		return "", fmt.Errorf("%w: upstream symlink %s points to %s", overlayerr.ErrPathEscape, src, target)
+	}
+
+	relSrc, err := filepath.Rel(root, src)
+	if err == nil && filepath.ToSlash(relSrc) == overlayRelPath(dst) {
+		return target, nil
+	}
+	if !filepath.IsAbs(target) && lexicallyWithin(resolved, filepath.Dir(src)) {
+		return target, nil
+	}
+
+	from, err := filepath.Abs(filepath.Dir(dst))
+	if err != nil {
+		return "", err
+	}
+	to, err := filepath.Abs(resolved)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(from, to)
+}
+
+// lexicallyWithin reports whether path is parent or inside it, without
+// resolving symlinks
+func lexicallyWithin(path, parent string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	absParent, err := filepath.Abs(parent)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absParent, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// applyUpstreamSymlinks applies the policy to planned sources that are
+// symlinks, so every link mode treats them the same way
+func applyUpstreamSymlinks(plan []plannedLink, policy string) ([]plannedLink, error) {
+	kept := plan[:0]
+	for _, p := range plan {
+		info, err := os.Lstat(p.src)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			kept = append(kept, p)
+			continue
+		}
+
+		switch policy {
+		case UpstreamSymlinksSkip:
+			continue
+		case UpstreamSymlinksPreserve:
+			p.preserve = true
+		case "", UpstreamSymlinksFollow:
+			target, err := filepath.EvalSymlinks(p.src)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: skipping dangling upstream symlink %s\n", p.src)
+				continue
+			}
+			if filepath.IsAbs(target) {
+				wd, err := os.Getwd()
+				if err != nil {
+					return nil, err
+				}
+				if target, err = filepath.Rel(wd, target); err != nil {
+					return nil, err
+				}
+			}
+			p.src = target
+		default:
+			return nil, fmt.Errorf("unknown upstream_symlinks policy: %s", policy)
+		}
+		kept = append(kept, p)
+	}
+	return kept, nil
+}
+
+// Policies for linked files the upstream has deleted, set per spec with
+// on_upstream_delete
+const (
+	OnUpstreamDeleteKeep   = "keep"   // Keep the last materialized content as a pinned copy
+	OnUpstreamDeleteRemove = "remove" // Remove the file from overlay/
+	OnUpstreamDeleteWarn   = "warn"   // Leave the file as it is and warn (default)
+)
+
+// normalizeTargets applies the configured Unicode normalization to every
+// target, so links and state entries agree across macOS and Linux runs
+func normalizeTargets(plan []plannedLink, form string) []plannedLink {
+	for i := range plan {
+		plan[i].dst = config.NormalizePath(form, plan[i].dst)
+	}
+	return plan
+}
+
+// Policies for targets that differ only in case, set with case_collisions
+const (
+	CaseCollisionsError  = "error"  // Fail listing every collision
+	CaseCollisionsRename = "rename" // Link later duplicates as name~N.ext
+	CaseCollisionsIgnore = "ignore" // Don't check
+)
+
+// resolveCaseCollisions finds planned targets that would land on the same
+// file on a case-insensitive filesystem and applies the policy. Without a
+// policy, collisions are only an error when overlay/ is case-insensitive.
+func resolveCaseCollisions(plan []plannedLink, policy string) ([]plannedLink, error) {
+	switch policy {
+	case "":
+		if !caseInsensitiveFS("overlay") {
+			return plan, nil
+		}
+		policy = CaseCollisionsError
+	case CaseCollisionsIgnore:
+		return plan, nil
+	case CaseCollisionsError, CaseCollisionsRename:
+	default:
+		return nil, fmt.Errorf("unsupported case_collisions policy: %s", policy)
+	}
+
+	seen := make(map[string]bool, len(plan))
+	for _, p := range plan {
+		seen[strings.ToLower(p.dst)] = true
+	}
+
+	first := make(map[string]string)
+	collisions := make(map[string][]string)
+	for i, p := range plan {
+		key := strings.ToLower(p.dst)
+		original, ok := first[key]
+		if !ok {
+			first[key] = p.dst
+			continue
+		}
+		if original == p.dst {
+			// The same target from two specs is left to createLink to report
+			continue
+		}
+		collisions[original] = append(collisions[original], p.dst)
+
+		if policy == CaseCollisionsRename {
+			renamed := renameCollision(p.dst, seen)
+			fmt.Printf("Case collision: linking %s as %s\n", p.dst, renamed)
+			plan[i].dst = renamed
+			seen[strings.ToLower(renamed)] = true
+			first[strings.ToLower(renamed)] = renamed
+		}
+	}
+
+	if policy == CaseCollisionsError && len(collisions) > 0 {
+		var lines []string
+		for original, others := range collisions {
+			lines = append(lines, fmt.Sprintf("  %s collides with %s", original, strings.Join(others, ", ")))
+		}
+		sort.Strings(lines)
+		return nil, fmt.Errorf("targets differ only in case and would overwrite each other on a case-insensitive filesystem (set case_collisions: rename to keep both):\n%s", strings.Join(lines, "\n"))
+	}
+	return plan, nil
+}
+
+// renameCollision returns the first name~N.ext variant of dst not in taken
+func renameCollision(dst string, taken map[string]bool) string {
+	ext := filepath.Ext(dst)
+	base := strings.TrimSuffix(dst, ext)
+	for n := 1; ; n++ {
+		candidate := fmt.Sprintf("%s~%d%s", base, n, ext)
+		if !taken[strings.ToLower(candidate)] {
+			return candidate
+		}
+	}
+}
+
+// caseInsensitiveFS reports whether dir is on a case-insensitive filesystem
+func caseInsensitiveFS(dir string) bool {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false
+	}
+	f, err := os.CreateTemp(dir, ".git-overlay-case-probe-")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	upper := filepath.Join(filepath.Dir(f.Name()), strings.ToUpper(filepath.Base(f.Name())))
+	_, err = os.Stat(upper)
+	return err == nil
+}
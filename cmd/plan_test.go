@@ -0,0 +1,363 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+	"github.com/spf13/cobra"
+)
+
+func TestResolveCaseCollisions(t *testing.T) {
+	newPlan := func() []plannedLink {
+		return []plannedLink{
+			{src: ".upstream/README.md", dst: "overlay/README.md"},
+			{src: ".upstream/Readme.md", dst: "overlay/Readme.md"},
+			{src: ".upstream/readme.md", dst: "overlay/readme.md"},
+			{src: ".upstream/README~1.md", dst: "overlay/README~1.md"},
+			{src: ".upstream/other.txt", dst: "overlay/other.txt"},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		policy  string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "error",
+			policy:  CaseCollisionsError,
+			wantErr: "overlay/README.md collides with overlay/Readme.md, overlay/readme.md",
+		},
+		{
+			name:   "rename",
+			policy: CaseCollisionsRename,
+			want:   []string{"overlay/README.md", "overlay/Readme~2.md", "overlay/readme~3.md", "overlay/README~1.md", "overlay/other.txt"},
+		},
+		{
+			name:   "ignore",
+			policy: CaseCollisionsIgnore,
+			want:   []string{"overlay/README.md", "overlay/Readme.md", "overlay/readme.md", "overlay/README~1.md", "overlay/other.txt"},
+		},
+		{
+			name:    "unknown policy",
+			policy:  "merge",
+			wantErr: "unsupported case_collisions policy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveCaseCollisions(newPlan(), tt.policy)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveCaseCollisions() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveCaseCollisions() error = %v", err)
+			}
+			var dsts []string
+			for _, p := range got {
+				dsts = append(dsts, p.dst)
+			}
+			if strings.Join(dsts, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("resolveCaseCollisions() = %v, want %v", dsts, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanLinksRefusesEscapingSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	outside := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream/docs", 0755); err != nil {
+		t.Fatalf("Failed to create upstream: %v", err)
+	}
+	if err := os.WriteFile(".upstream/docs/guide.md", []byte("guide"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "id_rsa"), []byte("secret"), 0600); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	if _, err := planLinks([]config.SymlinkSpec{{String: "docs"}}, ""); err != nil {
+		t.Fatalf("planLinks() error = %v", err)
+	}
+
+	// A crafted upstream links to a file outside the checkout
+	if err := os.Symlink(filepath.Join(outside, "id_rsa"), ".upstream/docs/key"); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if _, err := planLinks([]config.SymlinkSpec{{String: "docs"}}, ""); err == nil {
+		t.Error("planLinks() accepted a symlink resolving outside the upstream")
+	}
+	if err := os.Symlink(outside, ".upstream/home"); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if _, err := planLinks([]config.SymlinkSpec{{String: "home"}}, ""); err == nil {
+		t.Error("planLinks() accepted a spec resolving outside the upstream")
+	}
+}
+
+func TestApplyUpstreamSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream/lib", 0755); err != nil {
+		t.Fatalf("Failed to create upstream: %v", err)
+	}
+	if err := os.WriteFile(".upstream/lib/libfoo.so.1", []byte("elf"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	for name, target := range map[string]string{"libfoo.so": "libfoo.so.1", "stale.so": "libfoo.so.0"} {
+		if err := os.Symlink(target, ".upstream/lib/"+name); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+	}
+
+	tests := []struct {
+		policy       string
+		want         []string // src of each planned link
+		wantPreserve bool
+	}{
+		{policy: "", want: []string{".upstream/lib/libfoo.so.1", ".upstream/lib/libfoo.so.1"}},
+		{policy: UpstreamSymlinksFollow, want: []string{".upstream/lib/libfoo.so.1", ".upstream/lib/libfoo.so.1"}},
+		{policy: UpstreamSymlinksPreserve, want: []string{".upstream/lib/libfoo.so", ".upstream/lib/libfoo.so.1", ".upstream/lib/stale.so"}, wantPreserve: true},
+		{policy: UpstreamSymlinksSkip, want: []string{".upstream/lib/libfoo.so.1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			plan, err := planLinks([]config.SymlinkSpec{{String: "lib"}}, tt.policy)
+			if err != nil {
+				t.Fatalf("planLinks() error = %v", err)
+			}
+			plan, err = applyUpstreamSymlinks(plan, tt.policy)
+			if err != nil {
+				t.Fatalf("applyUpstreamSymlinks() error = %v", err)
+			}
+
+			var got []string
+			for _, p := range plan {
+				got = append(got, filepath.ToSlash(p.src))
+				if isLink := filepath.Base(p.src) != "libfoo.so.1"; p.preserve != (tt.wantPreserve && isLink) {
+					t.Errorf("%s: preserve = %v", p.src, p.preserve)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Planned sources = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	plan, err := planLinks([]config.SymlinkSpec{{String: "lib"}}, "")
+	if err != nil {
+		t.Fatalf("planLinks() error = %v", err)
+	}
+	if _, err := applyUpstreamSymlinks(plan, "bogus"); err == nil {
+		t.Error("applyUpstreamSymlinks() accepted an unknown policy")
+	}
+}
+
+func TestCreateLinksPreservesUpstreamSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream/lib", 0755); err != nil {
+		t.Fatalf("Failed to create upstream: %v", err)
+	}
+	if err := os.WriteFile(".upstream/lib/libfoo.so.1", []byte("elf"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Symlink("libfoo.so.1", ".upstream/lib/libfoo.so"); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	cfg := &config.Config{
+		Symlinks:         []config.SymlinkSpec{{String: "lib"}},
+		LinkMode:         "copy",
+		UpstreamSymlinks: UpstreamSymlinksPreserve,
+	}
+	cmd := &cobra.Command{}
+	cmd.Flags().String("link-mode", "copy", "")
+	cmd.Flags().Bool("force", false, "")
+
+	if err := CreateLinks(cmd, cfg); err != nil {
+		t.Fatalf("CreateLinks() error = %v", err)
+	}
+
+	target, err := os.Readlink("overlay/lib/libfoo.so")
+	if err != nil || target != "libfoo.so.1" {
+		t.Fatalf("overlay/lib/libfoo.so = %q, %v, want a symlink to libfoo.so.1", target, err)
+	}
+	data, err := os.ReadFile("overlay/lib/libfoo.so")
+	if err != nil || string(data) != "elf" {
+		t.Errorf("Preserved symlink does not resolve to the copied file: %q, %v", data, err)
+	}
+
+	state, err := config.LoadState()
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	for _, st := range collectStatus(cfg, state) {
+		if st.Code != statusOK {
+			t.Errorf("%s: status %q, want OK", st.Path, st.Code)
+		}
+	}
+}
+
+func TestPlanLinksOptional(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream", 0755); err != nil {
+		t.Fatalf("Failed to create upstream: %v", err)
+	}
+	if err := os.WriteFile(".upstream/a.txt", []byte("a"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	specs := []config.SymlinkSpec{
+		{String: "a.txt"},
+		{From: "new-layout", To: "new-layout", Optional: true},
+	}
+	plan, err := planLinks(specs, "")
+	if err != nil {
+		t.Fatalf("planLinks() error = %v", err)
+	}
+	if len(plan) != 1 || plan[0].dst != filepath.Join("overlay", "a.txt") {
+		t.Errorf("plan = %+v, want only a.txt", plan)
+	}
+
+	specs[1].Optional = false
+	if _, err := planLinks(specs, ""); !errors.Is(err, overlayerr.ErrSourceMissing) {
+		t.Errorf("planLinks() error = %v, want overlayerr.ErrSourceMissing", err)
+	}
+}
+
+func TestPreservedTarget(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	for _, dir := range []string{".upstream/lib", ".upstream/share"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	for _, file := range []string{".upstream/lib/libfoo.so.1", ".upstream/share/data"} {
+		if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", file, err)
+		}
+	}
+	links := map[string]string{
+		".upstream/lib/libfoo.so": "libfoo.so.1",
+		".upstream/lib/data":      "../share/data",
+		".upstream/lib/escape":    "../../outside",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatalf("Failed to create symlink %s: %v", link, err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		src     string
+		dst     string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "same place",
+			src:  ".upstream/lib/data",
+			dst:  "overlay/lib/data",
+			want: "../share/data",
+		},
+		{
+			name: "moved with its directory",
+			src:  ".upstream/lib/libfoo.so",
+			dst:  "overlay/vendor/x86/libfoo.so",
+			want: "libfoo.so.1",
+		},
+		{
+			name: "moved deeper",
+			src:  ".upstream/lib/data",
+			dst:  "overlay/vendor/x86/lib/data",
+			want: "../../../../.upstream/share/data",
+		},
+		{
+			name:    "escapes the upstream",
+			src:     ".upstream/lib/escape",
+			dst:     "overlay/lib/escape",
+			wantErr: overlayerr.ErrPathEscape,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := preservedTarget(tt.src, tt.dst, "")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("preservedTarget() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("preservedTarget() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("preservedTarget() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
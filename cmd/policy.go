@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+// validatePolicies checks every policies: entry names a known policy
+func validatePolicies(p config.PoliciesConfig) error {
+	for field, policy := range map[string]string{
+		"missing_source": p.MissingSource,
+		"conflict":       p.Conflict,
+		"big_file":       p.BigFile,
+		"blocked_path":   p.BlockedPath,
+	} {
+		switch policy {
+		case "", config.PolicyError, config.PolicyWarn, config.PolicyIgnore:
+		default:
+			return fmt.Errorf("invalid policies.%s %q, want error, warn or ignore", field, policy)
+		}
+	}
+	for _, pattern := range p.AllowedRefs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid policies.allowed_refs pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// checkRefAllowed refuses a ref for the upstream of the given name (empty
+// for the main upstream) that matches none of policies.allowed_refs. Patterns
+// match like paths, so release/* matches release/1.2 but not release/1.2/rc.
+func checkRefAllowed(p config.PoliciesConfig, name, ref string) error {
+	if len(p.AllowedRefs) == 0 {
+		return nil
+	}
+	for _, pattern := range p.AllowedRefs {
+		if ok, _ := path.Match(pattern, ref); ok {
+			return nil
+		}
+	}
+	upstream := "upstream"
+	if name != "" {
+		upstream = "upstream " + name
+	}
+	return fmt.Errorf("%w: %s ref %s matches none of %s", overlayerr.ErrRefNotAllowed, upstream, ref, strings.Join(p.AllowedRefs, ", "))
+}
+
+// checkAllowedRefs checks the refs of the main and every named upstream
+// against policies.allowed_refs, before any of them is fetched
+func checkAllowedRefs(cfg *config.Config) error {
+	if err := checkRefAllowed(cfg.Policies, "", cfg.Upstream.Ref); err != nil {
+		return err
+	}
+	for _, named := range cfg.Upstreams {
+		if err := checkRefAllowed(cfg.Policies, named.Name, named.Ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enforce handles a failed check as its policy says, def when unset: err is
+// returned under error, printed as a warning under warn, and dropped under
+// ignore. A nil return means the caller leaves the offending item out and
+// goes on.
+func enforce(policy, def string, err error) error {
+	if policy == "" {
+		policy = def
+	}
+	switch policy {
+	case config.PolicyWarn:
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return nil
+	case config.PolicyIgnore:
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+	"github.com/spf13/cobra"
+)
+
+func TestPolicies(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	files := map[string]int{"a.txt": 10, "big.bin": 4096, "conflict.txt": 10, ".github/workflows/ci.yml": 10}
+	for name, size := range files {
+		path := filepath.Join(".upstream", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create upstream directory: %v", err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	newConfig := func(policy string) *config.Config {
+		return &config.Config{
+			Symlinks: []config.SymlinkSpec{
+				{String: "a.txt"}, {String: "missing.txt"}, {String: "big.bin"},
+				{String: "conflict.txt"}, {String: ".github"},
+			},
+			BlockedPaths: []config.BlockedPath{{Path: "**/.github/workflows/**"}},
+			Limits:       config.LimitsConfig{MaxFileSize: "1K"},
+			Policies: config.PoliciesConfig{
+				MissingSource: policy,
+				Conflict:      policy,
+				BigFile:       policy,
+				BlockedPath:   policy,
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		check   func(*config.PoliciesConfig)
+		wantErr error
+	}{
+		{name: "missing source", check: func(p *config.PoliciesConfig) { p.MissingSource = config.PolicyError }, wantErr: overlayerr.ErrSourceMissing},
+		{name: "conflict", check: func(p *config.PoliciesConfig) { p.Conflict = config.PolicyError }, wantErr: overlayerr.ErrConflict},
+		{name: "big file", check: func(p *config.PoliciesConfig) { p.BigFile = config.PolicyError }, wantErr: overlayerr.ErrLimitExceeded},
+		{name: "blocked path", check: func(p *config.PoliciesConfig) { p.BlockedPath = config.PolicyError }},
+	}
+
+	for _, policy := range []string{config.PolicyWarn, config.PolicyIgnore} {
+		t.Run(policy, func(t *testing.T) {
+			os.RemoveAll("overlay")
+			if err := os.MkdirAll("overlay", 0755); err != nil {
+				t.Fatalf("Failed to create overlay directory: %v", err)
+			}
+			if err := os.WriteFile("overlay/conflict.txt", []byte("local"), 0644); err != nil {
+				t.Fatalf("Failed to create conflicting file: %v", err)
+			}
+
+			cmd := &cobra.Command{}
+			cmd.Flags().String("link-mode", "copy", "")
+			cmd.Flags().Bool("force", false, "")
+			if err := CreateLinks(cmd, newConfig(policy)); err != nil {
+				t.Fatalf("CreateLinks() error = %v", err)
+			}
+
+			if _, err := os.Stat("overlay/a.txt"); err != nil {
+				t.Errorf("overlay/a.txt not linked: %v", err)
+			}
+			for _, name := range []string{"overlay/big.bin", "overlay/.github/workflows/ci.yml"} {
+				if _, err := os.Lstat(name); err == nil {
+					t.Errorf("%s linked despite failing its check", name)
+				}
+			}
+			if content, _ := os.ReadFile("overlay/conflict.txt"); string(content) != "local" {
+				t.Errorf("overlay/conflict.txt = %q, want it left alone", content)
+			}
+
+			// Each check fails the run on its own under error
+			for _, tt := range tests {
+				os.RemoveAll("overlay/a.txt")
+				cfg := newConfig(policy)
+				tt.check(&cfg.Policies)
+				err := CreateLinks(cmd, cfg)
+				if err == nil {
+					t.Errorf("%s: CreateLinks() succeeded under error", tt.name)
+				} else if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("%s: CreateLinks() error = %v, want %v", tt.name, err, tt.wantErr)
+				}
+			}
+		})
+	}
+
+	// Unset policies keep the strict defaults, apart from blocked_paths
+	// which has always warned
+	plan, err := applyBlockedPaths([]plannedLink{{src: ".upstream/.github/workflows/ci.yml", dst: "overlay/.github/workflows/ci.yml"}}, newConfig("").BlockedPaths, "")
+	if err != nil || len(plan) != 0 {
+		t.Errorf("applyBlockedPaths() by default = %v, %v, want the file left out", plan, err)
+	}
+	if _, err := applyMaxFileSize([]plannedLink{{src: ".upstream/big.bin", dst: "overlay/big.bin"}}, "1K", ""); !errors.Is(err, overlayerr.ErrLimitExceeded) {
+		t.Errorf("applyMaxFileSize() by default error = %v, want overlayerr.ErrLimitExceeded", err)
+	}
+}
+
+func TestValidatePolicies(t *testing.T) {
+	if err := validatePolicies(config.PoliciesConfig{MissingSource: "warn", BigFile: "ignore"}); err != nil {
+		t.Errorf("validatePolicies() error = %v", err)
+	}
+	if err := validatePolicies(config.PoliciesConfig{Conflict: "skip"}); err == nil {
+		t.Error("validatePolicies() accepted an unknown policy")
+	}
+	if err := validatePolicies(config.PoliciesConfig{AllowedRefs: []string{"release/["}}); err == nil {
+		t.Error("validatePolicies() accepted a malformed allowed_refs pattern")
+	}
+}
+
+func TestCheckAllowedRefs(t *testing.T) {
+	policies := config.PoliciesConfig{AllowedRefs: []string{"v*", "release/*"}}
+	tests := []struct {
+		name     string
+		ref      string
+		upstream string
+		allowed  bool
+	}{
+		{name: "tag", ref: "v1.4.0", allowed: true},
+		{name: "release branch", ref: "release/1.4", allowed: true},
+		{name: "main", ref: "main"},
+		{name: "nested release branch", ref: "release/1.4/hotfix"},
+		{name: "commit", ref: "3f2a9c1d"},
+		{name: "named upstream", ref: "main", upstream: "docs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Upstream: config.UpstreamConfig{Ref: "v1.0.0"}, Policies: policies}
+			if tt.upstream == "" {
+				cfg.Upstream.Ref = tt.ref
+			} else {
+				cfg.Upstreams = []config.NamedUpstream{{Name: tt.upstream, UpstreamConfig: config.UpstreamConfig{Ref: tt.ref}}}
+			}
+			err := checkAllowedRefs(cfg)
+			if tt.allowed && err != nil {
+				t.Errorf("checkAllowedRefs() error = %v", err)
+			}
+			if !tt.allowed && !errors.Is(err, overlayerr.ErrRefNotAllowed) {
+				t.Errorf("checkAllowedRefs() error = %v, want overlayerr.ErrRefNotAllowed", err)
+			}
+		})
+	}
+
+	if err := checkAllowedRefs(&config.Config{Upstream: config.UpstreamConfig{Ref: "main"}}); err != nil {
+		t.Errorf("checkAllowedRefs() without a policy error = %v", err)
+	}
+}
+
+func TestRefPolicyCheckedFirst(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	configContent := "upstream:\n  url: https://example.com/repo.git\n  ref: v1.0.0\npolicies:\n  allowed_refs: [v*]\nsymlinks:\n  - README.md\n"
+	if err := os.WriteFile(".git-overlay.yml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	// switch-ref leaves the config as it is
+	cmd := &cobra.Command{RunE: switchRefCmd.RunE}
+	cmd.Flags().String("config", ".git-overlay.yml", "")
+	if err := cmd.RunE(cmd, []string{"main"}); !errors.Is(err, overlayerr.ErrRefNotAllowed) {
+		t.Errorf("switch-ref main error = %v, want overlayerr.ErrRefNotAllowed", err)
+	}
+	if data, _ := os.ReadFile(".git-overlay.yml"); string(data) != configContent {
+		t.Errorf("switch-ref rewrote the config:\n%s", data)
+	}
+
+	// sync --backup stops before taking the backup
+	cmd = &cobra.Command{RunE: syncCmd.RunE}
+	cmd.Flags().String("config", ".git-overlay.yml", "")
+	cmd.Flags().Bool("backup", true, "")
+	cmd.Flags().String("ref", "main", "")
+	cmd.Flags().Int("jobs", 1, "")
+	cmd.Flags().Bool("accept-rewrite", false, "")
+	if err := cmd.RunE(cmd, nil); !errors.Is(err, overlayerr.ErrRefNotAllowed) {
+		t.Errorf("sync --ref main error = %v, want overlayerr.ErrRefNotAllowed", err)
+	}
+	if _, err := os.Stat(config.DefaultBackupDir); err == nil {
+		t.Error("sync took a backup before refusing the ref")
+	}
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+// preflightLinks checks, before anything in overlay/ changes, that the copies
+// of a run fit on the filesystem holding overlay/ and that its hardlinks don't
+// cross filesystems, so a run fails up front instead of halfway through
+func preflightLinks(plan []plannedLink, opts linkOptions) error {
+	// overlay/ may not exist before the first run
+	target := "overlay"
+	if _, err := os.Stat(target); err != nil {
+		target = "."
+	}
+	targetDev, hasDevice := deviceID(target)
+
+	var need int64
+	for _, p := range plan {
+		if p.preserve {
+			continue
+		}
+		mode := opts.linkMode
+		if opts.auto != nil {
+			mode = opts.auto.mode(p.src)
+		}
+		if mode != "copy" && mode != "hardlink" {
+			continue
+		}
+
+		// Missing sources are reported when they are linked
+		info, err := os.Stat(p.src)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		if mode == "hardlink" {
+			if dev, ok := deviceID(p.src); ok && hasDevice && dev != targetDev {
+				return fmt.Errorf("%w: %s is not on the filesystem holding overlay/", overlayerr.ErrCrossDevice, p.src)
+			}
+			continue
+		}
+
+		// A copy of the same size is most likely left in place as it is
+		if existing, err := os.Lstat(p.dst); err == nil && existing.Mode().IsRegular() && existing.Size() == info.Size() {
+			continue
+		}
+		need += info.Size()
+	}
+
+	if need == 0 {
+		return nil
+	}
+	if free, ok := freeSpace(target); ok && need > free {
+		return fmt.Errorf("%w: copies need %s but %s is free on the filesystem holding overlay/", overlayerr.ErrInsufficientSpace, formatBytes(need), formatBytes(free))
+	}
+	return nil
+}
+
+// applyMaxFileSize leaves out planned files larger than limits.max_file_size,
+// or fails the run, as policies.big_file says
+func applyMaxFileSize(plan []plannedLink, maxFileSize, policy string) ([]plannedLink, error) {
+	if maxFileSize == "" {
+		return plan, nil
+	}
+	maxSize, ok := parseSize(maxFileSize)
+	if !ok || maxSize <= 0 {
+		return nil, fmt.Errorf("invalid limits.max_file_size %q, want a size such as 50M or 1GB", maxFileSize)
+	}
+
+	var kept []plannedLink
+	for _, p := range plan {
+		if !p.preserve {
+			if info, err := os.Stat(p.src); err == nil && info.Mode().IsRegular() && info.Size() > maxSize {
+				err := fmt.Errorf("%w: %s is %s, more than limits.max_file_size (%s)", overlayerr.ErrLimitExceeded, p.src, formatBytes(info.Size()), formatBytes(maxSize))
+				if err := enforce(policy, config.PolicyError, err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		kept = append(kept, p)
+	}
+	return kept, nil
+}
+
+// checkLimits fails a plan that links more files or content than limits
+// allows, before any file is read or linked
+func checkLimits(plan []plannedLink, limits config.LimitsConfig) error {
+	if limits.MaxFiles > 0 && len(plan) > limits.MaxFiles {
+		return fmt.Errorf("%w: the specs match %d files, more than limits.max_files (%d)", overlayerr.ErrLimitExceeded, len(plan), limits.MaxFiles)
+	}
+	if limits.MaxTotalSize == "" {
+		return nil
+	}
+	maxSize, ok := parseSize(limits.MaxTotalSize)
+	if !ok || maxSize <= 0 {
+		return fmt.Errorf("invalid limits.max_total_size %q, want a size such as 500M or 2GB", limits.MaxTotalSize)
+	}
+
+	var total int64
+	for _, p := range plan {
+		if p.preserve {
+			continue
+		}
+		if info, err := os.Stat(p.src); err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		if total > maxSize {
+			return fmt.Errorf("%w: the specs match more than limits.max_total_size (%s) of content", overlayerr.ErrLimitExceeded, formatBytes(maxSize))
+		}
+	}
+	return nil
+}
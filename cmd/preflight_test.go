@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+	"github.com/spf13/cobra"
+)
+
+func TestPreflightLinksSpace(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	free, ok := freeSpace(".")
+	if !ok {
+		t.Skip("free space is not known on this platform")
+	}
+
+	// A sparse file larger than the free space takes up none of it
+	if err := os.MkdirAll(".upstream", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+	if err := os.WriteFile(".upstream/small.txt", []byte("small"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	f, err := os.Create(".upstream/huge.img")
+	if err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	err = f.Truncate(free + 1<<30)
+	f.Close()
+	if err != nil {
+		t.Skipf("sparse files are not supported here: %v", err)
+	}
+
+	huge := plannedLink{src: ".upstream/huge.img", dst: "overlay/huge.img", spec: "huge.img"}
+	small := plannedLink{src: ".upstream/small.txt", dst: "overlay/small.txt", spec: "small.txt"}
+
+	tests := []struct {
+		name     string
+		linkMode string
+		plan     []plannedLink
+		wantErr  error
+	}{
+		{name: "copies that fit", linkMode: "copy", plan: []plannedLink{small}},
+		{name: "copies that don't fit", linkMode: "copy", plan: []plannedLink{small, huge}, wantErr: overlayerr.ErrInsufficientSpace},
+		{name: "symlinks take no space", linkMode: "symlink", plan: []plannedLink{huge}},
+		{name: "hardlinks take no space", linkMode: "hardlink", plan: []plannedLink{huge}},
+		{name: "missing sources are left to the link", linkMode: "copy", plan: []plannedLink{{src: ".upstream/gone", dst: "overlay/gone"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := preflightLinks(tt.plan, linkOptions{linkMode: tt.linkMode})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("preflightLinks() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// The run stops before anything is materialized
+	cfg := &config.Config{
+		LinkMode: "copy",
+		Symlinks: []config.SymlinkSpec{{String: "small.txt"}, {String: "huge.img"}},
+	}
+	cmd := &cobra.Command{}
+	cmd.Flags().String("link-mode", "symlink", "")
+	cmd.Flags().Bool("force", false, "")
+	if err := CreateLinks(cmd, cfg); !errors.Is(err, overlayerr.ErrInsufficientSpace) {
+		t.Fatalf("CreateLinks() error = %v, want %v", err, overlayerr.ErrInsufficientSpace)
+	}
+	if _, err := os.Lstat("overlay/small.txt"); err == nil {
+		t.Error("overlay/small.txt was copied although the run could not finish")
+	}
+}
+
+func TestPreflightLinksCrossDevice(t *testing.T) {
+	// A tmpfs on most Linux systems
+	other := "/dev/shm"
+	tmpDir := t.TempDir()
+	tmpDev, ok := deviceID(tmpDir)
+	otherDev, otherOK := deviceID(other)
+	if !ok || !otherOK || tmpDev == otherDev {
+		t.Skipf("no second filesystem at %s", other)
+	}
+
+	src, err := os.CreateTemp(other, "git-overlay-preflight-*")
+	if err != nil {
+		t.Skipf("can't write to %s: %v", other, err)
+	}
+	src.Close()
+	defer os.Remove(src.Name())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	plan := []plannedLink{{src: src.Name(), dst: filepath.Join("overlay", filepath.Base(src.Name()))}}
+	if err := preflightLinks(plan, linkOptions{linkMode: "hardlink"}); !errors.Is(err, overlayerr.ErrCrossDevice) {
+		t.Errorf("preflightLinks() error = %v, want %v", err, overlayerr.ErrCrossDevice)
+	}
+	if err := preflightLinks(plan, linkOptions{linkMode: "copy"}); err != nil {
+		t.Errorf("preflightLinks() for copies error = %v", err)
+	}
+}
+
+func TestCheckLimits(t *testing.T) {
+	dir := t.TempDir()
+	var plan []plannedLink
+	for _, name := range []string{"a.bin", "b.bin", "c.bin"} {
+		src := filepath.Join(dir, name)
+		if err := os.WriteFile(src, make([]byte, 1024), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		plan = append(plan, plannedLink{src: src, dst: filepath.Join("overlay", name)})
+	}
+
+	tests := []struct {
+		name    string
+		limits  config.LimitsConfig
+		wantErr error
+	}{
+		{name: "no limits", limits: config.LimitsConfig{}},
+		{name: "within limits", limits: config.LimitsConfig{MaxFiles: 3, MaxTotalSize: "3K"}},
+		{name: "too many files", limits: config.LimitsConfig{MaxFiles: 2}, wantErr: overlayerr.ErrLimitExceeded},
+		{name: "too much content", limits: config.LimitsConfig{MaxTotalSize: "2KB"}, wantErr: overlayerr.ErrLimitExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkLimits(plan, tt.limits)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("checkLimits() error = %v, want none", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkLimits() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := checkLimits(plan, config.LimitsConfig{MaxTotalSize: "lots"}); err == nil {
+		t.Error("checkLimits() with an invalid size succeeded, want error")
+	}
+}
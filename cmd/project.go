@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+	"github.com/spf13/cobra"
+)
+
+// defaultConfigFile is the config file used unless --config is given; a
+// directory containing it is the root of a git-overlay project
+const defaultConfigFile = ".git-overlay.yml"
+
+// skipProjectAnnotation marks commands that work on the current directory
+// as it is instead of discovering the project root, such as init
+const skipProjectAnnotation = "git-overlay/skip-project-root"
+
+// projectPrefix is the directory git-overlay was started in, relative to the
+// project root it moved to, slash-separated and "" when started at the root
+var projectPrefix string
+
+// enterProjectRoot moves to the root of the project containing the current
+// directory, so commands work from any subdirectory like git's own. The root
+// is the nearest directory with a config file inside the current git working
+// tree, or the working tree itself when GIT_WORK_TREE names one.
+func enterProjectRoot(cmd *cobra.Command) error {
+	if _, ok := cmd.Annotations[skipProjectAnnotation]; ok || cmd.Flags().Changed("config") {
+		return nil
+	}
+
+	// Relative git locations stop working once the directory changes
+	for _, env := range []string{"GIT_DIR", "GIT_WORK_TREE"} {
+		if value := os.Getenv(env); value != "" && !filepath.IsAbs(value) {
+			abs, err := filepath.Abs(value)
+			if err != nil {
+				return err
+			}
+			os.Setenv(env, abs)
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	// Upstream checkouts are refused with guidance by checkProjectRoot
+	if upstreamOwner(cwd) != "" {
+		return nil
+	}
+
+	top, topErr := gitToplevel(cwd)
+	var root string
+	if os.Getenv("GIT_WORK_TREE") != "" && topErr == nil {
+		if _, err := os.Stat(filepath.Join(top, defaultConfigFile)); err == nil {
+			root = top
+		}
+	} else if root = findProjectRoot(cwd); root != "" && topErr == nil && !isWithin(root, top) {
+		// Like git, never look past the repository the command runs in
+		root = ""
+	}
+	if root == "" || sameDir(root, cwd) {
+		return nil
+	}
+
+	if rel, err := relReal(root, cwd); err == nil && !strings.HasPrefix(rel, "..") {
+		projectPrefix = filepath.ToSlash(rel)
+	}
+	if err := os.Chdir(root); err != nil {
+		return fmt.Errorf("failed to change to project root %s: %w", root, err)
+	}
+	if flagBool(cmd, "debug") {
+		fmt.Fprintf(os.Stderr, "debug: running from project root %s\n", root)
+	}
+	return nil
+}
+
+// overlayArg resolves an overlay path given on the command line. Relative
+// paths are taken from the directory git-overlay was started in, so inside
+// overlay/app "config.yml" names overlay/app/config.yml.
+func overlayArg(arg string) string {
+	if projectPrefix != "" && projectPrefix != "." && !filepath.IsAbs(arg) {
+		arg = path.Join(projectPrefix, filepath.ToSlash(arg))
+	}
+	return overlayRelPath(arg)
+}
+
+// invocationPath resolves a file path given on the command line against the
+// directory git-overlay was started in, since the project root is entered
+// before commands run
+func invocationPath(arg string) string {
+	if projectPrefix != "" && projectPrefix != "." && !filepath.IsAbs(arg) {
+		return filepath.Join(filepath.FromSlash(projectPrefix), arg)
+	}
+	return arg
+}
+
+// checkProjectRoot refuses to run where the current directory would silently
+// be taken as the wrong project root: inside an upstream checkout, below the
+// root of a project, or in a project nested in another git repository
+// without being a repository itself
+func checkProjectRoot(cmd *cobra.Command) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	if owner := upstreamOwner(cwd); owner != "" {
+		return fmt.Errorf("%w: %s is inside the upstream checkout of the git-overlay project at %s; run git-overlay from %s instead", overlayerr.ErrWrongDirectory, cwd, owner, owner)
+	}
+
+	// An explicit config path says where the project is
+	if cmd.Flags().Changed("config") {
+		return nil
+	}
+
+	if _, err := os.Stat(defaultConfigFile); err != nil {
+		if root := findProjectRoot(filepath.Dir(cwd)); root != "" {
+			return fmt.Errorf("%w: %s is not the root of the git-overlay project; run git-overlay from %s", overlayerr.ErrWrongDirectory, cwd, root)
+		}
+		return nil
+	}
+
+	// Nested projects must be repositories of their own, since the upstream
+	// submodule and gitlink are added to the repository at the project root
+	if top, err := gitToplevel(cwd); err == nil && !sameDir(top, cwd) {
+		return fmt.Errorf("%w: %s is a git-overlay project nested in the git repository at %s; make it a repository of its own (for example a submodule of %s) or run git-overlay from %s with --config", overlayerr.ErrWrongDirectory, cwd, top, top, top)
+	}
+	return nil
+}
+
+// upstreamOwner returns the project whose .upstream or .upstreams checkout
+// contains dir, or "" if dir is not inside one
+func upstreamOwner(dir string) string {
+	for ancestor := dir; ; {
+		rel, err := filepath.Rel(ancestor, dir)
+		if err == nil {
+			first := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+			if first == config.UpstreamDir("") || first == config.UpstreamsDir {
+				if _, err := os.Stat(filepath.Join(ancestor, defaultConfigFile)); err == nil {
+					return ancestor
+				}
+			}
+		}
+		parent := filepath.Dir(ancestor)
+		if parent == ancestor {
+			return ""
+		}
+		ancestor = parent
+	}
+}
+
+// findProjectRoot returns the nearest directory from dir upwards that
+// contains the default config file, or "" if there is none
+func findProjectRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, defaultConfigFile)); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// gitToplevel returns the root of the git working tree containing dir
+func gitToplevel(dir string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find git working tree: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// isWithin reports whether dir is parent or below it, after resolving symlinks
+func isWithin(dir, parent string) bool {
+	rel, err := relReal(parent, dir)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// relReal is filepath.Rel over the paths with symlinks resolved
+func relReal(base, target string) (string, error) {
+	base, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		return "", err
+	}
+	target, err = filepath.EvalSymlinks(target)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(base, target)
+}
+
+// sameDir reports whether two paths name the same directory
+func sameDir(a, b string) bool {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(aInfo, bInfo)
+}
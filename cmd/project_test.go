@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestCheckProjectRoot(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, root string)
+		cwd     string
+		config  string // Explicit --config, if any
+		wantErr string
+	}{
+		{
+			name: "project root",
+			cwd:  ".",
+		},
+		{
+			name:    "inside the upstream checkout",
+			setup:   mkdirs(".upstream/src"),
+			cwd:     ".upstream/src",
+			wantErr: "inside the upstream checkout",
+		},
+		{
+			name:    "inside a named upstream checkout",
+			setup:   mkdirs(".upstreams/docs"),
+			cwd:     ".upstreams/docs",
+			wantErr: "inside the upstream checkout",
+		},
+		{
+			name:    "upstream checkout with its own config",
+			setup:   withConfig(".upstream"),
+			cwd:     ".upstream",
+			wantErr: "inside the upstream checkout",
+		},
+		{
+			name:    "project subdirectory",
+			setup:   mkdirs("overlay/app"),
+			cwd:     "overlay/app",
+			wantErr: "not the root of the git-overlay project",
+		},
+		{
+			name:   "subdirectory with explicit config",
+			setup:  mkdirs("overlay/app"),
+			cwd:    "overlay/app",
+			config: "../../.git-overlay.yml",
+		},
+		{
+			name: "nested project in the parent repository",
+			setup: func(t *testing.T, root string) {
+				gitInit(t, root)
+				withConfig("tools/sub")(t, root)
+			},
+			cwd:     "tools/sub",
+			wantErr: "nested in the git repository",
+		},
+		{
+			name: "nested project with its own repository",
+			setup: func(t *testing.T, root string) {
+				gitInit(t, root)
+				withConfig("tools/sub")(t, root)
+				gitInit(t, filepath.Join(root, "tools/sub"))
+			},
+			cwd: "tools/sub",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			if err := os.WriteFile(filepath.Join(root, defaultConfigFile), []byte("upstream: {}\n"), 0644); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+			if tt.setup != nil {
+				tt.setup(t, root)
+			}
+
+			origDir, err := os.Getwd()
+			if err != nil {
+				t.Fatalf("Failed to get working directory: %v", err)
+			}
+			if err := os.Chdir(filepath.Join(root, tt.cwd)); err != nil {
+				t.Fatalf("Failed to change directory: %v", err)
+			}
+			defer os.Chdir(origDir)
+
+			cmd := &cobra.Command{}
+			cmd.Flags().String("config", defaultConfigFile, "")
+			if tt.config != "" {
+				if err := cmd.Flags().Set("config", tt.config); err != nil {
+					t.Fatalf("Failed to set config flag: %v", err)
+				}
+			}
+
+			err = checkProjectRoot(cmd)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkProjectRoot() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkProjectRoot() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// mkdirs returns a setup creating dir under the project root
+func mkdirs(dir string) func(t *testing.T, root string) {
+	return func(t *testing.T, root string) {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+}
+
+// withConfig returns a setup creating a project config in dir
+func withConfig(dir string) func(t *testing.T, root string) {
+	return func(t *testing.T, root string) {
+		mkdirs(dir)(t, root)
+		if err := os.WriteFile(filepath.Join(root, dir, defaultConfigFile), []byte("upstream: {}\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+}
+
+// gitInit initializes a git repository in dir
+func gitInit(t *testing.T, dir string) {
+	t.Helper()
+	if err := runGitCommand(dir, []string{"init", "-q"}); err != nil {
+		t.Fatalf("Failed to init repository in %s: %v", dir, err)
+	}
+}
+
+func TestEnterProjectRoot(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, root string)
+		cwd        string
+		env        map[string]string
+		skip       bool   // Command annotated to skip discovery
+		wantDir    string // Directory expected afterwards, relative to the project root
+		wantPrefix string
+	}{
+		{
+			name:    "project root",
+			cwd:     ".",
+			wantDir: ".",
+		},
+		{
+			name:       "subdirectory of the project repository",
+			setup:      func(t *testing.T, root string) { gitInit(t, root); mkdirs("overlay/app")(t, root) },
+			cwd:        "overlay/app",
+			wantDir:    ".",
+			wantPrefix: "overlay/app",
+		},
+		{
+			name:       "subdirectory without a repository",
+			setup:      mkdirs("docs"),
+			cwd:        "docs",
+			wantDir:    ".",
+			wantPrefix: "docs",
+		},
+		{
+			name:    "init stays where it is",
+			setup:   mkdirs("docs"),
+			cwd:     "docs",
+			skip:    true,
+			wantDir: "docs",
+		},
+		{
+			name:    "upstream checkout is left to the guard",
+			setup:   mkdirs(".upstream/src"),
+			cwd:     ".upstream/src",
+			wantDir: ".upstream/src",
+		},
+		{
+			name: "nested repository is not left",
+			setup: func(t *testing.T, root string) {
+				gitInit(t, root)
+				mkdirs("vendor/lib")(t, root)
+				gitInit(t, filepath.Join(root, "vendor/lib"))
+			},
+			cwd:     "vendor/lib",
+			wantDir: "vendor/lib",
+		},
+		{
+			name: "GIT_WORK_TREE names the project",
+			setup: func(t *testing.T, root string) {
+				gitInit(t, root)
+				withConfig("other")(t, root)
+			},
+			cwd:        "other",
+			env:        map[string]string{"GIT_WORK_TREE": "..", "GIT_DIR": "../.git"},
+			wantDir:    ".",
+			wantPrefix: "other",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			if err := os.WriteFile(filepath.Join(root, defaultConfigFile), []byte("upstream: {}\n"), 0644); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+			if tt.setup != nil {
+				tt.setup(t, root)
+			}
+
+			origDir, err := os.Getwd()
+			if err != nil {
+				t.Fatalf("Failed to get working directory: %v", err)
+			}
+			if err := os.Chdir(filepath.Join(root, tt.cwd)); err != nil {
+				t.Fatalf("Failed to change directory: %v", err)
+			}
+			defer os.Chdir(origDir)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			projectPrefix = ""
+			defer func() { projectPrefix = "" }()
+
+			cmd := &cobra.Command{}
+			cmd.Flags().String("config", defaultConfigFile, "")
+			if tt.skip {
+				cmd.Annotations = map[string]string{skipProjectAnnotation: ""}
+			}
+
+			if err := enterProjectRoot(cmd); err != nil {
+				t.Fatalf("enterProjectRoot() error = %v", err)
+			}
+			cwd, err := os.Getwd()
+			if err != nil {
+				t.Fatalf("Failed to get working directory: %v", err)
+			}
+			if !sameDir(cwd, filepath.Join(root, tt.wantDir)) {
+				t.Errorf("working directory = %s, want %s", cwd, filepath.Join(root, tt.wantDir))
+			}
+			if projectPrefix != tt.wantPrefix {
+				t.Errorf("projectPrefix = %q, want %q", projectPrefix, tt.wantPrefix)
+			}
+			for key := range tt.env {
+				if value := os.Getenv(key); !filepath.IsAbs(value) {
+					t.Errorf("%s = %q, want it made absolute", key, value)
+				}
+			}
+		})
+	}
+}
+
+func TestOverlayArg(t *testing.T) {
+	tests := []struct {
+		prefix string
+		arg    string
+		want   string
+	}{
+		{prefix: "", arg: "overlay/app/config.yml", want: "app/config.yml"},
+		{prefix: "", arg: "app/config.yml", want: "app/config.yml"},
+		{prefix: "overlay/app", arg: "config.yml", want: "app/config.yml"},
+		{prefix: "overlay/app", arg: "../lib/x.go", want: "lib/x.go"},
+		{prefix: "overlay", arg: "app", want: "app"},
+	}
+
+	defer func() { projectPrefix = "" }()
+	for _, tt := range tests {
+		projectPrefix = tt.prefix
+		if got := overlayArg(tt.arg); got != tt.want {
+			t.Errorf("overlayArg(%q) with prefix %q = %q, want %q", tt.arg, tt.prefix, got, tt.want)
+		}
+	}
+}
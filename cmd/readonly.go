@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+// setWritable adds or removes the write bits of a regular file
+func setWritable(path string, writable bool) error {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return err
+	}
+
+	mode := info.Mode().Perm()
+	if writable {
+		mode |= 0200
+	} else {
+		mode &^= 0222
+	}
+	if mode == info.Mode().Perm() {
+		return nil
+	}
+	return os.Chmod(path, mode)
+}
+
+// unlockCopies makes copy-mode managed files writable again so they can be
+// replaced or removed; protect_copies locks them again once linked
+func unlockCopies(files []config.ManagedFile) {
+	for _, mf := range files {
+		if mf.LinkMode == "copy" {
+			setWritable(filepath.Join("overlay", mf.Path), true)
+		}
+	}
+}
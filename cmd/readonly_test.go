@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestProtectCopies(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not meaningful on windows")
+	}
+
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+	if err := os.WriteFile(".upstream/file.txt", []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create upstream file: %v", err)
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("link-mode", "copy", "")
+	cmd.Flags().Bool("force", true, "")
+
+	cfg := &config.Config{
+		Symlinks:      []config.SymlinkSpec{{String: "file.txt"}},
+		Trash:         config.TrashConfig{Enabled: new(bool)},
+		ProtectCopies: true,
+	}
+
+	tests := []struct {
+		name          string
+		protectCopies bool
+		wantWritable  bool
+	}{
+		{name: "locked after copy", protectCopies: true, wantWritable: false},
+		{name: "relinked while locked", protectCopies: true, wantWritable: false},
+		{name: "unlocked when disabled", protectCopies: false, wantWritable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.ProtectCopies = tt.protectCopies
+			if err := CreateLinks(cmd, cfg); err != nil {
+				t.Fatalf("CreateLinks() error = %v", err)
+			}
+
+			info, err := os.Stat("overlay/file.txt")
+			if err != nil {
+				t.Fatalf("Failed to stat overlay file: %v", err)
+			}
+			if writable := info.Mode().Perm()&0200 != 0; writable != tt.wantWritable {
+				t.Errorf("mode = %v, want writable %v", info.Mode().Perm(), tt.wantWritable)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+//go:build linux
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl request number from linux/fs.h
+const ficlone = 0x40049409
+
+// reflinkFile creates dst as a copy-on-write clone of src
+func reflinkFile(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	srcInfo, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, srcInfo.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dstFile.Fd(), ficlone, srcFile.Fd()); errno != 0 {
+		dstFile.Close()
+		os.Remove(dst)
+		return errno
+	}
+	return dstFile.Close()
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package cmd
+
+import "errors"
+
+// reflinkFile is not implemented outside Linux
+func reflinkFile(src, dst string) error {
+	return errors.New("reflinks are not supported on this platform")
+}
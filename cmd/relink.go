@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var relinkCmd = &cobra.Command{
+	Use:   "relink",
+	Short: "Rebuild links from the current upstream checkouts without fetching",
+	Long: `Rebuild links from the upstream checkouts as they are on disk. Nothing is
+fetched or checked out, which makes relink much faster than sync and useful
+after switching branches in the parent repository or restoring a backup.`,
+	Annotations: map[string]string{lockAnnotation: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		// An interrupt records the links made so far before exiting
+		defer trapInterrupts()()
+
+		if err := checkUpstreamCheckouts(cfg); err != nil {
+			return err
+		}
+
+		// Rebuild links, updating gitignore and state once at the end
+		if err := CreateLinks(cmd, cfg); err != nil {
+			return fmt.Errorf("failed to rebuild links: %w", err)
+		}
+
+		fmt.Println("Links rebuilt from the current upstream checkouts")
+		return nil
+	},
+}
+
+// checkUpstreamCheckouts makes sure every upstream has been checked out, since
+// relink never fetches one
+func checkUpstreamCheckouts(cfg *config.Config) error {
+	names := []string{""}
+	for _, named := range cfg.Upstreams {
+		names = append(names, named.Name)
+	}
+	for _, name := range names {
+		dir := config.UpstreamDir(name)
+		if _, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("upstream checkout %s is missing, run 'git-overlay sync' first", dir)
+		}
+	}
+	return nil
+}
+
+func init() {
+	relinkCmd.Flags().StringArray("only", nil, "Only link targets under this overlay path (repeatable)")
+	relinkCmd.Flags().Bool("ignore-case", false, "Match --only paths ignoring case")
+	relinkCmd.Flags().StringArray("component", nil, "Only link the specs of this component (repeatable)")
+	relinkCmd.Flags().String("chown", "", "Give copy-mode files this numeric uid:gid when running as root")
+	relinkCmd.Flags().Bool("keep-going", false, "Link everything that can be linked and report all failures at the end")
+	rootCmd.AddCommand(relinkCmd)
+}
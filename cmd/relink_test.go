@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestRelinkCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	configContent := `upstream:
+  url: "https://example.com/repo.git"
+  ref: "main"
+symlinks:
+  - docs
+`
+	if err := os.WriteFile(".git-overlay.yml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+
+	newCmd := func() *cobra.Command {
+		cmd := &cobra.Command{Use: "relink", RunE: relinkCmd.RunE}
+		cmd.Flags().String("config", ".git-overlay.yml", "")
+		cmd.Flags().String("link-mode", "symlink", "")
+		cmd.Flags().Bool("force", true, "")
+		return cmd
+	}
+
+	// Without a checkout there is nothing to link from, and nothing is fetched
+	cmd := newCmd()
+	if err := cmd.RunE(cmd, nil); err == nil {
+		t.Fatal("relink succeeded without an upstream checkout")
+	}
+
+	if err := os.MkdirAll(".upstream/docs", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+	if err := os.WriteFile(".upstream/docs/a.md", []byte("a"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	cmd = newCmd()
+	if err := cmd.RunE(cmd, nil); err != nil {
+		t.Fatalf("relink error = %v", err)
+	}
+	if _, err := os.Lstat("overlay/docs/a.md"); err != nil {
+		t.Errorf("relink did not link overlay/docs/a.md: %v", err)
+	}
+}
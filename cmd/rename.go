@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+// renamer rewrites overlay/ targets with the rename: rules
+type renamer struct {
+	rules    []config.RenameRule
+	patterns []*regexp.Regexp
+}
+
+// newRenamer compiles the rename: rules
+func newRenamer(rules []config.RenameRule) (*renamer, error) {
+	r := &renamer{rules: rules}
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rename pattern %q: %w", rule.Match, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// target rewrites an overlay-relative, slash-separated target with the first
+// rule matching it, reporting whether one did
+func (r *renamer) target(rel string) (string, bool) {
+	for i, re := range r.patterns {
+		if re.MatchString(rel) {
+			return path.Clean(re.ReplaceAllString(rel, r.rules[i].To)), true
+		}
+	}
+	return rel, false
+}
+
+// applyRenames rewrites planned targets with the rename: rules. A rule that
+// would move a target out of overlay/, or onto another planned target, fails
+// the run rather than overwrite anything.
+func applyRenames(plan []plannedLink, rules []config.RenameRule) ([]plannedLink, error) {
+	if len(rules) == 0 {
+		return plan, nil
+	}
+	r, err := newRenamer(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	moved := newMovedTargets(len(plan))
+	for i, p := range plan {
+		rel := filepath.ToSlash(overlayRelPath(p.dst))
+		renamed, ok := r.target(rel)
+		if ok {
+			if renamed == "." || validatePath("overlay", renamed) != nil {
+				return nil, fmt.Errorf("rename rules move %s outside overlay/ (to %q)", rel, renamed)
+			}
+			plan[i].dst = filepath.Join("overlay", filepath.FromSlash(renamed))
+		}
+		if other, taken := moved.add(rel, renamed, ok); taken {
+			return nil, fmt.Errorf("rename rules map %s and %s to the same target %s", other, rel, renamed)
+		}
+	}
+	return plan, nil
+}
+
+// movedTargets tracks where planned links land after rules move them, to
+// catch two links moved onto the same target. Targets already shared by
+// overlapping specs are left to the specs.
+type movedTargets struct {
+	origins map[string]targetOrigin
+}
+
+// targetOrigin is the planned link that landed on a target
+type targetOrigin struct {
+	rel   string // Target before the move
+	moved bool
+}
+
+func newMovedTargets(size int) *movedTargets {
+	return &movedTargets{origins: make(map[string]targetOrigin, size)}
+}
+
+// add records the link planned at rel as landing on target, and returns the
+// other link already there when either of them was moved
+func (m *movedTargets) add(rel, target string, moved bool) (string, bool) {
+	if other, taken := m.origins[target]; taken && other.rel != rel && (moved || other.moved) {
+		return other.rel, true
+	}
+	m.origins[target] = targetOrigin{rel: rel, moved: moved}
+	return "", false
+}
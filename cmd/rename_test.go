@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+func TestApplyRenames(t *testing.T) {
+	rules := []config.RenameRule{
+		{Match: `^docs/(.*)$`, To: "handbook/$1"},
+		{Match: `^docs/`, To: "never/"},
+		{Match: `\.markdown$`, To: ".md"},
+	}
+
+	tests := []struct {
+		name    string
+		rules   []config.RenameRule
+		targets []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "first matching rule applies",
+			rules:   rules,
+			targets: []string{"docs/intro.md", "README.markdown", "src/main.go"},
+			want:    []string{"handbook/intro.md", "README.md", "src/main.go"},
+		},
+		{
+			name:    "no rules",
+			targets: []string{"docs/intro.md"},
+			want:    []string{"docs/intro.md"},
+		},
+		{
+			name:    "overlapping specs keep sharing a target",
+			rules:   rules,
+			targets: []string{"src/a.go", "src/a.go"},
+			want:    []string{"src/a.go", "src/a.go"},
+		},
+		{
+			name:    "collision",
+			rules:   rules,
+			targets: []string{"docs/a.md", "handbook/a.md"},
+			wantErr: "same target handbook/a.md",
+		},
+		{
+			name:    "escape",
+			rules:   []config.RenameRule{{Match: `^(.*)$`, To: "../$1"}},
+			targets: []string{"a.txt"},
+			wantErr: "outside overlay/",
+		},
+		{
+			name:    "invalid pattern",
+			rules:   []config.RenameRule{{Match: `(`, To: "x"}},
+			targets: []string{"a.txt"},
+			wantErr: "invalid rename pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var plan []plannedLink
+			for _, target := range tt.targets {
+				plan = append(plan, plannedLink{src: filepath.Join(".upstream", target), dst: filepath.Join("overlay", target)})
+			}
+
+			got, err := applyRenames(plan, tt.rules)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("applyRenames() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyRenames() error = %v", err)
+			}
+			var targets []string
+			for _, p := range got {
+				targets = append(targets, overlayRelPath(p.dst))
+			}
+			if !reflect.DeepEqual(targets, tt.want) {
+				t.Errorf("targets = %v, want %v", targets, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/git"
+	"github.com/spf13/cobra"
+)
+
+// repairManagedFiles revalidates the state after the project moved. Entries
+// whose path or source would leave overlay/ or the upstream are dropped, and
+// symlinks that no longer point at their source relative to overlay/, such as
+// absolute links into the old location, are recreated. It returns the paths
+// relinked, dropped, and missing from overlay/.
+func repairManagedFiles(state *config.State) (relinked, dropped, missing []string, err error) {
+	for _, mf := range append([]config.ManagedFile(nil), state.ManagedFiles...) {
+		upstream := config.UpstreamDir(mf.Upstream)
+		if validatePath("overlay", mf.Path) != nil || (mf.Source != "" && validatePath(upstream, mf.Source) != nil) {
+			state.RemoveManagedFile(mf.Path)
+			dropped = append(dropped, mf.Path)
+			continue
+		}
+
+		dst := filepath.Join("overlay", mf.Path)
+		info, err := os.Lstat(dst)
+		if err != nil {
+			missing = append(missing, mf.Path)
+			continue
+		}
+		if mf.LinkMode != "symlink" || mf.Source == "" || info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		src := filepath.Join(upstream, mf.Source)
+		want, err := filepath.Rel(filepath.Dir(dst), src)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if target, err := os.Readlink(dst); err == nil && target == want {
+			continue
+		}
+		if err := os.Remove(dst); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to remove %s: %w", dst, err)
+		}
+		if err := symlinkFile(src, dst); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to relink %s: %w", dst, err)
+		}
+		relinked = append(relinked, mf.Path)
+	}
+	return relinked, dropped, missing, nil
+}
+
+var repairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "Fix links, state and the upstream URL after the project was moved",
+	Long: `Repair a project after its directory was moved or cloned to a new path.
+Symlinks in overlay/ that no longer point at their upstream source relative to
+overlay/, such as absolute links into the old location, are recreated, and
+.upstream is linked to upstream_dir again. State entries with paths outside
+overlay/ or the upstream are dropped, and the content hash cache is reset.
+When the upstream submodule is a local repository, the absolute URL git
+recorded for it is pointed at the path .gitmodules now resolves to.`,
+	Annotations: map[string]string{lockAnnotation: ""},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		state, err := loadState(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+
+		// An external checkout is linked to by its absolute path from the config
+		if cfg.UpstreamDir != "" {
+			if err := linkUpstreamDir(cfg.UpstreamDir); err != nil {
+				return err
+			}
+			state.UpstreamDir = cfg.UpstreamDir
+		} else if cfg.Upstream.IsGit() {
+			url, err := git.RepairUpstreamURL()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v; point upstream.url at it with 'git-overlay set-upstream'\n", err)
+			} else if url != "" {
+				fmt.Printf("Pointed the upstream submodule at %s\n", url)
+			}
+		}
+
+		relinked, dropped, missing, err := repairManagedFiles(state)
+		if err != nil {
+			return err
+		}
+		for _, path := range relinked {
+			fmt.Printf("Relinked overlay/%s\n", path)
+		}
+		for _, path := range dropped {
+			fmt.Printf("Dropped invalid state entry %s\n", path)
+		}
+
+		if err := updateGitignore(cfg, managedIgnores(state)); err != nil {
+			return fmt.Errorf("failed to update gitignore: %w", err)
+		}
+		if err := state.SaveState(); err != nil {
+			return fmt.Errorf("failed to save state: %w", err)
+		}
+
+		// Cached hashes are keyed by inode, which a copy of the project doesn't keep
+		if path, err := hashCachePath(); err == nil {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to reset hash cache: %w", err)
+			}
+		}
+
+		if len(missing) > 0 {
+			fmt.Printf("%d managed files are missing from overlay/; run 'git-overlay relink' to recreate them\n", len(missing))
+		}
+		fmt.Printf("Repaired: %d relinked, %d state entries dropped\n", len(relinked), len(dropped))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(repairCmd)
+}
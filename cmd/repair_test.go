@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+func TestRepairManagedFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	for _, dir := range []string{".upstream/src", "overlay/src"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	for _, name := range []string{".upstream/src/a.go", ".upstream/b.txt", ".upstream/c.txt", "overlay/copy.txt"} {
+		if err := os.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	// An absolute link into where the project used to be, and a correct one
+	if err := os.Symlink("/old/project/.upstream/src/a.go", "overlay/src/a.go"); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	if err := os.Symlink("../.upstream/b.txt", "overlay/b.txt"); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	state := &config.State{ManagedFiles: []config.ManagedFile{
+		{Path: "src/a.go", LinkMode: "symlink", Source: "src/a.go"},
+		{Path: "b.txt", LinkMode: "symlink", Source: "b.txt"},
+		{Path: "c.txt", LinkMode: "symlink", Source: "c.txt"},
+		{Path: "copy.txt", LinkMode: "copy", Source: "copy.txt"},
+		{Path: "../escaped.txt", LinkMode: "symlink", Source: "b.txt"},
+		{Path: "abs.txt", LinkMode: "symlink", Source: "/old/project/.upstream/b.txt"},
+	}}
+
+	relinked, dropped, missing, err := repairManagedFiles(state)
+	if err != nil {
+		t.Fatalf("repairManagedFiles() error = %v", err)
+	}
+	if len(relinked) != 1 || relinked[0] != "src/a.go" {
+		t.Errorf("relinked = %v, want [src/a.go]", relinked)
+	}
+	if len(dropped) != 2 {
+		t.Errorf("dropped = %v, want the escaping and absolute entries", dropped)
+	}
+	if len(missing) != 1 || missing[0] != "c.txt" {
+		t.Errorf("missing = %v, want [c.txt]", missing)
+	}
+	if len(state.ManagedFiles) != 4 {
+		t.Errorf("state has %d entries, want 4", len(state.ManagedFiles))
+	}
+
+	target, err := os.Readlink("overlay/src/a.go")
+	if err != nil {
+		t.Fatalf("Failed to read link: %v", err)
+	}
+	if want := filepath.Join("..", "..", ".upstream", "src", "a.go"); target != want {
+		t.Errorf("overlay/src/a.go -> %s, want %s", target, want)
+	}
+	if data, err := os.ReadFile("overlay/src/a.go"); err != nil || string(data) != ".upstream/src/a.go" {
+		t.Errorf("overlay/src/a.go reads %q, %v", data, err)
+	}
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+// resolvedFile is where a file in overlay/ comes from upstream
+type resolvedFile struct {
+	Overlay  string `json:"overlay"`            // Path in overlay/, relative to the project root
+	Upstream string `json:"upstream,omitempty"` // Named upstream, empty for the main one
+	Source   string `json:"source"`             // Path relative to the upstream checkout
+	Path     string `json:"path"`               // Absolute path of the source on disk
+	Type     string `json:"type"`
+	Location string `json:"location"`
+	Ref      string `json:"ref"`
+	Commit   string `json:"commit,omitempty"` // Commit checked out, for git upstreams
+	Managed  bool   `json:"managed"`          // Recorded in the state rather than only covered by a spec
+	Pinned   bool   `json:"pinned,omitempty"`
+}
+
+// resolveFile finds the upstream source of an overlay path and the commit it
+// is checked out at
+func resolveFile(cfg *config.Config, state *config.State, path string) (*resolvedFile, error) {
+	rel := overlayRelPath(path)
+	upstream, source, err := resolveUpstreamSource(cfg, state, path)
+	if err != nil {
+		return nil, err
+	}
+	u, err := namedUpstream(cfg, upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	// An upstream_dir checkout is reached through the .upstream link
+	dir := config.UpstreamDir(upstream)
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s is not checked out; run 'git-overlay sync'", overlayerr.ErrSourceMissing, dir)
+	}
+	abs, err := filepath.Abs(filepath.Join(real, filepath.FromSlash(source)))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Lstat(abs); err != nil {
+		return nil, fmt.Errorf("%w: %s", overlayerr.ErrSourceMissing, filepath.Join(dir, source))
+	}
+
+	desc := describeUpstream(upstream, u, dir)
+	resolved := &resolvedFile{
+		Overlay:  filepath.ToSlash(filepath.Join("overlay", rel)),
+		Upstream: upstream,
+		Source:   source,
+		Path:     abs,
+		Type:     desc.Type,
+		Location: desc.Location,
+		Ref:      desc.Ref,
+		Commit:   desc.Commit,
+	}
+	if managed, mf := state.IsManagedFile(rel); managed {
+		resolved.Managed = true
+		resolved.Pinned = mf.Pinned
+	}
+	return resolved, nil
+}
+
+var resolveCmd = &cobra.Command{
+	Use:   "resolve <overlay-path>",
+	Short: "Print the upstream file a managed overlay file comes from",
+	Long: `Print the absolute path of the upstream source of a file in overlay/ and the
+upstream ref and commit it is checked out at, for editor plugins that jump
+from an overlay file to its canonical source. The first line of the output is
+the path alone; --json prints the overlay path, upstream name, source path,
+location, ref, commit and whether the file is recorded in the state or pinned.
+
+Files not yet linked are resolved through the specs in the config.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		state, err := loadState(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+
+		resolved, err := resolveFile(cfg, state, overlayArg(args[0]))
+		if err != nil {
+			return err
+		}
+
+		if flagBool(cmd, "json") {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(resolved)
+		}
+
+		fmt.Println(resolved.Path)
+		from := fmt.Sprintf("from %s %s", resolved.Location, resolved.Ref)
+		if resolved.Commit != "" {
+			from += " at " + shortID(resolved.Commit)
+		}
+		if resolved.Pinned {
+			from += " (pinned, overlay copy may differ)"
+		}
+		fmt.Println(from)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resolveCmd)
+	resolveCmd.Flags().Bool("json", false, "Print the resolved file as JSON")
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+func TestResolveFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, env := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(env, "test")
+	}
+	for _, env := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(env, "test@example.com")
+	}
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream/pkg", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+	if err := runGitCommand(".upstream", []string{"init", "-b", "main"}); err != nil {
+		t.Fatalf("Failed to init upstream: %v", err)
+	}
+	for _, name := range []string{"foo.go", "bar.go"} {
+		if err := os.WriteFile(".upstream/pkg/"+name, []byte("package pkg"), 0644); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+	}
+	for _, args := range [][]string{{"add", "."}, {"commit", "-m", "Initial"}} {
+		if err := runGitCommand(".upstream", args); err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+	}
+	out, _ := exec.Command("git", "-C", ".upstream", "rev-parse", "HEAD").Output()
+	head := strings.TrimSpace(string(out))
+
+	cfg := &config.Config{
+		Upstream: config.UpstreamConfig{URL: "https://example.com/repo.git", Ref: "main"},
+		Symlinks: []config.SymlinkSpec{{From: "pkg", To: "lib"}},
+	}
+	state := &config.State{}
+	state.AddManagedFile("lib/foo.go", "copy", "pkg/foo.go")
+	state.SetPinned("lib/foo.go", true)
+
+	tests := []struct {
+		path        string
+		wantSource  string
+		wantManaged bool
+		wantErr     error
+	}{
+		{path: "overlay/lib/foo.go", wantSource: "pkg/foo.go", wantManaged: true},
+		{path: "lib/bar.go", wantSource: "pkg/bar.go"},
+		{path: "overlay/lib/gone.go", wantErr: overlayerr.ErrSourceMissing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := resolveFile(cfg, state, tt.path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("resolveFile() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveFile() error = %v", err)
+			}
+
+			if got.Source != tt.wantSource || got.Managed != tt.wantManaged || got.Pinned != tt.wantManaged {
+				t.Errorf("resolveFile() = %+v, want source %s, managed and pinned %v", got, tt.wantSource, tt.wantManaged)
+			}
+			if !filepath.IsAbs(got.Path) || !strings.HasSuffix(filepath.ToSlash(got.Path), "/.upstream/"+tt.wantSource) {
+				t.Errorf("Path = %s, want the absolute path of .upstream/%s", got.Path, tt.wantSource)
+			}
+			if got.Commit != head || got.Ref != "main" || got.Location != cfg.Upstream.URL {
+				t.Errorf("upstream = %s %s at %s, want %s main at %s", got.Location, got.Ref, got.Commit, cfg.Upstream.URL, head)
+			}
+		})
+	}
+
+	if _, err := resolveFile(cfg, state, "overlay/custom.go"); err == nil {
+		t.Error("resolveFile() of an unmanaged file succeeded, want error")
+	}
+}
@@ -11,11 +11,18 @@ var (
 		Use:     "git-overlay",
 		Short:   "Git Overlay - Manage overlay repositories that extend upstream Git repositories",
 		Version: version,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := enterProjectRoot(cmd); err != nil {
+				return err
+			}
+			return lockCommand(cmd)
+		},
 	}
 )
 
 // Execute runs the root command
 func Execute() error {
+	defer func() { heldLock.release() }()
 	return rootCmd.Execute()
 }
 
@@ -26,8 +33,9 @@ func SetVersion(v string) {
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringP("config", "c", ".git-overlay.yml", "Path to config file")
+	rootCmd.PersistentFlags().StringP("config", "c", defaultConfigFile, "Path or https URL of config file")
+	rootCmd.PersistentFlags().String("config-sha256", "", "Expected SHA-256 of the config file")
 	rootCmd.PersistentFlags().BoolP("force", "f", false, "Force overwrite of existing files/links")
-	rootCmd.PersistentFlags().String("link-mode", "symlink", "Link mode (symlink|hardlink|copy)")
+	rootCmd.PersistentFlags().String("link-mode", "symlink", "Link mode (symlink|reflink|hardlink|copy|auto)")
 	rootCmd.PersistentFlags().Bool("debug", false, "Enable debug logging")
 }
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+// maxSecretScanSize is the largest file scanned; bigger ones are data, not config
+const maxSecretScanSize = 4 << 20
+
+// minSecretEntropy is the Shannon entropy in bits per character above which a
+// value assigned to a secret-sounding key may be a real secret. Hex keys only
+// reach about 3.7, so values also need letters and digits to be reported,
+// which rules out placeholders like "changeme-in-production".
+const minSecretEntropy = 3.5
+
+// secretRules are token formats that are secrets wherever they appear
+var secretRules = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"private key", regexp.MustCompile(`-----BEGIN (RSA |EC |DSA |OPENSSH |PGP |ENCRYPTED )?PRIVATE KEY( BLOCK)?-----`)},
+	{"AWS access key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{60,})\b`)},
+	{"GitLab token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"Stripe live key", regexp.MustCompile(`\b[sr]k_live_[0-9A-Za-z]{24,}\b`)},
+}
+
+// secretAssignment matches a value given to a key named like a secret, which
+// is only reported when the value is random enough to be one
+var secretAssignment = regexp.MustCompile(`(?i)(password|passwd|secret|token|api_?key|access_?key|private_?key)["']?\s*[:=]\s*["']?([A-Za-z0-9+/_.=-]{16,})`)
+
+// secretFinding is a line of an upstream file that looks like it holds a secret
+type secretFinding struct {
+	path string
+	line int
+	rule string
+}
+
+// String formats the finding as path:line for reports
+func (f secretFinding) String() string {
+	return fmt.Sprintf("%s:%d (%s)", f.path, f.line, f.rule)
+}
+
+// shannonEntropy returns the entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	var entropy float64
+	n := float64(len(s))
+	for _, c := range counts {
+		p := float64(c) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// scanLine returns the rule a line breaks, if any
+func scanLine(line string) (string, bool) {
+	for _, rule := range secretRules {
+		if rule.pattern.MatchString(line) {
+			return rule.name, true
+		}
+	}
+	for _, m := range secretAssignment.FindAllStringSubmatch(line, -1) {
+		value := m[2]
+		if strings.ContainsAny(value, "0123456789") && strings.IndexFunc(value, unicode.IsLetter) >= 0 && shannonEntropy(value) >= minSecretEntropy {
+			return "high-entropy " + strings.ToLower(m[1]), true
+		}
+	}
+	return "", false
+}
+
+// scanFile reports the lines of a text file that look like secrets. Binary
+// and oversized files are skipped.
+func scanFile(path string) ([]secretFinding, error) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxSecretScanSize || !isText(path) {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var findings []secretFinding
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxSecretScanSize)
+	for n := 1; scanner.Scan(); n++ {
+		if rule, ok := scanLine(scanner.Text()); ok {
+			findings = append(findings, secretFinding{path: path, line: n, rule: rule})
+		}
+	}
+	return findings, scanner.Err()
+}
+
+// scanSecrets screens the sources of planned links for secrets and applies
+// the secret_scan policy to what it finds
+func scanSecrets(plan []plannedLink, sc config.SecretScanConfig) error {
+	switch sc.Policy {
+	case "", config.SecretScanOff:
+		return nil
+	case config.SecretScanWarn, config.SecretScanError:
+	default:
+		return fmt.Errorf("unsupported secret_scan.policy: %s", sc.Policy)
+	}
+
+	var findings []secretFinding
+	for _, p := range plan {
+		if p.preserve {
+			continue
+		}
+		relSrc, _ := filepath.Rel(config.UpstreamDir(p.upstream), p.src)
+		if matchAnyGlob(sc.Allow, relSrc) {
+			continue
+		}
+		found, err := scanFile(p.src)
+		if err != nil {
+			return fmt.Errorf("failed to scan %s for secrets: %w", p.src, err)
+		}
+		findings = append(findings, found...)
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+
+	if sc.Policy == config.SecretScanWarn {
+		for _, f := range findings {
+			fmt.Fprintf(os.Stderr, "Warning: possible secret at %s\n", f)
+		}
+		return nil
+	}
+	lines := make([]string, len(findings))
+	for i, f := range findings {
+		lines[i] = "  " + f.String()
+	}
+	return fmt.Errorf("%w:\n%s", overlayerr.ErrSecretFound, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/git"
+)
+
+// settingsWarnings holds the settings warnings already printed, since the
+// settings are loaded several times in a run
+var settingsWarnings sync.Map
+
+// warnSettings prints a settings warning once per run
+func warnSettings(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if _, seen := settingsWarnings.LoadOrStore(msg, true); !seen {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", msg)
+	}
+}
+
+// userSettings loads the per-user settings, with the git-overlay section of
+// git config overriding the settings file. An unreadable file or git config
+// is treated as empty so it never blocks a repo-level command.
+func userSettings() *config.Settings {
+	settings, err := config.LoadSettings()
+	if err != nil {
+		warnSettings("ignoring user settings: %v", err)
+		settings = &config.Settings{}
+	}
+	values, err := git.ConfigSection(config.GitConfigSection)
+	if err != nil {
+		warnSettings("ignoring git config: %v", err)
+		return settings
+	}
+	for _, warning := range settings.ApplyGitConfig(values) {
+		warnSettings("ignoring %s", warning)
+	}
+	return settings
+}
+
+// applyAuthHelpers sets each credential variable that isn't already set from
+// the output of its auth helper command
+func applyAuthHelpers(settings *config.Settings) error {
+	for env, helper := range settings.AuthHelpers {
+		if os.Getenv(env) != "" {
+			continue
+		}
+		args := strings.Fields(helper)
+		if len(args) == 0 {
+			continue
+		}
+		out, err := exec.Command(args[0], args[1:]...).Output()
+		if err != nil {
+			return fmt.Errorf("auth helper for %s failed: %w", env, err)
+		}
+		if err := os.Setenv(env, strings.TrimSpace(string(out))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// authHelpersMu keeps upstreams fetched in parallel from running the same
+// auth helper at once
+var authHelpersMu sync.Mutex
+
+// fetchCredentials sets credential variables from the auth helpers. It runs
+// right before a remote config, upstream or push is reached, rather than for
+// every command, so commands that stay offline work without the helpers.
+func fetchCredentials() error {
+	authHelpersMu.Lock()
+	defer authHelpersMu.Unlock()
+	return applyAuthHelpers(userSettings())
+}
+
+func init() {
+	git.SetBeforeFetch(fetchCredentials)
+}
+
+// configCachePath returns where the last fetched copy of a remote config is kept
+func configCachePath(location string) (string, error) {
+	dir, err := userSettings().Cache()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(location))
+	return filepath.Join(dir, "configs", hex.EncodeToString(sum[:])+".yml"), nil
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestFetchCredentials(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	t.Setenv("OVERLAY_TEST_TOKEN", "")
+
+	writeSettings := func(helper string) {
+		t.Helper()
+		dir := filepath.Join(configHome, "git-overlay")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		content := "auth_helpers:\n  OVERLAY_TEST_TOKEN: " + helper + "\n"
+		if err := os.WriteFile(filepath.Join(dir, "config.yml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tmpDir := t.TempDir()
+	originalDir, _ := os.Getwd()
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+
+	configContent := `upstream:
+  url: "https://github.com/acme/base.git"
+  ref: "main"
+symlinks:
+  - src
+`
+	if err := os.WriteFile(".git-overlay.yml", []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failing helper must not break commands that never fetch
+	writeSettings("false")
+	cmd := &cobra.Command{}
+	cmd.Flags().String("config", ".git-overlay.yml", "")
+	if _, err := loadConfig(cmd); err != nil {
+		t.Fatalf("loadConfig() with failing auth helper: %v", err)
+	}
+	if err := fetchCredentials(); err == nil {
+		t.Error("fetchCredentials() with failing auth helper succeeded")
+	}
+
+	writeSettings("echo token")
+	if err := fetchCredentials(); err != nil {
+		t.Fatalf("fetchCredentials() error = %v", err)
+	}
+	if got := os.Getenv("OVERLAY_TEST_TOKEN"); got != "token" {
+		t.Errorf("OVERLAY_TEST_TOKEN = %q, want %q", got, "token")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package cmd
+
+import "net"
+
+// listenUnix listens on a Unix socket at path. There is no umask outside
+// Unix; the socket is restricted once created.
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package cmd
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenUnix listens on a Unix socket at path under a umask that keeps out
+// everyone but the owner from the moment the socket exists
+func listenUnix(path string) (net.Listener, error) {
+	old := syscall.Umask(0077)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// overlayStats summarizes the managed files of an overlay
+type overlayStats struct {
+	Files       int                  `json:"files"`
+	ByMode      map[string]modeStats `json:"by_mode"`
+	BytesShared int64                `json:"bytes_shared"` // Content not duplicated thanks to symlink, hardlink or reflink
+	BytesCopied int64                `json:"bytes_copied"` // Content duplicated by copy mode
+	Largest     []statsFile          `json:"largest"`
+	Upstreams   map[string]int64     `json:"upstream_bytes"` // Checkout size on disk by upstream directory
+}
+
+// modeStats counts the managed files of one link mode
+type modeStats struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// statsFile is a managed file with the size of its upstream source
+type statsFile struct {
+	Path     string `json:"path"`
+	LinkMode string `json:"link_mode"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// collectStats sizes the upstream sources of the managed files and the
+// upstream checkouts, keeping the top largest files
+func collectStats(cfg *config.Config, state *config.State, top int) *overlayStats {
+	stats := &overlayStats{
+		ByMode:    make(map[string]modeStats),
+		Upstreams: make(map[string]int64),
+	}
+
+	var files []statsFile
+	for _, mf := range state.ManagedFiles {
+		info, err := os.Stat(filepath.Join(config.UpstreamDir(mf.Upstream), mf.Source))
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		f := statsFile{Path: mf.Path, LinkMode: mf.LinkMode, Bytes: info.Size()}
+		files = append(files, f)
+
+		stats.Files++
+		m := stats.ByMode[mf.LinkMode]
+		m.Files++
+		m.Bytes += f.Bytes
+		stats.ByMode[mf.LinkMode] = m
+		if mf.LinkMode == "copy" {
+			stats.BytesCopied += f.Bytes
+		} else {
+			stats.BytesShared += f.Bytes
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Bytes > files[j].Bytes })
+	if len(files) > top {
+		files = files[:top]
+	}
+	stats.Largest = files
+
+	dirs := []string{config.UpstreamDir("")}
+	for _, named := range cfg.Upstreams {
+		dirs = append(dirs, config.UpstreamDir(named.Name))
+	}
+	for _, dir := range dirs {
+		if size, err := dirSize(upstreamRoot(dir)); err == nil {
+			stats.Upstreams[dir] = size
+		}
+	}
+	return stats
+}
+
+// dirSize totals the regular files under dir without following symlinks
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// formatBytes renders a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Summarize managed files by link mode and size",
+	Long: `Report how many files are managed in each link mode, how much content is
+shared with the upstream rather than copied, the largest managed files and
+the size of the upstream checkouts. Everything is computed locally.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		jsonOutput, err := cmd.Flags().GetBool("json")
+		if err != nil {
+			return err
+		}
+		top, err := cmd.Flags().GetInt("top")
+		if err != nil {
+			return err
+		}
+
+		state, err := loadState(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+
+		stats := collectStats(cfg, state, top)
+		if jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(stats)
+		}
+
+		fmt.Printf("Managed files: %d\n", stats.Files)
+		modes := make([]string, 0, len(stats.ByMode))
+		for mode := range stats.ByMode {
+			modes = append(modes, mode)
+		}
+		sort.Strings(modes)
+		for _, mode := range modes {
+			m := stats.ByMode[mode]
+			fmt.Printf("  %-10s %6d files  %10s\n", mode, m.Files, formatBytes(m.Bytes))
+		}
+		fmt.Printf("Shared with upstream: %s\n", formatBytes(stats.BytesShared))
+		fmt.Printf("Copied: %s\n", formatBytes(stats.BytesCopied))
+
+		if len(stats.Largest) > 0 {
+			fmt.Println("Largest files:")
+			for _, f := range stats.Largest {
+				fmt.Printf("  %10s  %s (%s)\n", formatBytes(f.Bytes), f.Path, f.LinkMode)
+			}
+		}
+
+		dirs := make([]string, 0, len(stats.Upstreams))
+		for dir := range stats.Upstreams {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(dirs)
+		for _, dir := range dirs {
+			fmt.Printf("Upstream checkout %s: %s\n", dir, formatBytes(stats.Upstreams[dir]))
+		}
+		return nil
+	},
+}
+
+func init() {
+	statsCmd.Flags().Bool("json", false, "Print the statistics as JSON")
+	statsCmd.Flags().Int("top", 10, "Number of largest files to list")
+	rootCmd.AddCommand(statsCmd)
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+func TestCollectStats(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream", 0755); err != nil {
+		t.Fatalf("Failed to create upstream: %v", err)
+	}
+	sizes := map[string]int{"small.txt": 10, "big.bin": 1000, "copied.txt": 100}
+	for name, size := range sizes {
+		if err := os.WriteFile(".upstream/"+name, []byte(strings.Repeat("x", size)), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	state := &config.State{}
+	state.AddManagedFile("small.txt", "symlink", "small.txt")
+	state.AddManagedFile("big.bin", "hardlink", "big.bin")
+	state.AddManagedFile("copied.txt", "copy", "copied.txt")
+	state.AddManagedFile("gone.txt", "symlink", "gone.txt")
+
+	stats := collectStats(&config.Config{}, state, 2)
+
+	if stats.Files != 3 {
+		t.Errorf("Files = %d, want 3", stats.Files)
+	}
+	if stats.BytesShared != 1010 || stats.BytesCopied != 100 {
+		t.Errorf("BytesShared = %d, BytesCopied = %d, want 1010 and 100", stats.BytesShared, stats.BytesCopied)
+	}
+	if m := stats.ByMode["copy"]; m.Files != 1 || m.Bytes != 100 {
+		t.Errorf("ByMode[copy] = %+v", m)
+	}
+	if len(stats.Largest) != 2 || stats.Largest[0].Path != "big.bin" || stats.Largest[1].Path != "copied.txt" {
+		t.Errorf("Largest = %+v", stats.Largest)
+	}
+	if got := stats.Upstreams[".upstream"]; got != 1110 {
+		t.Errorf("Upstream checkout size = %d, want 1110", got)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		in   int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 20, "5.0 MiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.in); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/filehash"
+	"github.com/rjocoleman/git-overlay/internal/git"
+	"github.com/spf13/cobra"
+)
+
+// Status codes for managed files, two characters wide like git status --porcelain
+const (
+	statusOK        = "  "
+	statusMissing   = " D" // Managed file no longer exists in overlay/
+	statusModified  = " M" // Content or link target differs from upstream
+	statusBroken    = " B" // Upstream source is gone, so the link is dangling
+	statusUntracked = " U" // Recorded in state but not covered by any spec
+	statusPinned    = " P" // Pinned as a local copy that sync leaves alone
+)
+
+// fileStatus is the status of a single managed file
+type fileStatus struct {
+	Path string
+	Code string
+	File config.ManagedFile
+}
+
+// writePorcelain prints the code and path of every file that isn't up to date
+func writePorcelain(w io.Writer, statuses []fileStatus) {
+	for _, st := range statuses {
+		if st.Code != statusOK {
+			fmt.Fprintf(w, "%s %s\n", st.Code, st.Path)
+		}
+	}
+}
+
+// collectStatus checks every managed file in state against overlay/ and .upstream
+func collectStatus(cfg *config.Config, state *config.State) []fileStatus {
+	indexes := upstreamIndexes(cfg)
+	sums, _ := config.LoadSums()
+	hashes := openHashCache()
+	warmHashes(state, hashes)
+	// The cache only saves rereading files, so failing to save it is harmless
+	defer hashes.Save()
+	var data *generateData
+	var statuses []fileStatus
+	for _, mf := range state.ManagedFiles {
+		if mf.Pinned {
+			code := statusPinned
+			if _, err := os.Lstat(filepath.Join("overlay", mf.Path)); err != nil {
+				code = statusMissing
+			}
+			statuses = append(statuses, fileStatus{Path: mf.Path, Code: code, File: mf})
+			continue
+		}
+		if mf.LinkMode == generatedLinkMode {
+			if data == nil {
+				d := newGenerateData(cfg)
+				data = &d
+			}
+			statuses = append(statuses, fileStatus{Path: mf.Path, Code: generatedFileStatus(cfg, *data, mf), File: mf})
+			continue
+		}
+		code := managedFileStatus(mf, indexes, sums, hashes)
+		if code == statusOK && !isCoveredBySpec(cfg, mf.Path) {
+			code = statusUntracked
+		}
+		statuses = append(statuses, fileStatus{Path: mf.Path, Code: code, File: mf})
+	}
+	return statuses
+}
+
+// managedFileStatus compares a managed file with its upstream source. Sizes
+// come from the upstream tree index when there is one; content is compared by
+// hashes cached across runs. Without an upstream checkout, copies are checked
+// against their recorded sums.
+func managedFileStatus(mf config.ManagedFile, indexes map[string]*git.TreeIndex, sums config.Sums, hashes *filehash.Cache) string {
+	dst := filepath.Join("overlay", mf.Path)
+	src := filepath.Join(config.UpstreamDir(mf.Upstream), mf.Source)
+
+	info, err := os.Lstat(dst)
+	if err != nil {
+		return statusMissing
+	}
+
+	// Entries from dirs: and the metadata file only have to exist
+	switch mf.LinkMode {
+	case dirLinkMode:
+		if !info.IsDir() {
+			return statusModified
+		}
+		return statusOK
+	case keepLinkMode, metaLinkMode:
+		return statusOK
+	}
+	if mf.LinkMode == preservedLinkMode {
+		// A preserved symlink must still say what the upstream one says
+		want, err := preservedTarget(src, dst, mf.Upstream)
+		if err != nil {
+			return statusBroken
+		}
+		if got, err := os.Readlink(dst); err != nil || got != want {
+			return statusModified
+		}
+		return statusOK
+	}
+
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		if !upstreamCheckedOut(mf.Upstream) {
+			if code, ok := sumStatus(mf, sums); ok {
+				return code
+			}
+		}
+		return statusBroken
+	}
+
+	if mf.LinkMode == "symlink" {
+		if info.Mode()&os.ModeSymlink == 0 {
+			return statusModified
+		}
+		target, err := os.Stat(dst)
+		if err != nil {
+			return statusBroken
+		}
+		if !os.SameFile(target, srcInfo) {
+			return statusModified
+		}
+		return statusOK
+	}
+
+	if info.IsDir() || srcInfo.IsDir() {
+		return statusOK
+	}
+	if mf.LinkMode == "hardlink" && os.SameFile(info, srcInfo) {
+		return statusOK
+	}
+
+	if entry, ok := indexEntry(indexes, mf.Upstream, mf.Source); ok && entry.Size != info.Size() {
+		return statusModified
+	}
+	if same, err := sameContent(hashes, src, dst); err != nil || !same {
+		return statusModified
+	}
+	return statusOK
+}
+
+// isCoveredBySpec reports whether an overlay-relative path belongs to any spec
+func isCoveredBySpec(cfg *config.Config, path string) bool {
+	path = filepath.ToSlash(path)
+	if isCoveredByDir(cfg, path) || isCoveredByGenerate(cfg, path) || (cfg.MetaFile && path == metaFile) {
+		return true
+	}
+	for _, link := range cfg.Symlinks {
+		target := link.To
+		if link.String != "" {
+			target = link.String
+		}
+		target = strings.Trim(filepath.ToSlash(filepath.Clean(target)), "/")
+		if path == target || strings.HasPrefix(path, target+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// sameContent reports whether two files have identical content, comparing
+// their sizes and then their cached hashes
+func sameContent(hashes *filehash.Cache, a, b string) (bool, error) {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	if aInfo.Size() != bInfo.Size() {
+		return false, nil
+	}
+	aSum, err := hashes.Sum(a)
+	if err != nil {
+		return false, err
+	}
+	bSum, err := hashes.Sum(b)
+	if err != nil {
+		return false, err
+	}
+	return aSum == bSum, nil
+}
+
+// hashCachePath returns where the content hash cache is kept in the git
+// directory
+func hashCachePath() (string, error) {
+	dir, err := config.GitDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "git-overlay", "hashes.json"), nil
+}
+
+// openHashCache loads the content hash cache kept in the git directory, or
+// starts one in memory outside a git repository
+func openHashCache() *filehash.Cache {
+	path, err := hashCachePath()
+	if err != nil {
+		return filehash.NewCache()
+	}
+	return filehash.LoadCache(path)
+}
+
+// warmHashes hashes the copies status compares with their upstream sources,
+// and the sources, on parallel workers ahead of the comparisons
+func warmHashes(state *config.State, hashes *filehash.Cache) {
+	var paths []string
+	for _, mf := range state.ManagedFiles {
+		if mf.Pinned || mf.Source == "" {
+			continue
+		}
+		switch mf.LinkMode {
+		case "symlink", "hardlink", generatedLinkMode, dirLinkMode, keepLinkMode, metaLinkMode, preservedLinkMode:
+			continue
+		}
+		paths = append(paths, filepath.Join("overlay", mf.Path), filepath.Join(config.UpstreamDir(mf.Upstream), mf.Source))
+	}
+	hashes.SumAll(paths, 0)
+}
+
+// refOverrideWarning describes an upstream left on a ref applied with sync --ref
+func refOverrideWarning(cfg *config.Config, state *config.State) string {
+	if state.RefOverride == "" || state.RefOverride == cfg.Upstream.Ref {
+		return ""
+	}
+	return fmt.Sprintf("warning: upstream is at %s from 'sync --ref', not the configured ref %s; run 'git-overlay sync' to return to it", state.RefOverride, cfg.Upstream.Ref)
+}
+
+// upstreamDirWarning describes links created against a different upstream_dir
+// than the configured one
+func upstreamDirWarning(cfg *config.Config, state *config.State) string {
+	if state.UpstreamDir == cfg.UpstreamDir || len(state.ManagedFiles) == 0 {
+		return ""
+	}
+	from, to := state.UpstreamDir, cfg.UpstreamDir
+	if from == "" {
+		from = config.UpstreamDir("")
+	}
+	if to == "" {
+		to = config.UpstreamDir("")
+	}
+	return fmt.Sprintf("warning: links were created from %s but upstream_dir is now %s; run 'git-overlay sync' to move them", from, to)
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the state of managed files",
+	Long: `Show managed files that are missing, modified, broken, or no longer
+covered by any spec in .git-overlay.yml, with when each was last synced and
+from which upstream commit.
+
+With --porcelain, print one line per file that needs attention in a stable
+format for scripts and shell prompts: a two-character code, a space and the
+path relative to overlay/. Codes are " D" (missing), " M" (modified),
+" B" (broken), " U" (in state but not covered by any spec) and " P"
+(pinned as a local copy).
+
+Managed files committed to the parent repository are reported as a warning;
+--fix untracks them with git rm --cached, leaving them on disk.`,
+	// Only --fix changes the repository
+	Annotations: map[string]string{lockAnnotation: "fix"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		porcelain, err := cmd.Flags().GetBool("porcelain")
+		if err != nil {
+			return err
+		}
+
+		state, err := loadState(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+
+		statuses := collectStatus(cfg, state)
+
+		// Materialized upstream content must not end up in the repository
+		committed, err := committedManagedFiles(state)
+		if err != nil {
+			return err
+		}
+		if len(committed) > 0 && flagBool(cmd, "fix") {
+			if err := untrackFiles(committed); err != nil {
+				return err
+			}
+			fmt.Printf("Untracked %d committed managed files; commit the removal to finish\n", len(committed))
+			committed = nil
+		}
+
+		for _, warning := range []string{refOverrideWarning(cfg, state), upstreamDirWarning(cfg, state), committedWarning(committed)} {
+			if warning != "" {
+				fmt.Fprintln(os.Stderr, warning)
+			}
+		}
+
+		if porcelain {
+			writePorcelain(os.Stdout, statuses)
+			return nil
+		}
+
+		labels := map[string]string{
+			statusMissing:   "missing",
+			statusModified:  "modified",
+			statusBroken:    "broken",
+			statusUntracked: "not in config",
+			statusPinned:    "pinned",
+		}
+		problems := 0
+		for _, st := range statuses {
+			if st.Code == statusOK {
+				continue
+			}
+			// Pinned files are listed but diverge on purpose
+			if st.Code != statusPinned {
+				problems++
+			}
+			line := fmt.Sprintf("  %-14s overlay/%s", labels[st.Code]+":", st.Path)
+			if note := syncedNote(st.File); note != "" {
+				line += " (" + note + ")"
+			}
+			fmt.Println(line)
+		}
+
+		if problems == 0 {
+			fmt.Printf("All %d managed files are up to date\n", len(statuses))
+		} else {
+			fmt.Printf("%d of %d managed files need attention\n", problems, len(statuses))
+		}
+		return nil
+	},
+}
+
+func init() {
+	statusCmd.Flags().Bool("porcelain", false, "Print machine-readable output")
+	statusCmd.Flags().Bool("fix", false, "Untrack managed files committed to the repository")
+	rootCmd.AddCommand(statusCmd)
+}
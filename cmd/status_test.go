@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+func TestCollectStatus(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	for _, dir := range []string{".upstream/dir", "overlay/dir"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	for _, name := range []string{"ok.txt", "copy.txt", "edited.txt", "missing.txt", "orphan.txt"} {
+		if err := os.WriteFile(".upstream/dir/"+name, []byte("upstream"), 0644); err != nil {
+			t.Fatalf("Failed to create source: %v", err)
+		}
+	}
+
+	if err := os.Symlink("../../.upstream/dir/ok.txt", "overlay/dir/ok.txt"); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.Symlink("../../.upstream/dir/gone.txt", "overlay/dir/broken.txt"); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := copyFile(".upstream/dir/copy.txt", "overlay/dir/copy.txt"); err != nil {
+		t.Fatalf("Failed to copy: %v", err)
+	}
+	if err := os.WriteFile("overlay/dir/edited.txt", []byte("local edit"), 0644); err != nil {
+		t.Fatalf("Failed to create edited file: %v", err)
+	}
+	if err := os.Symlink("../.upstream/dir/orphan.txt", "overlay/orphan.txt"); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	cfg := &config.Config{
+		Symlinks: []config.SymlinkSpec{{String: "dir"}},
+	}
+	state := &config.State{}
+	state.AddManagedFile("dir/ok.txt", "symlink", "dir/ok.txt")
+	state.AddManagedFile("dir/broken.txt", "symlink", "dir/gone.txt")
+	state.AddManagedFile("dir/copy.txt", "copy", "dir/copy.txt")
+	state.AddManagedFile("dir/edited.txt", "copy", "dir/edited.txt")
+	state.AddManagedFile("dir/missing.txt", "symlink", "dir/missing.txt")
+	state.AddManagedFile("orphan.txt", "symlink", "dir/orphan.txt")
+
+	want := map[string]string{
+		"dir/ok.txt":      statusOK,
+		"dir/broken.txt":  statusBroken,
+		"dir/copy.txt":    statusOK,
+		"dir/edited.txt":  statusModified,
+		"dir/missing.txt": statusMissing,
+		"orphan.txt":      statusUntracked,
+	}
+
+	for _, st := range collectStatus(cfg, state) {
+		if st.Code != want[st.Path] {
+			t.Errorf("%s: code = %q, want %q", st.Path, st.Code, want[st.Path])
+		}
+	}
+}
+
+func TestRefOverrideWarning(t *testing.T) {
+	cfg := &config.Config{Upstream: config.UpstreamConfig{Ref: "main"}}
+
+	tests := []struct {
+		name     string
+		override string
+		wantWarn bool
+	}{
+		{name: "no override", override: ""},
+		{name: "override matches config", override: "main"},
+		{name: "off configured ref", override: "feature/x", wantWarn: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &config.State{RefOverride: tt.override}
+			got := refOverrideWarning(cfg, state)
+			if (got != "") != tt.wantWarn {
+				t.Errorf("refOverrideWarning() = %q, wantWarn %v", got, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestUpstreamDirWarning(t *testing.T) {
+	managed := []config.ManagedFile{{Path: "overlay/a.txt"}}
+
+	tests := []struct {
+		name     string
+		cfgDir   string
+		stateDir string
+		managed  []config.ManagedFile
+		wantWarn bool
+	}{
+		{name: "default location", managed: managed},
+		{name: "unchanged external", cfgDir: "/cache/a", stateDir: "/cache/a", managed: managed},
+		{name: "moved external", cfgDir: "/cache/b", stateDir: "/cache/a", managed: managed, wantWarn: true},
+		{name: "moved out of the repository", cfgDir: "/cache/a", managed: managed, wantWarn: true},
+		{name: "nothing linked yet", cfgDir: "/cache/a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{UpstreamDir: tt.cfgDir}
+			state := &config.State{UpstreamDir: tt.stateDir, ManagedFiles: tt.managed}
+			got := upstreamDirWarning(cfg, state)
+			if (got != "") != tt.wantWarn {
+				t.Errorf("upstreamDirWarning() = %q, wantWarn %v", got, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestCommittedManagedFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := runGitCommand(".", []string{"init", "-b", "main"}); err != nil {
+		t.Fatalf("Failed to init repository: %v", err)
+	}
+	for _, name := range []string{"a.txt", "lib/x.txt", "cache/notes.txt", "pinned.txt", "local.txt"} {
+		path := filepath.Join("overlay", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	state := &config.State{}
+	state.AddManagedFile("a.txt", "copy", "a.txt")
+	state.AddManagedFile("lib", "symlink", "lib")
+	state.AddManagedFile("cache", dirLinkMode, "")
+	state.AddManagedFile("pinned.txt", "copy", "pinned.txt")
+	state.SetPinned("pinned.txt", true)
+
+	if paths, err := committedManagedFiles(state); err != nil || len(paths) != 0 {
+		t.Fatalf("committedManagedFiles() before commit = %v, %v, want none", paths, err)
+	}
+	if err := runGitCommand(".", []string{"add", "-f", "overlay"}); err != nil {
+		t.Fatalf("Failed to add overlay: %v", err)
+	}
+
+	paths, err := committedManagedFiles(state)
+	if err != nil {
+		t.Fatalf("committedManagedFiles() error = %v", err)
+	}
+	if want := []string{"overlay/a.txt", "overlay/lib/x.txt"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("committedManagedFiles() = %v, want %v", paths, want)
+	}
+	if warning := committedWarning(paths); !strings.Contains(warning, "overlay/lib/x.txt") {
+		t.Errorf("committedWarning() = %q", warning)
+	}
+
+	if err := untrackFiles(paths); err != nil {
+		t.Fatalf("untrackFiles() error = %v", err)
+	}
+	if paths, err := committedManagedFiles(state); err != nil || len(paths) != 0 {
+		t.Errorf("committedManagedFiles() after fix = %v, %v, want none", paths, err)
+	}
+	if _, err := os.Stat("overlay/a.txt"); err != nil {
+		t.Errorf("untrackFiles() removed the file: %v", err)
+	}
+}
+
+func TestStatusWithSums(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	for _, dir := range []string{".upstream", "overlay"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	for _, name := range []string{"copy.txt", "edited.txt", "skipped.txt"} {
+		if err := os.WriteFile(".upstream/"+name, []byte("upstream"), 0644); err != nil {
+			t.Fatalf("Failed to create source: %v", err)
+		}
+		if err := copyFile(".upstream/"+name, "overlay/"+name); err != nil {
+			t.Fatalf("Failed to copy: %v", err)
+		}
+	}
+
+	cfg := &config.Config{
+		Symlinks:  []config.SymlinkSpec{{String: "copy.txt"}, {String: "edited.txt"}, {String: "skipped.txt"}},
+		Checksums: true,
+	}
+	state := &config.State{}
+	state.AddManagedFile("copy.txt", "copy", "copy.txt")
+	state.AddManagedFile("edited.txt", "copy", "edited.txt")
+	state.AddManagedFile("skipped.txt", "copy", "skipped.txt")
+
+	// skipped.txt wasn't part of the run, so it gets no sum
+	if err := recordSums(cfg, state, []string{"overlay/copy.txt", "overlay/edited.txt"}); err != nil {
+		t.Fatalf("recordSums() error = %v", err)
+	}
+	sums, err := config.LoadSums()
+	if err != nil {
+		t.Fatalf("LoadSums() error = %v", err)
+	}
+	if len(sums) != 2 || sums["skipped.txt"] != "" {
+		t.Errorf("sums = %v, want copy.txt and edited.txt", sums)
+	}
+
+	if err := os.RemoveAll(".upstream"); err != nil {
+		t.Fatalf("Failed to remove upstream: %v", err)
+	}
+	if err := os.WriteFile("overlay/edited.txt", []byte("local edit"), 0644); err != nil {
+		t.Fatalf("Failed to edit file: %v", err)
+	}
+
+	want := map[string]string{
+		"copy.txt":    statusOK,
+		"edited.txt":  statusModified,
+		"skipped.txt": statusBroken,
+	}
+	for _, st := range collectStatus(cfg, state) {
+		if st.Code != want[st.Path] {
+			t.Errorf("%s: code = %q, want %q", st.Path, st.Code, want[st.Path])
+		}
+	}
+}
+
+func TestStatusPorcelain(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll("overlay", 0755); err != nil {
+		t.Fatalf("Failed to create overlay: %v", err)
+	}
+	if err := os.WriteFile("overlay/pinned.txt", []byte("local"), 0644); err != nil {
+		t.Fatalf("Failed to create pinned file: %v", err)
+	}
+
+	cfg := &config.Config{Symlinks: []config.SymlinkSpec{{String: "missing.txt"}, {String: "pinned.txt"}}}
+	state := &config.State{}
+	state.AddManagedFile("missing.txt", "symlink", "missing.txt")
+	state.AddManagedFile("pinned.txt", "copy", "pinned.txt")
+	state.SetPinned("pinned.txt", true)
+
+	var buf bytes.Buffer
+	writePorcelain(&buf, collectStatus(cfg, state))
+	if want := " D missing.txt\n P pinned.txt\n"; buf.String() != want {
+		t.Errorf("porcelain output = %q, want %q", buf.String(), want)
+	}
+}
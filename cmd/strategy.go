@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// LinkStrategy materializes a single upstream file at a path in overlay/
+type LinkStrategy interface {
+	Link(src, dst string) error
+}
+
+// LinkStrategyFunc adapts a function to the LinkStrategy interface
+type LinkStrategyFunc func(src, dst string) error
+
+// Link calls f(src, dst)
+func (f LinkStrategyFunc) Link(src, dst string) error {
+	return f(src, dst)
+}
+
+// linkPluginPrefix is the prefix of external link strategy binaries on PATH
+const linkPluginPrefix = "git-overlay-link-"
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = map[string]LinkStrategy{
+		"symlink":  LinkStrategyFunc(symlinkFile),
+		"reflink":  LinkStrategyFunc(reflinkFile),
+		"hardlink": LinkStrategyFunc(os.Link),
+		"copy":     LinkStrategyFunc(copyFile),
+	}
+)
+
+// RegisterLinkStrategy makes a link strategy available as a link mode
+func RegisterLinkStrategy(name string, strategy LinkStrategy) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	strategies[name] = strategy
+}
+
+// linkStrategyFor returns the strategy for a link mode, falling back to an
+// external git-overlay-link-<mode> binary on PATH
+func linkStrategyFor(mode string) (LinkStrategy, error) {
+	strategiesMu.RLock()
+	strategy, ok := strategies[mode]
+	strategiesMu.RUnlock()
+	if ok {
+		return strategy, nil
+	}
+
+	path, err := exec.LookPath(linkPluginPrefix + mode)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported link mode: %s", mode)
+	}
+	return execLinkStrategy(path), nil
+}
+
+// symlinkFile creates a symlink at dst pointing at src relative to dst's directory
+func symlinkFile(src, dst string) error {
+	relPath, err := filepath.Rel(filepath.Dir(dst), src)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(relPath, dst)
+}
+
+// execLinkStrategy runs "<binary> <src> <dst>", which must create dst
+type execLinkStrategy string
+
+func (e execLinkStrategy) Link(src, dst string) error {
+	cmd := exec.Command(string(e), src, dst)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", filepath.Base(string(e)), err)
+	}
+	if _, err := os.Lstat(dst); err != nil {
+		return fmt.Errorf("%s did not create %s", filepath.Base(string(e)), dst)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestLinkStrategies(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+	if err := os.WriteFile(".upstream/file.txt", []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create upstream file: %v", err)
+	}
+
+	RegisterLinkStrategy("upper", LinkStrategyFunc(func(src, dst string) error {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dst, []byte(strings.ToUpper(string(data))), 0644)
+	}))
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\necho stub > \"$2\"\n"
+	if err := os.WriteFile(filepath.Join(binDir, linkPluginPrefix+"stub"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write link plugin: %v", err)
+	}
+	t.Setenv("PATH", binDir)
+
+	tests := []struct {
+		mode    string
+		want    string
+		wantErr bool
+	}{
+		{mode: "upper", want: "CONTENT"},
+		{mode: "stub", want: "stub\n"},
+		{mode: "missing", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			if tt.mode == "stub" && runtime.GOOS == "windows" {
+				t.Skip("shell script plugins are not supported on windows")
+			}
+			os.RemoveAll("overlay")
+			os.Remove(config.StateFile)
+
+			cmd := &cobra.Command{}
+			cmd.Flags().String("link-mode", tt.mode, "")
+			cmd.Flags().Bool("force", true, "")
+
+			cfg := &config.Config{
+				Symlinks: []config.SymlinkSpec{{String: "file.txt"}},
+			}
+			err := CreateLinks(cmd, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateLinks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got, err := os.ReadFile("overlay/file.txt")
+			if err != nil {
+				t.Fatalf("Failed to read overlay file: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("overlay/file.txt = %q, want %q", got, tt.want)
+			}
+
+			state, err := config.LoadState()
+			if err != nil {
+				t.Fatalf("Failed to load state: %v", err)
+			}
+			if len(state.ManagedFiles) != 1 || state.ManagedFiles[0].LinkMode != tt.mode {
+				t.Errorf("state = %+v, want one file with link mode %s", state.ManagedFiles, tt.mode)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+// hasSum reports whether files of a link mode hold their own copy of the
+// upstream content, which a checksum can vouch for. Symlinks and files
+// git-overlay writes itself are left out.
+func hasSum(linkMode string) bool {
+	switch linkMode {
+	case "symlink", preservedLinkMode, dirLinkMode, keepLinkMode, generatedLinkMode, metaLinkMode:
+		return false
+	}
+	return true
+}
+
+// recordSums updates the sums file with checksums enabled. Only the targets
+// materialized or found matching in this run, listed in createdLinks, are
+// hashed; other managed files keep their earlier sum, so a local edit outside
+// a partial run is never recorded as upstream content.
+func recordSums(cfg *config.Config, state *config.State, createdLinks []string) error {
+	if !cfg.Checksums {
+		return nil
+	}
+	earlier, err := config.LoadSums()
+	if err != nil {
+		// Rebuilt below from the files of this run
+		earlier = config.Sums{}
+	}
+
+	linked := make(map[string]bool, len(createdLinks))
+	for _, dst := range createdLinks {
+		linked[strings.TrimPrefix(filepath.ToSlash(dst), "overlay/")] = true
+	}
+
+	sums := make(config.Sums)
+	for _, mf := range state.ManagedFiles {
+		if mf.Pinned || !hasSum(mf.LinkMode) {
+			continue
+		}
+		if !linked[mf.Path] {
+			if sum, ok := earlier[mf.Path]; ok {
+				sums[mf.Path] = sum
+			}
+			continue
+		}
+		dst := filepath.Join("overlay", mf.Path)
+		if info, err := os.Lstat(dst); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		sum, err := fileSHA256(dst)
+		if err != nil {
+			return err
+		}
+		sums[mf.Path] = sum
+	}
+	return sums.Save()
+}
+
+// sumStatus checks a copy against its recorded sum, for when the upstream
+// checkout isn't there to compare with
+func sumStatus(mf config.ManagedFile, sums config.Sums) (string, bool) {
+	want, ok := sums[mf.Path]
+	if !ok || !hasSum(mf.LinkMode) {
+		return "", false
+	}
+	dst := filepath.Join("overlay", mf.Path)
+	info, err := os.Lstat(dst)
+	if err != nil {
+		return statusMissing, true
+	}
+	if !info.Mode().IsRegular() {
+		return statusModified, true
+	}
+	if got, err := fileSHA256(dst); err != nil || got != want {
+		return statusModified, true
+	}
+	return statusOK, true
+}
+
+// upstreamCheckedOut reports whether the checkout of an upstream has any
+// content, unlike the empty directory of a submodule that was never updated
+func upstreamCheckedOut(name string) bool {
+	entries, err := os.ReadDir(config.UpstreamDir(name))
+	return err == nil && len(entries) > 0
+}
@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces credentials in support bundles
+const redacted = "REDACTED"
+
+var (
+	// secretKeyPattern matches config keys whose values are credentials
+	secretKeyPattern = regexp.MustCompile(`(?i)(token|secret|passw(or)?d|credential|(^|_)(auth|key)(_|s?$))`)
+	// urlUserinfoPattern matches the user and password part of a URL
+	urlUserinfoPattern = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/@\s]+@`)
+	// secretQueryPattern matches credentials passed in a URL query
+	secretQueryPattern = regexp.MustCompile(`(?i)([?&][^=&\s]*(token|secret|passw(or)?d|key|auth|signature)[^=&\s]*=)[^&#\s]+`)
+)
+
+// redactText masks credentials embedded in URLs
+func redactText(s string) string {
+	s = urlUserinfoPattern.ReplaceAllString(s, "${1}"+redacted+"@")
+	return secretQueryPattern.ReplaceAllString(s, "${1}"+redacted)
+}
+
+// redactYAML masks the values of credential-like keys and the credentials in
+// URLs of a YAML document, keeping its comments and layout
+func redactYAML(data []byte) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	redactNode(&root)
+	return yaml.Marshal(&root)
+}
+
+// redactNode masks secrets below n in place
+func redactNode(n *yaml.Node) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if secretKeyPattern.MatchString(key.Value) {
+				*value = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: redacted}
+				continue
+			}
+			redactNode(value)
+		}
+	case yaml.ScalarNode:
+		n.Value = redactText(n.Value)
+	default:
+		for _, child := range n.Content {
+			redactNode(child)
+		}
+	}
+}
+
+// supportReport describes the installation and project for a bug report.
+// Failures are written into the report, as a bundle is most needed when
+// things are broken.
+func supportReport(cmd *cobra.Command, cfg *config.Config, cfgErr error) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "git-overlay: %s\n", version)
+	fmt.Fprintf(&b, "go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if out, err := exec.Command("git", "--version").Output(); err == nil {
+		fmt.Fprintf(&b, "git: %s\n", strings.TrimSpace(strings.TrimPrefix(string(out), "git version ")))
+	} else {
+		fmt.Fprintf(&b, "git: unavailable (%v)\n", err)
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		fmt.Fprintf(&b, "project: %s\n", cwd)
+	}
+	fmt.Fprintf(&b, "config: %s\n", redactText(flagString(cmd, "config")))
+	if cfgErr != nil {
+		fmt.Fprintf(&b, "config error: %s\n", redactText(cfgErr.Error()))
+	}
+
+	b.WriteString("\nupstreams:\n")
+	if cfg != nil {
+		upstreams := []config.NamedUpstream{{UpstreamConfig: cfg.Upstream}}
+		upstreams = append(upstreams, cfg.Upstreams...)
+		for _, u := range upstreams {
+			dir := config.UpstreamDir(u.Name)
+			status := "not checked out"
+			if _, err := os.Stat(dir); err == nil {
+				status = "checked out"
+				if repo, err := gogit.PlainOpen(dir); err == nil {
+					if head, err := repo.Head(); err == nil {
+						status = "at " + head.Hash().String()
+					}
+				}
+			}
+			fmt.Fprintf(&b, "  %s: %s %s, %s\n", dir, upstreamLocation(u.UpstreamConfig), u.Ref, status)
+		}
+		if cfg.UpstreamDir != "" {
+			fmt.Fprintf(&b, "  upstream_dir: %s\n", cfg.UpstreamDir)
+		}
+	}
+
+	b.WriteString("\nlink modes:\n")
+	for _, mode := range linkModes {
+		if err := probeLinkMode(mode); err != nil {
+			fmt.Fprintf(&b, "  %-9s unavailable (%v)\n", mode, err)
+		} else {
+			fmt.Fprintf(&b, "  %-9s ok\n", mode)
+		}
+	}
+	if free, ok := freeSpace("."); ok {
+		fmt.Fprintf(&b, "\nfree space: %s\n", formatBytes(free))
+	}
+	return redactText(b.String())
+}
+
+// addBytesToTar writes data to the archive as a regular file called name
+func addBytesToTar(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// supportFiles collects the files of a support bundle by name. Config files
+// that can't be parsed are left out, as they couldn't be redacted.
+func supportFiles(cmd *cobra.Command) map[string][]byte {
+	files := make(map[string][]byte)
+	var notes []string
+
+	cfg, cfgErr := loadConfig(cmd)
+
+	configPath := flagString(cmd, "config")
+	if !isRemoteConfig(configPath) {
+		if data, err := os.ReadFile(configPath); err == nil {
+			if clean, err := redactYAML(data); err == nil {
+				files["config.yml"] = clean
+			} else {
+				notes = append(notes, fmt.Sprintf("config.yml left out: %v", err))
+			}
+		}
+	}
+	if cfg != nil {
+		if data, err := yaml.Marshal(cfg); err == nil {
+			if clean, err := redactYAML(data); err == nil {
+				files["config.resolved.yml"] = clean
+			}
+		}
+	}
+
+	if path, err := config.SettingsPath(); err == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			if clean, err := redactYAML(data); err == nil {
+				files["settings.yml"] = clean
+			} else {
+				notes = append(notes, fmt.Sprintf("settings.yml left out: %v", err))
+			}
+		}
+	}
+
+	location := ""
+	if cfg != nil {
+		location = cfg.StateLocation
+	}
+	if path, err := config.StatePath(location); err == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			files["state.json"] = data
+		}
+	}
+	if data, err := os.ReadFile(".gitmodules"); err == nil {
+		files["gitmodules"] = []byte(redactText(string(data)))
+	}
+
+	report := supportReport(cmd, cfg, cfgErr)
+	if len(notes) > 0 {
+		report += "\nnotes:\n  " + strings.Join(notes, "\n  ") + "\n"
+	}
+	files["report.txt"] = []byte(report)
+	return files
+}
+
+// bundleNames returns the names of files in order
+func bundleNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeSupportBundle writes files into a gzipped tarball at path, below a
+// git-overlay-support directory
+func writeSupportBundle(path string, files map[string][]byte) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range bundleNames(files) {
+		if err := addBytesToTar(tw, "git-overlay-support/"+name, files[name]); err != nil {
+			return fmt.Errorf("failed to archive %s: %w", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finish support bundle: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to finish support bundle: %w", err)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0600)
+}
+
+var supportBundleCmd = &cobra.Command{
+	Use:   "support-bundle [file]",
+	Short: "Collect what a bug report needs into a tarball",
+	Long: `Collect the config, the user settings, the state file, .gitmodules, the
+git-overlay, Go and git versions, the upstream checkouts and the link modes
+this filesystem supports into a tarball to attach to a bug report. Nothing is
+sent anywhere.
+
+Values of keys that look like credentials (token, secret, password, auth,
+key) and credentials in URLs are replaced with REDACTED. Review the bundle
+before sharing it all the same.
+
+The bundle is written to git-overlay-support-<time>.tar.gz unless a file is
+given.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := "git-overlay-support-" + time.Now().Format("20060102-150405") + ".tar.gz"
+		if len(args) == 1 {
+			path = args[0]
+		}
+		path = invocationPath(path)
+
+		files := supportFiles(cmd)
+		if err := writeSupportBundle(path, files); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote support bundle to %s (%s)\n", path, strings.Join(bundleNames(files), ", "))
+		fmt.Println("Review it before attaching it to a bug report")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(supportBundleCmd)
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// loadSymlinksFile reads the symlinks_file of the config at location, if it
+// names one, and appends its paths to the config's symlinks. The file is
+// resolved like extends, relative to the config that names it.
+func loadSymlinksFile(location string, values map[string]interface{}, pinned bool) error {
+	file, ok := values["symlinks_file"]
+	if !ok {
+		return nil
+	}
+	delete(values, "symlinks_file")
+
+	name, ok := file.(string)
+	if !ok || name == "" {
+		return fmt.Errorf("symlinks_file in %s must be a path or URL", location)
+	}
+	resolved, err := resolveExtends(location, name)
+	if err != nil {
+		return err
+	}
+	if err := checkPinnedInclude(pinned, resolved); err != nil {
+		return err
+	}
+	data, err := readConfigSource(resolved)
+	if err != nil {
+		return fmt.Errorf("failed to read symlinks file %s: %w", resolved, err)
+	}
+	paths, err := parseSymlinksFile(resolved, data)
+	if err != nil {
+		return err
+	}
+
+	var specs []interface{}
+	if existing, ok := values["symlinks"]; ok && existing != nil {
+		if specs, ok = existing.([]interface{}); !ok {
+			return fmt.Errorf("symlinks in %s must be a list", location)
+		}
+	}
+	for _, p := range paths {
+		specs = append(specs, p)
+	}
+	values["symlinks"] = specs
+	return nil
+}
+
+// parseSymlinksFile returns the paths and globs listed in a symlinks file,
+// one per line. Blank lines and comments starting with # are skipped.
+func parseSymlinksFile(name string, data []byte) ([]string, error) {
+	var paths []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i == 0 || (i > 0 && (line[i-1] == ' ' || line[i-1] == '\t')) {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if filepath.IsAbs(line) || line == ".." || strings.HasPrefix(line, "../") {
+			return nil, fmt.Errorf("%s:%d: %s is not a path inside the upstream", name, n, line)
+		}
+		paths = append(paths, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read symlinks file %s: %w", name, err)
+	}
+	return paths, nil
+}
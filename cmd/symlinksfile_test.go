@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestParseSymlinksFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "paths and globs",
+			data: "src/main.go\nconfigs/*.yml\n",
+			want: []string{"src/main.go", "configs/*.yml"},
+		},
+		{
+			name: "comments and blank lines",
+			data: "# generated by tool\n\n  docs  \nsrc # the sources\nissue#12.md\n",
+			want: []string{"docs", "src", "issue#12.md"},
+		},
+		{
+			name:    "absolute path",
+			data:    "src\n/etc/passwd\n",
+			wantErr: true,
+		},
+		{
+			name:    "escaping path",
+			data:    "../secrets\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSymlinksFile("paths.txt", []byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSymlinksFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSymlinksFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigSymlinksFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	// The list is resolved relative to the config that names it
+	if err := os.MkdirAll("common", 0755); err != nil {
+		t.Fatalf("Failed to create common directory: %v", err)
+	}
+	base := `upstream:
+  url: "https://github.com/acme/base.git"
+  ref: "main"
+symlinks_file: base-paths.txt
+`
+	if err := os.WriteFile(filepath.Join("common", "base.yml"), []byte(base), 0644); err != nil {
+		t.Fatalf("Failed to write base config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join("common", "base-paths.txt"), []byte("# shared\nMakefile\n"), 0644); err != nil {
+		t.Fatalf("Failed to write symlinks file: %v", err)
+	}
+
+	local := `extends: common/base.yml
+symlinks:
+  - docs
+symlinks_file: paths.txt
+`
+	if err := os.WriteFile(".git-overlay.yml", []byte(local), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if err := os.WriteFile("paths.txt", []byte("src/*.go\nconfigs\n"), 0644); err != nil {
+		t.Fatalf("Failed to write symlinks file: %v", err)
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("config", ".git-overlay.yml", "")
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	var specs []string
+	for _, link := range cfg.Symlinks {
+		specs = append(specs, link.String)
+	}
+	if want := []string{"Makefile", "docs", "src/*.go", "configs"}; !reflect.DeepEqual(specs, want) {
+		t.Errorf("symlinks = %v, want %v", specs, want)
+	}
+
+	if err := os.Remove("paths.txt"); err != nil {
+		t.Fatalf("Failed to remove symlinks file: %v", err)
+	}
+	if _, err := loadConfig(cmd); err == nil {
+		t.Error("loadConfig() with a missing symlinks file succeeded")
+	}
+}
@@ -3,43 +3,131 @@ package cmd
 import (
 	"fmt"
 
-	"github.com/rjocoleman/git-overlay/internal/git"
+	"github.com/rjocoleman/git-overlay/internal/config"
 	"github.com/spf13/cobra"
 )
 
 var syncCmd = &cobra.Command{
-	Use:   "sync",
-	Short: "Update upstream code and rebuild links",
+	Use:         "sync",
+	Short:       "Update upstream code and rebuild links",
+	Annotations: map[string]string{lockAnnotation: ""},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := loadConfig(cmd)
 		if err != nil {
 			return fmt.Errorf("failed to load config: %w", err)
 		}
 
-		// Open repository and sync upstream
-		repo, err := git.InitMainRepository()
+		// Work not yet committed could be overwritten halfway through
+		if err := checkDirty(cmd, cfg); err != nil {
+			return err
+		}
+
+		// Limit the bandwidth and time fetches may take
+		if err := applyTransportOptions(cmd); err != nil {
+			return err
+		}
+
+		// An interrupt finishes the checkout or link in progress and records what was done
+		defer trapInterrupts()()
+
+		backup, err := cmd.Flags().GetBool("backup")
+		if err != nil {
+			return err
+		}
+
+		// A one-off ref replaces the configured one for this sync only
+		refOverride, err := cmd.Flags().GetString("ref")
+		if err != nil {
+			return err
+		}
+		if refOverride == cfg.Upstream.Ref {
+			refOverride = ""
+		}
+		if refOverride != "" {
+			fmt.Printf("Syncing %s instead of configured ref %s\n", refOverride, cfg.Upstream.Ref)
+			cfg.Upstream.Ref = refOverride
+		}
+
+		// A ref outside the policy is refused before the backup is taken
+		if err := checkAllowedRefs(cfg); err != nil {
+			return err
+		}
+
+		// Snapshot the overlay before anything is relinked
+		if backup || cfg.Backup.Enabled {
+			statePath, err := config.StatePath(cfg.StateLocation)
+			if err != nil {
+				return err
+			}
+			path, err := createBackup(cfg.Backup.Path(), statePath)
+			if err != nil {
+				return fmt.Errorf("failed to back up overlay: %w", err)
+			}
+			fmt.Printf("Backed up overlay to %s\n", path)
+		}
+
+		jobs, err := cmd.Flags().GetInt("jobs")
 		if err != nil {
-			return fmt.Errorf("failed to open repository: %w", err)
+			return err
+		}
+		if settings := userSettings(); !cmd.Flags().Changed("jobs") && settings.Jobs > 0 {
+			jobs = settings.Jobs
 		}
 
-		if err := repo.SyncUpstream(cfg.Upstream.Ref); err != nil {
-			return fmt.Errorf("failed to sync upstream: %w", err)
+		acceptRewrite, err := cmd.Flags().GetBool("accept-rewrite")
+		if err != nil {
+			return err
 		}
 
-		// Update gitignore and rebuild links
-		if err := updateGitignore(cfg, nil); err != nil {
-			return fmt.Errorf("failed to update .gitignore: %w", err)
+		// Bring the upstreams to their configured refs
+		if err := syncAllUpstreams(cfg, syncOptions{acceptRewrite: acceptRewrite, jobs: jobs}); err != nil {
+			return err
+		}
+		if err := interrupted(); err != nil {
+			return err
 		}
 
+		// Rebuild links, updating gitignore and state once at the end
 		if err := CreateLinks(cmd, cfg); err != nil {
 			return fmt.Errorf("failed to rebuild links: %w", err)
 		}
 
+		if err := recordRefOverride(cfg, refOverride); err != nil {
+			return err
+		}
+
 		fmt.Println("Git overlay repository synchronized successfully")
-		return nil
+		return commitRun(cmd, cfg, "sync")
 	},
 }
 
+// recordRefOverride notes in the state which ref sync --ref applied, or
+// clears it after a sync to the configured ref
+func recordRefOverride(cfg *config.Config, ref string) error {
+	state, err := loadState(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	state.RefOverride = ref
+	if err := state.SaveState(); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	return nil
+}
+
 func init() {
+	syncCmd.Flags().String("ref", "", "Sync this ref once instead of the configured one, without editing the config")
+	syncCmd.Flags().IntP("jobs", "j", defaultSyncJobs, "Number of upstreams to sync at once")
+	syncCmd.Flags().Bool("backup", false, "Snapshot overlay/ before syncing (restore with 'restore --last')")
+	syncCmd.Flags().Bool("accept-rewrite", false, "Follow an upstream branch that was force-pushed, dropping the synced commit's history")
+	syncCmd.Flags().Bool("commit", false, "Commit the changed config, submodule, gitignore, state and overlay files")
+	syncCmd.Flags().Bool("assume-clean", false, "Skip existing-file, conflict and state checks when overlay/ holds no managed files yet, as in CI")
+	syncCmd.Flags().StringArray("only", nil, "Only link targets under this overlay path (repeatable)")
+	syncCmd.Flags().Bool("ignore-case", false, "Match --only paths ignoring case")
+	syncCmd.Flags().StringArray("component", nil, "Only link the specs of this component (repeatable)")
+	addTransportFlags(syncCmd)
+	syncCmd.Flags().String("chown", "", "Give copy-mode files this numeric uid:gid when running as root")
+	syncCmd.Flags().Bool("allow-dirty", false, "Run even with uncommitted changes under overlay/ or to the bookkeeping files")
+	syncCmd.Flags().Bool("keep-going", false, "Link everything that can be linked and report all failures at the end")
 	rootCmd.AddCommand(syncCmd)
 }
@@ -0,0 +1,424 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+// syncPlanVersion is bumped when the plan document changes incompatibly
+const syncPlanVersion = 2
+
+// syncPlan is everything sync would do, in order, worked out without doing any of it
+type syncPlan struct {
+	Version   int            `json:"version"`
+	Options   planOptions    `json:"options"`
+	Upstreams []upstreamStep `json:"upstreams"`
+	Links     []linkStep     `json:"links"`
+	Deletes   []deleteStep   `json:"deletes"`
+	Gitignore bool           `json:"gitignore"` // Whether the managed block of .gitignore changes
+
+	// Fingerprint hashes the config, the state and everything on disk the
+	// plan depends on, so apply can tell whether any of it changed since
+	Fingerprint string `json:"fingerprint"`
+}
+
+// planOptions are the flags a plan was made with, which apply runs it with
+type planOptions struct {
+	LinkMode   string   `json:"link_mode"`
+	Force      bool     `json:"force,omitempty"`
+	Only       []string `json:"only,omitempty"`
+	IgnoreCase bool     `json:"ignore_case,omitempty"`
+	Components []string `json:"components,omitempty"`
+}
+
+// upstreamStep is an upstream brought to its configured ref
+type upstreamStep struct {
+	Name     string   `json:"name,omitempty"` // Empty for the main upstream
+	Dir      string   `json:"dir"`
+	Type     string   `json:"type"`
+	Location string   `json:"location"`
+	Mirrors  []string `json:"mirrors,omitempty"`
+	Ref      string   `json:"ref"`
+	Commit   string   `json:"commit,omitempty"` // Commit the links are planned from, which apply checks out, for git upstreams
+}
+
+// Actions of a planned link
+const (
+	linkCreate    = "create"    // Nothing at the target yet
+	linkReplace   = "replace"   // Whatever is at the target is replaced
+	linkKeep      = "keep"      // A copy already matching upstream is left in place
+	linkProtected = "protected" // The target matches clean.protect and is skipped
+	linkConflict  = "conflict"  // The target exists and the run would stop without --force
+)
+
+// linkStep is a file materialized in overlay/
+type linkStep struct {
+	Action   string `json:"action"`
+	Target   string `json:"target"`
+	Source   string `json:"source"`
+	LinkMode string `json:"link_mode"`
+}
+
+// deleteStep is a managed file whose upstream source is gone
+type deleteStep struct {
+	Target string `json:"target"`
+	Policy string `json:"policy"` // on_upstream_delete of its spec
+
+	// Protected is set when the target matches clean.protect, which a
+	// remove policy leaves in place
+	Protected bool `json:"protected,omitempty"`
+}
+
+// planUpstreams lists the upstreams sync fetches, in the order it starts them
+func planUpstreams(cfg *config.Config) []upstreamStep {
+	steps := []upstreamStep{planUpstream("", cfg.Upstream)}
+	for _, named := range cfg.Upstreams {
+		steps = append(steps, planUpstream(named.Name, named.UpstreamConfig))
+	}
+	return steps
+}
+
+// planUpstream describes how one upstream is brought to its ref
+func planUpstream(name string, u config.UpstreamConfig) upstreamStep {
+	step := upstreamStep{
+		Name:     name,
+		Dir:      config.UpstreamDir(name),
+		Type:     u.Type,
+		Location: upstreamLocation(u),
+		Mirrors:  u.Mirrors,
+		Ref:      u.Ref,
+	}
+	if step.Type == "" {
+		step.Type = config.UpstreamTypeGit
+	}
+	if u.IsGit() {
+		if repo, err := gogit.PlainOpen(step.Dir); err == nil {
+			if head, err := repo.Head(); err == nil {
+				step.Commit = head.Hash().String()
+			}
+		}
+	}
+	return step
+}
+
+// planLinkAction works out what createLink would do at a planned target
+func planLinkAction(p plannedLink, linkMode string, opts linkOptions) string {
+	if _, err := os.Stat(p.dst); err != nil {
+		return linkCreate
+	}
+	if linkMode == "copy" || strings.HasSuffix(p.dst, ".gitignore") {
+		if info, err := os.Lstat(p.dst); err == nil && info.Mode().IsRegular() {
+			relSrc, _ := filepath.Rel(config.UpstreamDir(p.upstream), p.src)
+			if entry, ok := indexEntry(opts.indexes, p.upstream, relSrc); ok {
+				if same, _ := entry.Matches(p.dst); same {
+					return linkKeep
+				}
+			}
+		}
+	}
+	if matchAnyGlob(opts.protect, p.dst) {
+		return linkProtected
+	}
+	if !opts.force {
+		return linkConflict
+	}
+	return linkReplace
+}
+
+// buildSyncPlan works out what sync would do from the config, the state and
+// the upstream checkouts as they are on disk. The links are those of the
+// commits checked out now, since the plan never fetches.
+func buildSyncPlan(cmd *cobra.Command, cfg *config.Config) (*syncPlan, error) {
+	opts, err := newLinkOptions(cmd, cfg)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadState(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+
+	specs, links, _, err := planRun(cmd, cfg, state, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &syncPlan{
+		Version: syncPlanVersion,
+		Options: planOptions{
+			LinkMode:   opts.linkMode,
+			Force:      opts.force,
+			IgnoreCase: flagBool(cmd, "ignore-case"),
+		},
+		Upstreams: planUpstreams(cfg),
+		Links:     []linkStep{},
+		Deletes:   []deleteStep{},
+	}
+
+	var ignores []string
+	for _, p := range links {
+		linkMode := opts.linkMode
+		switch {
+		case p.preserve:
+			linkMode = preservedLinkMode
+		case strings.HasSuffix(p.dst, ".gitignore"):
+			linkMode = "copy"
+		case opts.auto != nil:
+			linkMode = opts.auto.mode(p.src)
+		}
+		action := planLinkAction(p, linkMode, opts)
+		plan.Links = append(plan.Links, linkStep{
+			Action:   action,
+			Target:   filepath.ToSlash(p.dst),
+			Source:   filepath.ToSlash(p.src),
+			LinkMode: linkMode,
+		})
+		if action != linkProtected {
+			ignores = append(ignores, p.dst)
+		}
+	}
+
+	removed := make(map[string]bool)
+	if !opts.assumeClean {
+		deletes, err := upstreamDeletes(specs, links, state, opts.only)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range deletes {
+			target := "overlay/" + d.file.Path
+			protected := d.policy == OnUpstreamDeleteRemove && matchAnyGlob(opts.protect, target)
+			plan.Deletes = append(plan.Deletes, deleteStep{
+				Target:    target,
+				Policy:    d.policy,
+				Protected: protected,
+			})
+			if d.policy != OnUpstreamDeleteWarn && !protected {
+				removed[d.file.Path] = true
+			}
+		}
+	}
+
+	// A full run ignores what it links along with the entries of dirs:,
+	// generate: and meta_file; a limited one keeps the rest of the state
+	for _, mf := range state.ManagedFiles {
+		if mf.Pinned || removed[mf.Path] {
+			continue
+		}
+		if opts.only != nil || mf.Source == "" {
+			ignores = append(ignores, "overlay/"+mf.Path)
+		}
+	}
+	existing, updated, err := renderGitignore(cfg, ignores)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gitignore: %w", err)
+	}
+	plan.Gitignore = existing == nil || string(existing) != string(updated)
+
+	if opts.only != nil {
+		plan.Options.Only, _ = cmd.Flags().GetStringArray("only")
+		plan.Options.Components, _ = cmd.Flags().GetStringArray("component")
+	}
+	plan.Fingerprint, err = planFingerprint(cfg, plan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fingerprint plan: %w", err)
+	}
+	return plan, nil
+}
+
+// planFingerprint hashes the resolved config, the state file, .gitignore,
+// the steps of the plan and what is at each of its sources and targets now
+func planFingerprint(cfg *config.Config, plan *syncPlan) (string, error) {
+	h := sha256.New()
+	write := func(label string, data []byte) {
+		fmt.Fprintf(h, "%s %d\n", label, len(data))
+		h.Write(data)
+	}
+
+	cfgData, err := yaml.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	write("config", cfgData)
+
+	statePath, err := config.StatePath(cfg.StateLocation)
+	if err != nil {
+		return "", err
+	}
+	for _, path := range []string{statePath, ".gitignore"} {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		write(path, data)
+	}
+
+	steps := *plan
+	steps.Fingerprint = ""
+	stepsData, err := json.Marshal(steps)
+	if err != nil {
+		return "", err
+	}
+	write("plan", stepsData)
+
+	targets := make([]string, 0, 2*len(plan.Links)+len(plan.Deletes))
+	for _, l := range plan.Links {
+		targets = append(targets, l.Source, l.Target)
+	}
+	for _, d := range plan.Deletes {
+		targets = append(targets, d.Target)
+	}
+	for _, target := range targets {
+		write(target, []byte(describeTarget(target)))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// describeTarget summarizes what is at a source or target for the
+// fingerprint: its content for a file, where it points for a symlink
+func describeTarget(path string) string {
+	info, err := os.Lstat(path)
+	switch {
+	case err != nil:
+		return "missing"
+	case info.Mode()&os.ModeSymlink != 0:
+		target, _ := os.Readlink(path)
+		return "symlink " + target
+	case info.IsDir():
+		return "dir"
+	case info.Mode().IsRegular():
+		sum, _ := fileSHA256(path)
+		return fmt.Sprintf("file %o %s", info.Mode().Perm(), sum)
+	}
+	return "other"
+}
+
+// countActions tallies the planned links by action
+func (p *syncPlan) countActions() map[string]int {
+	counts := make(map[string]int)
+	for _, l := range p.Links {
+		counts[l.Action]++
+	}
+	return counts
+}
+
+// writeText prints the plan as numbered steps for review
+func (p *syncPlan) writeText(w io.Writer, verbose bool) {
+	step := 0
+	next := func(format string, args ...any) {
+		step++
+		fmt.Fprintf(w, "%d. "+format+"\n", append([]any{step}, args...)...)
+	}
+
+	for _, u := range p.Upstreams {
+		current := ""
+		if u.Commit != "" {
+			current = fmt.Sprintf(" (now at %s)", u.Commit[:7])
+		}
+		if u.Type == config.UpstreamTypeGit {
+			next("Fetch %s into %s", u.Location, u.Dir)
+			for _, mirror := range u.Mirrors {
+				fmt.Fprintf(w, "   falling back to %s\n", mirror)
+			}
+			next("Check out %s in %s%s", u.Ref, u.Dir, current)
+		} else {
+			next("Download %s %s %s into %s", u.Type, u.Location, u.Ref, u.Dir)
+		}
+	}
+
+	counts := p.countActions()
+	for _, action := range []string{linkCreate, linkReplace, linkKeep, linkProtected, linkConflict} {
+		if counts[action] == 0 {
+			continue
+		}
+		switch action {
+		case linkCreate:
+			next("Create %d links", counts[action])
+		case linkReplace:
+			next("Replace %d existing targets", counts[action])
+		case linkKeep:
+			next("Keep %d copies already matching upstream", counts[action])
+		case linkProtected:
+			next("Skip %d protected targets", counts[action])
+		case linkConflict:
+			next("Stop at %d existing targets (rerun with --force to replace them)", counts[action])
+		}
+		if verbose || action == linkConflict {
+			for _, l := range p.Links {
+				if l.Action == action {
+					fmt.Fprintf(w, "   %s <- %s (%s)\n", l.Target, l.Source, l.LinkMode)
+				}
+			}
+		}
+	}
+
+	for _, d := range p.Deletes {
+		switch {
+		case d.Protected:
+			next("Skip protected %s, deleted upstream", d.Target)
+		case d.Policy == OnUpstreamDeleteRemove:
+			next("Remove %s, deleted upstream", d.Target)
+		case d.Policy == OnUpstreamDeleteKeep:
+			next("Pin %s, deleted upstream", d.Target)
+		default:
+			next("Leave %s, deleted upstream, as it is", d.Target)
+		}
+	}
+
+	if p.Gitignore {
+		next("Rewrite the managed block of .gitignore")
+	}
+	fmt.Fprintln(w, "Links are planned from the upstream commits checked out now")
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Print what sync would do without doing it",
+	Long: `Print the ordered operations sync would run: the fetch and checkout of each
+upstream, the links created, replaced or kept, files removed because they were
+deleted upstream, and whether .gitignore changes. Nothing is fetched or
+written, so links are planned from the upstream commits checked out now.
+
+With --json the plan is printed as a document that can be attached to a change
+review, and run later with 'git-overlay apply'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		plan, err := buildSyncPlan(cmd, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to plan sync: %w", err)
+		}
+
+		if flagBool(cmd, "json") {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(plan)
+		}
+		plan.writeText(os.Stdout, flagBool(cmd, "verbose"))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+	planCmd.Flags().Bool("json", false, "Print the plan as JSON")
+	planCmd.Flags().BoolP("verbose", "v", false, "List every planned link")
+	planCmd.Flags().StringArray("only", nil, "Only plan targets under this overlay path (repeatable)")
+	planCmd.Flags().Bool("ignore-case", false, "Match --only paths ignoring case")
+	planCmd.Flags().StringArray("component", nil, "Only plan the specs of this component (repeatable)")
+}
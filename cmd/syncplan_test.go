@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestBuildSyncPlan(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream/src", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+	for _, name := range []string{"new.txt", "existing.txt"} {
+		if err := os.WriteFile(".upstream/src/"+name, []byte("content"), 0644); err != nil {
+			t.Fatalf("Failed to create upstream file: %v", err)
+		}
+	}
+	if err := os.MkdirAll("overlay/src", 0755); err != nil {
+		t.Fatalf("Failed to create overlay directory: %v", err)
+	}
+	for _, name := range []string{"existing.txt", "gone.txt"} {
+		if err := os.WriteFile("overlay/src/"+name, []byte("local"), 0644); err != nil {
+			t.Fatalf("Failed to create overlay file: %v", err)
+		}
+	}
+
+	state := &config.State{}
+	state.AddManagedFile("src/gone.txt", "copy", "src/gone.txt")
+	if err := state.SaveState(); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	cfg := &config.Config{
+		Upstream: config.UpstreamConfig{URL: "https://example.com/upstream.git", Ref: "v2"},
+		Symlinks: []config.SymlinkSpec{{String: "src", OnUpstreamDelete: OnUpstreamDeleteRemove}},
+	}
+
+	tests := []struct {
+		name         string
+		force        bool
+		wantExisting string
+	}{
+		{name: "without force", force: false, wantExisting: linkConflict},
+		{name: "with force", force: true, wantExisting: linkReplace},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().String("link-mode", "symlink", "")
+			cmd.Flags().Bool("force", tt.force, "")
+
+			plan, err := buildSyncPlan(cmd, cfg)
+			if err != nil {
+				t.Fatalf("buildSyncPlan() error = %v", err)
+			}
+
+			if len(plan.Upstreams) != 1 || plan.Upstreams[0].Location != cfg.Upstream.URL || plan.Upstreams[0].Ref != "v2" {
+				t.Errorf("Upstreams = %+v, want the main upstream at v2", plan.Upstreams)
+			}
+
+			actions := make(map[string]string)
+			for _, l := range plan.Links {
+				actions[l.Target] = l.Action
+			}
+			want := map[string]string{
+				"overlay/src/new.txt":      linkCreate,
+				"overlay/src/existing.txt": tt.wantExisting,
+			}
+			for target, action := range want {
+				if actions[target] != action {
+					t.Errorf("%s: action = %q, want %q", target, actions[target], action)
+				}
+			}
+
+			if len(plan.Deletes) != 1 || plan.Deletes[0].Target != "overlay/src/gone.txt" || plan.Deletes[0].Policy != OnUpstreamDeleteRemove {
+				t.Errorf("Deletes = %+v, want overlay/src/gone.txt removed", plan.Deletes)
+			}
+			if !plan.Gitignore {
+				t.Error("Gitignore = false, want a new .gitignore")
+			}
+
+			var out bytes.Buffer
+			plan.writeText(&out, false)
+			for _, line := range []string{
+				"1. Fetch https://example.com/upstream.git into .upstream",
+				"2. Check out v2 in .upstream",
+				"Create 1 links",
+				"Remove overlay/src/gone.txt, deleted upstream",
+				"Rewrite the managed block of .gitignore",
+			} {
+				if !strings.Contains(out.String(), line) {
+					t.Errorf("plan text missing %q:\n%s", line, out.String())
+				}
+			}
+		})
+	}
+
+	// Planning leaves everything as it was
+	if _, err := os.Lstat("overlay/src/new.txt"); !os.IsNotExist(err) {
+		t.Errorf("overlay/src/new.txt exists after planning")
+	}
+	if _, err := os.Lstat(".gitignore"); !os.IsNotExist(err) {
+		t.Errorf(".gitignore exists after planning")
+	}
+}
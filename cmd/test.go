@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// exportOverlay copies overlay/ into dir with every link resolved, so the
+// export doesn't depend on .upstream or the parent repository. Linked
+// directories are copied with their contents, and dangling links are
+// skipped with a warning.
+func exportOverlay(dir string) error {
+	if _, err := os.Stat("overlay"); err != nil {
+		return fmt.Errorf("overlay directory does not exist, run 'git-overlay sync' first")
+	}
+
+	var files [][2]string
+	if err := collectExport("overlay", dir, map[string]bool{}, &files); err != nil {
+		return fmt.Errorf("failed to export overlay: %w", err)
+	}
+
+	queue := newCopyQueue(copyWorkers)
+	for _, f := range files {
+		f := f
+		queue.add(f[1], func() error { return copyFile(f[0], f[1]) })
+	}
+	if err := queue.close(); err != nil {
+		return fmt.Errorf("failed to export overlay: %w", err)
+	}
+	return nil
+}
+
+// collectExport creates the directories of src under dst, following links,
+// and lists the files to copy. Directories already being exported above are
+// a link cycle.
+func collectExport(src, dst string, exporting map[string]bool, files *[][2]string) error {
+	real, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return err
+	}
+	if exporting[real] {
+		return fmt.Errorf("%s links back to a directory that contains it", src)
+	}
+	exporting[real] = true
+	defer delete(exporting, real)
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		path, target := filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())
+		info, err := os.Stat(path)
+		switch {
+		case err != nil && e.Type()&os.ModeSymlink != 0:
+			fmt.Fprintf(os.Stderr, "Warning: skipping dangling link %s\n", path)
+		case err != nil:
+			return err
+		case info.IsDir():
+			if err := collectExport(path, target, exporting, files); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			*files = append(*files, [2]string{path, target})
+		default:
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s, not a regular file\n", path)
+		}
+	}
+	return nil
+}
+
+// shellCommand runs command through the platform's shell in dir
+func shellCommand(dir, command string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Dir = dir
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+var testCmd = &cobra.Command{
+	Use:   "test [-- command...]",
+	Short: "Verify the overlay builds from a pristine export",
+	Long: `Copy overlay/ with every link resolved into a temporary directory and run
+test.command from the config there, so a ref bump can be checked hermetically
+before the new pin is committed. A command given after -- replaces the
+configured one. The export is removed afterwards unless --keep is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		command := cfg.Test.Command
+		if len(args) > 0 {
+			command = strings.Join(args, " ")
+		}
+		if command == "" {
+			return fmt.Errorf("no test command: set test.command in the config or pass one after --")
+		}
+
+		dir, err := os.MkdirTemp("", "git-overlay-test-*")
+		if err != nil {
+			return fmt.Errorf("failed to create export directory: %w", err)
+		}
+		if flagBool(cmd, "keep") {
+			fmt.Printf("Keeping export in %s\n", dir)
+		} else {
+			defer os.RemoveAll(dir)
+		}
+
+		if err := exportOverlay(dir); err != nil {
+			return err
+		}
+
+		fmt.Printf("Running %q in a pristine export of overlay/\n", command)
+		if err := shellCommand(dir, command).Run(); err != nil {
+			return fmt.Errorf("test command failed: %w", err)
+		}
+		fmt.Println("Overlay test passed")
+		return nil
+	},
+}
+
+func init() {
+	testCmd.Flags().Bool("keep", false, "Keep the temporary export for inspection")
+	rootCmd.AddCommand(testCmd)
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestTestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test commands are written for sh")
+	}
+
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	configContent := `upstream:
+  url: "https://example.com/repo.git"
+  ref: "main"
+symlinks:
+  - app.txt
+test:
+  command: test -f app.txt && ! test -L app.txt && test ! -e .upstream
+`
+	if err := os.WriteFile(".git-overlay.yml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+
+	newCmd := func() *cobra.Command {
+		cmd := &cobra.Command{RunE: testCmd.RunE}
+		cmd.Flags().String("config", ".git-overlay.yml", "")
+		cmd.Flags().Bool("keep", false, "")
+		return cmd
+	}
+
+	// Nothing to export before the first sync
+	cmd := newCmd()
+	if err := cmd.RunE(cmd, nil); err == nil {
+		t.Fatal("test succeeded without an overlay")
+	}
+
+	if err := os.MkdirAll(".upstream", 0755); err != nil {
+		t.Fatalf("Failed to create upstream: %v", err)
+	}
+	if err := os.WriteFile(".upstream/app.txt", []byte("app"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.MkdirAll("overlay", 0755); err != nil {
+		t.Fatalf("Failed to create overlay: %v", err)
+	}
+	if err := os.Symlink("../.upstream/app.txt", "overlay/app.txt"); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+
+	// Links are resolved in the export, which stands on its own
+	cmd = newCmd()
+	if err := cmd.RunE(cmd, nil); err != nil {
+		t.Fatalf("test error = %v", err)
+	}
+
+	cmd = newCmd()
+	if err := cmd.RunE(cmd, []string{"false"}); err == nil {
+		t.Error("test succeeded with a failing command")
+	}
+
+	// A directory linked as a whole is exported with its contents, and a
+	// dangling link is left out rather than failing the export
+	if err := os.MkdirAll(".upstream/docs/guide", 0755); err != nil {
+		t.Fatalf("Failed to create upstream docs: %v", err)
+	}
+	if err := os.WriteFile(".upstream/docs/guide/intro.md", []byte("intro"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.Symlink("../.upstream/docs", "overlay/docs"); err != nil {
+		t.Fatalf("Failed to link directory: %v", err)
+	}
+	if err := os.Symlink("../.upstream/gone.txt", "overlay/gone.txt"); err != nil {
+		t.Fatalf("Failed to create dangling link: %v", err)
+	}
+	cmd = newCmd()
+	check := "test -f docs/guide/intro.md && ! test -L docs && ! test -e gone.txt && ! test -L gone.txt"
+	if err := cmd.RunE(cmd, []string{check}); err != nil {
+		t.Errorf("test of an overlay with a linked directory error = %v", err)
+	}
+
+	// A link back up the tree would export forever
+	if err := os.Symlink("..", ".upstream/docs/loop"); err != nil {
+		t.Fatalf("Failed to create link cycle: %v", err)
+	}
+	cmd = newCmd()
+	if err := cmd.RunE(cmd, []string{"true"}); err == nil {
+		t.Error("test succeeded exporting a link cycle")
+	}
+}
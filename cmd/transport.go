@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/git"
+	"github.com/spf13/cobra"
+)
+
+// parseBandwidth reads a rate in bytes per second, such as 500K or 2M, with
+// binary K, M and G suffixes and an optional trailing B or /s
+func parseBandwidth(s string) (int64, error) {
+	value := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "/S")
+	n, ok := parseSize(value)
+	if !ok || n <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q, want a rate such as 500K or 2M", s)
+	}
+	return n, nil
+}
+
+// parseSize reads a byte count such as 512K or 2GB, with binary K, M, G and T
+// suffixes and an optional trailing B or iB
+func parseSize(s string) (int64, bool) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(value, "B")
+	value = strings.TrimSuffix(value, "I")
+
+	multiplier := int64(1)
+	if n := len(value); n > 0 {
+		if i := strings.IndexByte("KMGT", value[n-1]); i >= 0 {
+			multiplier = int64(1) << (10 * (i + 1))
+			value = value[:n-1]
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return int64(n * float64(multiplier)), true
+}
+
+// applyTransportOptions limits the clones, fetches and pulls of the run with
+// --max-bandwidth and --fetch-timeout
+func applyTransportOptions(cmd *cobra.Command) error {
+	var opts git.TransportOptions
+	if s := flagString(cmd, "max-bandwidth"); s != "" {
+		rate, err := parseBandwidth(s)
+		if err != nil {
+			return err
+		}
+		opts.MaxBandwidth = rate
+	}
+	if f := cmd.Flags().Lookup("fetch-timeout"); f != nil {
+		timeout, err := cmd.Flags().GetDuration("fetch-timeout")
+		if err != nil {
+			return err
+		}
+		if timeout < 0 {
+			return fmt.Errorf("invalid --fetch-timeout %s", timeout)
+		}
+		opts.FetchTimeout = timeout
+	}
+	git.SetTransportOptions(opts)
+	return nil
+}
+
+// addTransportFlags defines the flags read by applyTransportOptions
+func addTransportFlags(cmd *cobra.Command) {
+	cmd.Flags().String("max-bandwidth", "", "Limit fetching over http(s) to this many bytes per second, e.g. 500K or 2M")
+	cmd.Flags().Duration("fetch-timeout", 0, "Give up on a clone or fetch that takes longer than this, e.g. 5m (default no limit)")
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import "testing"
+
+func TestParseBandwidth(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "1000", want: 1000},
+		{in: "500K", want: 500 << 10},
+		{in: "2M", want: 2 << 20},
+		{in: "1.5MiB", want: 3 << 19},
+		{in: "1g/s", want: 1 << 30},
+		{in: "10KB/s", want: 10 << 10},
+		{in: "2GB", want: 2 << 30},
+		{in: "", wantErr: true},
+		{in: "fast", wantErr: true},
+		{in: "0", wantErr: true},
+		{in: "-1M", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseBandwidth(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseBandwidth(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseBandwidth(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// trash moves displaced files into a timestamped directory instead of deleting them
+type trash struct {
+	enabled bool
+	dir     string
+}
+
+// newTrash creates a trash for the current run
+func newTrash(cfg *config.Config) *trash {
+	return &trash{
+		enabled: cfg.Trash.IsEnabled(),
+		dir:     filepath.Join(cfg.Trash.Path(), time.Now().Format("20060102-150405")),
+	}
+}
+
+// remove moves path into the trash, or deletes it when the trash is disabled.
+// Symlinks carry no content of their own and are always deleted outright.
+func (t *trash) remove(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if t == nil || !t.enabled || info.Mode()&os.ModeSymlink != 0 {
+		return os.RemoveAll(path)
+	}
+
+	_, err = t.put(path, path)
+	return err
+}
+
+// put moves path into the trash as name, even when the trash is disabled,
+// and returns where it went
+func (t *trash) put(path, name string) (string, error) {
+	dst := filepath.Join(t.dir, name)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", fmt.Errorf("failed to create trash directory: %w", err)
+	}
+
+	// Avoid clobbering something already trashed in this run
+	if _, err := os.Lstat(dst); err == nil {
+		dst = fmt.Sprintf("%s.%d", dst, time.Now().UnixNano())
+	}
+
+	if err := os.Rename(path, dst); err != nil {
+		return "", fmt.Errorf("failed to move %s to trash: %w", path, err)
+	}
+	return dst, nil
+}
+
+var purgeTrashCmd = &cobra.Command{
+	Use:   "purge-trash",
+	Short: "Permanently delete files moved to the trash",
+	Long: `Permanently delete files that clean and --force moved to the trash
+directory (default: .git-overlay.trash) instead of deleting them, and the
+overlay directories that restore replaced.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		dir := cfg.Trash.Path()
+		if err := validatePath(".", dir); err != nil {
+			return fmt.Errorf("invalid trash directory: %w", err)
+		}
+
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			fmt.Println("Trash is already empty")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read trash directory: %w", err)
+		}
+
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to purge trash: %w", err)
+		}
+
+		fmt.Printf("Purged %d trash snapshots\n", len(entries))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(purgeTrashCmd)
+}
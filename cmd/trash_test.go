@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrashRemove(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll("overlay/dir", 0755); err != nil {
+		t.Fatalf("Failed to create overlay directory: %v", err)
+	}
+	if err := os.WriteFile("overlay/dir/copy.txt", []byte("edited"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Symlink("copy.txt", "overlay/dir/link.txt"); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	tr := &trash{enabled: true, dir: filepath.Join(".git-overlay.trash", "snapshot")}
+
+	// Regular files are moved into the trash with their path preserved
+	if err := tr.remove("overlay/dir/copy.txt"); err != nil {
+		t.Fatalf("remove() error = %v", err)
+	}
+	if _, err := os.Stat("overlay/dir/copy.txt"); !os.IsNotExist(err) {
+		t.Error("File was not removed from overlay")
+	}
+	content, err := os.ReadFile(".git-overlay.trash/snapshot/overlay/dir/copy.txt")
+	if err != nil {
+		t.Fatalf("File was not moved to trash: %v", err)
+	}
+	if string(content) != "edited" {
+		t.Errorf("Trashed content = %q, want %q", string(content), "edited")
+	}
+
+	// Symlinks are deleted outright
+	if err := tr.remove("overlay/dir/link.txt"); err != nil {
+		t.Fatalf("remove() error = %v", err)
+	}
+	if _, err := os.Lstat("overlay/dir/link.txt"); !os.IsNotExist(err) {
+		t.Error("Symlink was not removed")
+	}
+	if _, err := os.Lstat(".git-overlay.trash/snapshot/overlay/dir/link.txt"); !os.IsNotExist(err) {
+		t.Error("Symlink should not be moved to trash")
+	}
+
+	// Disabled trash deletes files
+	tr.enabled = false
+	if err := os.WriteFile("overlay/dir/other.txt", []byte("other"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := tr.remove("overlay/dir/other.txt"); err != nil {
+		t.Fatalf("remove() error = %v", err)
+	}
+	if _, err := os.Stat(".git-overlay.trash/snapshot/overlay/dir/other.txt"); !os.IsNotExist(err) {
+		t.Error("File should not be moved to disabled trash")
+	}
+}
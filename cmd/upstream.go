@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/git"
+	"github.com/rjocoleman/git-overlay/internal/provider"
+)
+
+// syncOptions controls how upstreams are brought to their refs
+type syncOptions struct {
+	initialize    bool // Add a git upstream to the repository as a submodule first
+	acceptRewrite bool // Follow a branch whose history was force-pushed
+	jobs          int  // Upstreams synced at once
+
+	// Commits to check out instead of the configured refs, by upstream
+	// directory, as recorded in a plan that apply runs
+	commits map[string]string
+}
+
+// commit returns the commit to check out in the git upstream at dir instead
+// of its ref's tip, or "" for the tip
+func (o syncOptions) commit(dir string, u config.UpstreamConfig) string {
+	if !u.IsGit() {
+		return ""
+	}
+	return o.commits[dir]
+}
+
+// syncUpstreamSource brings .upstream to the configured ref
+func syncUpstreamSource(cfg *config.Config, opts syncOptions) error {
+	if cfg.UpstreamDir != "" {
+		return syncExternalUpstream(cfg, opts)
+	}
+	if !cfg.Upstream.IsGit() {
+		return syncProvider(cfg.Upstream, config.UpstreamDir(""))
+	}
+
+	repo, err := git.InitMainRepository()
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	submodule := submoduleOptions(cfg.Submodule)
+	if opts.initialize {
+		if err := repo.AddUpstreamSubmodule(cfg.Upstream.URL, submodule, cfg.Upstream.Mirrors...); err != nil {
+			return fmt.Errorf("failed to add upstream submodule: %w", err)
+		}
+	} else if err := git.ConfigureUpstreamSubmodule(cfg.Upstream.URL, submodule); err != nil {
+		return fmt.Errorf("failed to update upstream submodule: %w", err)
+	}
+
+	if err := repo.SyncUpstreamAt(cfg.Upstream.Ref, opts.commit(config.UpstreamDir(""), cfg.Upstream), opts.acceptRewrite, cfg.Upstream.Mirrors...); err != nil {
+		return fmt.Errorf("failed to sync upstream: %w", err)
+	}
+	return nil
+}
+
+// syncExternalUpstream brings the checkout in upstream_dir to the configured
+// ref and points .upstream at it. A git upstream there is a plain clone, not a
+// submodule, so several worktrees can share it.
+func syncExternalUpstream(cfg *config.Config, opts syncOptions) error {
+	dir := cfg.UpstreamDir
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return fmt.Errorf("failed to create upstream_dir parent: %w", err)
+	}
+
+	if cfg.Upstream.IsGit() {
+		if err := git.SyncCloneAt(dir, cfg.Upstream.URL, cfg.Upstream.Ref, opts.commit(config.UpstreamDir(""), cfg.Upstream), opts.acceptRewrite, cfg.Upstream.Mirrors...); err != nil {
+			return fmt.Errorf("failed to sync upstream: %w", err)
+		}
+	} else if err := syncProvider(cfg.Upstream, dir); err != nil {
+		return err
+	}
+
+	return linkUpstreamDir(dir)
+}
+
+// linkUpstreamDir makes .upstream a symlink to dir, replacing a symlink to
+// anywhere else. A real .upstream directory, such as a submodule checkout, is
+// left for the user to remove.
+func linkUpstreamDir(dir string) error {
+	link := config.UpstreamDir("")
+	if info, err := os.Lstat(link); err == nil {
+		if info.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("%s is a directory, so it can't link to upstream_dir %s; remove it first (for a submodule: git submodule deinit -f %s && git rm %s)", link, dir, link, link)
+		}
+		if target, err := os.Readlink(link); err == nil && target == dir {
+			return nil
+		}
+		if err := os.Remove(link); err != nil {
+			return fmt.Errorf("failed to remove old %s link: %w", link, err)
+		}
+	}
+	if err := os.Symlink(dir, link); err != nil {
+		return fmt.Errorf("failed to link %s to upstream_dir: %w", link, err)
+	}
+	return nil
+}
+
+// upstreamRoot resolves an upstream checkout that is a symlink, such as
+// .upstream pointing at upstream_dir, so walks descend into it
+func upstreamRoot(dir string) string {
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		return resolved
+	}
+	return dir
+}
+
+// submoduleOptions converts the submodule section of the config
+func submoduleOptions(sub config.SubmoduleConfig) git.SubmoduleOptions {
+	return git.SubmoduleOptions{
+		Ignore:  sub.Ignore,
+		Update:  sub.Update,
+		Branch:  sub.Branch,
+		Shallow: sub.Shallow,
+	}
+}
+
+// syncProvider fetches a non-git upstream through its provider next to dir
+// and swaps it in, so a failed fetch leaves the existing tree intact
+func syncProvider(upstream config.UpstreamConfig, dir string) error {
+	if err := fetchCredentials(); err != nil {
+		return err
+	}
+	p, err := provider.New(upstream)
+	if err != nil {
+		return err
+	}
+
+	id, err := p.Resolve(upstream.Ref)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s upstream ref %s: %w", upstream.Type, upstream.Ref, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dir), ".git-overlay-upstream-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fetched := filepath.Join(tmpDir, "upstream")
+	if err := p.Fetch(id, fetched); err != nil {
+		return fmt.Errorf("failed to fetch %s upstream: %w", upstream.Type, err)
+	}
+	fmt.Printf("Fetched %s upstream at %s\n", upstream.Type, id)
+
+	root := fetched
+	if upstream.Subpath != "" {
+		if err := validatePath(fetched, upstream.Subpath); err != nil {
+			return fmt.Errorf("invalid upstream.subpath: %w", err)
+		}
+		root = filepath.Join(fetched, upstream.Subpath)
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			return fmt.Errorf("upstream.subpath %s is not a directory in the fetched upstream", upstream.Subpath)
+		}
+	}
+
+	return swapUpstream(root, dir)
+}
+
+// swapUpstream replaces the upstream checkout at dir with src
+func swapUpstream(src, dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove existing %s directory: %w", dir, err)
+	}
+	if err := os.Rename(src, dir); err != nil {
+		return fmt.Errorf("failed to move extracted upstream into %s: %w", dir, err)
+	}
+
+	return nil
+}
+
+// defaultSyncJobs is how many upstreams are synced at once unless --jobs is given
+const defaultSyncJobs = 4
+
+// syncAllUpstreams brings the main upstream and every named upstream to
+// their refs, running up to opts.jobs of them at once. Failures are collected
+// so one broken upstream doesn't hide the others.
+func syncAllUpstreams(cfg *config.Config, opts syncOptions) error {
+	// A ref outside the policy is refused before anything moves
+	if err := checkAllowedRefs(cfg); err != nil {
+		return err
+	}
+
+	jobs := opts.jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	tasks := []func() error{
+		func() error { return syncUpstreamSource(cfg, opts) },
+	}
+	for _, named := range cfg.Upstreams {
+		named := named
+		tasks = append(tasks, func() error {
+			if err := syncNamedUpstream(named, opts); err != nil {
+				return fmt.Errorf("upstream %s: %w", named.Name, err)
+			}
+			return nil
+		})
+	}
+
+	errs := make([]error, len(tasks))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		sem <- struct{}{}
+		// Upstreams already syncing finish; no more are started
+		if errs[i] = interrupted(); errs[i] != nil {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(i int, task func() error) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = task()
+		}(i, task)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// syncNamedUpstream brings a named upstream in .upstreams/<name> to its ref
+func syncNamedUpstream(named config.NamedUpstream, opts syncOptions) error {
+	dir := config.UpstreamDir(named.Name)
+	if !named.IsGit() {
+		return syncProvider(named.UpstreamConfig, dir)
+	}
+	if err := os.MkdirAll(config.UpstreamsDir, 0755); err != nil {
+		return err
+	}
+	return git.SyncCloneAt(dir, named.URL, named.Ref, opts.commit(dir, named.UpstreamConfig), opts.acceptRewrite, named.Mirrors...)
+}
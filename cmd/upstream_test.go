@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/filehash"
+	"github.com/spf13/cobra"
+)
+
+func TestSyncAllUpstreams(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script providers are not supported on windows")
+	}
+
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	// The main upstream comes from a provider that writes a single file
+	binDir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$1\" in\nresolve) echo \"$2\" ;;\nfetch) echo main > \"$3/main.txt\" ;;\nesac\n"
+	if err := os.WriteFile(filepath.Join(binDir, "git-overlay-provider-fake"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write provider: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	docsRepo := filepath.Join(t.TempDir(), "docs")
+	if err := os.MkdirAll(docsRepo, 0755); err != nil {
+		t.Fatalf("Failed to create docs repo: %v", err)
+	}
+	if err := runGitCommand(docsRepo, []string{"init", "-b", "main"}); err != nil {
+		t.Fatalf("Failed to init docs repo: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(docsRepo, "guide.md"), []byte("guide"), 0644); err != nil {
+		t.Fatalf("Failed to create docs file: %v", err)
+	}
+	if err := runGitCommand(docsRepo, []string{"add", "guide.md"}); err != nil {
+		t.Fatalf("Failed to add docs file: %v", err)
+	}
+	if err := runGitCommand(docsRepo, []string{"commit", "-m", "Add guide"}); err != nil {
+		t.Fatalf("Failed to commit docs file: %v", err)
+	}
+
+	cfg := &config.Config{
+		Upstream: config.UpstreamConfig{Type: "fake", Ref: "v1"},
+		Upstreams: []config.NamedUpstream{
+			{Name: "docs", UpstreamConfig: config.UpstreamConfig{URL: docsRepo, Ref: "main"}},
+			{Name: "broken", UpstreamConfig: config.UpstreamConfig{URL: filepath.Join(tmpDir, "missing"), Ref: "main"}},
+		},
+		Symlinks: []config.SymlinkSpec{
+			{String: "main.txt"},
+			{From: "guide.md", To: "docs/guide.md", Upstream: "docs"},
+		},
+	}
+
+	err = syncAllUpstreams(cfg, syncOptions{jobs: 2})
+	if err == nil || !strings.Contains(err.Error(), "upstream broken") {
+		t.Fatalf("syncAllUpstreams() error = %v, want error for upstream broken", err)
+	}
+	if strings.Contains(err.Error(), "upstream docs") {
+		t.Errorf("syncAllUpstreams() error = %v, want no error for upstream docs", err)
+	}
+
+	// Healthy upstreams are synced despite the failing one
+	for _, path := range []string{".upstream/main.txt", ".upstreams/docs/guide.md"} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to exist: %v", path, err)
+		}
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("link-mode", "symlink", "")
+	cmd.Flags().Bool("force", true, "")
+	if err := CreateLinks(cmd, cfg); err != nil {
+		t.Fatalf("CreateLinks() error = %v", err)
+	}
+
+	data, err := os.ReadFile("overlay/docs/guide.md")
+	if err != nil || string(data) != "guide" {
+		t.Errorf("overlay/docs/guide.md = %q, %v, want %q", data, err, "guide")
+	}
+
+	state, err := config.LoadState()
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	_, mf := state.IsManagedFile("docs/guide.md")
+	if mf == nil || mf.Upstream != "docs" || mf.Source != "guide.md" {
+		t.Errorf("managed file = %+v, want source guide.md from upstream docs", mf)
+	}
+	if got := managedFileStatus(*mf, nil, nil, filehash.NewCache()); got != statusOK {
+		t.Errorf("managedFileStatus() = %q, want %q", got, statusOK)
+	}
+}
+
+func TestSyncExternalUpstream(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script providers are not supported on windows")
+	}
+
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$1\" in\nresolve) echo \"$2\" ;;\nfetch) echo \"$2\" > \"$3/version.txt\" ;;\nesac\n"
+	if err := os.WriteFile(filepath.Join(binDir, "git-overlay-provider-fake"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write provider: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	external := filepath.Join(t.TempDir(), "cache", "upstream")
+	cfg := &config.Config{
+		Upstream:    config.UpstreamConfig{Type: "fake", Ref: "v1"},
+		UpstreamDir: external,
+	}
+
+	if err := syncUpstreamSource(cfg, syncOptions{}); err != nil {
+		t.Fatalf("syncUpstreamSource() error = %v", err)
+	}
+	if target, err := os.Readlink(".upstream"); err != nil || target != external {
+		t.Fatalf(".upstream links to %q (%v), want %s", target, err, external)
+	}
+	if data, err := os.ReadFile(".upstream/version.txt"); err != nil || strings.TrimSpace(string(data)) != "v1" {
+		t.Errorf("version.txt = %q (%v), want v1", data, err)
+	}
+	if paths, err := uncoveredPaths(cfg, false, true, ""); err != nil || len(paths) != 1 || paths[0] != "version.txt" {
+		t.Errorf("uncoveredPaths() = %q, %v; want the files of the external checkout", paths, err)
+	}
+
+	// Moving upstream_dir relinks .upstream
+	moved := filepath.Join(t.TempDir(), "upstream")
+	cfg.UpstreamDir = moved
+	cfg.Upstream.Ref = "v2"
+	if err := syncUpstreamSource(cfg, syncOptions{}); err != nil {
+		t.Fatalf("syncUpstreamSource() after move error = %v", err)
+	}
+	if target, err := os.Readlink(".upstream"); err != nil || target != moved {
+		t.Errorf(".upstream links to %q (%v), want %s", target, err, moved)
+	}
+
+	// A real .upstream directory is never replaced
+	if err := os.Remove(".upstream"); err != nil {
+		t.Fatalf("Failed to remove link: %v", err)
+	}
+	if err := os.Mkdir(".upstream", 0755); err != nil {
+		t.Fatalf("Failed to create .upstream: %v", err)
+	}
+	if err := syncUpstreamSource(cfg, syncOptions{}); err == nil || !strings.Contains(err.Error(), "is a directory") {
+		t.Errorf("syncUpstreamSource() over a real .upstream error = %v, want refusal", err)
+	}
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// upstreamSpecsFile is the manifest an upstream publishes to say which of
+// its paths overlays are meant to link
+type upstreamSpecsFile struct {
+	Symlinks []config.SymlinkSpec `yaml:"symlinks"`
+}
+
+// loadUpstreamSpecs replaces the specs read from the symlinks_from_upstream
+// manifest with those in the main upstream checkout as it is now, so a sync
+// links what the synced commit publishes. Before the upstream is checked out
+// there is nothing to read; a checkout without the manifest is an error only
+// when required.
+func loadUpstreamSpecs(cfg *config.Config, required bool) error {
+	if cfg.SymlinksFromUpstream == "" {
+		return nil
+	}
+	if err := validatePath(".", cfg.SymlinksFromUpstream); err != nil {
+		return fmt.Errorf("symlinks_from_upstream: %w", err)
+	}
+
+	specs := cfg.Symlinks[:0:0]
+	for _, link := range cfg.Symlinks {
+		if !link.Manifest {
+			specs = append(specs, link)
+		}
+	}
+	cfg.Symlinks = specs
+
+	dir := config.UpstreamDir("")
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) == 0 {
+		return nil
+	}
+	path := filepath.Join(dir, cfg.SymlinksFromUpstream)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read upstream manifest: %w", err)
+	}
+
+	var manifest upstreamSpecsFile
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("failed to parse upstream manifest %s: %w", path, err)
+	}
+	for _, link := range manifest.Symlinks {
+		// The upstream only speaks for its own paths
+		if link.Upstream != "" {
+			return fmt.Errorf("upstream manifest %s: spec %s can't name an upstream", path, specSource(link))
+		}
+		for _, p := range []string{link.From, link.To} {
+			if err := validatePath(".", p); err != nil {
+				return fmt.Errorf("upstream manifest %s: spec %s: %w", path, specSource(link), err)
+			}
+		}
+		link.Manifest = true
+		cfg.Symlinks = append(cfg.Symlinks, link)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestUpstreamSpecs(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	content := `upstream:
+  url: "https://github.com/acme/base.git"
+  ref: "main"
+symlinks:
+  - local.txt
+symlinks_from_upstream: overlay-manifest.yml
+`
+	if err := os.WriteFile(".git-overlay.yml", []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cmd := &cobra.Command{}
+	cmd.Flags().String("config", ".git-overlay.yml", "")
+	cmd.Flags().String("link-mode", "symlink", "")
+	cmd.Flags().Bool("force", true, "")
+
+	// Nothing to read before the upstream is checked out
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		t.Fatalf("loadConfig() before checkout error = %v", err)
+	}
+	if len(cfg.Symlinks) != 1 {
+		t.Errorf("symlinks before checkout = %v, want only the configured spec", cfg.Symlinks)
+	}
+
+	for _, name := range []string{"local.txt", "a.txt", "b/c.txt"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(".upstream", name)), 0755); err != nil {
+			t.Fatalf("Failed to create upstream directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(".upstream", name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+	}
+	writeManifest := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(".upstream/overlay-manifest.yml", []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write manifest: %v", err)
+		}
+	}
+	writeManifest("symlinks:\n  - a.txt\n")
+
+	cfg, err = loadConfig(cmd)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	var specs []string
+	for _, link := range cfg.Symlinks {
+		specs = append(specs, specSource(link))
+	}
+	if want := []string{"local.txt", "a.txt"}; !reflect.DeepEqual(specs, want) {
+		t.Errorf("symlinks = %v, want %v", specs, want)
+	}
+
+	// A sync links what the newly checked out manifest lists
+	writeManifest("symlinks:\n  - from: b/c.txt\n    to: c.txt\n")
+	if err := CreateLinks(cmd, cfg); err != nil {
+		t.Fatalf("CreateLinks() error = %v", err)
+	}
+	for _, path := range []string{"overlay/local.txt", "overlay/c.txt"} {
+		if _, err := os.Lstat(path); err != nil {
+			t.Errorf("%s was not linked: %v", path, err)
+		}
+	}
+	if _, err := os.Lstat("overlay/a.txt"); !os.IsNotExist(err) {
+		t.Errorf("overlay/a.txt from the old manifest was linked: %v", err)
+	}
+	if len(cfg.Symlinks) != 2 {
+		t.Errorf("symlinks after reload = %v, want 2 specs", cfg.Symlinks)
+	}
+
+	tests := []struct {
+		name     string
+		manifest string
+	}{
+		{name: "other upstream", manifest: "symlinks:\n  - from: a.txt\n    upstream: tools\n"},
+		{name: "escaping path", manifest: "symlinks:\n  - from: a.txt\n    to: ../a.txt\n"},
+		{name: "missing manifest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.manifest == "" {
+				os.Remove(".upstream/overlay-manifest.yml")
+			} else {
+				writeManifest(tt.manifest)
+			}
+			if err := CreateLinks(cmd, cfg); err == nil {
+				t.Error("CreateLinks() succeeded, want a manifest error")
+			}
+		})
+	}
+}
@@ -1,13 +1,23 @@
 package cmd
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/git"
+	"github.com/rjocoleman/git-overlay/internal/provider"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 )
@@ -31,6 +41,29 @@ func runGitCommand(dir string, args []string) error {
 	return cmd.Run()
 }
 
+// flagString returns the value of a string flag, or "" if the command does not define it
+func flagString(cmd *cobra.Command, name string) string {
+	if f := cmd.Flags().Lookup(name); f != nil {
+		return f.Value.String()
+	}
+	return ""
+}
+
+// debugf prints a debug message when --debug or debug: in the config is set
+func debugf(cmd *cobra.Command, cfg *config.Config, format string, args ...interface{}) {
+	if flagBool(cmd, "debug") || cfg.DebugMode {
+		fmt.Fprintf(os.Stderr, "debug: "+format+"\n", args...)
+	}
+}
+
+// flagBool returns the value of a bool flag, or false if the command does not define it
+func flagBool(cmd *cobra.Command, name string) bool {
+	if f := cmd.Flags().Lookup(name); f != nil {
+		return f.Value.String() == "true"
+	}
+	return false
+}
+
 // loadConfig loads and validates the configuration file
 func loadConfig(cmd *cobra.Command) (*config.Config, error) {
 	configPath, err := cmd.Flags().GetString("config")
@@ -38,49 +71,288 @@ func loadConfig(cmd *cobra.Command) (*config.Config, error) {
 		return nil, err
 	}
 
-	data, err := os.ReadFile(configPath)
+	if err := checkProjectRoot(cmd); err != nil {
+		return nil, err
+	}
+
+	git.SetURLRewrites(userSettings().URLRewrites)
+
+	data, err := readConfigSource(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	// Verify the config against a pinned checksum, mainly for remote configs
+	want := flagString(cmd, "config-sha256")
+	if want != "" {
+		sum := sha256.Sum256(data)
+		if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, want) {
+			return nil, fmt.Errorf("%w: got sha256 %s, want %s", overlayerr.ErrChecksumMismatch, got, want)
+		}
+	}
+
+	// Merge in any configs pulled in through extends
+	values, err := loadConfigTree(configPath, data, map[string]bool{}, want != "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config file: %w", err)
+	}
+	merged, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge config file: %w", err)
+	}
+
 	var cfg config.Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	if err := yaml.Unmarshal(merged, &cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	if err := expandComponents(&cfg); err != nil {
+		return nil, err
+	}
+
+	// Add the specs the upstream publishes, as far as it's checked out
+	if err := loadUpstreamSpecs(&cfg, false); err != nil {
+		return nil, err
+	}
 
 	// Validate required fields
-	if cfg.Upstream.URL == "" {
-		return nil, fmt.Errorf("upstream.url is required")
+	if err := validateUpstream("upstream", cfg.Upstream); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for i, u := range cfg.Upstreams {
+		if u.Name == "" || strings.ContainsAny(u.Name, `/\`) || strings.HasPrefix(u.Name, ".") {
+			return nil, fmt.Errorf("upstreams[%d].name must be a plain directory name", i)
+		}
+		if names[u.Name] {
+			return nil, fmt.Errorf("duplicate upstream name: %s", u.Name)
+		}
+		names[u.Name] = true
+		if err := validateUpstream("upstreams."+u.Name, u.UpstreamConfig); err != nil {
+			return nil, err
+		}
+	}
+	for _, link := range cfg.Symlinks {
+		if link.Upstream != "" && !names[link.Upstream] {
+			return nil, fmt.Errorf("spec %s refers to unknown upstream %s", link.From, link.Upstream)
+		}
+		if link.When != "" {
+			if _, err := parseWhen(link.When); err != nil {
+				return nil, fmt.Errorf("spec %s: %w", specSource(link), err)
+			}
+		}
+		if err := validatePlatforms(link.Platforms); err != nil {
+			return nil, fmt.Errorf("spec %s: %w", specSource(link), err)
+		}
+	}
+	if _, err := orderSpecs(cfg.Symlinks); err != nil {
+		return nil, err
+	}
+	if err := validatePolicies(cfg.Policies); err != nil {
+		return nil, err
 	}
-	if cfg.Upstream.Ref == "" {
-		return nil, fmt.Errorf("upstream.ref is required")
+	if cfg.UpstreamDir != "" {
+		cfg.UpstreamDir = filepath.Clean(os.ExpandEnv(cfg.UpstreamDir))
+		if !filepath.IsAbs(cfg.UpstreamDir) {
+			return nil, fmt.Errorf("upstream_dir must be an absolute path: %s", cfg.UpstreamDir)
+		}
 	}
 
 	return &cfg, nil
 }
 
-// createLink creates a single link (symlink, hardlink, or copy) from src to dst
-func createLink(src, dst string, linkMode string, force bool, createdLinks *[]string, state *config.State) error {
+// loadState loads the state from the configured location with the
+// configured path normalization
+func loadState(cfg *config.Config) (*config.State, error) {
+	state, err := config.LoadStateAt(cfg.StateLocation)
+	if err != nil {
+		return nil, err
+	}
+	state.SetNormalization(cfg.UnicodeNormalization)
+	return state, nil
+}
+
+// validateUpstream checks the required fields of an upstream; non-git
+// upstreams are checked by their provider
+func validateUpstream(field string, upstream config.UpstreamConfig) error {
+	if upstream.IsGit() {
+		if upstream.URL == "" {
+			return fmt.Errorf("%s.url is required", field)
+		}
+	} else if _, err := provider.New(upstream); err != nil {
+		if field == "upstream" {
+			return err
+		}
+		return fmt.Errorf("%s: %w", field, err)
+	}
+	if len(upstream.Mirrors) > 0 && !upstream.IsGit() {
+		return fmt.Errorf("%s.mirrors is only supported for git upstreams", field)
+	}
+	if upstream.Ref == "" {
+		return fmt.Errorf("%s.ref is required", field)
+	}
+	return nil
+}
+
+// overlayRelPath normalizes a path given as overlay/<path> or relative to
+// overlay/ into a slash-separated overlay-relative path
+func overlayRelPath(path string) string {
+	path = filepath.ToSlash(filepath.Clean(path))
+	return strings.TrimPrefix(path, "overlay/")
+}
+
+// linkOptions holds the settings applied to every link created in a run
+type linkOptions struct {
+	linkMode  string
+	strategy  LinkStrategy
+	auto      *autoLinker // Chooses linkMode and strategy per file when set
+	force     bool
+	protect   []string
+	trash     *trash
+	upstream  string // Named upstream of the spec being linked, empty for .upstream
+	component string // components: group of the spec being linked
+	indexes   map[string]*git.TreeIndex
+	copies    *copyQueue    // Runs copy-mode links in parallel when set
+	synced    *syncedCopies // Tells which managed copies weren't edited since their sync
+	preserve  bool          // Recreate src, an upstream symlink, instead of linking it
+
+	// assumeClean skips every check of existing targets, for runs into an
+	// overlay/ that holds no managed files yet. Parent directories already
+	// validated are remembered in dirs.
+	assumeClean bool
+	dirs        map[string]bool
+
+	// only limits the run to the links under some overlay paths when set
+	only *onlyFilter
+
+	protectCopies bool
+	owner         *owner // Given the copies when set
+
+	conflicts string // policies.conflict, for targets not managed yet
+
+	// syncedAt and the upstream commits by upstream name are recorded
+	// with every file the run materializes
+	syncedAt time.Time
+	commits  map[string]string
+}
+
+// createLink materializes src at dst using the run's link strategy
+func createLink(src, dst string, opts linkOptions, createdLinks *[]string, state *config.State) error {
+	linkMode, strategy := opts.linkMode, opts.strategy
+	if opts.auto != nil {
+		linkMode = opts.auto.mode(src)
+		var err error
+		if strategy, err = linkStrategyFor(linkMode); err != nil {
+			return err
+		}
+	}
+
 	// Validate paths
-	if err := validatePath("overlay", strings.TrimPrefix(dst, "overlay/")); err != nil {
+	relPath := overlayRelPath(dst)
+	if err := validatePath("overlay", relPath); err != nil {
 		return fmt.Errorf("invalid target path: %w", err)
 	}
 
 	// Create parent directory if it doesn't exist
 	parentDir := filepath.Dir(dst)
-	if err := os.MkdirAll(parentDir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory for %s: %w", dst, err)
+	if !opts.dirs[parentDir] {
+		if err := mkdirOwned(parentDir, opts.owner); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", dst, err)
+		}
+
+		// A symlinked directory in overlay/ must not redirect writes out of the repository
+		if err := validateWithin(".", parentDir); err != nil {
+			return fmt.Errorf("invalid target path: %w", err)
+		}
+		if opts.dirs != nil {
+			opts.dirs[parentDir] = true
+		}
+	}
+
+	relSrc, _ := filepath.Rel(config.UpstreamDir(opts.upstream), src)
+
+	// Track the target for gitignore and state. changed tells whether the
+	// run gave dst content it didn't have.
+	record := func(linkMode string, changed bool) {
+		*createdLinks = append(*createdLinks, dst)
+		if opts.assumeClean {
+			state.AppendUpstreamFile(opts.upstream, relPath, linkMode, relSrc)
+		} else {
+			state.AddUpstreamFile(opts.upstream, relPath, linkMode, relSrc)
+		}
+		if !opts.syncedAt.IsZero() {
+			state.MarkSynced(opts.syncedAt, opts.commits[opts.upstream], changed)
+		}
+		if opts.component != "" {
+			state.SetComponent(opts.component)
+		}
+	}
+
+	// A queued copy to the same target has to land before it is checked
+	if opts.copies != nil && opts.copies.queued(dst) {
+		if err := opts.copies.wait(); err != nil {
+			return err
+		}
+	}
+
+	// Copies already matching the synced upstream content are left in place
+	if !opts.assumeClean && (linkMode == "copy" || strings.HasSuffix(dst, ".gitignore")) {
+		if info, err := os.Lstat(dst); err == nil && info.Mode().IsRegular() {
+			if entry, ok := indexEntry(opts.indexes, opts.upstream, relSrc); ok {
+				if same, _ := entry.Matches(dst); same {
+					if err := opts.settleCopy(dst); err != nil {
+						return err
+					}
+					record("copy", false)
+					return nil
+				}
+			}
+		}
+	}
+
+	// Handle existing target, unless the run assumes there is none
+	refresh := false
+	changed := true
+	if !opts.assumeClean {
+		if dstInfo, err := os.Stat(dst); err == nil {
+			// A link already resolving to src keeps its content when recreated
+			if srcInfo, err := os.Stat(src); err == nil && os.SameFile(srcInfo, dstInfo) {
+				changed = false
+			}
+			if matchAnyGlob(opts.protect, dst) {
+				fmt.Printf("Skipping protected path: %s\n", dst)
+				return nil
+			}
+			if !opts.force {
+				// Left as it is, and unmanaged, unless the policy fails the run
+				return enforce(opts.conflicts, config.PolicyError, fmt.Errorf("%w: %s", overlayerr.ErrConflict, dst))
+			}
+			// A copy made by an earlier run, and not edited since, is
+			// rewritten in place where it changed rather than replaced whole
+			if linkMode == "copy" {
+				if mf := managedCopy(state, relPath, dst); mf != nil {
+					refresh = opts.synced.unchanged(mf, dst)
+				}
+			}
+			// Move existing file to the trash, or remove an existing link
+			if !refresh {
+				if err := opts.trash.remove(dst); err != nil {
+					return fmt.Errorf("failed to remove existing target %s: %w", dst, err)
+				}
+			}
+		}
 	}
 
-	// Handle existing target
-	if _, err := os.Stat(dst); err == nil {
-		if !force {
-			return fmt.Errorf("target already exists: %s", dst)
+	// Upstream symlinks kept as symlinks point at what they did upstream
+	if opts.preserve {
+		target, err := preservedTarget(src, dst, opts.upstream)
+		if err != nil {
+			return err
 		}
-		// Remove existing file or link
-		if err := os.Remove(dst); err != nil {
-			return fmt.Errorf("failed to remove existing target %s: %w", dst, err)
+		if err := os.Symlink(target, dst); err != nil {
+			return fmt.Errorf("failed to preserve symlink %s: %w", dst, err)
 		}
+		record(preservedLinkMode, changed)
+		return nil
 	}
 
 	// Special handling for .gitignore
@@ -89,126 +361,281 @@ func createLink(src, dst string, linkMode string, force bool, createdLinks *[]st
 		if err := copyFile(src, dst); err != nil {
 			return fmt.Errorf("failed to copy .gitignore: %w", err)
 		}
-		// Track created link and state
-		*createdLinks = append(*createdLinks, dst)
-		relPath := strings.TrimPrefix(dst, "overlay/")
-		relSrc := strings.TrimPrefix(src, ".upstream/")
-		state.AddManagedFile(relPath, "copy", relSrc)
+		if err := opts.settleCopy(dst); err != nil {
+			return err
+		}
+		record("copy", true)
 		return nil
 	}
 
-	switch linkMode {
-	case "symlink":
-		// For symlinks, we need to use relative paths
-		relPath, err := filepath.Rel(filepath.Dir(dst), src)
-		if err != nil {
-			return fmt.Errorf("failed to create relative path from %s to %s: %w", src, dst, err)
-		}
-		if err := os.Symlink(relPath, dst); err != nil {
-			return fmt.Errorf("failed to create symlink from %s to %s: %w", src, dst, err)
+	link := func() error {
+		if refresh {
+			if _, err := refreshCopy(src, dst); err != nil {
+				return fmt.Errorf("failed to refresh copy %s: %w", dst, err)
+			}
+			return opts.settleCopy(dst)
 		}
-	case "hardlink":
-		if err := os.Link(src, dst); err != nil {
-			return fmt.Errorf("failed to create hardlink from %s to %s: %w", src, dst, err)
+		if err := strategy.Link(src, dst); err != nil {
+			return fmt.Errorf("failed to %s %s to %s: %w", linkMode, src, dst, err)
 		}
-	case "copy":
-		if err := copyFile(src, dst); err != nil {
-			return fmt.Errorf("failed to copy from %s to %s: %w", src, dst, err)
+		if linkMode == "copy" {
+			return opts.settleCopy(dst)
 		}
-	default:
-		return fmt.Errorf("unsupported link mode: %s", linkMode)
+		return nil
+	}
+	if opts.copies != nil {
+		opts.copies.add(dst, link)
+	} else if err := link(); err != nil {
+		return err
 	}
 
-	// Track created link for gitignore and state
-	*createdLinks = append(*createdLinks, dst)
-
-	// Track in state
-	relPath := strings.TrimPrefix(dst, "overlay/")
-	relSrc := strings.TrimPrefix(src, ".upstream/")
-	state.AddManagedFile(relPath, linkMode, relSrc)
+	record(linkMode, changed)
+	return nil
+}
 
+// managedCopy returns the state entry of dst when it is a regular file the
+// state records as an unpinned copy, and nil otherwise
+func managedCopy(state *config.State, relPath, dst string) *config.ManagedFile {
+	info, err := os.Lstat(dst)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	if managed, mf := state.IsManagedFile(relPath); managed && mf.LinkMode == "copy" && !mf.Pinned {
+		return mf
+	}
 	return nil
 }
 
-// CreateLinks creates symlinks according to the configuration
-func CreateLinks(cmd *cobra.Command, cfg *config.Config) error {
+// networkNote prints the network filesystem note once per run
+var networkNote sync.Once
+
+// newLinkOptions works out the link mode and settings of a run from the
+// flags, the config and the user settings
+func newLinkOptions(cmd *cobra.Command, cfg *config.Config) (linkOptions, error) {
 	linkMode, err := cmd.Flags().GetString("link-mode")
 	if err != nil {
-		return err
+		return linkOptions{}, err
 	}
 
-	// Override link mode from config if set
+	// Override link mode from config if set, then from the user settings
+	// unless --link-mode was given
 	if cfg.LinkMode != "" {
 		linkMode = cfg.LinkMode
+	} else if f := cmd.Flags().Lookup("link-mode"); f != nil && !f.Changed {
+		if mode := userSettings().LinkMode; mode != "" {
+			linkMode = mode
+		} else if fs, ok := networkFilesystem("."); ok {
+			// Hardlinks fail on network filesystems and some clients
+			// mishandle symlinks, so nothing is shared with the upstream
+			networkNote.Do(func() {
+				fmt.Fprintf(os.Stderr, "Note: the project is on %s, so files are copied rather than symlinked (set link_mode to choose)\n", fs)
+			})
+			linkMode = "copy"
+		}
 	}
 
 	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return linkOptions{}, err
+	}
+
+	var strategy LinkStrategy
+	var auto *autoLinker
+	if linkMode == autoLinkMode {
+		// Picks a mode per file, falling back by itself
+		auto = newAutoLinker()
+	} else {
+		// Downgrade to a fallback mode if the filesystem can't create this one
+		linkMode, err = selectLinkMode(linkMode, cfg.LinkFallback)
+		if err != nil {
+			return linkOptions{}, err
+		}
+
+		strategy, err = linkStrategyFor(linkMode)
+		if err != nil {
+			return linkOptions{}, err
+		}
+	}
+
+	opts := linkOptions{
+		linkMode: linkMode,
+		strategy: strategy,
+		auto:     auto,
+		force:    force,
+		protect:  cfg.Clean.Protect,
+		trash:    newTrash(cfg),
+
+		protectCopies: cfg.ProtectCopies,
+		conflicts:     cfg.Policies.Conflict,
+
+		syncedAt: time.Now(),
+		commits:  upstreamCommits(cfg),
+	}
+
+	opts.owner, err = copyOwner(cmd, cfg)
+	if err != nil {
+		return linkOptions{}, err
+	}
+
+	opts.only, err = newOnlyFilter(cmd)
+	if err != nil {
+		return linkOptions{}, err
+	}
+	components, err := componentFlag(cmd, cfg)
+	if err != nil {
+		return linkOptions{}, err
+	}
+	if len(components) > 0 {
+		if opts.only == nil {
+			opts.only = &onlyFilter{}
+		}
+		opts.only.components = components
+	}
+
+	// Without existing copies to compare, the upstream indexes aren't needed
+	if flagBool(cmd, "assume-clean") {
+		// A clean run rebuilds the whole state, which a limited run can't
+		if opts.only != nil {
+			return linkOptions{}, fmt.Errorf("--only can't be combined with --assume-clean")
+		}
+		opts.assumeClean = true
+		opts.dirs = make(map[string]bool)
+	} else {
+		opts.indexes = upstreamIndexes(cfg)
+		opts.synced = newSyncedCopies(cfg)
+	}
+	return opts, nil
+}
+
+// checkAssumeClean refuses --assume-clean over an overlay/ that still holds
+// managed files: copied over unchecked, a link into the upstream would have
+// its source overwritten
+func checkAssumeClean(state *config.State) error {
+	for _, mf := range state.ManagedFiles {
+		if mf.Pinned {
+			continue
+		}
+		dst := filepath.Join("overlay", mf.Path)
+		if _, err := os.Lstat(dst); err == nil {
+			return fmt.Errorf("--assume-clean needs an overlay/ without managed files, but %s exists; sync without it", dst)
+		}
+	}
+	return nil
+}
+
+// CreateLinks creates symlinks according to the configuration
+func CreateLinks(cmd *cobra.Command, cfg *config.Config) error {
+	opts, err := newLinkOptions(cmd, cfg)
 	if err != nil {
 		return err
 	}
 
 	// Load state
-	state, err := config.LoadState()
+	state, err := loadState(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to load state: %w", err)
 	}
 
-	// Track all created symlinks for gitignore
-	var createdLinks []string
-
-	for _, link := range cfg.Symlinks {
-		var pattern, targetBase string
-		if link.String != "" {
-			pattern = link.String
-			targetBase = link.String
-		} else {
-			pattern = link.From
-			targetBase = link.To
+	// Read-only copies are unlocked while they may be replaced. A clean run
+	// has none to replace and rebuilds the state, keeping only pinned files.
+	if opts.assumeClean {
+		if err := checkAssumeClean(state); err != nil {
+			return err
 		}
+		state.ManagedFiles = pinnedFiles(state.ManagedFiles)
+	} else if opts.only != nil {
+		unlockCopies(opts.only.filterFiles(state.ManagedFiles))
+	} else {
+		unlockCopies(state.ManagedFiles)
+	}
 
-		// Calculate source and target paths
-		from := filepath.Join(".upstream", pattern)
-		to := filepath.Join("overlay", targetBase)
+	// Track all created symlinks for gitignore
+	var createdLinks []string
 
-		// Check if source exists
-		info, err := os.Stat(from)
-		if err != nil {
-			return fmt.Errorf("source does not exist: %s", from)
-		}
+	// With --keep-going, failing specs are reported at the end instead of
+	// stopping the run
+	keepGoing := flagBool(cmd, "keep-going")
 
-		// Handle directories
-		if info.IsDir() {
-			// Walk the directory and create links for each file
-			err := filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					return err
-				}
+	specs, plan, failed, err := planRun(cmd, cfg, state, opts)
+	if err != nil {
+		return err
+	}
 
-				// Skip directories themselves
-				if info.IsDir() {
-					return nil
-				}
+	if err := preflightLinks(plan, opts); err != nil {
+		return err
+	}
 
-				// Calculate relative path from source base
-				relPath, err := filepath.Rel(from, path)
-				if err != nil {
-					return fmt.Errorf("failed to get relative path: %w", err)
-				}
+	if !opts.assumeClean {
+		if err := applyUpstreamDeletes(specs, plan, state, opts); err != nil {
+			return err
+		}
+	}
 
-				// Calculate target path preserving directory structure
-				targetPath := filepath.Join("overlay", targetBase, relPath)
+	// Copies stream on parallel workers; other modes are cheap enough one at a time
+	if opts.linkMode == "copy" {
+		opts.copies = newCopyQueue(copyWorkers)
+	}
 
-				return createLink(path, targetPath, linkMode, force, &createdLinks, state)
-			})
-			if err != nil {
-				return fmt.Errorf("failed to process directory %s: %w", pattern, err)
+	var stopped error
+	for _, p := range plan {
+		// An interrupt stops the run between links
+		if stopped = interrupted(); stopped != nil {
+			break
+		}
+		specOpts := opts
+		specOpts.upstream = p.upstream
+		specOpts.component = p.component
+		specOpts.preserve = p.preserve
+		if err := createLink(p.src, p.dst, specOpts, &createdLinks, state); err != nil {
+			if keepGoing {
+				failed = append(failed, &specError{spec: p.spec, err: err})
+				continue
 			}
-		} else {
-			// Handle single file
-			if err := createLink(from, to, linkMode, force, &createdLinks, state); err != nil {
-				return fmt.Errorf("failed to process file %s: %w", pattern, err)
+			if opts.copies != nil {
+				opts.copies.close()
+			}
+			return fmt.Errorf("failed to process %s: %w", p.spec, err)
+		}
+	}
+	if opts.copies != nil {
+		if err := opts.copies.close(); err != nil {
+			if !keepGoing {
+				return err
 			}
+			failed = append(failed, err)
+		}
+	}
+
+	// Record the links made so far, or by a run limited with --only; the
+	// gitignore covers every file in the state, since the rest of the
+	// earlier links are still in place. dirs:, generate: and meta_file are
+	// left for a full run.
+	if stopped != nil || opts.only != nil {
+		if err := updateGitignore(cfg, managedIgnores(state)); err != nil {
+			return fmt.Errorf("failed to update gitignore: %w", err)
+		}
+		if err := state.SaveState(); err != nil {
+			return fmt.Errorf("failed to save state: %w", err)
+		}
+		if err := recordSums(cfg, state, createdLinks); err != nil {
+			return fmt.Errorf("failed to record checksums: %w", err)
+		}
+		if stopped != nil {
+			return stopped
 		}
+		return keepGoingError(failed)
+	}
+
+	if err := createDirs(cfg, state, opts.owner, &createdLinks); err != nil {
+		return err
+	}
+
+	if err := generateFiles(cfg, state, opts, opts.syncedAt, &createdLinks); err != nil {
+		return err
+	}
+
+	if err := writeMetaFile(cfg, state, opts, opts.syncedAt, &createdLinks); err != nil {
+		return err
 	}
 
 	// Update gitignore with all created links
@@ -216,12 +643,16 @@ func CreateLinks(cmd *cobra.Command, cfg *config.Config) error {
 		return fmt.Errorf("failed to update gitignore: %w", err)
 	}
 
-	// Save state
+	// Save state, noting where .upstream pointed for these links
+	state.UpstreamDir = cfg.UpstreamDir
 	if err := state.SaveState(); err != nil {
 		return fmt.Errorf("failed to save state: %w", err)
 	}
+	if err := recordSums(cfg, state, createdLinks); err != nil {
+		return fmt.Errorf("failed to record checksums: %w", err)
+	}
 
-	return nil
+	return keepGoingError(failed)
 }
 
 // copyPath copies a file or directory from src to dst
@@ -237,7 +668,7 @@ func copyPath(src, dst string) error {
 	return copyFile(src, dst)
 }
 
-// copyFile copies a single file from src to dst
+// copyFile copies a single file from src to dst, streaming through a pooled buffer
 func copyFile(src, dst string) error {
 	srcFile, err := os.Open(src)
 	if err != nil {
@@ -251,47 +682,154 @@ func copyFile(src, dst string) error {
 	}
 	defer dstFile.Close()
 
-	if _, err := dstFile.ReadFrom(srcFile); err != nil {
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+
+	// Hide ReadFrom/WriteTo so the copy goes through the pooled buffer
+	if _, err := io.CopyBuffer(struct{ io.Writer }{dstFile}, struct{ io.Reader }{srcFile}, *buf); err != nil {
 		return err
 	}
 
-	srcInfo, err := os.Stat(src)
+	srcInfo, err := srcFile.Stat()
 	if err != nil {
 		return err
 	}
 	return os.Chmod(dst, srcInfo.Mode())
 }
 
-// copyDir recursively copies a directory from src to dst
+// copyDir recursively copies a directory from src to dst. Directories are
+// created first, then files are copied on parallel workers.
 func copyDir(src, dst string) error {
-	srcInfo, err := os.Stat(src)
+	var files [][2]string
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return os.MkdirAll(target, info.Mode())
+		}
+		files = append(files, [2]string{path, target})
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	if err := os.MkdirAll(dst, srcInfo.Mode()); err != nil {
-		return err
+	queue := newCopyQueue(copyWorkers)
+	for _, f := range files {
+		f := f
+		queue.add(f[1], func() error { return copyFile(f[0], f[1]) })
+	}
+	return queue.close()
+}
+
+// planRun works out every link of a run from the specs in use, without
+// touching overlay/. With --keep-going, specs that fail to expand are
+// returned in failed instead of stopping the plan.
+func planRun(cmd *cobra.Command, cfg *config.Config, state *config.State, opts linkOptions) ([]config.SymlinkSpec, []plannedLink, []error, error) {
+	// Link what the upstream publishes at the commit now checked out
+	if err := loadUpstreamSpecs(cfg, true); err != nil {
+		return nil, nil, nil, err
 	}
 
-	entries, err := os.ReadDir(src)
+	// Materialize specs after the specs they depend on
+	specs, err := orderSpecs(cfg.Symlinks)
 	if err != nil {
-		return err
+		return nil, nil, nil, err
 	}
 
-	for _, entry := range entries {
-		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
+	// Leave out specs for other platforms or whose when: doesn't hold
+	specs, err = applyConditions(cmd, cfg, specs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-		if entry.IsDir() {
-			if err := copyDir(srcPath, dstPath); err != nil {
-				return err
+	keepGoing := flagBool(cmd, "keep-going")
+	var failed []error
+
+	var plan []plannedLink
+	for _, link := range specs {
+		links, err := planSpec(link, cfg.UpstreamSymlinks)
+		if link.Optional && errors.Is(err, overlayerr.ErrSourceMissing) {
+			debugf(cmd, cfg, "skipping optional spec %s: %v", specSource(link), err)
+			continue
+		}
+		if errors.Is(err, overlayerr.ErrSourceMissing) {
+			if err = enforce(cfg.Policies.MissingSource, config.PolicyError, err); err == nil {
+				continue
 			}
-		} else {
-			if err := copyFile(srcPath, dstPath); err != nil {
-				return err
+		}
+		if err != nil {
+			if !keepGoing {
+				return nil, nil, nil, err
 			}
+			failed = append(failed, &specError{spec: specSource(link), err: err})
+			continue
 		}
+		plan = append(plan, links...)
 	}
 
-	return nil
+	plan, err = applyUpstreamSymlinks(plan, cfg.UpstreamSymlinks)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	plan, err = applyRenames(plan, cfg.Rename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	plan, err = applyContentTypes(plan, cfg.ContentTypes)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	plan = normalizeTargets(plan, cfg.UnicodeNormalization)
+
+	plan, err = applyWindowsPaths(plan, cfg.WindowsPaths)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	plan, err = resolveCaseCollisions(plan, cfg.CaseCollisions)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	plan, err = applyBlockedPaths(plan, cfg.BlockedPaths, cfg.Policies.BlockedPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	plan, err = applyMaxFileSize(plan, cfg.Limits.MaxFileSize, cfg.Policies.BigFile)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := checkLimits(plan, cfg.Limits); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := scanSecrets(plan, cfg.SecretScan); err != nil {
+		return nil, nil, nil, err
+	}
+
+	plan = skipPinned(plan, state)
+
+	if opts.only != nil {
+		if plan, err = opts.only.filterPlan(plan); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return specs, plan, failed, nil
 }
@@ -3,7 +3,10 @@ package cmd
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/rjocoleman/git-overlay/internal/config"
 	"github.com/spf13/cobra"
@@ -202,3 +205,200 @@ func TestCreateLinks(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateGitignoreUnchanged(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.WriteFile(".gitignore", []byte("node_modules/\n"), 0644); err != nil {
+		t.Fatalf("Failed to create .gitignore: %v", err)
+	}
+
+	cfg := &config.Config{}
+	links := []string{"overlay/b.txt", "overlay/a.txt", "overlay/b.txt"}
+	if err := updateGitignore(cfg, links); err != nil {
+		t.Fatalf("updateGitignore() error = %v", err)
+	}
+
+	data, err := os.ReadFile(".gitignore")
+	if err != nil {
+		t.Fatalf("Failed to read .gitignore: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "node_modules/\n") {
+		t.Errorf("user entries were not kept:\n%s", data)
+	}
+	if strings.Count(string(data), "overlay/b.txt") != 1 {
+		t.Errorf("duplicate links were not merged:\n%s", data)
+	}
+	if strings.Index(string(data), "overlay/a.txt") > strings.Index(string(data), "overlay/b.txt") {
+		t.Errorf("links are not sorted:\n%s", data)
+	}
+
+	// The same links in another order leave the file untouched
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(".gitignore", past, past); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+	if err := updateGitignore(cfg, []string{"overlay/a.txt", "overlay/b.txt"}); err != nil {
+		t.Fatalf("updateGitignore() error = %v", err)
+	}
+	info, err := os.Stat(".gitignore")
+	if err != nil {
+		t.Fatalf("Failed to stat .gitignore: %v", err)
+	}
+	if !info.ModTime().Equal(past) {
+		t.Errorf(".gitignore was rewritten without changes")
+	}
+}
+
+func TestOverlayRelPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: filepath.Join("overlay", "docs", "a.md"), want: "docs/a.md"},
+		{path: "overlay/docs/a.md", want: "docs/a.md"},
+		{path: "docs/a.md", want: "docs/a.md"},
+		{path: "overlay/docs/", want: "docs"},
+		{path: "./overlay/VERSION", want: "VERSION"},
+	}
+	for _, tt := range tests {
+		if got := overlayRelPath(tt.path); got != tt.want {
+			t.Errorf("overlayRelPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCreateLinksAssumeClean(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	for _, name := range []string{"a.txt", "dir/b.txt", "dir/c.txt", "pinned.txt"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(".upstream", name)), 0755); err != nil {
+			t.Fatalf("Failed to create upstream directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(".upstream", name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create source file: %v", err)
+		}
+	}
+
+	// A committed checkout: a pinned copy and a state naming a file no spec links anymore
+	if err := os.MkdirAll("overlay", 0755); err != nil {
+		t.Fatalf("Failed to create overlay: %v", err)
+	}
+	if err := os.WriteFile("overlay/pinned.txt", []byte("local"), 0644); err != nil {
+		t.Fatalf("Failed to create pinned file: %v", err)
+	}
+	state := &config.State{}
+	state.AddManagedFile("pinned.txt", "copy", "pinned.txt")
+	state.SetPinned("pinned.txt", true)
+	state.AddManagedFile("stale.txt", "symlink", "stale.txt")
+	if err := state.SaveState(); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	cfg := &config.Config{
+		Symlinks: []config.SymlinkSpec{{String: "a.txt"}, {String: "dir/b.txt"}, {String: "dir/c.txt"}, {String: "pinned.txt"}},
+	}
+	cmd := &cobra.Command{}
+	cmd.Flags().String("link-mode", "symlink", "")
+	cmd.Flags().Bool("force", false, "")
+	cmd.Flags().Bool("assume-clean", true, "")
+
+	if err := CreateLinks(cmd, cfg); err != nil {
+		t.Fatalf("CreateLinks() error = %v", err)
+	}
+	for _, path := range []string{"overlay/a.txt", "overlay/dir/b.txt", "overlay/dir/c.txt"} {
+		if info, err := os.Lstat(path); err != nil || info.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("%s was not linked: %v", path, err)
+		}
+	}
+	if data, _ := os.ReadFile("overlay/pinned.txt"); string(data) != "local" {
+		t.Errorf("pinned file was replaced: %q", data)
+	}
+
+	state, err = config.LoadState()
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	var paths []string
+	for _, mf := range state.ManagedFiles {
+		paths = append(paths, mf.Path)
+	}
+	if want := []string{"a.txt", "dir/b.txt", "dir/c.txt", "pinned.txt"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("state paths = %v, want %v", paths, want)
+	}
+	if !state.IsPinned("pinned.txt") {
+		t.Error("pinned.txt is no longer pinned")
+	}
+
+	// The links are managed files now, so another clean run is refused even with --force
+	cmd.Flags().Set("force", "true")
+	if err := CreateLinks(cmd, cfg); err == nil {
+		t.Error("CreateLinks() over existing links succeeded, want an error")
+	}
+	cmd.Flags().Set("assume-clean", "false")
+	if err := CreateLinks(cmd, cfg); err != nil {
+		t.Errorf("CreateLinks() without assume-clean error = %v", err)
+	}
+}
+
+func TestCreateLinksAssumeCleanOverLinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream", 0755); err != nil {
+		t.Fatalf("Failed to create upstream directory: %v", err)
+	}
+	if err := os.WriteFile(".upstream/a.txt", []byte("upstream"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	cfg := &config.Config{Symlinks: []config.SymlinkSpec{{String: "a.txt"}}}
+	cmd := &cobra.Command{}
+	cmd.Flags().String("link-mode", "symlink", "")
+	cmd.Flags().Bool("force", false, "")
+	cmd.Flags().Bool("assume-clean", false, "")
+	if err := CreateLinks(cmd, cfg); err != nil {
+		t.Fatalf("CreateLinks() error = %v", err)
+	}
+
+	// A copy through the existing symlink would truncate the upstream source
+	cmd.Flags().Set("link-mode", "copy")
+	cmd.Flags().Set("assume-clean", "true")
+	if err := CreateLinks(cmd, cfg); err == nil {
+		t.Error("CreateLinks() with --assume-clean over a linked overlay succeeded, want an error")
+	}
+	if data, err := os.ReadFile(".upstream/a.txt"); err != nil || string(data) != "upstream" {
+		t.Errorf(".upstream/a.txt = %q, %v, want it untouched", data, err)
+	}
+	if info, err := os.Lstat("overlay/a.txt"); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("overlay/a.txt is no longer the symlink: %v", err)
+	}
+}
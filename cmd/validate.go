@@ -2,15 +2,21 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
 )
 
+// maxSymlinkHops bounds how many symlinks resolvePath follows, like ELOOP
+const maxSymlinkHops = 40
+
 // validatePath ensures a path does not escape its parent directory
 func validatePath(base, path string) error {
 	// Check if path is absolute
 	if filepath.IsAbs(path) {
-		return fmt.Errorf("absolute paths are not allowed: %s", path)
+		return fmt.Errorf("%w: %s", overlayerr.ErrAbsolutePath, path)
 	}
 
 	// Clean paths to normalize them
@@ -25,8 +31,54 @@ func validatePath(base, path string) error {
 
 	// Check if the path tries to escape using ../
 	if strings.HasPrefix(rel, "..") || strings.Contains(path, "../") {
-		return fmt.Errorf("path attempts to escape base directory: %s", path)
+		return fmt.Errorf("%w: %s", overlayerr.ErrPathEscape, path)
 	}
 
 	return nil
 }
+
+// resolvePath returns the absolute path that path finally refers to once
+// every symlink is followed. Unlike filepath.EvalSymlinks it also resolves
+// dangling links, so where they would point can still be checked.
+func resolvePath(path string) (string, error) {
+	for hops := 0; hops <= maxSymlinkHops; hops++ {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Abs(resolved)
+		}
+
+		// Resolve the parent, then follow the final component by hand
+		dir, err := resolvePath(filepath.Dir(path))
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(dir, filepath.Base(path))
+		target, err := os.Readlink(path)
+		if err != nil {
+			// Not a symlink, so nothing further to follow
+			return path, nil
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(dir, target)
+		}
+		path = filepath.Clean(target)
+	}
+	return "", fmt.Errorf("too many levels of symbolic links: %s", path)
+}
+
+// validateWithin ensures path, with every symlink resolved, stays inside root
+func validateWithin(root, path string) error {
+	rootReal, err := resolvePath(root)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", root, err)
+	}
+	target, err := resolvePath(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+
+	rel, err := filepath.Rel(rootReal, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s resolves to %s, outside %s", path, target, root)
+	}
+	return nil
+}
@@ -1,6 +1,10 @@
 package cmd
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func TestValidatePath(t *testing.T) {
 	tests := []struct {
@@ -68,3 +72,65 @@ func TestValidatePath(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateWithin(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "upstream")
+	outside := filepath.Join(tmpDir, "outside")
+
+	for _, dir := range []string{filepath.Join(root, "dir"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "dir", "file.txt"), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	links := map[string]string{
+		"inside":       "dir/file.txt",
+		"inside-dir":   "dir",
+		"absolute":     filepath.Join(outside, "secret"),
+		"relative":     "../outside/secret",
+		"escape-dir":   outside,
+		"dangling-out": "../outside/missing",
+		"dangling-in":  "dir/missing",
+		"chain":        "relative",
+		"loop-a":       "loop-b",
+		"loop-b":       "loop-a",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatalf("Failed to create symlink %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		path      string
+		wantError bool
+	}{
+		{path: "dir/file.txt"},
+		{path: "inside"},
+		{path: "inside-dir/file.txt"},
+		{path: "dangling-in"},
+		{path: "not-there-yet/file.txt"},
+		{path: "absolute", wantError: true},
+		{path: "relative", wantError: true},
+		{path: "escape-dir/secret", wantError: true},
+		{path: "dangling-out", wantError: true},
+		{path: "chain", wantError: true},
+		{path: "loop-a", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			err := validateWithin(root, filepath.Join(root, tt.path))
+			if (err != nil) != tt.wantError {
+				t.Errorf("validateWithin() error = %v, wantError %v", err, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxWalkDepth bounds how deep walks of the upstream and overlay/ descend
+const maxWalkDepth = 64
+
+// walkFiles calls fn for every non-directory under root in lexical order.
+// Symlinked directories are followed when they resolve inside within, so a
+// directory linked elsewhere in the upstream is expanded like a real one;
+// with an empty within they are passed to fn like files.
+// Symlink loops and trees deeper than maxWalkDepth are skipped with a warning
+// instead of recursing forever.
+func walkFiles(root, within string, fn func(path string) error) error {
+	var withinReal string
+	if within != "" {
+		var err error
+		if withinReal, err = filepath.EvalSymlinks(within); err != nil {
+			return err
+		}
+	}
+
+	var visit func(dir string, depth int, ancestors []os.FileInfo) error
+	visit = func(dir string, depth int, ancestors []os.FileInfo) error {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		for _, a := range ancestors {
+			if os.SameFile(a, info) {
+				fmt.Fprintf(os.Stderr, "Warning: skipping symlink loop at %s\n", dir)
+				return nil
+			}
+		}
+		if depth > maxWalkDepth {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s, more than %d directories deep\n", dir, maxWalkDepth)
+			return nil
+		}
+		ancestors = append(ancestors, info)
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			isDir := entry.IsDir()
+			if entry.Type()&os.ModeSymlink != 0 {
+				isDir = withinReal != "" && symlinkedDirWithin(path, withinReal)
+			}
+			if isDir {
+				if err := visit(path, depth+1, ancestors); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := fn(path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return visit(root, 0, nil)
+}
+
+// symlinkedDirWithin reports whether path is a symlink to a directory inside withinReal
+func symlinkedDirWithin(path, withinReal string) bool {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(target)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	rel, err := filepath.Rel(withinReal, target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// overlayDepth returns how many directories deep path is below overlay/
+func overlayDepth(path string) int {
+	rel, err := filepath.Rel("overlay", path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
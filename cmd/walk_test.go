@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWalkFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	upstream := filepath.Join(tmpDir, "upstream")
+	outside := filepath.Join(tmpDir, "outside")
+
+	for _, dir := range []string{filepath.Join(upstream, "a", "b"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	for _, file := range []string{filepath.Join(upstream, "a", "b", "f.txt"), filepath.Join(outside, "secret.txt")} {
+		if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", file, err)
+		}
+	}
+	links := map[string]string{
+		filepath.Join(upstream, "a", "b", "loop"): "..",          // Loops back to a
+		filepath.Join(upstream, "linked"):         "a/b",         // Directory inside the upstream
+		filepath.Join(upstream, "escape"):         outside,       // Directory outside the upstream
+		filepath.Join(upstream, "dangling"):       "nonexistent", // Broken link
+	}
+	for path, target := range links {
+		if err := os.Symlink(target, path); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+	}
+
+	var got []string
+	err := walkFiles(upstream, upstream, func(path string) error {
+		rel, _ := filepath.Rel(upstream, path)
+		got = append(got, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walkFiles() error = %v", err)
+	}
+
+	want := []string{
+		"a/b/f.txt",
+		"dangling",
+		"escape",
+		"linked/f.txt",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("walkFiles() = %v, want %v", got, want)
+	}
+}
+
+func TestWalkFilesDepthLimit(t *testing.T) {
+	root := t.TempDir()
+	deep := filepath.Join(root, strings.Repeat("d/", maxWalkDepth+1))
+	if err := os.MkdirAll(deep, 0755); err != nil {
+		t.Fatalf("Failed to create deep tree: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(deep, "too-deep.txt"), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "top.txt"), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	var got []string
+	if err := walkFiles(root, root, func(path string) error {
+		got = append(got, filepath.Base(path))
+		return nil
+	}); err != nil {
+		t.Fatalf("walkFiles() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{"top.txt"}) {
+		t.Errorf("walkFiles() = %v, want only top.txt", got)
+	}
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// watcher polls the upstream and acts once each time its tracked ref moves
+type watcher struct {
+	d        *daemon
+	autoSync bool
+	notify   func(message string)
+	seen     string // Latest upstream version already acted on
+}
+
+// poll fetches the upstream and, when the remote has moved to a version not
+// seen before, syncs or notifies. A version is acted on once, so a declined
+// update isn't announced again until the upstream moves further, but a
+// failed sync is tried again at the next poll.
+func (w *watcher) poll() error {
+	w.d.fetch()
+	w.d.mu.Lock()
+	report := w.d.report
+	w.d.mu.Unlock()
+	// fetch has already warned about a failure
+	if report == nil {
+		return nil
+	}
+	if !report.Outdated || report.Comparison.Latest == w.seen {
+		return nil
+	}
+
+	latest := shortID(report.Comparison.Latest)
+	if report.Comparison.LatestTag != "" {
+		latest = report.Comparison.LatestTag
+	}
+	if !w.autoSync {
+		w.notify(fmt.Sprintf("upstream %s moved to %s (%s checked out); run 'git-overlay sync' to update", report.Ref, latest, shortID(report.Comparison.Current)))
+		w.seen = report.Comparison.Latest
+		return nil
+	}
+	fmt.Printf("Upstream %s moved to %s, syncing\n", report.Ref, latest)
+	if err := w.d.sync(); err != nil {
+		return fmt.Errorf("failed to sync: %w", err)
+	}
+	w.seen = report.Comparison.Latest
+	fmt.Println("Sync complete")
+	return nil
+}
+
+// notifyTerminal rings the terminal bell with the message on stderr
+func notifyTerminal(message string) {
+	fmt.Fprintf(os.Stderr, "\a%s %s\n", time.Now().Format(time.TimeOnly), message)
+}
+
+// notifyDesktop shows the message as a desktop notification where a notifier
+// is available, as well as in the terminal
+func notifyDesktop(message string) {
+	notifyTerminal(message)
+	var notifier *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		notifier = exec.Command("osascript", "-e", fmt.Sprintf("display notification %q with title \"git-overlay\"", message))
+	default:
+		if _, err := exec.LookPath("notify-send"); err == nil {
+			notifier = exec.Command("notify-send", "git-overlay", message)
+		}
+	}
+	if notifier == nil {
+		return
+	}
+	if err := notifier.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to show desktop notification: %v\n", err)
+	}
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Poll the upstream and sync or notify when its branch moves",
+	Long: `Run in the foreground, fetching the upstream every --poll. When the tracked
+branch moves past the checked out commit, either sync and relink overlay/
+(--auto-sync, or watch_auto_sync in the user settings) or ring the terminal
+bell with a note that a newer upstream is available. With --desktop the note is
+also shown as a desktop notification (notify-send on Linux and the BSDs,
+osascript on macOS).
+
+Each new upstream version is acted on once. A failed fetch or sync is reported
+and retried at the next poll.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := loadConfig(cmd); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if err := applyTransportOptions(cmd); err != nil {
+			return err
+		}
+
+		poll, err := cmd.Flags().GetDuration("poll")
+		if err != nil {
+			return err
+		}
+		if poll <= 0 {
+			return fmt.Errorf("--poll must be positive, got %s", poll)
+		}
+
+		w := &watcher{d: &daemon{cmd: cmd}, autoSync: userSettings().WatchAutoSync, notify: notifyTerminal}
+		if cmd.Flags().Changed("auto-sync") {
+			w.autoSync = flagBool(cmd, "auto-sync")
+		}
+		if flagBool(cmd, "desktop") {
+			w.notify = notifyDesktop
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		fmt.Printf("Watching the upstream every %s\n", poll)
+		ticker := time.NewTicker(poll)
+		defer ticker.Stop()
+		for {
+			if err := w.poll(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().Duration("poll", defaultDaemonInterval, "How often to fetch the upstream, e.g. 15m")
+	watchCmd.Flags().Bool("auto-sync", false, "Sync when the upstream moves instead of notifying (default from watch_auto_sync)")
+	watchCmd.Flags().Bool("desktop", false, "Also show a desktop notification when the upstream moves")
+	watchCmd.Flags().Bool("allow-dirty", false, "Let --auto-sync run with uncommitted changes under overlay/ or to the bookkeeping files")
+	addTransportFlags(watchCmd)
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestWatcherPoll(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script providers are not supported on windows")
+	}
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$1\" in\nresolve) echo \"$2\" ;;\nfetch) echo \"$2\" > \"$3/version.txt\" ;;\nesac\n"
+	if err := os.WriteFile(filepath.Join(binDir, "git-overlay-provider-fake"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write provider: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	tests := []struct {
+		name        string
+		autoSync    bool
+		wantNotices int
+		wantSynced  bool
+	}{
+		{name: "notify", wantNotices: 1},
+		{name: "auto-sync", autoSync: true, wantSynced: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.Chdir(t.TempDir()); err != nil {
+				t.Fatalf("Failed to change to temp directory: %v", err)
+			}
+			// The fake provider's latest version is always ahead of v1
+			configContent := `upstream:
+  type: fake
+  ref: v1
+link_mode: copy
+symlinks:
+  - version.txt
+`
+			if err := os.WriteFile(".git-overlay.yml", []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+
+			cmd := &cobra.Command{}
+			cmd.Flags().String("config", ".git-overlay.yml", "")
+			cmd.Flags().String("link-mode", "symlink", "")
+			cmd.Flags().Bool("force", false, "")
+
+			var notices []string
+			w := &watcher{d: &daemon{cmd: cmd}, autoSync: tt.autoSync, notify: func(message string) {
+				notices = append(notices, message)
+			}}
+			// The same upstream version is only acted on once
+			for i := 0; i < 2; i++ {
+				if err := w.poll(); err != nil {
+					t.Fatalf("poll() error = %v", err)
+				}
+			}
+
+			if len(notices) != tt.wantNotices {
+				t.Errorf("notices = %q, want %d", notices, tt.wantNotices)
+			}
+			_, err := os.Stat("overlay/version.txt")
+			if synced := err == nil; synced != tt.wantSynced {
+				t.Errorf("synced = %v, want %v", synced, tt.wantSynced)
+			}
+		})
+	}
+}
+
+func TestWatcherRetriesFailedSync(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script providers are not supported on windows")
+	}
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$1\" in\nresolve) echo \"$2\" ;;\nfetch) echo \"$2\" > \"$3/version.txt\" ;;\nesac\n"
+	if err := os.WriteFile(filepath.Join(binDir, "git-overlay-provider-fake"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write provider: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	configContent := `upstream:
+  type: fake
+  ref: v1
+link_mode: copy
+symlinks:
+  - version.txt
+`
+	if err := os.WriteFile(".git-overlay.yml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	// An unmanaged file at the target makes the sync stop without --force
+	if err := os.MkdirAll("overlay", 0755); err != nil {
+		t.Fatalf("Failed to create overlay: %v", err)
+	}
+	if err := os.WriteFile("overlay/version.txt", []byte("local"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("config", ".git-overlay.yml", "")
+	cmd.Flags().String("link-mode", "symlink", "")
+	cmd.Flags().Bool("force", false, "")
+	w := &watcher{d: &daemon{cmd: cmd}, autoSync: true, notify: func(string) {}}
+
+	if err := w.poll(); err == nil {
+		t.Fatal("poll() succeeded syncing over an existing file")
+	}
+	if w.seen != "" {
+		t.Errorf("seen = %q after a failed sync, want it unset", w.seen)
+	}
+
+	// The same upstream version is synced once the conflict is gone
+	if err := os.Remove("overlay/version.txt"); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if err := w.poll(); err != nil {
+		t.Fatalf("poll() retry error = %v", err)
+	}
+	if data, err := os.ReadFile("overlay/version.txt"); err != nil || string(data) == "local" {
+		t.Errorf("overlay/version.txt = %q (%v), want the synced upstream", data, err)
+	}
+}
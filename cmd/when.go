@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+	"golang.org/x/mod/semver"
+)
+
+// whenCond is a single condition of a when: expression
+type whenCond struct {
+	negate bool
+	path   string // Path checked by exists(), empty for ref comparisons
+	op     string // Comparison operator for ref
+	value  string // Ref compared against
+}
+
+// whenExpr is a parsed when: expression: any of the groups must hold, and
+// every condition within a group
+type whenExpr [][]whenCond
+
+// whenOps are the ref comparisons, two-character operators first
+var whenOps = []string{">=", "<=", "==", "!=", ">", "<"}
+
+// parseWhen parses expressions such as `ref >= v2.0`,
+// `exists(".upstream/new-layout")` and combinations with !, && and ||
+func parseWhen(expr string) (whenExpr, error) {
+	var parsed whenExpr
+	for _, alt := range strings.Split(expr, "||") {
+		var group []whenCond
+		for _, term := range strings.Split(alt, "&&") {
+			cond, err := parseWhenCond(strings.TrimSpace(term))
+			if err != nil {
+				return nil, fmt.Errorf("invalid when %q: %w", expr, err)
+			}
+			group = append(group, cond)
+		}
+		parsed = append(parsed, group)
+	}
+	return parsed, nil
+}
+
+// parseWhenCond parses one condition of a when: expression
+func parseWhenCond(term string) (whenCond, error) {
+	var cond whenCond
+	if rest, ok := strings.CutPrefix(term, "!"); ok {
+		cond.negate = true
+		term = strings.TrimSpace(rest)
+	}
+
+	if arg, ok := strings.CutPrefix(term, "exists("); ok {
+		arg, ok = strings.CutSuffix(arg, ")")
+		if !ok {
+			return cond, fmt.Errorf("unterminated exists(")
+		}
+		cond.path = unquoteWhen(arg)
+		if cond.path == "" {
+			return cond, fmt.Errorf("exists() needs a path")
+		}
+		return cond, nil
+	}
+
+	rest, ok := strings.CutPrefix(term, "ref")
+	if !ok {
+		return cond, fmt.Errorf("unknown condition %q, want ref <op> <version> or exists(path)", term)
+	}
+	rest = strings.TrimSpace(rest)
+	for _, op := range whenOps {
+		if value, ok := strings.CutPrefix(rest, op); ok {
+			cond.op = op
+			cond.value = unquoteWhen(value)
+			if cond.value == "" {
+				return cond, fmt.Errorf("ref %s needs a value", op)
+			}
+			return cond, nil
+		}
+	}
+	return cond, fmt.Errorf("unknown comparison in %q", term)
+}
+
+// unquoteWhen trims a value and removes the quotes around it, if any
+func unquoteWhen(s string) string {
+	s = strings.TrimSpace(s)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		return unquoted
+	}
+	return strings.Trim(s, `'`)
+}
+
+// eval reports whether the expression holds for the given upstream ref
+func (e whenExpr) eval(ref string) (bool, error) {
+	for _, group := range e {
+		holds := true
+		for _, cond := range group {
+			ok, err := cond.eval(ref)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				holds = false
+				break
+			}
+		}
+		if holds {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// eval reports whether a single condition holds for the given upstream ref
+func (c whenCond) eval(ref string) (bool, error) {
+	var ok bool
+	if c.path != "" {
+		_, err := os.Stat(c.path)
+		ok = err == nil
+	} else {
+		cmp, err := compareRefs(ref, c.value, c.op)
+		if err != nil {
+			return false, err
+		}
+		ok = cmp
+	}
+	return ok != c.negate, nil
+}
+
+// compareRefs compares refs as semantic versions, with an optional leading
+// v. Branches and other refs can only be compared with == and !=.
+func compareRefs(ref, value, op string) (bool, error) {
+	a, b := semverRef(ref), semverRef(value)
+	if !semver.IsValid(a) || !semver.IsValid(b) {
+		switch op {
+		case "==":
+			return ref == value, nil
+		case "!=":
+			return ref != value, nil
+		}
+		return false, fmt.Errorf("ref %s %s %s: both refs must be semantic versions", ref, op, value)
+	}
+
+	cmp := semver.Compare(a, b)
+	switch op {
+	case ">=":
+		return cmp >= 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "!=":
+		return cmp != 0, nil
+	}
+	return cmp == 0, nil
+}
+
+// semverRef adds the v prefix semver expects to refs like 2.0.1
+func semverRef(ref string) string {
+	if strings.HasPrefix(ref, "v") {
+		return ref
+	}
+	return "v" + ref
+}
+
+// specRef returns the ref of the upstream a spec links from
+func specRef(cfg *config.Config, link config.SymlinkSpec) string {
+	for _, named := range cfg.Upstreams {
+		if named.Name == link.Upstream && link.Upstream != "" {
+			return named.Ref
+		}
+	}
+	return cfg.Upstream.Ref
+}
+
+// validatePlatforms checks that platforms: entries are os or os/arch
+func validatePlatforms(platforms []string) error {
+	for _, p := range platforms {
+		goos, goarch, _ := strings.Cut(p, "/")
+		if goos == "" || (strings.Contains(p, "/") && goarch == "") || strings.Count(p, "/") > 1 {
+			return fmt.Errorf("invalid platform %q, want os or os/arch such as linux/amd64", p)
+		}
+	}
+	return nil
+}
+
+// matchesPlatform reports whether the host is one of platforms, given as os
+// or os/arch. No platforms means every host.
+func matchesPlatform(platforms []string, goos, goarch string) bool {
+	if len(platforms) == 0 {
+		return true
+	}
+	for _, p := range platforms {
+		pOS, pArch, hasArch := strings.Cut(p, "/")
+		if pOS == goos && (!hasArch || pArch == goarch) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyConditions drops specs for other platforms and specs whose when:
+// condition doesn't hold at sync time
+func applyConditions(cmd *cobra.Command, cfg *config.Config, specs []config.SymlinkSpec) ([]config.SymlinkSpec, error) {
+	var kept []config.SymlinkSpec
+	for _, link := range specs {
+		if !matchesPlatform(link.Platforms, runtime.GOOS, runtime.GOARCH) {
+			debugf(cmd, cfg, "skipping spec %s: not for %s/%s", specSource(link), runtime.GOOS, runtime.GOARCH)
+			continue
+		}
+		if link.When == "" {
+			kept = append(kept, link)
+			continue
+		}
+		expr, err := parseWhen(link.When)
+		if err != nil {
+			return nil, fmt.Errorf("spec %s: %w", specSource(link), err)
+		}
+		ok, err := expr.eval(specRef(cfg, link))
+		if err != nil {
+			return nil, fmt.Errorf("spec %s: %w", specSource(link), err)
+		}
+		if !ok {
+			debugf(cmd, cfg, "skipping spec %s: when %q does not hold", specSource(link), link.When)
+			continue
+		}
+		kept = append(kept, link)
+	}
+	return kept, nil
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestWhen(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll(".upstream/new-layout", 0755); err != nil {
+		t.Fatalf("Failed to create upstream: %v", err)
+	}
+
+	tests := []struct {
+		expr     string
+		ref      string
+		want     bool
+		parseErr bool
+		evalErr  bool
+	}{
+		{expr: "ref >= v2.0", ref: "v2.1.0", want: true},
+		{expr: "ref >= v2.0", ref: "v1.9.3", want: false},
+		{expr: "ref < 2.0", ref: "1.9.3", want: true},
+		{expr: "ref == v2.0", ref: "v2.0.0", want: true},
+		{expr: "ref != main", ref: "main", want: false},
+		{expr: `ref == "main"`, ref: "main", want: true},
+		{expr: `exists(".upstream/new-layout")`, want: true},
+		{expr: `exists(".upstream/old-layout")`, want: false},
+		{expr: `!exists(".upstream/old-layout")`, want: true},
+		{expr: `ref >= v2 && exists(".upstream/old-layout")`, ref: "v2.0.0", want: false},
+		{expr: `ref >= v3 || exists(".upstream/new-layout")`, ref: "v2.0.0", want: true},
+		{expr: "ref >= v2.0", ref: "main", evalErr: true},
+		{expr: "version >= v2.0", parseErr: true},
+		{expr: "ref ~ v2.0", parseErr: true},
+		{expr: `exists(".upstream"`, parseErr: true},
+		{expr: "ref >=", parseErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := parseWhen(tt.expr)
+			if tt.parseErr {
+				if err == nil {
+					t.Errorf("parseWhen(%q) succeeded, want error", tt.expr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseWhen(%q) error = %v", tt.expr, err)
+			}
+			got, err := expr.eval(tt.ref)
+			if tt.evalErr {
+				if err == nil {
+					t.Errorf("eval(%q) succeeded, want error", tt.ref)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("eval(%q) error = %v", tt.ref, err)
+			}
+			if got != tt.want {
+				t.Errorf("%q with ref %q = %v, want %v", tt.expr, tt.ref, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyConditions(t *testing.T) {
+	cfg := &config.Config{
+		Upstream:  config.UpstreamConfig{Ref: "v1.4.0"},
+		Upstreams: []config.NamedUpstream{{Name: "docs", UpstreamConfig: config.UpstreamConfig{Ref: "v3.0.0"}}},
+	}
+	specs := []config.SymlinkSpec{
+		{String: "always"},
+		{From: "old", To: "config", When: "ref < v2.0"},
+		{From: "new", To: "config", When: "ref >= v2.0"},
+		{From: "guide", To: "guide", Upstream: "docs", When: "ref >= v2.0"},
+		{From: "units", To: "units", Platforms: []string{"plan9/mips"}},
+	}
+
+	kept, err := applyConditions(&cobra.Command{}, cfg, specs)
+	if err != nil {
+		t.Fatalf("applyConditions() error = %v", err)
+	}
+	var got []string
+	for _, link := range kept {
+		got = append(got, specSource(link))
+	}
+	want := []string{"always", "old", "guide"}
+	if len(got) != len(want) {
+		t.Fatalf("applyConditions() kept %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("applyConditions() kept %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestMatchesPlatform(t *testing.T) {
+	tests := []struct {
+		platforms []string
+		goos      string
+		goarch    string
+		want      bool
+	}{
+		{platforms: nil, goos: "linux", goarch: "amd64", want: true},
+		{platforms: []string{"linux/amd64", "darwin/arm64"}, goos: "darwin", goarch: "arm64", want: true},
+		{platforms: []string{"linux/amd64", "darwin/arm64"}, goos: "darwin", goarch: "amd64", want: false},
+		{platforms: []string{"linux"}, goos: "linux", goarch: "arm64", want: true},
+		{platforms: []string{"windows"}, goos: "linux", goarch: "amd64", want: false},
+	}
+	for _, tt := range tests {
+		if got := matchesPlatform(tt.platforms, tt.goos, tt.goarch); got != tt.want {
+			t.Errorf("matchesPlatform(%v, %s/%s) = %v, want %v", tt.platforms, tt.goos, tt.goarch, got, tt.want)
+		}
+	}
+
+	for _, p := range []string{"", "/amd64", "linux/", "linux/amd64/v2"} {
+		if err := validatePlatforms([]string{p}); err == nil {
+			t.Errorf("validatePlatforms(%q) succeeded, want error", p)
+		}
+	}
+	if err := validatePlatforms([]string{"linux", "darwin/arm64"}); err != nil {
+		t.Errorf("validatePlatforms() error = %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+// windowsReserved are device names Windows reserves with or without an extension
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// windowsInvalidChars can't appear in Windows file names
+const windowsInvalidChars = `<>:"|?*`
+
+// windowsNameProblem describes why a single path element is unusable on
+// Windows, or returns "" if it is fine
+func windowsNameProblem(name string) string {
+	stem := strings.ToUpper(strings.SplitN(name, ".", 2)[0])
+	if windowsReserved[strings.TrimRight(stem, " ")] {
+		return "reserved name"
+	}
+	if strings.ContainsAny(name, windowsInvalidChars) {
+		return "invalid character"
+	}
+	for _, r := range name {
+		if r < 32 {
+			return "control character"
+		}
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return "trailing dot or space"
+	}
+	return ""
+}
+
+// escapeWindowsName makes a path element usable on Windows: invalid characters
+// become %XX, reserved stems gain a trailing underscore and trailing dots and
+// spaces are percent-encoded
+func escapeWindowsName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 32 || strings.ContainsRune(windowsInvalidChars+"%", r) {
+			fmt.Fprintf(&b, "%%%02X", r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	name = b.String()
+
+	for strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		last := name[len(name)-1]
+		name = fmt.Sprintf("%s%%%02X", name[:len(name)-1], last)
+	}
+
+	stem, rest, hasExt := strings.Cut(name, ".")
+	if windowsReserved[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		name = stem + "_"
+		if hasExt {
+			name += "." + rest
+		}
+	}
+	return name
+}
+
+// applyWindowsPaths checks planned targets for names and lengths Windows
+// can't handle and applies the configured policy
+func applyWindowsPaths(plan []plannedLink, wp config.WindowsPathsConfig) ([]plannedLink, error) {
+	policy := wp.Policy
+	switch policy {
+	case "", config.WindowsPathsIgnore:
+		return plan, nil
+	case config.WindowsPathsError, config.WindowsPathsSkip, config.WindowsPathsEscape:
+	default:
+		return nil, fmt.Errorf("unsupported windows_paths.policy: %s", policy)
+	}
+	maxLength := wp.MaxLength
+	if maxLength == 0 {
+		maxLength = config.DefaultWindowsMaxPath
+	}
+
+	var kept []plannedLink
+	var problems []string
+	for _, p := range plan {
+		elems := strings.Split(filepath.ToSlash(p.dst), "/")
+		var reason string
+		for i, elem := range elems {
+			if problem := windowsNameProblem(elem); problem != "" {
+				if policy == config.WindowsPathsEscape {
+					elems[i] = escapeWindowsName(elem)
+					continue
+				}
+				reason = fmt.Sprintf("%s %q", problem, elem)
+				break
+			}
+		}
+		escaped := filepath.FromSlash(strings.Join(elems, "/"))
+		if reason == "" && utf8.RuneCountInString(filepath.ToSlash(escaped)) > maxLength {
+			reason = fmt.Sprintf("longer than %d characters", maxLength)
+		}
+
+		if reason == "" {
+			if escaped != p.dst {
+				fmt.Printf("Windows paths: linking %s as %s\n", p.dst, escaped)
+				p.dst = escaped
+			}
+			kept = append(kept, p)
+			continue
+		}
+
+		if policy == config.WindowsPathsError {
+			problems = append(problems, fmt.Sprintf("  %s: %s", p.dst, reason))
+			continue
+		}
+		// Paths that can't be escaped, such as long ones, are skipped
+		fmt.Printf("Windows paths: skipping %s (%s)\n", p.dst, reason)
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("targets are unusable on Windows (see windows_paths.policy):\n%s", strings.Join(problems, "\n"))
+	}
+	return kept, nil
+}
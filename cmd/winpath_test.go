@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+func TestEscapeWindowsName(t *testing.T) {
+	tests := map[string]string{
+		"CON":        "CON_",
+		"aux.h":      "aux_.h",
+		"nul.tar.gz": "nul_.tar.gz",
+		"what?.txt":  "what%3F.txt",
+		"trailing.":  "trailing%2E",
+		"console":    "console",
+	}
+	for name, want := range tests {
+		if got := escapeWindowsName(name); got != want {
+			t.Errorf("escapeWindowsName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestApplyWindowsPaths(t *testing.T) {
+	long := "overlay/" + strings.Repeat("a", 60) + ".txt"
+	newPlan := func() []plannedLink {
+		return []plannedLink{
+			{dst: "overlay/src/main.c"},
+			{dst: "overlay/aux/file.txt"},
+			{dst: "overlay/docs/CON.md"},
+			{dst: long},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		policy  string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "ignore",
+			policy: config.WindowsPathsIgnore,
+			want:   []string{"overlay/src/main.c", "overlay/aux/file.txt", "overlay/docs/CON.md", long},
+		},
+		{
+			name:   "skip",
+			policy: config.WindowsPathsSkip,
+			want:   []string{"overlay/src/main.c"},
+		},
+		{
+			name:   "escape",
+			policy: config.WindowsPathsEscape,
+			want:   []string{"overlay/src/main.c", "overlay/aux_/file.txt", "overlay/docs/CON_.md"},
+		},
+		{
+			name:    "error",
+			policy:  config.WindowsPathsError,
+			wantErr: `overlay/docs/CON.md: reserved name "CON.md"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyWindowsPaths(newPlan(), config.WindowsPathsConfig{Policy: tt.policy, MaxLength: 64})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyWindowsPaths() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyWindowsPaths() error = %v", err)
+			}
+			var dsts []string
+			for _, p := range got {
+				dsts = append(dsts, p.dst)
+			}
+			if strings.Join(dsts, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("applyWindowsPaths() = %v, want %v", dsts, tt.want)
+			}
+		})
+	}
+}
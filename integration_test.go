@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/rjocoleman/git-overlay/cmd"
 	"github.com/rjocoleman/git-overlay/internal/config"
@@ -19,7 +20,9 @@ func setupTestRepo(t *testing.T, path string) {
 	t.Helper()
 
 	// Initialize git repository
-	repo, err := git.PlainInit(path, false)
+	repo, err := git.PlainInitWithOptions(path, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName("main")},
+	})
 	if err != nil {
 		t.Fatalf("failed to initialize git repo: %v", err)
 	}
@@ -107,12 +110,12 @@ func TestEndToEnd(t *testing.T) {
 	}
 
 	// Add upstream submodule
-	if err := repo.AddUpstreamSubmodule(cfg.Upstream.URL); err != nil {
+	if err := repo.AddUpstreamSubmodule(cfg.Upstream.URL, igit.SubmoduleOptions{}); err != nil {
 		t.Fatalf("failed to add upstream submodule: %v", err)
 	}
 
 	// Sync to ref
-	if err := repo.SyncUpstream(cfg.Upstream.Ref); err != nil {
+	if err := repo.SyncUpstream(cfg.Upstream.Ref, false); err != nil {
 		t.Fatalf("failed to sync upstream: %v", err)
 	}
 
@@ -161,7 +164,7 @@ func TestEndToEnd(t *testing.T) {
 	}
 
 	// Sync changes first
-	if err := repo.SyncUpstream(cfg.Upstream.Ref); err != nil {
+	if err := repo.SyncUpstream(cfg.Upstream.Ref, false); err != nil {
 		t.Fatalf("failed to sync upstream: %v", err)
 	}
 
@@ -0,0 +1,359 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Extract unpacks a .zip, .tar, .tar.gz or .tgz archive into dest, dropping the
+// first strip path components of every entry (like tar --strip-components)
+func Extract(src, dest string, strip int) error {
+	name := strings.ToLower(src)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return extractZip(src, dest, strip)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", src, err)
+		}
+		defer gz.Close()
+		return ExtractTar(gz, dest, strip)
+	case strings.HasSuffix(name, ".tar"):
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return ExtractTar(f, dest, strip)
+	default:
+		return fmt.Errorf("unsupported archive format: %s", filepath.Base(src))
+	}
+}
+
+// ExtractTar unpacks an uncompressed tar stream into dest. Symlinks must
+// point inside dest, hard links must name a file extracted before them, and
+// nothing is written through a symlink, so a hostile archive can't reach
+// outside dest. Entries replace what an earlier entry put at the same path.
+func ExtractTar(r io.Reader, dest string, strip int) error {
+	return extractTar(r, dest, strip, false)
+}
+
+// ApplyLayer applies an OCI image layer to dest, which holds the layers
+// applied before it. Whiteout entries (.wh.<name>) delete name, opaque
+// whiteouts (.wh..wh..opq) empty their directory, and entries replace whatever
+// an earlier layer left at their path, directories included.
+func ApplyLayer(r io.Reader, dest string) error {
+	return extractTar(r, dest, 0, true)
+}
+
+// ExtractFile writes r to name under dest with the same checks as archive
+// entries, for blobs that aren't archives
+func ExtractFile(r io.Reader, dest, name string) error {
+	target, ok, err := entryPath(dest, name, 0)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("invalid file name %q", name)
+	}
+	if err := checkParents(dest, target); err != nil {
+		return err
+	}
+	if err := replace(target, false); err != nil {
+		return err
+	}
+	return writeFile(target, r, 0644)
+}
+
+// whiteoutPrefix marks OCI layer entries that delete a path
+const whiteoutPrefix = ".wh."
+
+// opaqueWhiteout marks a directory whose earlier content is hidden
+const opaqueWhiteout = ".wh..wh..opq"
+
+// whiteout applies a whiteout entry at target, reporting false for entries
+// that aren't whiteouts
+func whiteout(dest, target string) (bool, error) {
+	base := filepath.Base(target)
+	if !strings.HasPrefix(base, whiteoutPrefix) {
+		return false, nil
+	}
+	dir := filepath.Dir(target)
+	if err := checkParents(dest, target); err != nil {
+		return true, err
+	}
+	if base == opaqueWhiteout {
+		entries, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return true, err
+		}
+		for _, e := range entries {
+			if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+				return true, err
+			}
+		}
+		return true, nil
+	}
+	name := strings.TrimPrefix(base, whiteoutPrefix)
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return true, fmt.Errorf("invalid whiteout entry %s", target)
+	}
+	victim := filepath.Join(dir, name)
+	if r, err := filepath.Rel(dest, victim); err != nil || r == "." || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return true, fmt.Errorf("whiteout entry %s escapes the destination", target)
+	}
+	return true, os.RemoveAll(victim)
+}
+
+// extractTar unpacks a tar stream into dest, as an OCI layer when layer is set
+func extractTar(r io.Reader, dest string, strip int, layer bool) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar: %w", err)
+		}
+
+		target, ok, err := entryPath(dest, hdr.Name, strip)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := checkParents(dest, target); err != nil {
+			return err
+		}
+		if layer {
+			if ok, err := whiteout(dest, target); ok || err != nil {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if info, err := os.Lstat(target); err == nil && !info.IsDir() {
+				if err := os.Remove(target); err != nil {
+					return err
+				}
+			}
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := checkLinkTarget(dest, target, hdr.Linkname); err != nil {
+				return err
+			}
+			if err := replace(target, layer); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			src, ok, err := entryPath(dest, hdr.Linkname, strip)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("archive hard link %s points at a stripped entry %s", hdr.Name, hdr.Linkname)
+			}
+			if err := checkParents(dest, src); err != nil {
+				return err
+			}
+			if info, err := os.Lstat(src); err != nil || !info.Mode().IsRegular() {
+				return fmt.Errorf("archive hard link %s must point at a file extracted before it, not %s", hdr.Name, hdr.Linkname)
+			}
+			if err := replace(target, layer); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Link(src, target); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := replace(target, layer); err != nil {
+				return err
+			}
+			if err := writeFile(target, tr, os.FileMode(hdr.Mode).Perm()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// extractZip unpacks a zip file into dest
+func extractZip(src, dest string, strip int) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", src, err)
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		target, ok, err := entryPath(dest, f.Name, strip)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		if err := checkParents(dest, target); err != nil {
+			return err
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := replace(target, false); err != nil {
+			return err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(target, rc, f.Mode().Perm())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryPath maps an archive entry name to a path under dest. It reports false
+// for entries consumed entirely by strip, and rejects entries escaping dest.
+func entryPath(dest, name string, strip int) (string, bool, error) {
+	name = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	parts := strings.Split(name, "/")
+	if len(parts) <= strip || name == "" {
+		return "", false, nil
+	}
+	rel := path.Join(parts[strip:]...)
+
+	target := filepath.Join(dest, filepath.FromSlash(rel))
+	if r, err := filepath.Rel(dest, target); err != nil || strings.HasPrefix(r, "..") {
+		return "", false, fmt.Errorf("archive entry escapes destination: %s", name)
+	}
+	return target, true, nil
+}
+
+// checkParents makes sure no directory between dest and target is a symlink
+// or a file, so writing target can't be redirected outside dest
+func checkParents(dest, target string) error {
+	rel, err := filepath.Rel(dest, filepath.Dir(target))
+	if err != nil || rel == "." {
+		return err
+	}
+	dir := dest
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("archive entry %s would be written through %s, which is not a directory", target, dir)
+		}
+	}
+	return nil
+}
+
+// checkLinkTarget rejects symlink targets that are absolute or lead outside
+// dest from the link at target. A .. is only allowed before the target's other
+// components: after one it would climb out of whatever that component is when
+// the link is followed, which may be a symlink extracted before or after this
+// one, so checking the text alone couldn't keep chained links inside dest.
+func checkLinkTarget(dest, target, linkname string) error {
+	if filepath.IsAbs(linkname) || path.IsAbs(filepath.ToSlash(linkname)) {
+		return fmt.Errorf("archive symlink %s has an absolute target %s", target, linkname)
+	}
+	named := false
+	for _, part := range strings.Split(filepath.ToSlash(linkname), "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if named {
+				return fmt.Errorf("archive symlink %s climbs back out of a path component: %s", target, linkname)
+			}
+		default:
+			named = true
+		}
+	}
+	resolved := filepath.Join(filepath.Dir(target), filepath.FromSlash(linkname))
+	if r, err := filepath.Rel(dest, resolved); err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("archive symlink %s points outside the destination: %s", target, linkname)
+	}
+	return nil
+}
+
+// replace removes a file or symlink left at target by an earlier entry, so
+// the new entry is never written through it. A directory is only replaced
+// when dirs is set, as a later image layer may do.
+func replace(target string, dirs bool) error {
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if !dirs {
+			return fmt.Errorf("archive entry %s replaces a directory", target)
+		}
+		return os.RemoveAll(target)
+	}
+	return os.Remove(target)
+}
+
+// writeFile writes r to a new file at path, creating parent directories
+func writeFile(path string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if mode == 0 {
+		mode = 0644
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
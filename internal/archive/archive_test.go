@@ -0,0 +1,236 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractTar(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	files := map[string]string{
+		"sdk-1.0/README.md":     "readme",
+		"sdk-1.0/src/client.go": "package sdk",
+	}
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+
+	dest := t.TempDir()
+	if err := ExtractTar(bytes.NewReader(buf.Bytes()), dest, 1); err != nil {
+		t.Fatalf("ExtractTar() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dest, "src", "client.go"))
+	if err != nil || string(data) != "package sdk" {
+		t.Errorf("Extracted content = %q, %v", string(data), err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "sdk-1.0")); !os.IsNotExist(err) {
+		t.Error("Leading component was not stripped")
+	}
+}
+
+func TestEntryPath(t *testing.T) {
+	dest := "/tmp/dest"
+
+	if _, ok, err := entryPath(dest, "top/", 1); ok || err != nil {
+		t.Errorf("entryPath() for stripped entry = %v, %v", ok, err)
+	}
+
+	// Parent references are clamped to the archive root rather than escaping
+	got, ok, err := entryPath(dest, "../../etc/passwd", 0)
+	if err != nil || !ok || got != filepath.Join(dest, "etc", "passwd") {
+		t.Errorf("entryPath() = %q, %v, %v", got, ok, err)
+	}
+}
+
+// tarball builds a tar stream from headers, giving regular files their
+// content from body
+func tarball(t *testing.T, entries []tar.Header, body map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range entries {
+		hdr := hdr
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(body[hdr.Name]))
+			hdr.Mode = 0644
+		}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatalf("Failed to write header %s: %v", hdr.Name, err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			tw.Write([]byte(body[hdr.Name]))
+		}
+	}
+	tw.Close()
+	return buf.Bytes()
+}
+
+func TestExtractTarHostile(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tar.Header
+	}{
+		{
+			name: "absolute symlink then write through it",
+			entries: []tar.Header{
+				{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: "OUTSIDE"},
+				{Name: "evil/pwned.txt", Typeflag: tar.TypeReg},
+			},
+		},
+		{
+			name: "escaping symlink",
+			entries: []tar.Header{
+				{Name: "a/evil", Typeflag: tar.TypeSymlink, Linkname: "../../outside"},
+			},
+		},
+		{
+			name: "symlink chained through another symlink",
+			entries: []tar.Header{
+				{Name: "sub/l1", Typeflag: tar.TypeSymlink, Linkname: ".."},
+				{Name: "l2", Typeflag: tar.TypeSymlink, Linkname: "sub/l1/.."},
+			},
+		},
+		{
+			name: "symlink chained through a later symlink",
+			entries: []tar.Header{
+				{Name: "sub/", Typeflag: tar.TypeDir},
+				{Name: "l2", Typeflag: tar.TypeSymlink, Linkname: "sub/l1/.."},
+				{Name: "sub/l1", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			},
+		},
+		{
+			name: "hard link to a file outside",
+			entries: []tar.Header{
+				{Name: "evil", Typeflag: tar.TypeLink, Linkname: "OUTSIDE/secret.txt"},
+			},
+		},
+		{
+			name: "hard link to nothing extracted",
+			entries: []tar.Header{
+				{Name: "evil", Typeflag: tar.TypeLink, Linkname: "missing.txt"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outside := t.TempDir()
+			if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+			for i := range tt.entries {
+				tt.entries[i].Linkname = strings.ReplaceAll(tt.entries[i].Linkname, "OUTSIDE", outside)
+			}
+
+			dest := t.TempDir()
+			if err := ExtractTar(bytes.NewReader(tarball(t, tt.entries, nil)), dest, 0); err == nil {
+				t.Error("ExtractTar() accepted a hostile archive")
+			}
+			if _, err := os.Stat(filepath.Join(outside, "pwned.txt")); !os.IsNotExist(err) {
+				t.Error("ExtractTar() wrote outside the destination")
+			}
+			if target, err := filepath.EvalSymlinks(filepath.Join(dest, "l2")); err == nil && !strings.HasPrefix(target, dest) {
+				t.Errorf("l2 resolves outside the destination to %s", target)
+			}
+		})
+	}
+}
+
+func TestExtractTarLinks(t *testing.T) {
+	entries := []tar.Header{
+		{Name: "lib/v1.txt", Typeflag: tar.TypeReg},
+		{Name: "lib/current.txt", Typeflag: tar.TypeSymlink, Linkname: "v1.txt"},
+		{Name: "bin/v1.txt", Typeflag: tar.TypeSymlink, Linkname: "../lib/./v1.txt"},
+		{Name: "copy.txt", Typeflag: tar.TypeLink, Linkname: "lib/v1.txt"},
+		// A later entry replaces the symlink rather than writing through it
+		{Name: "lib/current.txt", Typeflag: tar.TypeReg},
+	}
+	body := map[string]string{"lib/v1.txt": "v1", "lib/current.txt": "current"}
+
+	dest := t.TempDir()
+	if err := ExtractTar(bytes.NewReader(tarball(t, entries, body)), dest, 0); err != nil {
+		t.Fatalf("ExtractTar() error = %v", err)
+	}
+	for name, want := range map[string]string{"lib/v1.txt": "v1", "lib/current.txt": "current", "copy.txt": "v1", "bin/v1.txt": "v1"} {
+		data, err := os.ReadFile(filepath.Join(dest, name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, want %q", name, data, err, want)
+		}
+	}
+}
+
+func TestApplyLayer(t *testing.T) {
+	dest := t.TempDir()
+	base := []tar.Header{
+		{Name: "etc/", Typeflag: tar.TypeDir},
+		{Name: "etc/old.conf", Typeflag: tar.TypeReg},
+		{Name: "etc/keep.conf", Typeflag: tar.TypeReg},
+		{Name: "cache/", Typeflag: tar.TypeDir},
+		{Name: "cache/a", Typeflag: tar.TypeReg},
+		{Name: "bin/tool", Typeflag: tar.TypeSymlink, Linkname: "tool-1"},
+		{Name: "data", Typeflag: tar.TypeReg},
+	}
+	top := []tar.Header{
+		{Name: "etc/.wh.old.conf", Typeflag: tar.TypeReg},
+		{Name: "cache/.wh..wh..opq", Typeflag: tar.TypeReg},
+		{Name: "cache/b", Typeflag: tar.TypeReg},
+		{Name: "bin/tool", Typeflag: tar.TypeSymlink, Linkname: "tool-2"},
+		{Name: "data/", Typeflag: tar.TypeDir},
+		{Name: "data/file", Typeflag: tar.TypeReg},
+	}
+	for _, layer := range [][]tar.Header{base, top} {
+		if err := ApplyLayer(bytes.NewReader(tarball(t, layer, nil)), dest); err != nil {
+			t.Fatalf("ApplyLayer() error = %v", err)
+		}
+	}
+
+	for _, gone := range []string{"etc/old.conf", "etc/.wh.old.conf", "cache/a", "cache/.wh..wh..opq"} {
+		if _, err := os.Lstat(filepath.Join(dest, gone)); !os.IsNotExist(err) {
+			t.Errorf("%s exists after the whiteout layer", gone)
+		}
+	}
+	for _, kept := range []string{"etc/keep.conf", "cache/b", "data/file"} {
+		if _, err := os.Lstat(filepath.Join(dest, kept)); err != nil {
+			t.Errorf("%s missing: %v", kept, err)
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(dest, "bin/tool")); err != nil || target != "tool-2" {
+		t.Errorf("bin/tool -> %q, %v, want tool-2", target, err)
+	}
+
+	// Whiteouts can't reach through a symlink either
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "victim"), nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dest, "escape")); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	hostile := []tar.Header{{Name: "escape/.wh.victim", Typeflag: tar.TypeReg}}
+	if err := ApplyLayer(bytes.NewReader(tarball(t, hostile, nil)), dest); err == nil {
+		t.Error("ApplyLayer() applied a whiteout through a symlink")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "victim")); err != nil {
+		t.Errorf("Whiteout removed a file outside the destination: %v", err)
+	}
+
+	// Nor can a whiteout name the destination or its parent
+	for _, name := range []string{".wh..", ".wh...", ".wh.", "sub/.wh..."} {
+		if err := ApplyLayer(bytes.NewReader(tarball(t, []tar.Header{{Name: name, Typeflag: tar.TypeReg}}, nil)), dest); err == nil {
+			t.Errorf("ApplyLayer() accepted the whiteout %s", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dest, "etc", "keep.conf")); err != nil {
+		t.Errorf("Whiteout removed the destination: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(dest)); err != nil {
+		t.Errorf("Whiteout removed the destination's parent: %v", err)
+	}
+}
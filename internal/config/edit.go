@@ -0,0 +1,241 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is a config file loaded as a yaml.Node tree, so edits keep the
+// user's comments, key order and anchors intact
+type Document struct {
+	path string
+	mode os.FileMode
+	root yaml.Node
+
+	// spaced holds top-level keys preceded by a blank line, which yaml.v3
+	// drops when encoding
+	spaced map[string]bool
+}
+
+// OpenDocument reads a config file for editing
+func OpenDocument(path string) (*Document, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{path: path, mode: info.Mode().Perm(), spaced: spacedKeys(data)}
+	if err := yaml.Unmarshal(data, &doc.root); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if doc.root.Kind == 0 {
+		doc.root = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	if doc.root.Kind != yaml.DocumentNode || len(doc.root.Content) != 1 || doc.root.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s is not a YAML mapping", path)
+	}
+	return doc, nil
+}
+
+// Save writes the document back to its file
+func (d *Document) Save() error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&d.root); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", d.path, err)
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	data := restoreSpacing(buf.Bytes(), d.spaced)
+
+	return WriteFileAtomic(d.path, data, d.mode)
+}
+
+// SetString sets the scalar at a dotted key path such as "upstream.ref",
+// creating intermediate mappings as needed
+func (d *Document) SetString(key, value string) error {
+	node := d.root.Content[0]
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		if node.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s is not a mapping", strings.Join(parts[:i], "."))
+		}
+
+		child := mappingValue(node, part)
+		last := i == len(parts)-1
+		if child == nil {
+			child = &yaml.Node{Kind: yaml.MappingNode}
+			if last {
+				child = &yaml.Node{Kind: yaml.ScalarNode}
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: part}, child)
+		}
+		if last {
+			if child.Kind != yaml.ScalarNode {
+				return fmt.Errorf("%s is not a scalar", key)
+			}
+			child.Tag = "!!str"
+			child.Value = value
+			return nil
+		}
+		node = child
+	}
+	return nil
+}
+
+// AddSymlink appends a spec to the symlinks list. An empty to, or one equal
+// to from, is written in the short string form.
+func (d *Document) AddSymlink(from, to string) error {
+	list, err := d.symlinks(true)
+	if err != nil {
+		return err
+	}
+	if to == "" {
+		to = from
+	}
+	for _, item := range list.Content {
+		if _, target := specNodePaths(item); target == to {
+			return fmt.Errorf("a spec for %s already exists", to)
+		}
+	}
+
+	if from == to {
+		list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: from})
+		return nil
+	}
+	list.Content = append(list.Content, &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "from"}, {Kind: yaml.ScalarNode, Value: from},
+		{Kind: yaml.ScalarNode, Value: "to"}, {Kind: yaml.ScalarNode, Value: to},
+	}})
+	return nil
+}
+
+// RemoveSymlink removes the spec whose target is to, reporting whether one was found
+func (d *Document) RemoveSymlink(to string) (bool, error) {
+	list, err := d.symlinks(false)
+	if err != nil || list == nil {
+		return false, err
+	}
+	for i, item := range list.Content {
+		if _, target := specNodePaths(item); target == to {
+			list.Content = append(list.Content[:i], list.Content[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// symlinks returns the symlinks sequence, optionally creating it
+func (d *Document) symlinks(create bool) (*yaml.Node, error) {
+	root := d.root.Content[0]
+	list := mappingValue(root, "symlinks")
+	if list == nil || (list.Kind == yaml.ScalarNode && list.Tag == "!!null") {
+		if !create {
+			return nil, nil
+		}
+		seq := &yaml.Node{Kind: yaml.SequenceNode}
+		if list != nil {
+			*list = *seq
+			return list, nil
+		}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "symlinks"}, seq)
+		return seq, nil
+	}
+	if list.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("symlinks is not a list")
+	}
+	return list, nil
+}
+
+// mappingValue returns the value node for key in a mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// specNodePaths returns the from and to paths of a symlinks list item
+func specNodePaths(item *yaml.Node) (string, string) {
+	if item.Kind == yaml.AliasNode {
+		item = item.Alias
+	}
+	if item.Kind == yaml.ScalarNode {
+		return item.Value, item.Value
+	}
+	var from, to string
+	if v := mappingValue(item, "from"); v != nil {
+		from = v.Value
+	}
+	if v := mappingValue(item, "to"); v != nil {
+		to = v.Value
+	}
+	return from, to
+}
+
+// topLevelKey returns the key of a column-0 "key:" line
+func topLevelKey(line string) (string, bool) {
+	if line == "" || line[0] == ' ' || line[0] == '#' || line[0] == '-' {
+		return "", false
+	}
+	key, _, ok := strings.Cut(line, ":")
+	return strings.Trim(key, `"'`), ok
+}
+
+// spacedKeys finds top-level keys whose block (including any comment lines
+// above it) is preceded by a blank line
+func spacedKeys(data []byte) map[string]bool {
+	spaced := make(map[string]bool)
+	blank, seen := false, false
+	for _, line := range strings.Split(string(data), "\n") {
+		switch {
+		case strings.TrimSpace(line) == "":
+			blank = seen
+		case strings.HasPrefix(line, "#"):
+			seen = true
+		default:
+			if key, ok := topLevelKey(line); ok && blank {
+				spaced[key] = true
+			}
+			seen = true
+			blank = false
+		}
+	}
+	return spaced
+}
+
+// restoreSpacing re-inserts the blank lines recorded by spacedKeys
+func restoreSpacing(data []byte, spaced map[string]bool) []byte {
+	lines := strings.Split(string(data), "\n")
+	var out []string
+	for _, line := range lines {
+		if key, ok := topLevelKey(line); ok && spaced[key] {
+			// Keep the key's head comment attached to it
+			i := len(out)
+			for i > 0 && strings.HasPrefix(out[i-1], "#") {
+				i--
+			}
+			if i > 0 {
+				out = append(out[:i], append([]string{""}, out[i:]...)...)
+			}
+		}
+		out = append(out, line)
+	}
+	return []byte(strings.Join(out, "\n"))
+}
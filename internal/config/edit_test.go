@@ -0,0 +1,116 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDocumentEdits(t *testing.T) {
+	input := `# Overlay for the acme service
+upstream:
+  url: "https://github.com/example/repo.git"
+  ref: main # track the default branch
+
+defaults: &link
+  from: src/lib
+  to: library
+
+symlinks:
+  # Application code
+  - app
+  - *link
+  - config
+`
+	want := `# Overlay for the acme service
+upstream:
+  url: "https://github.com/example/repo.git"
+  ref: v2.0.0 # track the default branch
+
+defaults: &link
+  from: src/lib
+  to: library
+
+symlinks:
+  # Application code
+  - app
+  - *link
+  - docs
+  - from: src/cmd
+    to: tools
+`
+
+	path := filepath.Join(t.TempDir(), ".git-overlay.yml")
+	if err := os.WriteFile(path, []byte(input), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	doc, err := OpenDocument(path)
+	if err != nil {
+		t.Fatalf("OpenDocument() error = %v", err)
+	}
+	if err := doc.SetString("upstream.ref", "v2.0.0"); err != nil {
+		t.Fatalf("SetString() error = %v", err)
+	}
+	if err := doc.AddSymlink("docs", ""); err != nil {
+		t.Fatalf("AddSymlink() error = %v", err)
+	}
+	if err := doc.AddSymlink("src/cmd", "tools"); err != nil {
+		t.Fatalf("AddSymlink() error = %v", err)
+	}
+	if err := doc.AddSymlink("other", "library"); err == nil {
+		t.Error("AddSymlink() with an existing target succeeded, want error")
+	}
+	if removed, err := doc.RemoveSymlink("config"); err != nil || !removed {
+		t.Fatalf("RemoveSymlink() = %v, %v, want true", removed, err)
+	}
+	if removed, _ := doc.RemoveSymlink("missing"); removed {
+		t.Error("RemoveSymlink() of a missing spec = true, want false")
+	}
+	if err := doc.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("saved config =\n%s\nwant\n%s", got, want)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat config: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestDocumentSetStringCreatesMappings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".git-overlay.yml")
+	if err := os.WriteFile(path, []byte("symlinks:\n  - app\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	doc, err := OpenDocument(path)
+	if err != nil {
+		t.Fatalf("OpenDocument() error = %v", err)
+	}
+	if err := doc.SetString("upstream.url", "https://example.com/repo.git"); err != nil {
+		t.Fatalf("SetString() error = %v", err)
+	}
+	if err := doc.SetString("symlinks.ref", "main"); err == nil {
+		t.Error("SetString() into a list succeeded, want error")
+	}
+	if err := doc.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, _ := os.ReadFile(path)
+	want := "symlinks:\n  - app\nupstream:\n  url: https://example.com/repo.git\n"
+	if string(got) != want {
+		t.Errorf("saved config = %q, want %q", got, want)
+	}
+}
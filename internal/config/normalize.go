@@ -0,0 +1,22 @@
+package config
+
+import "golang.org/x/text/unicode/norm"
+
+// Unicode normalization forms for managed paths, set with unicode_normalization
+const (
+	NormalizationNFC  = "nfc"  // Composed form, as used by Linux and Windows tools (default)
+	NormalizationNFD  = "nfd"  // Decomposed form, as historically produced by macOS
+	NormalizationNone = "none" // Keep paths byte-for-byte as found
+)
+
+// NormalizePath converts path to the given normalization form, so the same
+// name spelled in NFC or NFD is treated as one path
+func NormalizePath(form, path string) string {
+	switch form {
+	case "", NormalizationNFC:
+		return norm.NFC.String(path)
+	case NormalizationNFD:
+		return norm.NFD.String(path)
+	}
+	return path
+}
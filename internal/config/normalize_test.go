@@ -0,0 +1,47 @@
+package config
+
+import "testing"
+
+func TestNormalizePath(t *testing.T) {
+	const nfc = "café.txt"
+	const nfd = "café.txt"
+
+	tests := []struct {
+		name string
+		form string
+		path string
+		want string
+	}{
+		{name: "default composes", form: "", path: nfd, want: nfc},
+		{name: "nfc composes", form: NormalizationNFC, path: nfd, want: nfc},
+		{name: "nfd decomposes", form: NormalizationNFD, path: nfc, want: nfd},
+		{name: "none keeps nfd", form: NormalizationNone, path: nfd, want: nfd},
+		{name: "none keeps nfc", form: NormalizationNone, path: nfc, want: nfc},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizePath(tt.form, tt.path); got != tt.want {
+				t.Errorf("NormalizePath(%q, %q) = %q, want %q", tt.form, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetNormalizationMergesEntries(t *testing.T) {
+	state := &State{}
+	state.AddManagedFile("docs/café.txt", "symlink", "docs/café.txt")
+	state.AddManagedFile("docs/café.txt", "copy", "docs/café.txt")
+
+	state.SetNormalization(NormalizationNFC)
+
+	if len(state.ManagedFiles) != 1 {
+		t.Fatalf("State has %d files, want 1", len(state.ManagedFiles))
+	}
+	if got := state.ManagedFiles[0]; got.Path != "docs/café.txt" || got.LinkMode != "copy" {
+		t.Errorf("Merged entry = %+v, want NFC path with the later copy mode", got)
+	}
+	if ok, _ := state.IsManagedFile("docs/café.txt"); !ok {
+		t.Error("NFD spelling of a managed path was not found")
+	}
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// schemaProvider is implemented by types whose YAML form can't be derived from their fields
+type schemaProvider interface {
+	JSONSchema() map[string]interface{}
+}
+
+// Schema returns a JSON Schema describing the config file. It is derived from
+// the yaml, doc, enum and required struct tags on Config and its fields.
+func Schema() map[string]interface{} {
+	schema := schemaFor(reflect.TypeOf(Config{}))
+	// extends is merged away before the config is parsed, so it has no field
+	schema["properties"].(map[string]interface{})["extends"] = map[string]interface{}{
+		"type":        "string",
+		"description": "Base config (path or https URL) merged under this one",
+	}
+	// Top-level x- keys hold YAML anchors for reuse elsewhere in the file
+	schema["patternProperties"] = map[string]interface{}{"^x-": map[string]interface{}{}}
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "git-overlay configuration"
+	return schema
+}
+
+// schemaFor builds the schema for a single Go type
+func schemaFor(t reflect.Type) map[string]interface{} {
+	if provider, ok := reflect.Zero(t).Interface().(schemaProvider); ok {
+		return provider.JSONSchema()
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaFor(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": schemaFor(t.Elem()),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": schemaFor(t.Elem()),
+		}
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema builds an object schema from a struct's exported, yaml-tagged fields
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("yaml")
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		// Inlined structs contribute their fields to this object
+		if strings.Contains(tag, ",inline") && field.Type.Kind() == reflect.Struct {
+			inline := structSchema(field.Type)
+			for k, v := range inline["properties"].(map[string]interface{}) {
+				properties[k] = v
+			}
+			if req, ok := inline["required"].([]string); ok {
+				required = append(required, req...)
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		prop := schemaFor(field.Type)
+		if doc := field.Tag.Get("doc"); doc != "" {
+			prop["description"] = doc
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			var values []interface{}
+			for _, v := range strings.Split(enum, ",") {
+				values = append(values, v)
+			}
+			prop["enum"] = values
+		}
+		if field.Tag.Get("required") == "true" {
+			required = append(required, name)
+		}
+		properties[name] = prop
+	}
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,43 @@
+package config
+
+import "testing"
+
+func TestSchema(t *testing.T) {
+	schema := Schema()
+
+	properties, ok := schema["properties"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Schema has no properties")
+	}
+
+	for _, name := range []string{"extends", "upstream", "symlinks", "link_mode", "clean"} {
+		if _, ok := properties[name]; !ok {
+			t.Errorf("Schema missing property %q", name)
+		}
+	}
+
+	// Only x- keys are allowed besides the known ones, for YAML anchors
+	patterns, _ := schema["patternProperties"].(map[string]interface{})
+	if _, ok := patterns["^x-"]; !ok || schema["additionalProperties"] != false {
+		t.Errorf("Schema should allow x- keys and nothing else unknown, got patternProperties %v", schema["patternProperties"])
+	}
+
+	required, _ := schema["required"].([]string)
+	if len(required) != 1 || required[0] != "upstream" {
+		t.Errorf("required = %v, want [upstream]", required)
+	}
+
+	// Symlink specs accept both the string and struct forms
+	symlinks := properties["symlinks"].(map[string]interface{})
+	items := symlinks["items"].(map[string]interface{})
+	oneOf, ok := items["oneOf"].([]interface{})
+	if !ok || len(oneOf) != 2 {
+		t.Errorf("symlinks items oneOf = %v, want two alternatives", items["oneOf"])
+	}
+
+	// Internal fields are not exposed
+	spec := oneOf[1].(map[string]interface{})["properties"].(map[string]interface{})
+	if _, ok := spec["String"]; ok {
+		t.Error("Schema exposes SymlinkSpec.String")
+	}
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Settings are per-user defaults shared by every overlay, read from
+// $XDG_CONFIG_HOME/git-overlay/config.yml
+type Settings struct {
+	LinkMode string `yaml:"link_mode,omitempty"` // Link mode used when neither the repo config nor --link-mode sets one
+	Jobs     int    `yaml:"jobs,omitempty"`      // Upstreams synced at once when --jobs isn't given
+	CacheDir string `yaml:"cache_dir,omitempty"` // Cache directory (default $XDG_CACHE_HOME/git-overlay)
+	// WatchAutoSync makes watch sync when the upstream moves, unless
+	// --auto-sync is given
+	WatchAutoSync bool `yaml:"watch_auto_sync,omitempty"`
+	// AuthHelpers maps credential environment variables such as GITHUB_TOKEN
+	// to commands printing the credential, run when the variable isn't set
+	AuthHelpers map[string]string `yaml:"auth_helpers,omitempty"`
+	// URLRewrites maps upstream URL prefixes to replacements used when
+	// cloning and fetching, like git's url.<base>.insteadOf
+	URLRewrites map[string]string `yaml:"url_rewrites,omitempty"`
+}
+
+// xdgDir returns the XDG base directory named by env, falling back to
+// fallback under the home directory
+func xdgDir(env, fallback string) (string, error) {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, fallback), nil
+}
+
+// SettingsPath returns where the per-user settings file is read from
+func SettingsPath() (string, error) {
+	dir, err := xdgDir("XDG_CONFIG_HOME", ".config")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "git-overlay", "config.yml"), nil
+}
+
+// LoadSettings reads the per-user settings file; a missing file yields empty settings
+func LoadSettings() (*Settings, error) {
+	var s Settings
+	path, err := SettingsPath()
+	if err != nil {
+		return &s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read settings: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse settings %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// GitConfigSection is the git config section whose variables override the
+// settings file, e.g. git config git-overlay.linkmode copy
+const GitConfigSection = "git-overlay"
+
+// ApplyGitConfig overrides settings with variables of the git-overlay git
+// config section, keyed as git lowercases them. Unknown variables and bad
+// values are skipped and described in the returned warnings.
+func (s *Settings) ApplyGitConfig(values map[string]string) []string {
+	var warnings []string
+	for key, value := range values {
+		name := GitConfigSection + "." + key
+		switch key {
+		case "linkmode":
+			s.LinkMode = value
+		case "jobs":
+			jobs, err := strconv.Atoi(value)
+			if err != nil || jobs < 1 {
+				warnings = append(warnings, fmt.Sprintf("%s must be a positive number, got %q", name, value))
+				continue
+			}
+			s.Jobs = jobs
+		case "cachedir":
+			s.CacheDir = value
+		case "watchautosync":
+			on, ok := gitBool(value)
+			if !ok {
+				warnings = append(warnings, fmt.Sprintf("%s must be a boolean, got %q", name, value))
+				continue
+			}
+			s.WatchAutoSync = on
+		default:
+			warnings = append(warnings, fmt.Sprintf("unknown git config variable %s", name))
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// gitBool parses a git config boolean; a variable without a value is true
+func gitBool(value string) (bool, bool) {
+	switch strings.ToLower(value) {
+	case "", "true", "yes", "on", "1":
+		return true, true
+	case "false", "no", "off", "0":
+		return false, true
+	}
+	return false, false
+}
+
+// Cache returns the cache directory, $XDG_CACHE_HOME/git-overlay unless cache_dir is set
+func (s *Settings) Cache() (string, error) {
+	if strings.HasPrefix(s.CacheDir, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, s.CacheDir[2:]), nil
+	}
+	if s.CacheDir != "" {
+		return s.CacheDir, nil
+	}
+	dir, err := xdgDir("XDG_CACHE_HOME", ".cache")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "git-overlay"), nil
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSettings(t *testing.T) {
+	configHome := t.TempDir()
+	cacheHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	t.Setenv("XDG_CACHE_HOME", cacheHome)
+
+	// A missing settings file yields empty settings
+	settings, err := LoadSettings()
+	if err != nil {
+		t.Fatalf("LoadSettings() error = %v", err)
+	}
+	if settings.LinkMode != "" || settings.Jobs != 0 {
+		t.Errorf("LoadSettings() without a file = %+v, want empty", settings)
+	}
+	if dir, _ := settings.Cache(); dir != filepath.Join(cacheHome, "git-overlay") {
+		t.Errorf("Cache() = %q, want under XDG_CACHE_HOME", dir)
+	}
+
+	path := filepath.Join(configHome, "git-overlay", "config.yml")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create settings dir: %v", err)
+	}
+	content := `link_mode: copy
+jobs: 8
+cache_dir: /tmp/overlay-cache
+auth_helpers:
+  GITHUB_TOKEN: gh auth token
+url_rewrites:
+  https://github.com/acme/: git@github.corp:mirror/acme/
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write settings: %v", err)
+	}
+
+	settings, err = LoadSettings()
+	if err != nil {
+		t.Fatalf("LoadSettings() error = %v", err)
+	}
+	if settings.LinkMode != "copy" || settings.Jobs != 8 {
+		t.Errorf("LoadSettings() = %+v", settings)
+	}
+	if settings.AuthHelpers["GITHUB_TOKEN"] != "gh auth token" {
+		t.Errorf("AuthHelpers = %v", settings.AuthHelpers)
+	}
+	if settings.URLRewrites["https://github.com/acme/"] != "git@github.corp:mirror/acme/" {
+		t.Errorf("URLRewrites = %v", settings.URLRewrites)
+	}
+	if dir, _ := settings.Cache(); dir != "/tmp/overlay-cache" {
+		t.Errorf("Cache() = %q, want cache_dir", dir)
+	}
+}
+
+func TestApplyGitConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   map[string]string
+		want     Settings
+		warnings int
+	}{
+		{
+			name:   "overrides",
+			values: map[string]string{"linkmode": "copy", "jobs": "4", "cachedir": "/tmp/c", "watchautosync": "yes"},
+			want:   Settings{LinkMode: "copy", Jobs: 4, CacheDir: "/tmp/c", WatchAutoSync: true},
+		},
+		{
+			name:   "valueless boolean is true",
+			values: map[string]string{"watchautosync": ""},
+			want:   Settings{LinkMode: "symlink", Jobs: 8, WatchAutoSync: true},
+		},
+		{
+			name:     "bad values keep the file settings",
+			values:   map[string]string{"jobs": "0", "watchautosync": "maybe"},
+			want:     Settings{LinkMode: "symlink", Jobs: 8},
+			warnings: 2,
+		},
+		{
+			name:     "unknown variable",
+			values:   map[string]string{"linkmod": "copy"},
+			want:     Settings{LinkMode: "symlink", Jobs: 8},
+			warnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Settings{LinkMode: "symlink", Jobs: 8}
+			warnings := s.ApplyGitConfig(tt.values)
+			if len(warnings) != tt.warnings {
+				t.Errorf("ApplyGitConfig() warnings = %v, want %d", warnings, tt.warnings)
+			}
+			if s.LinkMode != tt.want.LinkMode || s.Jobs != tt.want.Jobs || s.CacheDir != tt.want.CacheDir || s.WatchAutoSync != tt.want.WatchAutoSync {
+				t.Errorf("ApplyGitConfig() = %+v, want %+v", *s, tt.want)
+			}
+		})
+	}
+}
@@ -1,30 +1,140 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StateFile is the path of the state file relative to the repository root
+const StateFile = ".git-overlay.state.json"
+
+// State locations selectable with state_location in the config file
+const (
+	StateLocationWorktree = "worktree" // StateFile in the repository root (default)
+	StateLocationGitDir   = "git-dir"  // git-overlay/state.json inside the git directory
 )
 
 // State represents the git-overlay state
 type State struct {
 	ManagedFiles []ManagedFile `json:"managed_files"`
+	RefOverride  string        `json:"ref_override,omitempty"` // Ref applied by sync --ref instead of the configured one
+	UpstreamDir  string        `json:"upstream_dir,omitempty"` // External checkout .upstream linked to when links were last created
+
+	path   string // Where the state is saved, defaults to StateFile
+	legacy string // Old state file to remove once the state has been saved elsewhere
+	form   string // Unicode normalization applied to managed paths
 }
 
 // ManagedFile represents a file managed by git-overlay
 type ManagedFile struct {
-	Path     string `json:"path"`     // Path relative to overlay directory
-	LinkMode string `json:"linkMode"` // Link mode used (symlink, hardlink, copy)
-	Source   string `json:"source"`   // Source path in .upstream
+	Path     string `json:"path"`               // Path relative to overlay directory
+	LinkMode string `json:"linkMode"`           // Link mode used (symlink, hardlink, copy)
+	Source   string `json:"source"`             // Source path in the upstream checkout
+	Upstream string `json:"upstream,omitempty"` // Named upstream the source belongs to, empty for .upstream
+	Pinned   bool   `json:"pinned,omitempty"`   // Frozen as a local copy that sync leaves alone
+	// SyncedAt is when the file was last materialized, or for a generated
+	// file when its rendering last changed (its .SyncTime)
+	SyncedAt    *time.Time `json:"synced_at,omitempty"`
+	UpstreamSHA string     `json:"upstream_sha,omitempty"` // Upstream commit the file was last materialized from
+	Component   string     `json:"component,omitempty"`    // components: group of the spec that linked the file
+}
+
+// StatePath returns the state file path for a state location
+func StatePath(location string) (string, error) {
+	switch location {
+	case "", StateLocationWorktree:
+		return StateFile, nil
+	case StateLocationGitDir:
+		dir, err := GitDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "git-overlay", "state.json"), nil
+	default:
+		return "", fmt.Errorf("unsupported state location: %s", location)
+	}
+}
+
+// GitDir returns the git directory of the repository in the current directory,
+// following the "gitdir:" indirection used by linked worktrees and submodules.
+// GIT_DIR takes precedence, as it does for git itself.
+func GitDir() (string, error) {
+	if dir := os.Getenv("GIT_DIR"); dir != "" {
+		return dir, nil
+	}
+	info, err := os.Stat(".git")
+	if err != nil {
+		return "", fmt.Errorf("failed to locate git directory: %w", err)
+	}
+	if info.IsDir() {
+		return ".git", nil
+	}
+
+	data, err := os.ReadFile(".git")
+	if err != nil {
+		return "", fmt.Errorf("failed to read .git file: %w", err)
+	}
+	dir := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(data)), "gitdir:"))
+	if dir == "" {
+		return "", fmt.Errorf("invalid .git file")
+	}
+	return dir, nil
 }
 
 // LoadState loads the state file
 func LoadState() (*State, error) {
-	data, err := os.ReadFile(".git-overlay.state.json")
+	return readState(StateFile)
+}
+
+// LoadStateAt loads the state from the given state location. When the state
+// lives in the git directory, entries from a leftover worktree state file are
+// merged in so repositories can move between locations without losing track of
+// managed files; the old file is removed on the next save.
+func LoadStateAt(location string) (*State, error) {
+	path, err := StatePath(location)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := readState(path)
+	if err != nil {
+		return nil, err
+	}
+	state.path = path
+
+	if path == StateFile {
+		return state, nil
+	}
+
+	legacy, err := readState(StateFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, mf := range legacy.ManagedFiles {
+		if ok, _ := state.IsManagedFile(mf.Path); !ok {
+			state.ManagedFiles = append(state.ManagedFiles, mf)
+		}
+	}
+	if _, err := os.Stat(StateFile); err == nil {
+		state.legacy = StateFile
+	}
+
+	return state, nil
+}
+
+// readState reads a state file, returning an empty state if it does not exist
+func readState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return &State{}, nil
+			return &State{path: path}, nil
 		}
 		return nil, fmt.Errorf("failed to read state file: %w", err)
 	}
@@ -33,42 +143,142 @@ func LoadState() (*State, error) {
 	if err := json.Unmarshal(data, &state); err != nil {
 		return nil, fmt.Errorf("failed to parse state file: %w", err)
 	}
+	state.path = path
 
 	return &state, nil
 }
 
-// SaveState saves the state file
+// SaveState saves the state file. Entries are written sorted by path with
+// forward slashes, and the file is left untouched if its content is unchanged.
 func (s *State) SaveState() error {
+	for i := range s.ManagedFiles {
+		s.ManagedFiles[i].Path = filepath.ToSlash(s.ManagedFiles[i].Path)
+		s.ManagedFiles[i].Source = filepath.ToSlash(s.ManagedFiles[i].Source)
+	}
+	sort.SliceStable(s.ManagedFiles, func(i, j int) bool {
+		return s.ManagedFiles[i].Path < s.ManagedFiles[j].Path
+	})
+
 	data, err := json.MarshalIndent(s, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal state: %w", err)
 	}
+	data = append(data, '\n')
+
+	path := s.path
+	if path == "" {
+		path = StateFile
+	}
+
+	// Avoid needless rewrites so the file's mtime only changes with its content
+	if existing, err := os.ReadFile(path); err != nil || !bytes.Equal(existing, data) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create state directory: %w", err)
+		}
+		if err := WriteFileAtomic(path, data, 0644); err != nil {
+			return fmt.Errorf("failed to write state file: %w", err)
+		}
+	}
 
-	if err := os.WriteFile(".git-overlay.state.json", data, 0644); err != nil {
-		return fmt.Errorf("failed to write state file: %w", err)
+	// The state has moved, so the old file is no longer needed
+	if s.legacy != "" && s.legacy != path {
+		if err := os.Remove(s.legacy); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove old state file: %w", err)
+		}
+		s.legacy = ""
 	}
 
 	return nil
 }
 
+// SetNormalization normalizes managed paths to form from now on, merging
+// entries that only differed in normalization (later entries win)
+func (s *State) SetNormalization(form string) {
+	s.form = form
+	files := s.ManagedFiles
+	s.ManagedFiles = nil
+	for _, mf := range files {
+		s.RemoveManagedFile(mf.Path)
+		mf.Path = s.key(mf.Path)
+		s.ManagedFiles = append(s.ManagedFiles, mf)
+	}
+}
+
+// key returns the form a managed path is stored and compared in: normalized
+// and slash-separated, so state files are portable between platforms
+func (s *State) key(p string) string {
+	return filepath.ToSlash(NormalizePath(s.form, p))
+}
+
 // AddManagedFile adds a file to the managed files list
 func (s *State) AddManagedFile(path, linkMode, source string) {
-	// Remove any existing entry for this path
+	s.AddUpstreamFile("", path, linkMode, source)
+}
+
+// AddUpstreamFile adds a file linked from a named upstream to the managed files list
+func (s *State) AddUpstreamFile(upstream, path, linkMode, source string) {
+	path = s.key(path)
+	mf := ManagedFile{
+		Path:     path,
+		LinkMode: linkMode,
+		Source:   filepath.ToSlash(source),
+		Upstream: upstream,
+	}
+
+	// Remove any existing entry for this path, keeping when it was synced
+	// if it still links the same upstream file
 	for i := len(s.ManagedFiles) - 1; i >= 0; i-- {
-		if s.ManagedFiles[i].Path == path {
+		if prev := s.ManagedFiles[i]; prev.Path == path {
+			if prev.Upstream == mf.Upstream && prev.Source == mf.Source {
+				mf.SyncedAt, mf.UpstreamSHA = prev.SyncedAt, prev.UpstreamSHA
+			}
 			s.ManagedFiles = append(s.ManagedFiles[:i], s.ManagedFiles[i+1:]...)
 		}
 	}
 
+	s.ManagedFiles = append(s.ManagedFiles, mf)
+}
+
+// AddGeneratedFile adds a file rendered from a generate: spec to the managed
+// files list, with the sync time it was rendered with
+func (s *State) AddGeneratedFile(path, linkMode string, syncedAt time.Time) {
+	s.AddManagedFile(path, linkMode, "")
+	s.MarkSynced(syncedAt, "", true)
+}
+
+// MarkSynced records on the file added last when it was materialized and
+// from which upstream commit, empty when the upstream has none. A file
+// already recorded from the same commit keeps its time unless changed is
+// set, as its content is the same.
+func (s *State) MarkSynced(syncedAt time.Time, upstreamSHA string, changed bool) {
+	mf := &s.ManagedFiles[len(s.ManagedFiles)-1]
+	if !changed && mf.SyncedAt != nil && upstreamSHA != "" && mf.UpstreamSHA == upstreamSHA {
+		return
+	}
+	mf.SyncedAt = &syncedAt
+	mf.UpstreamSHA = upstreamSHA
+}
+
+// SetComponent records the components: group of the spec that linked the
+// file added last
+func (s *State) SetComponent(component string) {
+	s.ManagedFiles[len(s.ManagedFiles)-1].Component = component
+}
+
+// AppendUpstreamFile adds a file linked from a named upstream without looking
+// for an existing entry, for runs that rebuild the list from scratch
+func (s *State) AppendUpstreamFile(upstream, path, linkMode, source string) {
 	s.ManagedFiles = append(s.ManagedFiles, ManagedFile{
-		Path:     path,
+		Path:     s.key(path),
 		LinkMode: linkMode,
-		Source:   source,
+		Source:   filepath.ToSlash(source),
+		Upstream: upstream,
 	})
 }
 
 // RemoveManagedFile removes a file from the managed files list
 func (s *State) RemoveManagedFile(path string) {
+	path = s.key(path)
 	for i := len(s.ManagedFiles) - 1; i >= 0; i-- {
 		if s.ManagedFiles[i].Path == path {
 			s.ManagedFiles = append(s.ManagedFiles[:i], s.ManagedFiles[i+1:]...)
@@ -76,8 +286,28 @@ func (s *State) RemoveManagedFile(path string) {
 	}
 }
 
+// SetPinned marks a managed file as pinned or returns it to being linked,
+// reporting whether the file is managed
+func (s *State) SetPinned(path string, pinned bool) bool {
+	path = s.key(path)
+	for i := range s.ManagedFiles {
+		if s.ManagedFiles[i].Path == path {
+			s.ManagedFiles[i].Pinned = pinned
+			return true
+		}
+	}
+	return false
+}
+
+// IsPinned reports whether a managed file is pinned
+func (s *State) IsPinned(path string) bool {
+	managed, mf := s.IsManagedFile(path)
+	return managed && mf.Pinned
+}
+
 // IsManagedFile checks if a file is managed by git-overlay
 func (s *State) IsManagedFile(path string) (bool, *ManagedFile) {
+	path = s.key(path)
 	for _, f := range s.ManagedFiles {
 		if f.Path == path {
 			return true, &f
@@ -88,9 +318,10 @@ func (s *State) IsManagedFile(path string) (bool, *ManagedFile) {
 
 // GetManagedFilesInDir returns all managed files in a directory
 func (s *State) GetManagedFilesInDir(dir string) []ManagedFile {
+	dir = s.key(dir)
 	var files []ManagedFile
 	for _, f := range s.ManagedFiles {
-		if filepath.Dir(f.Path) == dir || f.Path == dir {
+		if path.Dir(f.Path) == dir || f.Path == dir {
 			files = append(files, f)
 		}
 	}
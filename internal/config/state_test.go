@@ -0,0 +1,186 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveStateDeterministic(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	state := &State{}
+	state.AddManagedFile("z/last.txt", "symlink", "z/last.txt")
+	state.AddManagedFile("a/first.txt", "copy", "a/first.txt")
+	state.AddManagedFile("m/middle.txt", "hardlink", "m/middle.txt")
+	if err := state.SaveState(); err != nil {
+		t.Fatalf("SaveState() error = %v", err)
+	}
+
+	loaded, err := LoadState()
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	want := []string{"a/first.txt", "m/middle.txt", "z/last.txt"}
+	for i, mf := range loaded.ManagedFiles {
+		if mf.Path != want[i] {
+			t.Errorf("ManagedFiles[%d].Path = %q, want %q", i, mf.Path, want[i])
+		}
+	}
+
+	// Saving unchanged state must not rewrite the file
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(StateFile, past, past); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+	if err := loaded.SaveState(); err != nil {
+		t.Fatalf("SaveState() error = %v", err)
+	}
+	info, err := os.Stat(StateFile)
+	if err != nil {
+		t.Fatalf("Failed to stat state file: %v", err)
+	}
+	if !info.ModTime().Equal(past) {
+		t.Error("SaveState() rewrote an unchanged state file")
+	}
+
+	data, err := os.ReadFile(StateFile)
+	if err != nil {
+		t.Fatalf("Failed to read state file: %v", err)
+	}
+	if !strings.HasSuffix(string(data), "}\n") {
+		t.Error("State file does not end with a newline")
+	}
+}
+
+func TestLoadStateAtGitDir(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	if err := os.Mkdir(".git", 0755); err != nil {
+		t.Fatalf("Failed to create .git directory: %v", err)
+	}
+
+	// Leave a state file in the worktree from before the move
+	legacy := &State{}
+	legacy.AddManagedFile("old.txt", "symlink", "old.txt")
+	if err := legacy.SaveState(); err != nil {
+		t.Fatalf("SaveState() error = %v", err)
+	}
+
+	state, err := LoadStateAt(StateLocationGitDir)
+	if err != nil {
+		t.Fatalf("LoadStateAt() error = %v", err)
+	}
+	if ok, _ := state.IsManagedFile("old.txt"); !ok {
+		t.Error("Entries from the worktree state file were not merged")
+	}
+
+	state.AddManagedFile("new.txt", "copy", "new.txt")
+	if err := state.SaveState(); err != nil {
+		t.Fatalf("SaveState() error = %v", err)
+	}
+
+	if _, err := os.Stat(StateFile); !os.IsNotExist(err) {
+		t.Error("Worktree state file was not removed after moving to the git dir")
+	}
+
+	reloaded, err := LoadStateAt(StateLocationGitDir)
+	if err != nil {
+		t.Fatalf("LoadStateAt() error = %v", err)
+	}
+	if len(reloaded.ManagedFiles) != 2 {
+		t.Errorf("Reloaded state has %d files, want 2", len(reloaded.ManagedFiles))
+	}
+	if _, err := os.Stat(".git/git-overlay/state.json"); err != nil {
+		t.Errorf("State file not written to git dir: %v", err)
+	}
+}
+
+func TestStatePathsUseForwardSlashes(t *testing.T) {
+	state := &State{}
+	state.AddUpstreamFile("docs", filepath.Join("guide", "intro.md"), "copy", filepath.Join("src", "intro.md"))
+
+	mf := state.ManagedFiles[0]
+	if mf.Path != "guide/intro.md" || mf.Source != "src/intro.md" {
+		t.Errorf("Stored entry = %+v, want slash-separated path and source", mf)
+	}
+	if managed, _ := state.IsManagedFile(filepath.Join("guide", "intro.md")); !managed {
+		t.Error("IsManagedFile() did not find an OS-separated path")
+	}
+	if files := state.GetManagedFilesInDir("guide"); len(files) != 1 {
+		t.Errorf("GetManagedFilesInDir() = %v, want the one entry", files)
+	}
+	if !state.SetPinned(filepath.Join("guide", "intro.md"), true) || !state.IsPinned("guide/intro.md") {
+		t.Error("SetPinned() did not pin an OS-separated path")
+	}
+	state.RemoveManagedFile(filepath.Join("guide", "intro.md"))
+	if len(state.ManagedFiles) != 0 {
+		t.Errorf("RemoveManagedFile() left %v", state.ManagedFiles)
+	}
+}
+
+func TestMarkSynced(t *testing.T) {
+	state := &State{}
+	syncedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	state.AddUpstreamFile("", "a.txt", "copy", "a.txt")
+	state.MarkSynced(syncedAt, "0123456789abcdef0123456789abcdef01234567", false)
+	state.AddUpstreamFile("", "b.txt", "copy", "b.txt")
+
+	_, mf := state.IsManagedFile("a.txt")
+	if mf.SyncedAt == nil || !mf.SyncedAt.Equal(syncedAt) || mf.UpstreamSHA != "0123456789abcdef0123456789abcdef01234567" {
+		t.Errorf("MarkSynced() recorded %+v", mf)
+	}
+	if _, mf := state.IsManagedFile("b.txt"); mf.SyncedAt != nil || mf.UpstreamSHA != "" {
+		t.Errorf("MarkSynced() also recorded %+v", mf)
+	}
+
+	// Linking the same file again from the same commit keeps its time
+	// unless its content changed; a new commit records the new time
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	later, latest := syncedAt.Add(time.Hour), syncedAt.Add(2*time.Hour)
+	tests := []struct {
+		name    string
+		at      time.Time
+		sha     string
+		changed bool
+		want    time.Time
+	}{
+		{"same commit", later, sha, false, syncedAt},
+		{"changed content", later, sha, true, later},
+		{"new commit", latest, "fedcba9876543210fedcba9876543210fedcba98", false, latest},
+	}
+	for _, tt := range tests {
+		state.AddUpstreamFile("", "a.txt", "copy", "a.txt")
+		state.MarkSynced(tt.at, tt.sha, tt.changed)
+		if _, mf := state.IsManagedFile("a.txt"); !mf.SyncedAt.Equal(tt.want) || mf.UpstreamSHA != tt.sha {
+			t.Errorf("%s: MarkSynced() recorded %v from %s, want %v", tt.name, mf.SyncedAt, mf.UpstreamSHA, tt.want)
+		}
+	}
+
+	// Normalizing the paths keeps what was recorded about each file
+	state.SetPinned("a.txt", true)
+	state.SetNormalization(NormalizationNFC)
+	if _, mf := state.IsManagedFile("a.txt"); mf.SyncedAt == nil || mf.UpstreamSHA == "" || !mf.Pinned {
+		t.Errorf("SetNormalization() dropped fields: %+v", mf)
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// SumsFile records the SHA-256 of materialized copies, relative to the
+// repository root. It is committed, so copies can be checked without the
+// upstream checkout.
+const SumsFile = ".git-overlay.sums"
+
+// Sums maps overlay-relative paths to the hex SHA-256 of their content
+type Sums map[string]string
+
+// LoadSums reads the sums file, which may not exist yet. Lines are a hash,
+// two spaces and a path, as written by sha256sum.
+func LoadSums() (Sums, error) {
+	sums := make(Sums)
+	data, err := os.ReadFile(SumsFile)
+	if os.IsNotExist(err) {
+		return sums, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", SumsFile, err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		sum, path, ok := strings.Cut(line, "  ")
+		if !ok || len(sum) != 64 || path == "" {
+			return nil, fmt.Errorf("%s:%d: malformed line", SumsFile, n)
+		}
+		sums[path] = sum
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", SumsFile, err)
+	}
+	return sums, nil
+}
+
+// Save writes the sums sorted by path, removing the file when there are none.
+// An unchanged file is left untouched.
+func (s Sums) Save() error {
+	if len(s) == 0 {
+		if err := os.Remove(SumsFile); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", SumsFile, err)
+		}
+		return nil
+	}
+
+	paths := make([]string, 0, len(s))
+	for path := range s {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var buf bytes.Buffer
+	for _, path := range paths {
+		fmt.Fprintf(&buf, "%s  %s\n", s[path], path)
+	}
+
+	if existing, err := os.ReadFile(SumsFile); err == nil && bytes.Equal(existing, buf.Bytes()) {
+		return nil
+	}
+	if err := WriteFileAtomic(SumsFile, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", SumsFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSums(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	sums, err := LoadSums()
+	if err != nil || len(sums) != 0 {
+		t.Fatalf("LoadSums() without a file = %v, %v, want empty", sums, err)
+	}
+
+	a, b := strings.Repeat("a", 64), strings.Repeat("b", 64)
+	sums = Sums{"z/last.txt": a, "dir with space/first.txt": b}
+	if err := sums.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	data, err := os.ReadFile(SumsFile)
+	if err != nil {
+		t.Fatalf("Failed to read sums file: %v", err)
+	}
+	if want := b + "  dir with space/first.txt\n" + a + "  z/last.txt\n"; string(data) != want {
+		t.Errorf("sums file = %q, want %q", data, want)
+	}
+
+	loaded, err := LoadSums()
+	if err != nil {
+		t.Fatalf("LoadSums() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, sums) {
+		t.Errorf("LoadSums() = %v, want %v", loaded, sums)
+	}
+
+	if err := (Sums{}).Save(); err != nil {
+		t.Fatalf("Save() of no sums error = %v", err)
+	}
+	if _, err := os.Stat(SumsFile); !os.IsNotExist(err) {
+		t.Errorf("sums file still exists without sums: %v", err)
+	}
+
+	if err := os.WriteFile(SumsFile, []byte("not a sum\n"), 0644); err != nil {
+		t.Fatalf("Failed to write sums file: %v", err)
+	}
+	if _, err := LoadSums(); err == nil {
+		t.Error("LoadSums() of a malformed file succeeded")
+	}
+}
@@ -1,6 +1,12 @@
 package config
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
 
 var (
 	// ErrMissingURL is returned when the upstream URL is not provided
@@ -11,24 +17,269 @@ var (
 
 // Config represents the root configuration structure
 type Config struct {
-	Upstream  UpstreamConfig `yaml:"upstream"`
-	Symlinks  []SymlinkSpec  `yaml:"symlinks"`
-	LinkMode  string         `yaml:"link_mode,omitempty"`
-	DebugMode bool          `yaml:"debug,omitempty"`
+	Upstream  UpstreamConfig  `yaml:"upstream" required:"true" doc:"Upstream repository to overlay"`
+	Upstreams []NamedUpstream `yaml:"upstreams,omitempty" doc:"Additional upstreams, checked out under .upstreams/<name>"`
+	Symlinks  []SymlinkSpec   `yaml:"symlinks" doc:"Files and directories to link from upstream"`
+	Dirs      []DirSpec       `yaml:"dirs,omitempty" doc:"Empty directories to create in overlay/"`
+	Generate  []GenerateSpec  `yaml:"generate,omitempty" doc:"Files rendered from templates over sync metadata"`
+	LinkMode  string          `yaml:"link_mode,omitempty" doc:"How files are materialized in overlay/: symlink, reflink, hardlink, copy, auto to choose per file, or <name> for a git-overlay-link-<name> binary"`
+	DebugMode bool            `yaml:"debug,omitempty" doc:"Enable debug logging"`
+	Clean     CleanConfig     `yaml:"clean,omitempty" doc:"Settings for clean"`
+	Trash     TrashConfig     `yaml:"trash,omitempty" doc:"Where removed and overwritten files are kept"`
+	Backup    BackupConfig    `yaml:"backup,omitempty" doc:"Snapshots of overlay/ taken before sync"`
+	Test      TestConfig      `yaml:"test,omitempty" doc:"Verification run by the test command"`
+	Submodule SubmoduleConfig `yaml:"submodule,omitempty" doc:"How the parent repository tracks a git upstream in .gitmodules"`
+	Commit    CommitConfig    `yaml:"commit,omitempty" doc:"Commits made by init and sync with --commit"`
+
+	SymlinksFile         string             `yaml:"symlinks_file,omitempty" doc:"Text file of paths or globs to link, one per line with # comments, appended to symlinks"`
+	SymlinksFromUpstream string             `yaml:"symlinks_from_upstream,omitempty" doc:"Manifest in the upstream listing the specs to link, read from the synced checkout and appended to symlinks"`
+	StateLocation        string             `yaml:"state_location,omitempty" enum:"worktree,git-dir" doc:"Where the state file is kept"`
+	LinkFallback         []string           `yaml:"link_fallback,omitempty" doc:"Link modes to fall back to, in order, when link_mode can't be created"`
+	CaseCollisions       string             `yaml:"case_collisions,omitempty" enum:"error,rename,ignore" doc:"What to do with targets that differ only in case (default error on case-insensitive filesystems)"`
+	WindowsPaths         WindowsPathsConfig `yaml:"windows_paths,omitempty" doc:"Handling of targets Windows can't represent"`
+	SecretScan           SecretScanConfig   `yaml:"secret_scan,omitempty" doc:"Screening of upstream files for secrets before they are materialized"`
+	Limits               LimitsConfig       `yaml:"limits,omitempty" doc:"Most files and content a run may materialize"`
+	UpstreamSymlinks     string             `yaml:"upstream_symlinks,omitempty" enum:"follow,preserve,skip" doc:"What to do with symlinks inside the upstream (default follow)"`
+	UnicodeNormalization string             `yaml:"unicode_normalization,omitempty" enum:"nfc,nfd,none" doc:"Unicode normalization of managed paths (default nfc)"`
+	Rename               []RenameRule       `yaml:"rename,omitempty" doc:"Regex rules rewriting the overlay/ targets of every spec; the first matching rule applies"`
+	ContentTypes         []ContentTypeRule  `yaml:"content_types,omitempty" doc:"Rules skipping or moving upstream files by MIME type; the first matching rule applies"`
+	BlockedPaths         []BlockedPath      `yaml:"blocked_paths,omitempty" doc:"Globs of upstream sources or overlay targets that are never materialized, whatever the specs say"`
+	Policies             PoliciesConfig     `yaml:"policies,omitempty" doc:"Whether each check fails the run, warns or is ignored"`
+	ProtectCopies        bool               `yaml:"protect_copies,omitempty" doc:"Make copy-mode files read-only so edits to upstream-owned files are noticed"`
+	CopyOwner            string             `yaml:"copy_owner,omitempty" doc:"Numeric uid:gid to give copy-mode files when running as root, as in container builds"`
+	Checksums            bool               `yaml:"checksums,omitempty" doc:"Record the SHA-256 of copies in .git-overlay.sums so status can check them without the upstream checkout"`
+	AllowDirty           bool               `yaml:"allow_dirty,omitempty" doc:"Let init, sync and the daemon run with uncommitted changes under overlay/ or to the bookkeeping files"`
+	MetaFile             bool               `yaml:"meta_file,omitempty" doc:"Write sync provenance to overlay/.git-overlay.meta.json"`
+	UpstreamDir          string             `yaml:"upstream_dir,omitempty" doc:"Absolute directory outside the repository to check the main upstream out in; .upstream becomes a symlink to it"`
+
+	// Components groups specs by name; they are linked along with symlinks
+	// and can be synced or cleaned on their own with --component
+	Components map[string][]SymlinkSpec `yaml:"components,omitempty" doc:"Named groups of specs, linked along with symlinks and selected with --component"`
+}
+
+// DefaultTrashDir is where displaced files are moved when no trash dir is configured
+const DefaultTrashDir = ".git-overlay.trash"
+
+// TrashConfig controls where removed or overwritten files are kept
+type TrashConfig struct {
+	Enabled *bool  `yaml:"enabled,omitempty" doc:"Move displaced files to the trash (default true)"`
+	Dir     string `yaml:"dir,omitempty" doc:"Trash directory (default .git-overlay.trash)"`
+}
+
+// IsEnabled reports whether displaced files should be moved to the trash
+func (t TrashConfig) IsEnabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
+
+// Path returns the trash directory
+func (t TrashConfig) Path() string {
+	if t.Dir == "" {
+		return DefaultTrashDir
+	}
+	return t.Dir
+}
+
+// CleanConfig holds settings that control which files may be removed
+type CleanConfig struct {
+	// Protect lists globs (relative to the repository root) that are never deleted
+	Protect []string `yaml:"protect,omitempty" doc:"Globs that clean and sync never delete"`
+	// ConfirmAbove is how many paths clean may remove without --yes
+	ConfirmAbove int `yaml:"confirm_above,omitempty" doc:"Paths clean may remove before requiring --yes (default 50)"`
+}
+
+// DefaultCleanConfirmAbove is how many paths clean removes without --yes
+// when clean.confirm_above is not set
+const DefaultCleanConfirmAbove = 50
+
+// ConfirmLimit returns how many paths clean may remove without confirmation
+func (c CleanConfig) ConfirmLimit() int {
+	if c.ConfirmAbove <= 0 {
+		return DefaultCleanConfirmAbove
+	}
+	return c.ConfirmAbove
 }
 
+// Policies for targets Windows can't represent, set with windows_paths.policy
+const (
+	WindowsPathsIgnore = "ignore" // Don't check (default)
+	WindowsPathsError  = "error"  // Fail listing every offending target
+	WindowsPathsSkip   = "skip"   // Leave offending targets out
+	WindowsPathsEscape = "escape" // Escape names, skip paths that are too long
+)
+
+// LimitsConfig caps what a run may materialize, so a glob matching far more
+// than intended fails up front instead of filling overlay/
+type LimitsConfig struct {
+	MaxFiles     int    `yaml:"max_files,omitempty" doc:"Most files a run may link (default no limit)"`
+	MaxTotalSize string `yaml:"max_total_size,omitempty" doc:"Most content a run may link, e.g. 500M or 2GB (default no limit)"`
+	MaxFileSize  string `yaml:"max_file_size,omitempty" doc:"Largest single file a run may link, e.g. 50M; larger files are handled by policies.big_file (default no limit)"`
+}
+
+// Policies for a failed check, set per check under policies:
+const (
+	PolicyError  = "error"  // Fail the run
+	PolicyWarn   = "warn"   // Leave the offending spec or file out with a warning
+	PolicyIgnore = "ignore" // Leave it out silently
+)
+
+// PoliciesConfig sets how strictly each check is enforced, so a team can
+// relax one check without giving up the others
+type PoliciesConfig struct {
+	MissingSource string `yaml:"missing_source,omitempty" enum:"error,warn,ignore" doc:"Specs whose source doesn't exist upstream (default error)"`
+	Conflict      string `yaml:"conflict,omitempty" enum:"error,warn,ignore" doc:"Targets in overlay/ that git-overlay doesn't manage, without --force (default error)"`
+	BigFile       string `yaml:"big_file,omitempty" enum:"error,warn,ignore" doc:"Files over limits.max_file_size (default error)"`
+	BlockedPath   string `yaml:"blocked_path,omitempty" enum:"error,warn,ignore" doc:"Files matching blocked_paths (default warn)"`
+
+	AllowedRefs []string `yaml:"allowed_refs,omitempty" doc:"Glob patterns every upstream ref must match, such as v* or release/*; any ref when empty"`
+}
+
+// Policies for secrets found in upstream files, set with secret_scan.policy
+const (
+	SecretScanOff   = "off"   // Don't scan (default)
+	SecretScanWarn  = "warn"  // Report findings and link anyway
+	SecretScanError = "error" // Fail before anything is linked
+)
+
+// SecretScanConfig screens the upstream files about to be materialized for
+// tokens and keys, since they become part of the repository
+type SecretScanConfig struct {
+	Policy string   `yaml:"policy,omitempty" enum:"off,warn,error" doc:"What to do with files that look like they hold secrets (default off)"`
+	Allow  []string `yaml:"allow,omitempty" doc:"Globs of upstream paths left unscanned, for known fixtures"`
+}
+
+// DefaultWindowsMaxPath is the classic Windows MAX_PATH limit
+const DefaultWindowsMaxPath = 260
+
+// WindowsPathsConfig controls checks for reserved names (CON, NUL, aux.*),
+// invalid characters and overlong paths in targets
+type WindowsPathsConfig struct {
+	Policy    string `yaml:"policy,omitempty" enum:"ignore,error,skip,escape" doc:"What to do with targets Windows can't represent (default ignore)"`
+	MaxLength int    `yaml:"max_length,omitempty" doc:"Longest allowed target path, relative to the repository root (default 260)"`
+}
+
+// DefaultBackupDir is where overlay snapshots are stored when no backup dir is configured
+const DefaultBackupDir = ".git-overlay.backups"
+
+// BackupConfig controls snapshots of the overlay taken before sync
+type BackupConfig struct {
+	Enabled bool   `yaml:"enabled,omitempty" doc:"Snapshot overlay/ on every sync"`
+	Dir     string `yaml:"dir,omitempty" doc:"Backup directory (default .git-overlay.backups)"`
+}
+
+// Path returns the backup directory
+func (b BackupConfig) Path() string {
+	if b.Dir == "" {
+		return DefaultBackupDir
+	}
+	return b.Dir
+}
+
+// TestConfig holds the verification run by git-overlay test
+type TestConfig struct {
+	Command string `yaml:"command,omitempty" doc:"Shell command run inside a temporary export of overlay/, e.g. make build"`
+}
+
+// CommitConfig holds the settings of commits made with --commit
+type CommitConfig struct {
+	Message string `yaml:"message,omitempty" doc:"Go template for the commit message over .Command and the generate data, e.g. Update overlay to {{ .UpstreamRef }}"`
+}
+
+// SubmoduleConfig holds the .gitmodules settings of a git upstream
+type SubmoduleConfig struct {
+	Ignore  string `yaml:"ignore,omitempty" enum:"all,dirty,untracked,none" doc:"Changes in .upstream that git status ignores (default all)"`
+	Update  string `yaml:"update,omitempty" enum:"checkout,rebase,merge,none" doc:"How git submodule update moves .upstream (default checkout)"`
+	Branch  string `yaml:"branch,omitempty" doc:"Branch followed by git submodule update --remote, or . for the parent's current branch"`
+	Shallow bool   `yaml:"shallow,omitempty" doc:"Clone .upstream with depth 1 in git submodule update"`
+}
+
+// Upstream types selectable with upstream.type
+const (
+	UpstreamTypeGit     = "git"     // Git repository checked out as a submodule (default)
+	UpstreamTypeRelease = "release" // Asset attached to a GitHub or GitLab release
+	UpstreamTypeGoMod   = "gomod"   // Go module zip from the module proxy
+	UpstreamTypeOCI     = "oci"     // Image or artifact layers from an OCI registry
+)
+
 // UpstreamConfig holds upstream repository configuration
 type UpstreamConfig struct {
-	URL string `yaml:"url"`
-	Ref string `yaml:"ref"`
+	Type    string   `yaml:"type,omitempty" doc:"Kind of upstream: git (default), release, gomod, oci, or <name> for a git-overlay-provider-<name> binary"`
+	URL     string   `yaml:"url,omitempty" doc:"Upstream repository URL (git)"`
+	Mirrors []string `yaml:"mirrors,omitempty" doc:"Repository URLs cloned or fetched from in order when url can't be reached (git)"`
+	Ref     string   `yaml:"ref" required:"true" doc:"Branch, tag, or commit to track; release tag, module version or image tag for other types"`
+
+	Host            string `yaml:"host,omitempty" enum:"github,gitlab" doc:"Release host (default github)"`
+	Repo            string `yaml:"repo,omitempty" doc:"owner/repo publishing the release"`
+	Asset           string `yaml:"asset,omitempty" doc:"Glob matching the release asset to download"`
+	StripComponents int    `yaml:"strip_components,omitempty" doc:"Leading path components to drop when extracting"`
+
+	Module string `yaml:"module,omitempty" doc:"Go module path; ref is the module version or latest"`
+
+	Image   string `yaml:"image,omitempty" doc:"OCI image or artifact, e.g. ghcr.io/acme/bundle; ref is a tag or digest"`
+	Layer   string `yaml:"layer,omitempty" doc:"Layer to extract by index, title or media type (default all)"`
+	Subpath string `yaml:"subpath,omitempty" doc:"Directory inside the extracted content to use as the upstream root"`
+
+	Options map[string]string `yaml:"options,omitempty" doc:"Settings passed through to an external upstream provider"`
+}
+
+// NamedUpstream is an additional upstream that specs select with upstream: <name>
+type NamedUpstream struct {
+	Name           string `yaml:"name" required:"true" doc:"Name used by specs and as the directory under .upstreams"`
+	UpstreamConfig `yaml:",inline"`
+}
+
+// UpstreamsDir holds the checkouts of additional named upstreams
+const UpstreamsDir = ".upstreams"
+
+// UpstreamDir returns where an upstream is checked out: .upstream for the
+// main upstream (empty name) and .upstreams/<name> for named ones
+func UpstreamDir(name string) string {
+	if name == "" {
+		return ".upstream"
+	}
+	return filepath.Join(UpstreamsDir, name)
+}
+
+// IsGit reports whether the upstream is a git repository
+func (u UpstreamConfig) IsGit() bool {
+	return u.Type == "" || u.Type == UpstreamTypeGit
 }
 
 // SymlinkSpec defines a symlink mapping
 type SymlinkSpec struct {
-	From string `yaml:"from,omitempty"`
-	To   string `yaml:"to,omitempty"`
+	From string `yaml:"from,omitempty" doc:"Path under .upstream"`
+	To   string `yaml:"to,omitempty" doc:"Path under overlay/"`
+	// Upstream selects a named upstream from upstreams; empty means the main one
+	Upstream string `yaml:"upstream,omitempty" doc:"Name of the upstream to link from (default the main upstream)"`
+	// After lists targets of specs that must be materialized before this one
+	After []string `yaml:"after,omitempty" doc:"Targets (to paths) of specs to materialize before this one"`
+	// Platforms limits the spec to hosts matching os or os/arch, e.g. linux/amd64
+	Platforms []string `yaml:"platforms,omitempty" doc:"Hosts to link the spec on, as os or os/arch (default all)"`
+	// When limits the spec to upstream refs or layouts, e.g. ref >= v2.0
+	When string `yaml:"when,omitempty" doc:"Condition for linking the spec: ref <op> <version>, exists(path), combined with !, && and ||"`
+	// Optional specs are skipped when their source doesn't exist on the synced ref
+	Optional bool `yaml:"optional,omitempty" doc:"Skip the spec instead of failing when its source doesn't exist"`
+	// OnUpstreamDelete says what sync does with files the upstream has deleted
+	OnUpstreamDelete string `yaml:"on_upstream_delete,omitempty" enum:"keep,remove,warn" doc:"What to do with linked files deleted upstream: keep a pinned copy, remove, or warn (default)"`
 	// If string form is used, both From and To will be the same
 	String string `yaml:"-"`
+	// Manifest marks specs read from the upstream's symlinks_from_upstream file
+	Manifest bool `yaml:"-"`
+	// Component names the components: group the spec was listed under
+	Component string `yaml:"-"`
+}
+
+// JSONSchema describes both the string and the from/to forms of a spec
+func (SymlinkSpec) JSONSchema() map[string]interface{} {
+	type alias SymlinkSpec
+	return map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{
+				"type":        "string",
+				"description": "Path linked to the same location in overlay/",
+			},
+			structSchema(reflect.TypeOf(alias{})),
+		},
+	}
 }
 
 // UnmarshalYAML implements custom YAML unmarshaling
@@ -51,3 +302,189 @@ func (s *SymlinkSpec) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	*s = SymlinkSpec(v)
 	return nil
 }
+
+// MarshalYAML implements custom YAML marshaling, emitting the string form
+// when From and To are the same path
+func (s SymlinkSpec) MarshalYAML() (interface{}, error) {
+	if s.String != "" {
+		return s.String, nil
+	}
+	if s.From != "" && s.From == s.To && s.Upstream == "" && len(s.After) == 0 && s.OnUpstreamDelete == "" && !s.Optional && s.When == "" && len(s.Platforms) == 0 {
+		return s.From, nil
+	}
+
+	type alias SymlinkSpec
+	return alias(s), nil
+}
+
+// GenerateSpec is a small file rendered into overlay/ from a Go template,
+// e.g. a version stamp holding {{ .UpstreamSHA }}
+type GenerateSpec struct {
+	Path    string `yaml:"path" required:"true" doc:"File under overlay/ to write"`
+	Content string `yaml:"content" doc:"Go template rendered with the sync metadata"`
+}
+
+// RenameRule rewrites overlay/ targets matching a regular expression, for
+// layouts that differ from the upstream's in bulk, e.g. ^docs/(.*)$ to
+// handbook/$1
+type RenameRule struct {
+	Match string `yaml:"match" required:"true" doc:"Regular expression matched against targets relative to overlay/"`
+	To    string `yaml:"to" doc:"Replacement, with $1 or ${name} for submatches"`
+}
+
+// renameArrow separates the pattern and replacement of the string form
+const renameArrow = " -> "
+
+// JSONSchema describes both the "match -> to" string and the match/to forms
+// of a rename rule
+func (RenameRule) JSONSchema() map[string]interface{} {
+	type alias RenameRule
+	return map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{
+				"type":        "string",
+				"description": "Regular expression and replacement separated by ' -> '",
+				"pattern":     " -> ",
+			},
+			structSchema(reflect.TypeOf(alias{})),
+		},
+	}
+}
+
+// UnmarshalYAML accepts "match -> to" as well as the match/to form
+func (r *RenameRule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err == nil {
+		match, to, ok := strings.Cut(str, renameArrow)
+		if !ok {
+			return fmt.Errorf("rename rule %q must be 'pattern -> replacement'", str)
+		}
+		r.Match = strings.TrimSpace(match)
+		r.To = strings.TrimSpace(to)
+		return nil
+	}
+
+	type alias RenameRule
+	var v alias
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	*r = RenameRule(v)
+	return nil
+}
+
+// MarshalYAML emits the string form unless the pattern holds the arrow
+func (r RenameRule) MarshalYAML() (interface{}, error) {
+	if !strings.Contains(r.Match, renameArrow) && strings.TrimSpace(r.Match) == r.Match && strings.TrimSpace(r.To) == r.To {
+		return r.Match + renameArrow + r.To, nil
+	}
+	type alias RenameRule
+	return alias(r), nil
+}
+
+// ContentTypeRule skips or moves upstream files by MIME type, for rules
+// paths can't express, such as never linking binaries wherever the upstream
+// puts them
+type ContentTypeRule struct {
+	Type string `yaml:"type" required:"true" doc:"MIME type detected from the file content and extension, or a glob such as image/*"`
+	Path string `yaml:"path,omitempty" doc:"Glob the upstream source or overlay/ target must also match, ** for any number of directories"`
+	Skip bool   `yaml:"skip,omitempty" doc:"Leave matching files out"`
+	To   string `yaml:"to,omitempty" doc:"Directory under overlay/ to move matching targets into, keeping their path"`
+}
+
+// BlockedPath is a glob of paths linking refuses to materialize, such as CI
+// workflows or hooks a compromised upstream could slip into a linked directory
+type BlockedPath struct {
+	Path string `yaml:"path" doc:"Glob matched against upstream sources and overlay/ targets, ** for any number of directories"`
+	// Executable limits the entry to files with an execute bit set
+	Executable bool `yaml:"executable,omitempty" doc:"Only block files with an execute bit set"`
+}
+
+// JSONSchema describes both the string and the path/executable forms of a
+// blocked path
+func (BlockedPath) JSONSchema() map[string]interface{} {
+	type alias BlockedPath
+	return map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{
+				"type":        "string",
+				"description": "Glob matched against upstream sources and overlay/ targets",
+			},
+			structSchema(reflect.TypeOf(alias{})),
+		},
+	}
+}
+
+// UnmarshalYAML accepts a plain glob as well as the path/executable form
+func (b *BlockedPath) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err == nil {
+		b.Path = str
+		return nil
+	}
+
+	type alias BlockedPath
+	var v alias
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	*b = BlockedPath(v)
+	return nil
+}
+
+// MarshalYAML emits the plain glob form when no options are set
+func (b BlockedPath) MarshalYAML() (interface{}, error) {
+	if !b.Executable {
+		return b.Path, nil
+	}
+	type alias BlockedPath
+	return alias(b), nil
+}
+
+// DirSpec is an empty directory created and tracked in overlay/, for
+// directories that must exist but have nothing to link
+type DirSpec struct {
+	Path string `yaml:"path" doc:"Directory under overlay/"`
+	// Keep adds an empty .keep file so the directory survives tools that drop empty ones
+	Keep bool `yaml:"keep,omitempty" doc:"Create an empty .keep file inside the directory"`
+}
+
+// JSONSchema describes both the string and the path/keep forms of a dir
+func (DirSpec) JSONSchema() map[string]interface{} {
+	type alias DirSpec
+	return map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{
+				"type":        "string",
+				"description": "Directory under overlay/",
+			},
+			structSchema(reflect.TypeOf(alias{})),
+		},
+	}
+}
+
+// UnmarshalYAML accepts a plain path as well as the path/keep form
+func (d *DirSpec) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err == nil {
+		d.Path = str
+		return nil
+	}
+
+	type alias DirSpec
+	var v alias
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	*d = DirSpec(v)
+	return nil
+}
+
+// MarshalYAML emits the plain path form when no options are set
+func (d DirSpec) MarshalYAML() (interface{}, error) {
+	if !d.Keep {
+		return d.Path, nil
+	}
+	type alias DirSpec
+	return alias(d), nil
+}
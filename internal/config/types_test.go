@@ -151,3 +151,150 @@ link_mode: "hardlink"`,
 		})
 	}
 }
+
+func TestSymlinkSpecMarshalYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     SymlinkSpec
+		expected string
+	}{
+		{
+			name:     "string form",
+			spec:     SymlinkSpec{String: "app"},
+			expected: "app\n",
+		},
+		{
+			name:     "same from and to",
+			spec:     SymlinkSpec{From: "app", To: "app"},
+			expected: "app\n",
+		},
+		{
+			name:     "struct form",
+			spec:     SymlinkSpec{From: "src/lib", To: "library"},
+			expected: "from: src/lib\nto: library\n",
+		},
+		{
+			name:     "optional",
+			spec:     SymlinkSpec{From: "app", To: "app", Optional: true},
+			expected: "from: app\nto: app\noptional: true\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := yaml.Marshal(tt.spec)
+			if err != nil {
+				t.Fatalf("MarshalYAML() error = %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("MarshalYAML() = %q, want %q", string(got), tt.expected)
+			}
+		})
+	}
+}
+
+func TestDirSpecYAML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  DirSpec
+	}{
+		{name: "string form", input: `var/cache`, want: DirSpec{Path: "var/cache"}},
+		{name: "struct form", input: "path: tmp/uploads\nkeep: true", want: DirSpec{Path: "tmp/uploads", Keep: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got DirSpec
+			if err := yaml.Unmarshal([]byte(tt.input), &got); err != nil {
+				t.Fatalf("UnmarshalYAML() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("UnmarshalYAML() = %+v, want %+v", got, tt.want)
+			}
+
+			// Marshaling round-trips to the same form
+			out, err := yaml.Marshal(got)
+			if err != nil {
+				t.Fatalf("MarshalYAML() error = %v", err)
+			}
+			var back DirSpec
+			if err := yaml.Unmarshal(out, &back); err != nil || back != tt.want {
+				t.Errorf("Round trip = %+v, %v, want %+v", back, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockedPathYAML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  BlockedPath
+	}{
+		{name: "string form", input: `.github/workflows/**`, want: BlockedPath{Path: ".github/workflows/**"}},
+		{name: "struct form", input: "path: '**/*.sh'\nexecutable: true", want: BlockedPath{Path: "**/*.sh", Executable: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got BlockedPath
+			if err := yaml.Unmarshal([]byte(tt.input), &got); err != nil {
+				t.Fatalf("UnmarshalYAML() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("UnmarshalYAML() = %+v, want %+v", got, tt.want)
+			}
+
+			out, err := yaml.Marshal(got)
+			if err != nil {
+				t.Fatalf("MarshalYAML() error = %v", err)
+			}
+			var back BlockedPath
+			if err := yaml.Unmarshal(out, &back); err != nil || back != tt.want {
+				t.Errorf("Round trip = %+v, %v, want %+v", back, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenameRuleYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    RenameRule
+		wantErr bool
+	}{
+		{name: "string form", input: `'^docs/(.*)$ -> handbook/$1'`, want: RenameRule{Match: "^docs/(.*)$", To: "handbook/$1"}},
+		{name: "struct form", input: "match: '^a -> b$'\nto: c", want: RenameRule{Match: "^a -> b$", To: "c"}},
+		{name: "missing arrow", input: `^docs/`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got RenameRule
+			err := yaml.Unmarshal([]byte(tt.input), &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("UnmarshalYAML() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UnmarshalYAML() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("UnmarshalYAML() = %+v, want %+v", got, tt.want)
+			}
+
+			out, err := yaml.Marshal(got)
+			if err != nil {
+				t.Fatalf("MarshalYAML() error = %v", err)
+			}
+			var back RenameRule
+			if err := yaml.Unmarshal(out, &back); err != nil || back != tt.want {
+				t.Errorf("Round trip = %+v, %v, want %+v", back, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package filehash
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+// racyWindow is how recently a file may have changed for its hash not to be
+// kept across runs: a write within the timestamp granularity of the
+// filesystem after hashing wouldn't change its key
+const racyWindow = 2 * time.Second
+
+// entry is the hash of a file's content, with the stat data it was read at
+type entry struct {
+	Size  int64  `json:"size"`
+	MTime int64  `json:"mtime"` // Nanoseconds since the epoch
+	Inode uint64 `json:"inode,omitempty"`
+	Hash  string `json:"hash"`
+}
+
+// matches reports whether a file's stat data is still what it was hashed at
+func (e entry) matches(info os.FileInfo) bool {
+	return e.Size == info.Size() && e.MTime == info.ModTime().UnixNano() && e.Inode == inode(info)
+}
+
+// Cache holds the hashes of files by path, reused while their size, mtime
+// and inode are unchanged. It is safe for concurrent use.
+type Cache struct {
+	path string // Where the cache is saved, empty to keep it in memory
+
+	mu      sync.Mutex
+	entries map[string]entry
+	dirty   bool
+}
+
+// NewCache returns a cache kept in memory only
+func NewCache() *Cache {
+	return &Cache{entries: make(map[string]entry)}
+}
+
+// LoadCache reads the cache saved at path. A missing or unreadable cache
+// starts empty, since every hash can be computed again.
+func LoadCache(path string) *Cache {
+	c := NewCache()
+	c.path = path
+	if data, err := os.ReadFile(path); err == nil {
+		if json.Unmarshal(data, &c.entries) != nil || c.entries == nil {
+			c.entries = make(map[string]entry)
+		}
+	}
+	return c
+}
+
+// Save writes the cache back when it changed. Hashes of files modified within
+// racyWindow are left out, as are files that no longer exist.
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.path == "" || !c.dirty {
+		return nil
+	}
+
+	recent := time.Now().Add(-racyWindow).UnixNano()
+	kept := make(map[string]entry, len(c.entries))
+	for path, e := range c.entries {
+		if e.MTime >= recent {
+			continue
+		}
+		if _, err := os.Lstat(path); err != nil {
+			continue
+		}
+		kept[path] = e
+	}
+	data, err := json.Marshal(kept)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create hash cache directory: %w", err)
+	}
+	// Concurrent runs each write their own temporary file
+	if err := config.WriteFileAtomic(c.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write hash cache: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
+
+// Sum returns the hex XXH64 of the file at path, reading it only when its
+// size, mtime or inode changed since it was last hashed
+func (c *Cache) Sum(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	e, ok := c.entries[path]
+	c.mu.Unlock()
+	if ok && e.matches(info) {
+		return e.Hash, nil
+	}
+
+	sum, err := sumFile(path)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.entries[path] = entry{Size: info.Size(), MTime: info.ModTime().UnixNano(), Inode: inode(info), Hash: sum}
+	c.dirty = true
+	c.mu.Unlock()
+	return sum, nil
+}
+
+// SumAll hashes paths on workers at once, one per CPU when workers is 0, and
+// returns the hashes by path. Files that can't be read are left out.
+func (c *Cache) SumAll(paths []string, workers int) map[string]string {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	sums := make(map[string]string, len(paths))
+	var mu sync.Mutex
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range queue {
+				if sum, err := c.Sum(path); err == nil {
+					mu.Lock()
+					sums[path] = sum
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, path := range paths {
+		queue <- path
+	}
+	close(queue)
+	wg.Wait()
+	return sums
+}
+
+// sumFile returns the hex XXH64 of the file at path
+func sumFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%016x", h.Sum64()), nil
+}
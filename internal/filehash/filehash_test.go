@@ -0,0 +1,137 @@
+package filehash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSum64(t *testing.T) {
+	// Vectors from the reference implementation, seed 0
+	tests := []struct {
+		input string
+		want  uint64
+	}{
+		{input: "", want: 0xef46db3751d8e999},
+		{input: "a", want: 0xd24ec4f1a98c6e5b},
+		{input: "abc", want: 0x44bc2cf5ad770999},
+		{input: "Nobody inspects the spammish repetition", want: 0xfbcea83c8a378bf1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := Sum64([]byte(tt.input)); got != tt.want {
+				t.Errorf("Sum64() = %016x, want %016x", got, tt.want)
+			}
+
+			// Writing in pieces that straddle the 32-byte stripes gives the same sum
+			h := New()
+			for _, c := range []byte(tt.input) {
+				h.Write([]byte{c})
+			}
+			if got := h.Sum64(); got != tt.want {
+				t.Errorf("streamed Sum64() = %016x, want %016x", got, tt.want)
+			}
+		})
+	}
+
+	long := []byte(strings.Repeat("0123456789", 100))
+	h := New()
+	h.Write(long[:7])
+	h.Write(long[7:500])
+	h.Write(long[500:])
+	if h.Sum64() != Sum64(long) {
+		t.Error("Sum64() of a long input differs when written in pieces")
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "cache", "hashes.json")
+
+	var paths []string
+	for i := 0; i < 20; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("f%d.txt", i))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("content %d", i%10)), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+		// Old enough not to be racily clean
+		old := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatalf("Failed to age %s: %v", path, err)
+		}
+		paths = append(paths, path)
+	}
+
+	c := LoadCache(cachePath)
+	sums := c.SumAll(append(paths, filepath.Join(dir, "missing")), 4)
+	if len(sums) != len(paths) {
+		t.Fatalf("SumAll() hashed %d files, want %d", len(sums), len(paths))
+	}
+	if sums[paths[0]] != sums[paths[10]] || sums[paths[0]] == sums[paths[1]] {
+		t.Error("SumAll() hashes don't follow the content")
+	}
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// A cached hash is used while the stat data is unchanged, even when the
+	// content isn't, which is what keying by stat data trades for speed
+	reloaded := LoadCache(cachePath)
+	if len(reloaded.entries) != len(paths) {
+		t.Fatalf("reloaded cache has %d entries, want %d", len(reloaded.entries), len(paths))
+	}
+	e := reloaded.entries[paths[0]]
+	e.Hash = "cached"
+	reloaded.entries[paths[0]] = e
+	if sum, err := reloaded.Sum(paths[0]); err != nil || sum != "cached" {
+		t.Errorf("Sum() of an unchanged file = %q, %v, want the cached hash", sum, err)
+	}
+
+	// A rewrite changes the mtime and the hash is computed again
+	if err := os.WriteFile(paths[0], []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to rewrite file: %v", err)
+	}
+	want := fmt.Sprintf("%016x", Sum64([]byte("changed")))
+	if sum, err := reloaded.Sum(paths[0]); err != nil || sum != want {
+		t.Errorf("Sum() of a changed file = %q, %v, want %q", sum, err, want)
+	}
+
+	// Files changed just now are not saved, in case they change again
+	// within the same timestamp
+	if err := reloaded.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, ok := LoadCache(cachePath).entries[paths[0]]; ok {
+		t.Error("Save() kept the hash of a file modified just now")
+	}
+
+	// Caches saved at once each write their own temporary file
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		c := LoadCache(cachePath)
+		c.dirty = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.Save()
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("concurrent Save() error = %v", err)
+		}
+	}
+	if entries, err := os.ReadDir(filepath.Dir(cachePath)); err != nil || len(entries) != 1 {
+		t.Errorf("cache directory holds %v, %v, want only the cache", entries, err)
+	}
+	if len(LoadCache(cachePath).entries) == 0 {
+		t.Error("concurrent Save() left an empty cache")
+	}
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package filehash
+
+import (
+	"os"
+	"syscall"
+)
+
+// inode returns the inode number of a file, so a file replaced by another
+// with the same size and mtime is hashed again
+func inode(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
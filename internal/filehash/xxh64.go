@@ -0,0 +1,142 @@
+// Package filehash hashes file content quickly for drift checks, with XXH64
+// on parallel workers and a cache keyed by size, mtime and inode. It is not
+// meant for integrity against tampering; the sums file uses SHA-256 for that.
+package filehash
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// XXH64 primes, from the reference implementation
+const (
+	prime1 uint64 = 11400714785074694791
+	prime2 uint64 = 14029467366897019727
+	prime3 uint64 = 1609587929392839161
+	prime4 uint64 = 9650029242287828579
+	prime5 uint64 = 2870177450012600261
+)
+
+// stripe is the block XXH64 consumes in its main loop
+const stripe = 32
+
+func round(acc, input uint64) uint64 {
+	acc += input * prime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * prime1
+}
+
+func mergeRound(acc, val uint64) uint64 {
+	acc ^= round(0, val)
+	return acc*prime1 + prime4
+}
+
+// digest computes XXH64 with seed 0 incrementally
+type digest struct {
+	v1, v2, v3, v4 uint64
+	total          uint64
+	mem            [stripe]byte
+	n              int // Bytes buffered in mem
+}
+
+// New returns an XXH64 hash with seed 0
+func New() hash.Hash64 {
+	d := &digest{}
+	d.Reset()
+	return d
+}
+
+// Sum64 returns the XXH64 of b with seed 0
+func Sum64(b []byte) uint64 {
+	d := digest{}
+	d.Reset()
+	d.Write(b)
+	return d.Sum64()
+}
+
+func (d *digest) Reset() {
+	// Variables, so the sums wrap around as the reference implementation's do
+	p1, p2 := prime1, prime2
+	d.v1 = p1 + p2
+	d.v2 = p2
+	d.v3 = 0
+	d.v4 = -p1
+	d.total = 0
+	d.n = 0
+}
+
+func (d *digest) Size() int      { return 8 }
+func (d *digest) BlockSize() int { return stripe }
+
+func (d *digest) Write(b []byte) (int, error) {
+	written := len(b)
+	d.total += uint64(written)
+
+	if d.n+len(b) < stripe {
+		d.n += copy(d.mem[d.n:], b)
+		return written, nil
+	}
+	if d.n > 0 {
+		c := copy(d.mem[d.n:], b)
+		d.stripes(d.mem[:])
+		b = b[c:]
+		d.n = 0
+	}
+	full := len(b) - len(b)%stripe
+	d.stripes(b[:full])
+	d.n = copy(d.mem[:], b[full:])
+	return written, nil
+}
+
+// stripes runs the main loop over b, a multiple of stripe bytes long
+func (d *digest) stripes(b []byte) {
+	v1, v2, v3, v4 := d.v1, d.v2, d.v3, d.v4
+	for ; len(b) >= stripe; b = b[stripe:] {
+		v1 = round(v1, binary.LittleEndian.Uint64(b[0:8]))
+		v2 = round(v2, binary.LittleEndian.Uint64(b[8:16]))
+		v3 = round(v3, binary.LittleEndian.Uint64(b[16:24]))
+		v4 = round(v4, binary.LittleEndian.Uint64(b[24:32]))
+	}
+	d.v1, d.v2, d.v3, d.v4 = v1, v2, v3, v4
+}
+
+func (d *digest) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, d.Sum64())
+}
+
+func (d *digest) Sum64() uint64 {
+	var h uint64
+	if d.total >= stripe {
+		h = bits.RotateLeft64(d.v1, 1) + bits.RotateLeft64(d.v2, 7) + bits.RotateLeft64(d.v3, 12) + bits.RotateLeft64(d.v4, 18)
+		h = mergeRound(h, d.v1)
+		h = mergeRound(h, d.v2)
+		h = mergeRound(h, d.v3)
+		h = mergeRound(h, d.v4)
+	} else {
+		h = prime5
+	}
+	h += d.total
+
+	b := d.mem[:d.n]
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= round(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*prime1 + prime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * prime1
+		h = bits.RotateLeft64(h, 23)*prime2 + prime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * prime5
+		h = bits.RotateLeft64(h, 11) * prime1
+	}
+
+	h ^= h >> 33
+	h *= prime2
+	h ^= h >> 29
+	h *= prime3
+	h ^= h >> 32
+	return h
+}
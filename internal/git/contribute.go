@@ -0,0 +1,79 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ContributeBranch commits files, mapping paths in the checkout to local
+// files holding their new content, onto a new branch off the commit checked
+// out in dir. The commit is built in a scratch index, so the checkout's HEAD,
+// index and working tree are left as they are. It returns the new commit.
+func ContributeBranch(dir, branch, message string, files map[string]string) (string, error) {
+	head, err := HeadCommit(dir)
+	if err != nil {
+		return "", err
+	}
+	if _, err := gitOutput(dir, "check-ref-format", "--branch", branch); err != nil {
+		return "", fmt.Errorf("invalid branch name %s: %w", branch, err)
+	}
+	if _, err := gitOutput(dir, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+		return "", fmt.Errorf("branch %s already exists in %s", branch, dir)
+	}
+
+	scratch, err := os.MkdirTemp("", "git-overlay-contribute-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(scratch)
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(scratch, "index")}
+
+	if _, err := gitOutputEnv(dir, env, "read-tree", head); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", head, err)
+	}
+	changed := false
+	for path, local := range files {
+		path = filepath.ToSlash(path)
+		// git runs in dir, so relative paths must not reach it
+		local, err := filepath.Abs(local)
+		if err != nil {
+			return "", err
+		}
+		blob, err := gitOutput(dir, "hash-object", "-w", "--", local)
+		if err != nil {
+			return "", fmt.Errorf("failed to store %s: %w", local, err)
+		}
+		if old, err := gitOutput(dir, "rev-parse", "--verify", "--quiet", head+":"+path); err != nil || old != blob {
+			changed = true
+		}
+
+		info, err := os.Stat(local)
+		if err != nil {
+			return "", err
+		}
+		mode := "100644"
+		if info.Mode()&0111 != 0 {
+			mode = "100755"
+		}
+		if _, err := gitOutputEnv(dir, env, "update-index", "--add", "--cacheinfo", mode+","+blob+","+path); err != nil {
+			return "", fmt.Errorf("failed to stage %s: %w", path, err)
+		}
+	}
+	if !changed {
+		return "", fmt.Errorf("no changes from %s to contribute", head)
+	}
+
+	tree, err := gitOutputEnv(dir, env, "write-tree")
+	if err != nil {
+		return "", fmt.Errorf("failed to write tree: %w", err)
+	}
+	commit, err := gitOutput(dir, "commit-tree", tree, "-p", head, "-m", message)
+	if err != nil {
+		return "", fmt.Errorf("failed to commit: %w", err)
+	}
+	if _, err := gitOutput(dir, "branch", branch, commit); err != nil {
+		return "", fmt.Errorf("failed to create branch %s: %w", branch, err)
+	}
+	return commit, nil
+}
@@ -0,0 +1,106 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Deepening fetches this many more commits at first, doubling each round,
+// and fetches the whole history once it would reach maxDeepenStep
+const (
+	firstDeepenStep = 50
+	maxDeepenStep   = 1600
+)
+
+// isShallow reports whether the clone in dir has truncated history
+func isShallow(dir string) bool {
+	out, err := gitOutput(dir, "rev-parse", "--is-shallow-repository")
+	return err == nil && out == "true"
+}
+
+// fetchDepth returns the depth to fetch into repo at: 1 for a shallow clone
+// or one with nothing fetched yet, so syncs only download the commits they
+// check out, and 0 for a clone that already has its whole history
+func fetchDepth(repo *git.Repository) int {
+	if shallow, err := repo.Storer.Shallow(); err == nil && len(shallow) > 0 {
+		return 1
+	}
+	if _, err := repo.Head(); err == plumbing.ErrReferenceNotFound {
+		return 1
+	}
+	return 0
+}
+
+// reindex makes repo see objects fetched into it by the git command line
+func reindex(repo *git.Repository) {
+	if s, ok := repo.Storer.(interface{ Reindex() }); ok {
+		s.Reindex()
+	}
+}
+
+// fetchCommit fetches commit into the shallow clone in dir, for refs naming
+// a commit that isn't the tip of any branch or tag. Servers refusing to send
+// a commit by its id get the whole history fetched instead.
+func fetchCommit(dir, commit string) error {
+	if !isShallow(dir) {
+		return nil
+	}
+	if _, err := fetchOutput(dir, "fetch", "--quiet", "--no-tags", "--depth=1", "origin", commit); err == nil {
+		return nil
+	}
+	return Unshallow(dir)
+}
+
+// ancestorAfterDeepening deepens the shallow clone in dir until commit a
+// shows up in the history of b, and reports whether it did. A clone with its
+// whole history is left alone and reports false.
+func ancestorAfterDeepening(dir string, a, b plumbing.Hash) bool {
+	if !isShallow(dir) {
+		return false
+	}
+	enough := func() bool { return isAncestorCommit(dir, a.String(), b.String()) }
+	return deepenUntil(dir, enough) == nil && enough()
+}
+
+// isAncestorCommit reports whether commit a is in the history of b as far as
+// the clone in dir knows it
+func isAncestorCommit(dir, a, b string) bool {
+	_, err := gitOutput(dir, "merge-base", "--is-ancestor", a, b)
+	return err == nil
+}
+
+// deepenUntil fetches more history into a shallow clone in dir until enough
+// reports true, so syncs can stay shallow and only the commands that read
+// history pay for it. A clone that isn't shallow is left alone.
+func deepenUntil(dir string, enough func() bool) error {
+	if !isShallow(dir) || enough() {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Fetching more history into shallow clone %s\n", dir)
+	for step := firstDeepenStep; step < maxDeepenStep; step *= 2 {
+		if _, err := fetchOutput(dir, "fetch", "--quiet", "--no-tags", "--deepen="+strconv.Itoa(step), "origin"); err != nil {
+			return fmt.Errorf("failed to deepen %s: %w", dir, err)
+		}
+		if !isShallow(dir) || enough() {
+			return nil
+		}
+	}
+	return Unshallow(dir)
+}
+
+// Unshallow fetches the whole history into a shallow clone in dir, for
+// commands such as blame that need all of it
+func Unshallow(dir string) error {
+	if !isShallow(dir) {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Fetching the full history into shallow clone %s\n", dir)
+	if _, err := fetchOutput(dir, "fetch", "--quiet", "--no-tags", "--unshallow", "origin"); err != nil {
+		return fmt.Errorf("failed to unshallow %s: %w", dir, err)
+	}
+	return nil
+}
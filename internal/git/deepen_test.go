@@ -0,0 +1,189 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+func TestDeepenShallowClone(t *testing.T) {
+	tmpDir := t.TempDir()
+	upstreamDir := setupUpstreamRepo(t, tmpDir)
+
+	out, err := exec.Command("git", "-C", upstreamDir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatalf("Failed to read upstream head: %v", err)
+	}
+	first := strings.TrimSpace(string(out))
+	for i := 1; i <= 3; i++ {
+		name := fmt.Sprintf("file%d.txt", i)
+		if err := os.WriteFile(filepath.Join(upstreamDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		for _, args := range [][]string{{"add", name}, {"commit", "-m", "Add " + name}} {
+			if err := runGitCommand(upstreamDir, args); err != nil {
+				t.Fatalf("git %v failed: %v", args, err)
+			}
+		}
+	}
+
+	// Depth only applies to clones over a transport, not local paths
+	cloneDir := filepath.Join(tmpDir, "clone")
+	if err := runGitCommand(tmpDir, []string{"clone", "--quiet", "--depth", "1", "file://" + filepath.ToSlash(upstreamDir), cloneDir}); err != nil {
+		t.Fatalf("Failed to clone upstream: %v", err)
+	}
+	if !isShallow(cloneDir) {
+		t.Fatal("Expected a shallow clone")
+	}
+
+	changes, err := Changelog(cloneDir, first, "HEAD")
+	if err != nil {
+		t.Fatalf("Changelog() error = %v", err)
+	}
+	if len(changes) != 3 {
+		t.Errorf("Changelog() = %v, want the 3 commits after the first", changes)
+	}
+	if isShallow(cloneDir) {
+		t.Error("Expected deepening past the root commit to leave a full clone")
+	}
+
+	// Unshallow fetches everything and is a no-op on a full clone
+	shallowDir := filepath.Join(tmpDir, "shallow")
+	if err := runGitCommand(tmpDir, []string{"clone", "--quiet", "--depth", "1", "file://" + filepath.ToSlash(upstreamDir), shallowDir}); err != nil {
+		t.Fatalf("Failed to clone upstream: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := Unshallow(shallowDir); err != nil {
+			t.Fatalf("Unshallow() error = %v", err)
+		}
+	}
+	if isShallow(shallowDir) {
+		t.Error("Expected Unshallow() to fetch the full history")
+	}
+}
+
+func TestSyncCloneShallow(t *testing.T) {
+	tmpDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	upstreamDir := setupUpstreamRepo(t, tmpDir)
+	commit := func(name string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(upstreamDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		for _, args := range [][]string{{"add", name}, {"commit", "-m", "Add " + name}} {
+			if err := runGitCommand(upstreamDir, args); err != nil {
+				t.Fatalf("git %v failed: %v", args, err)
+			}
+		}
+	}
+
+	first, err := gitOutput(upstreamDir, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to read upstream head: %v", err)
+	}
+	commit("a.txt")
+
+	cloneDir := filepath.Join(tmpDir, "clone")
+	if err := SyncClone(cloneDir, upstreamDir, "main", false); err != nil {
+		t.Fatalf("SyncClone() error = %v", err)
+	}
+	if !isShallow(cloneDir) {
+		t.Fatal("Expected SyncClone() to make a shallow clone")
+	}
+
+	// A fast-forward is not taken for a rewrite behind the shallow boundary
+	commit("b.txt")
+	commit("c.txt")
+	if err := SyncClone(cloneDir, upstreamDir, "main", false); err != nil {
+		t.Fatalf("SyncClone() after fast-forward error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cloneDir, "c.txt")); err != nil {
+		t.Errorf("Expected the new commits to be checked out: %v", err)
+	}
+
+	// A commit that is no tip is fetched when checked out by its id
+	if err := SyncClone(cloneDir, upstreamDir, first, false); err != nil {
+		t.Fatalf("SyncClone() at an older commit error = %v", err)
+	}
+	if head, err := gitOutput(cloneDir, "rev-parse", "HEAD"); err != nil || head != first {
+		t.Errorf("HEAD = %q, %v, want %q", head, err, first)
+	}
+
+	// History readers deepen it
+	changes, err := Changelog(cloneDir, first, "origin/main")
+	if err != nil {
+		t.Fatalf("Changelog() error = %v", err)
+	}
+	if len(changes) != 3 {
+		t.Errorf("Changelog() = %v, want the 3 commits after the first", changes)
+	}
+}
+
+func TestSyncCloneAt(t *testing.T) {
+	tmpDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	upstreamDir := setupUpstreamRepo(t, tmpDir)
+	commit := func(name string) string {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(upstreamDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		for _, args := range [][]string{{"add", name}, {"commit", "-m", "Add " + name}} {
+			if err := runGitCommand(upstreamDir, args); err != nil {
+				t.Fatalf("git %v failed: %v", args, err)
+			}
+		}
+		head, err := gitOutput(upstreamDir, "rev-parse", "HEAD")
+		if err != nil {
+			t.Fatalf("Failed to read upstream head: %v", err)
+		}
+		return head
+	}
+
+	planned := commit("a.txt")
+	commit("b.txt")
+	if err := runGitCommand(upstreamDir, []string{"checkout", "-q", "-b", "other", planned}); err != nil {
+		t.Fatalf("Failed to create branch: %v", err)
+	}
+	elsewhere := commit("c.txt")
+	if err := runGitCommand(upstreamDir, []string{"checkout", "-q", "main"}); err != nil {
+		t.Fatalf("Failed to switch branch: %v", err)
+	}
+
+	// A commit in the branch's history behind the shallow boundary is checked out
+	cloneDir := filepath.Join(tmpDir, "clone")
+	if err := SyncCloneAt(cloneDir, upstreamDir, "main", planned, false); err != nil {
+		t.Fatalf("SyncCloneAt() error = %v", err)
+	}
+	if head, err := gitOutput(cloneDir, "rev-parse", "HEAD"); err != nil || head != planned {
+		t.Errorf("HEAD = %q, %v, want %q", head, err, planned)
+	}
+
+	// One the branch never led to is refused and the checkout stays put
+	if err := SyncCloneAt(cloneDir, upstreamDir, "main", elsewhere, false); !errors.Is(err, overlayerr.ErrPlanDrift) {
+		t.Fatalf("SyncCloneAt() off the branch error = %v, want ErrPlanDrift", err)
+	}
+	if head, err := gitOutput(cloneDir, "rev-parse", "HEAD"); err != nil || head != planned {
+		t.Errorf("HEAD after refusal = %q, %v, want %q", head, err, planned)
+	}
+
+	// CheckoutCommit puts the clone back without fetching
+	if err := SyncClone(cloneDir, upstreamDir, "main", false); err != nil {
+		t.Fatalf("SyncClone() error = %v", err)
+	}
+	if err := CheckoutCommit(cloneDir, planned); err != nil {
+		t.Fatalf("CheckoutCommit() error = %v", err)
+	}
+	if head, err := gitOutput(cloneDir, "rev-parse", "HEAD"); err != nil || head != planned {
+		t.Errorf("HEAD after CheckoutCommit() = %q, %v, want %q", head, err, planned)
+	}
+}
@@ -0,0 +1,137 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+// Kinds of TreeChange
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed" // Content or mode differs
+)
+
+// TreeChange is a file that differs between two commits of an upstream
+type TreeChange struct {
+	Path   string
+	Action string
+}
+
+// DiffRefs lists the files that differ between the commits two refs name in
+// the clone in dir, without touching its worktree. Refs are looked up the way
+// sync checks them out: as a branch of origin, a tag, then a commit. With
+// fetch, origin's branches and tags are fetched first.
+func DiffRefs(dir, from, to string, fetch bool) ([]TreeChange, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", dir, err)
+	}
+
+	if fetch {
+		err := withFetchTimeout(func(ctx context.Context) error {
+			return repo.FetchContext(ctx, &git.FetchOptions{
+				RemoteName: "origin",
+				RemoteURL:  rewriteURL(originURL(repo)),
+				Depth:      fetchDepth(repo),
+				Force:      true,
+				RefSpecs: []config.RefSpec{
+					"+refs/heads/*:refs/remotes/origin/*",
+					"+refs/tags/*:refs/tags/*",
+				},
+			})
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return nil, fmt.Errorf("failed to fetch upstream: %w", err)
+		}
+	}
+
+	fromTree, err := shallowRefTree(repo, dir, from)
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := shallowRefTree(repo, dir, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare %s and %s: %w", from, to, err)
+	}
+
+	changes := make([]TreeChange, 0, len(diff))
+	for _, c := range diff {
+		action, err := c.Action()
+		if err != nil {
+			return nil, err
+		}
+		switch action {
+		case merkletrie.Insert:
+			changes = append(changes, TreeChange{Path: c.To.Name, Action: ChangeAdded})
+		case merkletrie.Delete:
+			changes = append(changes, TreeChange{Path: c.From.Name, Action: ChangeRemoved})
+		default:
+			changes = append(changes, TreeChange{Path: c.To.Name, Action: ChangeChanged})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// shallowRefTree is refTree for the clone in dir, which may be shallow. Its
+// whole history is fetched when ref names a commit older than its tips.
+func shallowRefTree(repo *git.Repository, dir, ref string) (*object.Tree, error) {
+	tree, err := refTree(repo, ref)
+	if err == nil || !isShallow(dir) {
+		return tree, err
+	}
+	if err := Unshallow(dir); err != nil {
+		return nil, err
+	}
+	reindex(repo)
+	return refTree(repo, ref)
+}
+
+// refTree returns the tree of the commit ref names in repo
+func refTree(repo *git.Repository, ref string) (*object.Tree, error) {
+	hash, err := resolveRef(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit %s: %w", ref, err)
+	}
+	return commit.Tree()
+}
+
+// resolveRef finds the commit a ref names, peeling annotated tags
+func resolveRef(repo *git.Repository, ref string) (plumbing.Hash, error) {
+	if r, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", ref), true); err == nil {
+		return r.Hash(), nil
+	}
+	if r, err := repo.Reference(plumbing.NewTagReferenceName(ref), true); err == nil {
+		if tag, err := repo.TagObject(r.Hash()); err == nil {
+			commit, err := tag.Commit()
+			if err != nil {
+				return plumbing.ZeroHash, fmt.Errorf("failed to read tag %s: %w", ref, err)
+			}
+			return commit.Hash, nil
+		}
+		return r.Hash(), nil
+	}
+	if hash, err := repo.ResolveRevision(plumbing.Revision(ref)); err == nil {
+		return *hash, nil
+	}
+	return plumbing.ZeroHash, fmt.Errorf("%w: %s is not a branch, tag or commit of the upstream", overlayerr.ErrRefNotFound, ref)
+}
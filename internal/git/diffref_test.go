@@ -0,0 +1,69 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+func TestDiffRefs(t *testing.T) {
+	tmpDir := t.TempDir()
+	upstreamDir := setupUpstreamRepo(t, tmpDir)
+
+	commit := func(message string, args ...[]string) {
+		t.Helper()
+		for _, a := range args {
+			if err := runGitCommand(upstreamDir, a); err != nil {
+				t.Fatalf("git %v failed: %v", a, err)
+			}
+		}
+		if err := runGitCommand(upstreamDir, []string{"commit", "-q", "-m", message}); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(upstreamDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	write("old.txt", "old")
+	commit("Add old.txt", []string{"add", "old.txt"})
+	// An annotated tag has to be peeled to its commit
+	if err := runGitCommand(upstreamDir, []string{"tag", "-a", "v1", "-m", "v1"}); err != nil {
+		t.Fatalf("Failed to tag v1: %v", err)
+	}
+
+	write("test.txt", "changed content")
+	write("docs/new.txt", "new")
+	commit("Release v2", []string{"add", "test.txt", "docs/new.txt"}, []string{"rm", "-q", "old.txt"})
+	if err := runGitCommand(upstreamDir, []string{"tag", "v2"}); err != nil {
+		t.Fatalf("Failed to tag v2: %v", err)
+	}
+
+	changes, err := DiffRefs(upstreamDir, "v1", "v2", false)
+	if err != nil {
+		t.Fatalf("DiffRefs() error = %v", err)
+	}
+	want := []TreeChange{
+		{Path: "docs/new.txt", Action: ChangeAdded},
+		{Path: "old.txt", Action: ChangeRemoved},
+		{Path: "test.txt", Action: ChangeChanged},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("DiffRefs() = %+v, want %+v", changes, want)
+	}
+
+	if _, err := DiffRefs(upstreamDir, "v1", "v3", false); !errors.Is(err, overlayerr.ErrRefNotFound) {
+		t.Errorf("DiffRefs() to an unknown ref error = %v, want ErrRefNotFound", err)
+	}
+}
@@ -0,0 +1,50 @@
+package git
+
+import (
+	"os"
+	"strings"
+)
+
+// localRepoEnv lists the variables that point git at a repository, as
+// printed by git rev-parse --local-env-vars. Options given with git -c are
+// kept, since they apply to every repository.
+var localRepoEnv = []string{
+	"GIT_ALTERNATE_OBJECT_DIRECTORIES",
+	"GIT_COMMON_DIR",
+	"GIT_CONFIG",
+	"GIT_DIR",
+	"GIT_GRAFT_FILE",
+	"GIT_IMPLICIT_WORK_TREE",
+	"GIT_INDEX_FILE",
+	"GIT_NO_REPLACE_OBJECTS",
+	"GIT_OBJECT_DIRECTORY",
+	"GIT_PREFIX",
+	"GIT_REPLACE_REF_BASE",
+	"GIT_SHALLOW_FILE",
+	"GIT_WORK_TREE",
+}
+
+// UpstreamEnv returns the environment for git commands run in an upstream
+// checkout. Variables locating the overlay repository, set when git-overlay
+// runs as a git subcommand or with --git-dir, are left out so they don't
+// redirect the command away from the checkout, like git does for submodules.
+func UpstreamEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if !isLocalRepoVar(name) {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// isLocalRepoVar reports whether name is one of localRepoEnv
+func isLocalRepoVar(name string) bool {
+	for _, v := range localRepoEnv {
+		if name == v {
+			return true
+		}
+	}
+	return false
+}
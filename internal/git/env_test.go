@@ -0,0 +1,32 @@
+package git
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestUpstreamCommandsIgnoreOverlayGitDir(t *testing.T) {
+	tmpDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	upstreamDir := setupUpstreamRepo(t, tmpDir)
+
+	want, err := gitOutput(upstreamDir, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to read HEAD: %v", err)
+	}
+
+	// As set by git --git-dir or when git-overlay runs from a subdirectory
+	t.Setenv("GIT_DIR", filepath.Join(tmpDir, ".git"))
+	t.Setenv("GIT_WORK_TREE", tmpDir)
+
+	got, err := gitOutput(upstreamDir, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatalf("gitOutput() with GIT_DIR set: %v", err)
+	}
+	if got != want {
+		t.Errorf("gitOutput() = %q, want the upstream HEAD %q", got, want)
+	}
+	if _, err := gitOutput(".", "rev-parse", "HEAD"); err == nil {
+		t.Error("gitOutput(\".\") ignored GIT_DIR for the overlay repository")
+	}
+}
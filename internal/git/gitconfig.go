@@ -0,0 +1,37 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// ConfigSection returns the variables of a git config section as git reads
+// them in the current directory: system, global and repository config, later
+// ones winning. Keys are the rest of the variable name, which git lowercases
+// apart from subsections.
+func ConfigSection(section string) (map[string]string, error) {
+	values := make(map[string]string)
+	out, err := exec.Command("git", "config", "--null", "--get-regexp", "^"+regexp.QuoteMeta(section)+`\.`).Output()
+	if err != nil {
+		// Status 1 means no variable matched
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return values, nil
+		}
+		return nil, fmt.Errorf("failed to read git config %s: %w", section, err)
+	}
+
+	// Each entry is the name, a newline and the value, NUL-terminated; a
+	// variable without a value has no newline
+	for _, record := range strings.Split(string(out), "\x00") {
+		if record == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(record, "\n")
+		values[strings.TrimPrefix(name, strings.ToLower(section)+".")] = value
+	}
+	return values, nil
+}
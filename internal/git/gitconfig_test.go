@@ -0,0 +1,59 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigSection(t *testing.T) {
+	tmpDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	global := filepath.Join(t.TempDir(), "gitconfig")
+	if err := os.WriteFile(global, []byte("[git-overlay]\n\tjobs = 2\n\tcacheDir = /tmp/global\n"), 0644); err != nil {
+		t.Fatalf("Failed to write global config: %v", err)
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", global)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	values, err := ConfigSection("git-overlay")
+	if err != nil {
+		t.Fatalf("ConfigSection() error = %v", err)
+	}
+	if values["jobs"] != "2" || values["cachedir"] != "/tmp/global" {
+		t.Errorf("ConfigSection() = %v, want the global variables", values)
+	}
+
+	// Repository config wins over global, and a variable without a value
+	// is present with an empty one
+	if err := runGitCommand(tmpDir, []string{"config", "git-overlay.jobs", "4"}); err != nil {
+		t.Fatalf("Failed to set git config: %v", err)
+	}
+	f, err := os.OpenFile(filepath.Join(tmpDir, ".git", "config"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open repo config: %v", err)
+	}
+	f.WriteString("[git-overlay]\n\twatchAutoSync\n[git-overlay-other]\n\tjobs = 9\n")
+	f.Close()
+
+	values, err = ConfigSection("git-overlay")
+	if err != nil {
+		t.Fatalf("ConfigSection() error = %v", err)
+	}
+	if values["jobs"] != "4" {
+		t.Errorf("ConfigSection() jobs = %q, want the repository's 4", values["jobs"])
+	}
+	if v, ok := values["watchautosync"]; !ok || v != "" {
+		t.Errorf("ConfigSection() watchautosync = %q, %v, want an empty value", v, ok)
+	}
+	if len(values) != 3 {
+		t.Errorf("ConfigSection() = %v, want only the git-overlay section", values)
+	}
+
+	// An empty section is no error
+	values, err = ConfigSection("git-overlay-missing")
+	if err != nil || len(values) != 0 {
+		t.Errorf("ConfigSection() of a missing section = %v, %v, want empty", values, err)
+	}
+}
@@ -0,0 +1,116 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DeletedFileContent returns the last committed content of a file that no
+// longer exists at the commit checked out in dir. It needs the history of
+// the file, so a shallow clone is unshallowed when the deletion isn't in the
+// history it has.
+func DeletedFileContent(dir, path string) ([]byte, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return nil, fmt.Errorf("%s is not a git checkout", dir)
+	}
+
+	path = filepath.ToSlash(path)
+	commit, err := gitOutput(dir, "log", "-1", "--format=%H", "--diff-filter=D", "HEAD", "--", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the deletion of %s: %w", path, err)
+	}
+	if commit == "" && isShallow(dir) {
+		if err := Unshallow(dir); err != nil {
+			return nil, err
+		}
+		if commit, err = gitOutput(dir, "log", "-1", "--format=%H", "--diff-filter=D", "HEAD", "--", path); err != nil {
+			return nil, fmt.Errorf("failed to find the deletion of %s: %w", path, err)
+		}
+	}
+	if commit == "" {
+		return nil, fmt.Errorf("no deletion of %s in the history of %s", path, dir)
+	}
+
+	// Content must not be trimmed, unlike gitOutput
+	show := exec.Command("git", "-C", dir, "show", commit+"^:"+path)
+	show.Env = UpstreamEnv()
+	out, err := show.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s before %s: %w", path, commit, err)
+	}
+	return out, nil
+}
+
+// Changelog lists the commits between from and to in dir, newest first, as
+// abbreviated hash and subject. Merge commits are left out. A shallow clone
+// is deepened until from is in the history of to.
+func Changelog(dir, from, to string) ([]string, error) {
+	if err := deepenUntil(dir, func() bool { return isAncestorCommit(dir, from, to) }); err != nil {
+		return nil, err
+	}
+	out, err := gitOutput(dir, "log", "--no-merges", "--format=%h %s", from+".."+to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits %s..%s: %w", from, to, err)
+	}
+	if out == "" {
+		return nil, nil
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// HeadCommit returns the commit checked out in dir
+func HeadCommit(dir string) (string, error) {
+	commit, err := gitOutput(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to read HEAD: %w", err)
+	}
+	return commit, nil
+}
+
+// Log lists the last n commits at HEAD in dir, newest first, as abbreviated
+// hash and subject. Merge commits are left out. A shallow clone is deepened
+// until it has n commits.
+func Log(dir string, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	enough := func() bool {
+		count, err := gitOutput(dir, "rev-list", "--count", "HEAD")
+		c, _ := strconv.Atoi(count)
+		return err == nil && c >= n
+	}
+	if err := deepenUntil(dir, enough); err != nil {
+		return nil, err
+	}
+	return LocalLog(dir, n)
+}
+
+// LocalLog is Log without fetching: a shallow clone lists only the commits
+// it already has, for commands that must not reach the remote
+func LocalLog(dir string, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	out, err := gitOutput(dir, "log", "--no-merges", "--format=%h %s", "-n", strconv.Itoa(n), "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits in %s: %w", dir, err)
+	}
+	if out == "" {
+		return nil, nil
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// NearestTag returns the newest tag reachable from HEAD in dir, or "" when
+// there is none, as in clones made without tags
+func NearestTag(dir string) string {
+	tag, err := gitOutput(dir, "describe", "--tags", "--abbrev=0", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return tag
+}
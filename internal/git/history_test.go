@@ -0,0 +1,108 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeletedFileContent(t *testing.T) {
+	tmpDir := t.TempDir()
+	upstreamDir := setupUpstreamRepo(t, tmpDir)
+
+	if _, err := DeletedFileContent(upstreamDir, "test.txt"); err == nil {
+		t.Error("DeletedFileContent() succeeded for a file that was never deleted")
+	}
+
+	if err := runGitCommand(upstreamDir, []string{"rm", "-q", "test.txt"}); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if err := runGitCommand(upstreamDir, []string{"commit", "-m", "Remove test.txt"}); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	content, err := DeletedFileContent(upstreamDir, "test.txt")
+	if err != nil {
+		t.Fatalf("DeletedFileContent() error = %v", err)
+	}
+	if string(content) != "test content" {
+		t.Errorf("DeletedFileContent() = %q, want %q", content, "test content")
+	}
+
+	if _, err := DeletedFileContent(filepath.Join(tmpDir, "missing"), "test.txt"); err == nil {
+		t.Error("DeletedFileContent() succeeded outside a git checkout")
+	}
+}
+
+func TestChangelog(t *testing.T) {
+	tmpDir := t.TempDir()
+	upstreamDir := setupUpstreamRepo(t, tmpDir)
+
+	from, err := gitOutput(upstreamDir, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to read HEAD: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(upstreamDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		if err := runGitCommand(upstreamDir, []string{"add", name}); err != nil {
+			t.Fatalf("Failed to add %s: %v", name, err)
+		}
+		if err := runGitCommand(upstreamDir, []string{"commit", "-m", "Add " + name}); err != nil {
+			t.Fatalf("Failed to commit %s: %v", name, err)
+		}
+	}
+
+	log, err := Changelog(upstreamDir, from, "HEAD")
+	if err != nil {
+		t.Fatalf("Changelog() error = %v", err)
+	}
+	if len(log) != 2 || !strings.HasSuffix(log[0], " Add b.txt") || !strings.HasSuffix(log[1], " Add a.txt") {
+		t.Errorf("Changelog() = %q, want the two new commits newest first", log)
+	}
+
+	if log, err := Changelog(upstreamDir, "HEAD", "HEAD"); err != nil || len(log) != 0 {
+		t.Errorf("Changelog() of an empty range = %q, %v", log, err)
+	}
+}
+
+func TestLogAndNearestTag(t *testing.T) {
+	tmpDir := t.TempDir()
+	upstreamDir := setupUpstreamRepo(t, tmpDir)
+
+	if tag := NearestTag(upstreamDir); tag != "" {
+		t.Errorf("NearestTag() without tags = %q, want empty", tag)
+	}
+	if err := runGitCommand(upstreamDir, []string{"tag", "v1.0.0"}); err != nil {
+		t.Fatalf("Failed to tag: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(upstreamDir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatalf("Failed to create a.txt: %v", err)
+	}
+	for _, args := range [][]string{{"add", "a.txt"}, {"commit", "-m", "Add a.txt"}} {
+		if err := runGitCommand(upstreamDir, args); err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+	}
+
+	// The tag is still the nearest one after a later commit
+	if tag := NearestTag(upstreamDir); tag != "v1.0.0" {
+		t.Errorf("NearestTag() = %q, want v1.0.0", tag)
+	}
+
+	log, err := Log(upstreamDir, 1)
+	if err != nil {
+		t.Fatalf("Log() error = %v", err)
+	}
+	if len(log) != 1 || !strings.HasSuffix(log[0], " Add a.txt") {
+		t.Errorf("Log(1) = %q, want the latest commit", log)
+	}
+	if log, err := Log(upstreamDir, 10); err != nil || len(log) != 2 {
+		t.Errorf("Log(10) = %q, %v, want every commit", log, err)
+	}
+	if log, err := Log(upstreamDir, 0); err != nil || len(log) != 0 {
+		t.Errorf("Log(0) = %q, %v, want nothing", log, err)
+	}
+}
@@ -0,0 +1,159 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TreeEntry is a file in an upstream tree
+type TreeEntry struct {
+	Mode string `json:"mode"` // Git file mode, e.g. 100644, 100755 or 120000
+	Size int64  `json:"size"`
+	Blob string `json:"blob"` // Git blob hash of the content
+}
+
+// TreeIndex maps paths in an upstream checkout to their entries at a commit
+type TreeIndex struct {
+	Commit  string               `json:"commit"`
+	Entries map[string]TreeEntry `json:"entries"`
+}
+
+// LoadTreeIndex returns the index of the commit checked out in dir, reading
+// it from cacheDir when one was built for that commit and building and
+// persisting it otherwise. A new commit invalidates the cached index. The
+// index describes the files in dir only while none of them differ from the
+// commit, so a checkout with local changes has none.
+func LoadTreeIndex(dir, cacheDir string) (*TreeIndex, error) {
+	// Without its own .git, git would find an enclosing repository instead
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return nil, fmt.Errorf("%s is not a git checkout", dir)
+	}
+
+	commit, err := gitOutput(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checked out commit: %w", err)
+	}
+
+	// Untracked files aren't in the index, so lookups miss them anyway
+	changes, err := gitOutput(dir, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %s for local changes: %w", dir, err)
+	}
+	if changes != "" {
+		return nil, fmt.Errorf("%s has local changes", dir)
+	}
+	return LoadCommitIndex(dir, commit, cacheDir)
+}
+
+// LoadCommitIndex returns the index of any commit the checkout in dir has,
+// such as the one a file was last synced from, cached like LoadTreeIndex
+func LoadCommitIndex(dir, commit, cacheDir string) (*TreeIndex, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return nil, fmt.Errorf("%s is not a git checkout", dir)
+	}
+
+	path := filepath.Join(cacheDir, commit+".json")
+	if data, err := os.ReadFile(path); err == nil {
+		var idx TreeIndex
+		if err := json.Unmarshal(data, &idx); err == nil && idx.Commit == commit {
+			return &idx, nil
+		}
+	}
+
+	idx, err := buildTreeIndex(dir, commit)
+	if err != nil {
+		return nil, err
+	}
+
+	// The index is only a cache, so failing to persist it is not an error
+	if data, err := json.Marshal(idx); err == nil {
+		if err := os.MkdirAll(cacheDir, 0755); err == nil {
+			os.WriteFile(path, data, 0644)
+		}
+	}
+	return idx, nil
+}
+
+// buildTreeIndex lists every blob of commit with its mode, size and hash
+func buildTreeIndex(dir, commit string) (*TreeIndex, error) {
+	out, err := gitOutput(dir, "ls-tree", "-r", "-l", "-z", "--full-tree", commit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list upstream tree: %w", err)
+	}
+
+	idx := &TreeIndex{Commit: commit, Entries: make(map[string]TreeEntry)}
+	for _, record := range strings.Split(out, "\x00") {
+		// <mode> SP <type> SP <object> SP+ <size> TAB <path>
+		meta, path, ok := strings.Cut(record, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 4 || fields[1] != "blob" {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[3], 10, 64)
+		idx.Entries[path] = TreeEntry{Mode: fields[0], Size: size, Blob: fields[2]}
+	}
+	return idx, nil
+}
+
+// Lookup returns the entry for a slash-separated path in the tree
+func (idx *TreeIndex) Lookup(path string) (TreeEntry, bool) {
+	e, ok := idx.Entries[filepath.ToSlash(path)]
+	return e, ok
+}
+
+// Matches reports whether the file at path has the entry's content, checking
+// the size before hashing anything
+func (e TreeEntry) Matches(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if info.Size() != e.Size {
+		return false, nil
+	}
+	blob, err := BlobHash(path, len(e.Blob) == sha256.Size*2)
+	if err != nil {
+		return false, err
+	}
+	return blob == e.Blob, nil
+}
+
+// BlobHash computes the git blob hash of a file, using SHA-256 for
+// repositories in the SHA-256 object format
+func BlobHash(path string, sha256Format bool) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	var h hash.Hash = sha1.New()
+	if sha256Format {
+		h = sha256.New()
+	}
+	var header bytes.Buffer
+	fmt.Fprintf(&header, "blob %d\x00", info.Size())
+	h.Write(header.Bytes())
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
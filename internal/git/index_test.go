@@ -0,0 +1,100 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTreeIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	upstreamDir := setupUpstreamRepo(t, tmpDir)
+	cacheDir := filepath.Join(tmpDir, "cache")
+
+	idx, err := LoadTreeIndex(upstreamDir, cacheDir)
+	if err != nil {
+		t.Fatalf("LoadTreeIndex() error = %v", err)
+	}
+	entry, ok := idx.Lookup("test.txt")
+	if !ok {
+		t.Fatal("test.txt missing from index")
+	}
+	if entry.Mode != "100644" || entry.Size != int64(len("test content")) {
+		t.Errorf("Entry = %+v", entry)
+	}
+
+	// The blob hash matches what git computes for the checked out file
+	want, err := gitOutput(upstreamDir, "hash-object", "test.txt")
+	if err != nil {
+		t.Fatalf("Failed to hash file: %v", err)
+	}
+	if entry.Blob != want {
+		t.Errorf("Blob = %s, want %s", entry.Blob, want)
+	}
+	if ok, err := entry.Matches(filepath.Join(upstreamDir, "test.txt")); err != nil || !ok {
+		t.Errorf("Matches() = %v, %v, want true", ok, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(cacheDir, idx.Commit+".json")); err != nil {
+		t.Errorf("Index was not persisted: %v", err)
+	}
+
+	// A new commit invalidates the cached index
+	if err := os.WriteFile(filepath.Join(upstreamDir, "new.txt"), []byte("new"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := runGitCommand(upstreamDir, []string{"add", "new.txt"}); err != nil {
+		t.Fatalf("Failed to add file: %v", err)
+	}
+	if err := runGitCommand(upstreamDir, []string{"commit", "-m", "Add new.txt"}); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	next, err := LoadTreeIndex(upstreamDir, cacheDir)
+	if err != nil {
+		t.Fatalf("LoadTreeIndex() error = %v", err)
+	}
+	if next.Commit == idx.Commit {
+		t.Error("Index was not rebuilt for the new commit")
+	}
+	if _, ok := next.Lookup("new.txt"); !ok {
+		t.Error("new.txt missing from rebuilt index")
+	}
+
+	// An edited checkout no longer matches its commit, so it has no index
+	if err := os.WriteFile(filepath.Join(upstreamDir, "test.txt"), []byte("edited"), 0644); err != nil {
+		t.Fatalf("Failed to edit file: %v", err)
+	}
+	if _, err := LoadTreeIndex(upstreamDir, cacheDir); err == nil {
+		t.Error("LoadTreeIndex() of an edited checkout returned an index")
+	}
+	if err := os.Remove(filepath.Join(upstreamDir, "test.txt")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if _, err := LoadTreeIndex(upstreamDir, cacheDir); err == nil {
+		t.Error("LoadTreeIndex() of a checkout missing a file returned an index")
+	}
+}
+
+func TestTreeEntryMatches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	// git hash-object of "hello\n"
+	entry := TreeEntry{Size: 6, Blob: "ce013625030ba8dba906f756967f9e9ca394464a"}
+	if ok, err := entry.Matches(path); err != nil || !ok {
+		t.Errorf("Matches() = %v, %v, want true", ok, err)
+	}
+
+	entry.Blob = "0000000000000000000000000000000000000000"
+	if ok, _ := entry.Matches(path); ok {
+		t.Error("Matches() = true for a different blob")
+	}
+
+	entry.Size = 7
+	if ok, _ := entry.Matches(path); ok {
+		t.Error("Matches() = true for a different size")
+	}
+}
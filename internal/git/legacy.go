@@ -0,0 +1,156 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/config"
+)
+
+// Submodule is a submodule of the repository in the current directory
+type Submodule struct {
+	Name   string
+	Path   string
+	URL    string
+	Branch string // Branch tracked by git submodule update --remote, if any
+	Commit string // Commit recorded in HEAD, empty when not committed yet
+}
+
+// Subtree is a directory merged in with git subtree
+type Subtree struct {
+	Dir    string
+	Commit string // Upstream commit of the latest add, merge or pull
+}
+
+// ListSubmodules reads the submodules in .gitmodules and the commits HEAD
+// records for them, sorted by path
+func ListSubmodules() ([]Submodule, error) {
+	data, err := os.ReadFile(gitmodulesFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", gitmodulesFile, err)
+	}
+	modules := config.NewModules()
+	if err := modules.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", gitmodulesFile, err)
+	}
+
+	var subs []Submodule
+	for _, m := range modules.Submodules {
+		sub := Submodule{Name: m.Name, Path: m.Path, URL: m.URL, Branch: m.Branch}
+		// Output is "160000 commit <hash>\t<path>"
+		if out, err := gitOutput(".", "ls-tree", "HEAD", "--", m.Path); err == nil {
+			if fields := strings.Fields(out); len(fields) >= 3 && fields[1] == "commit" {
+				sub.Commit = fields[2]
+			}
+		}
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].Path < subs[j].Path })
+	return subs, nil
+}
+
+// ListSubtrees finds the directories added with git subtree from the
+// git-subtree-dir and git-subtree-split trailers it writes in commit messages,
+// sorted by directory
+func ListSubtrees() ([]Subtree, error) {
+	if _, err := gitOutput(".", "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		return nil, nil
+	}
+	out, err := gitOutput(".", "log", "--format=%B%x00", "--grep=^git-subtree-dir:", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to search history for subtrees: %w", err)
+	}
+
+	// The log is newest first, so the first commit seen for a directory is
+	// the one it was last updated to
+	seen := make(map[string]bool)
+	var subtrees []Subtree
+	for _, message := range strings.Split(out, "\x00") {
+		var st Subtree
+		for _, line := range strings.Split(message, "\n") {
+			line = strings.TrimSpace(line)
+			if dir, ok := strings.CutPrefix(line, "git-subtree-dir:"); ok {
+				st.Dir = strings.Trim(strings.TrimSpace(dir), "/")
+			} else if split, ok := strings.CutPrefix(line, "git-subtree-split:"); ok {
+				st.Commit = strings.TrimSpace(split)
+			}
+		}
+		if st.Dir == "" || seen[st.Dir] {
+			continue
+		}
+		seen[st.Dir] = true
+		subtrees = append(subtrees, st)
+	}
+	sort.Slice(subtrees, func(i, j int) bool { return subtrees[i].Dir < subtrees[j].Dir })
+	return subtrees, nil
+}
+
+// SuperprojectRemoteURL returns the URL of the remote relative submodule URLs
+// are resolved against: the current branch's remote, or origin. It is empty
+// when the repository has no such remote.
+func SuperprojectRemoteURL() string {
+	remote := "origin"
+	if branch, err := gitOutput(".", "symbolic-ref", "--quiet", "--short", "HEAD"); err == nil {
+		if name, err := gitOutput(".", "config", "--get", "branch."+branch+".remote"); err == nil && name != "" && name != "." {
+			remote = name
+		}
+	}
+	url, err := gitOutput(".", "config", "--get", "remote."+remote+".url")
+	if err != nil {
+		return ""
+	}
+	return url
+}
+
+// IsRelativeURL reports whether a submodule URL is relative to the
+// superproject's remote, starting with ./ or ../
+func IsRelativeURL(url string) bool {
+	return strings.HasPrefix(url, "./") || strings.HasPrefix(url, "../")
+}
+
+// ResolveSubmoduleURL resolves the relative submodule URL rel against the
+// superproject's remote URL base the way git does: each ../ drops the last
+// path component of base. It fails when rel climbs above the host.
+func ResolveSubmoduleURL(base, rel string) (string, error) {
+	url := rel
+	// The scheme and host, the host of a scp-like URL, or the root of a path
+	// are kept whole
+	prefix, dir := "", strings.TrimSuffix(base, "/")
+	if i := strings.Index(dir, "://"); i >= 0 {
+		if j := strings.Index(dir[i+3:], "/"); j >= 0 {
+			prefix, dir = dir[:i+3+j+1], dir[i+3+j+1:]
+		} else {
+			prefix, dir = dir+"/", ""
+		}
+	} else if i := strings.Index(dir, ":"); i >= 0 && !strings.Contains(dir[:i], "/") {
+		prefix, dir = dir[:i+1], dir[i+1:]
+	} else if rest, ok := strings.CutPrefix(dir, "/"); ok {
+		prefix, dir = "/", rest
+	}
+
+	for {
+		if rest, ok := strings.CutPrefix(rel, "./"); ok {
+			rel = rest
+		} else if rest, ok := strings.CutPrefix(rel, "../"); ok {
+			if dir == "" {
+				return "", fmt.Errorf("submodule URL %s climbs above %s", url, base)
+			}
+			rel = rest
+			if i := strings.LastIndex(dir, "/"); i >= 0 {
+				dir = dir[:i]
+			} else {
+				dir = ""
+			}
+		} else {
+			break
+		}
+	}
+	if dir == "" {
+		return prefix + rel, nil
+	}
+	return prefix + dir + "/" + rel, nil
+}
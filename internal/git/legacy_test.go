@@ -0,0 +1,78 @@
+package git
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestListSubmodulesAndSubtrees(t *testing.T) {
+	tmpDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	// An empty repository has neither
+	if subtrees, err := ListSubtrees(); err != nil || len(subtrees) != 0 {
+		t.Fatalf("ListSubtrees() in an empty repository = %v, %v", subtrees, err)
+	}
+
+	upstreamDir := setupUpstreamRepo(t, tmpDir)
+	for _, args := range [][]string{
+		{"-c", "protocol.file.allow=always", "submodule", "add", "-b", "main", upstreamDir, "vendor/lib"},
+		{"commit", "-m", "Add vendor/lib"},
+		// git subtree records the upstream commit in trailers like these
+		{"commit", "--allow-empty", "-m", "Squashed 'third/tool/' content from commit 1111111\n\ngit-subtree-dir: third/tool\ngit-subtree-split: 1111111111111111111111111111111111111111"},
+		{"commit", "--allow-empty", "-m", "Squashed 'third/tool/' changes from 1111111..2222222\n\ngit-subtree-dir: third/tool\ngit-subtree-split: 2222222222222222222222222222222222222222"},
+	} {
+		if err := runGitCommand(tmpDir, args); err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+	}
+	out, err := exec.Command("git", "-C", upstreamDir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatalf("Failed to read upstream head: %v", err)
+	}
+
+	subs, err := ListSubmodules()
+	if err != nil {
+		t.Fatalf("ListSubmodules() error = %v", err)
+	}
+	if len(subs) != 1 {
+		t.Fatalf("ListSubmodules() = %+v, want vendor/lib", subs)
+	}
+	want := Submodule{Name: "vendor/lib", Path: "vendor/lib", URL: upstreamDir, Branch: "main", Commit: strings.TrimSpace(string(out))}
+	if subs[0] != want {
+		t.Errorf("ListSubmodules() = %+v, want %+v", subs[0], want)
+	}
+
+	subtrees, err := ListSubtrees()
+	if err != nil {
+		t.Fatalf("ListSubtrees() error = %v", err)
+	}
+	if len(subtrees) != 1 || subtrees[0].Dir != "third/tool" || subtrees[0].Commit != strings.Repeat("2", 40) {
+		t.Errorf("ListSubtrees() = %+v, want third/tool at the latest split", subtrees)
+	}
+}
+
+func TestResolveSubmoduleURL(t *testing.T) {
+	tests := []struct {
+		base    string
+		rel     string
+		want    string
+		wantErr bool
+	}{
+		{"https://example.com/org/app.git", "../lib.git", "https://example.com/org/lib.git", false},
+		{"https://example.com/org/app.git/", "./lib.git", "https://example.com/org/app.git/lib.git", false},
+		{"https://example.com/org/app.git", "../../other/lib.git", "https://example.com/other/lib.git", false},
+		{"https://example.com/org/app.git", "../../../lib.git", "", true},
+		{"git@example.com:org/app.git", "../lib.git", "git@example.com:org/lib.git", false},
+		{"git@example.com:app.git", "../lib.git", "git@example.com:lib.git", false},
+		{"/srv/git/app.git", "../lib.git", "/srv/git/lib.git", false},
+		{"/app.git", "../lib.git", "/lib.git", false},
+	}
+	for _, tt := range tests {
+		got, err := ResolveSubmoduleURL(tt.base, tt.rel)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ResolveSubmoduleURL(%q, %q) = %q, %v, want %q", tt.base, tt.rel, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package git
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// withMirrors calls fetch with primary and then each mirror in turn until one
+// can be reached, returning the URL that worked. An empty primary stands for
+// the URL configured for origin. Without mirrors, fetch is called once. URLs
+// are rewritten as set with SetURLRewrites before fetch sees them.
+func withMirrors(primary string, mirrors []string, fetch func(url string) error) (string, error) {
+	urls := append([]string{primary}, mirrors...)
+	var err error
+	for i, url := range urls {
+		rewritten := rewriteURL(url)
+		err = fetch(rewritten)
+		if err == nil || err == git.NoErrAlreadyUpToDate {
+			return rewritten, err
+		}
+		if i+1 < len(urls) {
+			name := url
+			if name == "" {
+				name = "origin"
+			}
+			fmt.Fprintf(os.Stderr, "Warning: failed to reach %s (%v), trying mirror %s\n", name, err, urls[i+1])
+		}
+	}
+	return "", err
+}
@@ -0,0 +1,142 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// Comparison describes how far a checked-out upstream is behind its remote
+type Comparison struct {
+	Current       string   `json:"current"`
+	Latest        string   `json:"latest"`
+	CommitsBehind int      `json:"commits_behind"`
+	LatestTag     string   `json:"latest_tag,omitempty"`
+	NewerTags     []string `json:"newer_tags,omitempty"`
+}
+
+// Outdated reports whether the remote has moved past the current version
+func (c *Comparison) Outdated() bool {
+	return c.Current != c.Latest || c.CommitsBehind > 0 || len(c.NewerTags) > 0
+}
+
+// CompareUpstream compares the commit checked out in dir with the remote tip
+// of ref and the remote's semver tags. Only objects are fetched; the checkout
+// and local refs are left untouched.
+func CompareUpstream(dir, ref string) (*Comparison, error) {
+	current, err := gitOutput(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read synced commit: %w", err)
+	}
+
+	remote, err := remoteRefs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Comparison{Current: current, Latest: current}
+
+	if tip, ok := remote["refs/heads/"+ref]; ok {
+		c.Latest = tip
+		if tip != current {
+			if _, err := fetchOutput(dir, "fetch", "--quiet", "--no-tags", "--no-write-fetch-head", "origin", tip); err != nil {
+				// Servers may refuse fetching by id; fall back to the branch
+				if _, err := fetchOutput(dir, "fetch", "--quiet", "--no-tags", "--no-write-fetch-head", "origin", "refs/heads/"+ref); err != nil {
+					return nil, fmt.Errorf("failed to fetch %s: %w", ref, err)
+				}
+			}
+			// Only commits back to the checked-out one are counted
+			if err := deepenUntil(dir, func() bool { return isAncestorCommit(dir, current, tip) }); err != nil {
+				return nil, err
+			}
+			count, err := gitOutput(dir, "rev-list", "--count", current+".."+tip)
+			if err != nil {
+				return nil, fmt.Errorf("failed to count commits: %w", err)
+			}
+			c.CommitsBehind, _ = strconv.Atoi(count)
+		}
+	}
+
+	// Prereleases are not offered as upgrades
+	var tags []string
+	for name := range remote {
+		if tag, ok := strings.CutPrefix(name, "refs/tags/"); ok && semver.IsValid(tag) && semver.Prerelease(tag) == "" {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return semver.Compare(tags[i], tags[j]) < 0 })
+	if len(tags) > 0 {
+		c.LatestTag = tags[len(tags)-1]
+	}
+
+	// Only a semver tag ref can be behind newer tags
+	if semver.IsValid(ref) {
+		if _, ok := remote["refs/tags/"+ref]; ok {
+			for _, tag := range tags {
+				if semver.Compare(tag, ref) > 0 {
+					c.NewerTags = append(c.NewerTags, tag)
+				}
+			}
+			if c.LatestTag != "" {
+				c.Latest = remote["refs/tags/"+c.LatestTag]
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// remoteRefs lists the refs of origin, resolving annotated tags to commits
+func remoteRefs(dir string) (map[string]string, error) {
+	out, err := fetchOutput(dir, "ls-remote", "origin")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote refs: %w", err)
+	}
+
+	refs := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		hash, name, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		if peeled, ok := strings.CutSuffix(name, "^{}"); ok {
+			refs[peeled] = hash
+			continue
+		}
+		if _, seen := refs[name]; !seen {
+			refs[name] = hash
+		}
+	}
+	return refs, nil
+}
+
+// gitOutput runs git in dir and returns its trimmed stdout
+func gitOutput(dir string, args ...string) (string, error) {
+	return gitOutputEnv(dir, nil, args...)
+}
+
+// gitOutputEnv is gitOutput with extra environment variables. Only dir "."
+// is the overlay repository, which GIT_DIR and GIT_WORK_TREE may name.
+func gitOutputEnv(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", append(append(rewriteArgs(), "-C", dir), args...)...)
+	if dir != "." {
+		cmd.Env = append(UpstreamEnv(), env...)
+	} else if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
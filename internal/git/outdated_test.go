@@ -0,0 +1,81 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompareUpstream(t *testing.T) {
+	tmpDir := t.TempDir()
+	upstreamDir := setupUpstreamRepo(t, tmpDir)
+
+	if err := runGitCommand(upstreamDir, []string{"tag", "-a", "v1.0.0", "-m", "v1.0.0"}); err != nil {
+		t.Fatalf("Failed to tag upstream: %v", err)
+	}
+
+	cloneDir := filepath.Join(tmpDir, "clone")
+	if err := runGitCommand(tmpDir, []string{"clone", "--quiet", upstreamDir, cloneDir}); err != nil {
+		t.Fatalf("Failed to clone upstream: %v", err)
+	}
+
+	for i, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(upstreamDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		if err := runGitCommand(upstreamDir, []string{"add", name}); err != nil {
+			t.Fatalf("Failed to add %s: %v", name, err)
+		}
+		if err := runGitCommand(upstreamDir, []string{"commit", "-m", "Add " + name}); err != nil {
+			t.Fatalf("Failed to commit %s: %v", name, err)
+		}
+		if i == 0 {
+			if err := runGitCommand(upstreamDir, []string{"tag", "v1.1.0"}); err != nil {
+				t.Fatalf("Failed to tag upstream: %v", err)
+			}
+			if err := runGitCommand(upstreamDir, []string{"tag", "v1.2.0-rc.1"}); err != nil {
+				t.Fatalf("Failed to tag upstream: %v", err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name          string
+		ref           string
+		commitsBehind int
+		newerTags     []string
+	}{
+		{name: "branch", ref: "main", commitsBehind: 2},
+		{name: "tag", ref: "v1.0.0", newerTags: []string{"v1.1.0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CompareUpstream(cloneDir, tt.ref)
+			if err != nil {
+				t.Fatalf("CompareUpstream() error = %v", err)
+			}
+			if got.CommitsBehind != tt.commitsBehind {
+				t.Errorf("CommitsBehind = %d, want %d", got.CommitsBehind, tt.commitsBehind)
+			}
+			if !reflect.DeepEqual(got.NewerTags, tt.newerTags) {
+				t.Errorf("NewerTags = %v, want %v", got.NewerTags, tt.newerTags)
+			}
+			if got.LatestTag != "v1.1.0" {
+				t.Errorf("LatestTag = %q, want %q", got.LatestTag, "v1.1.0")
+			}
+			if !got.Outdated() {
+				t.Error("Outdated() = false, want true")
+			}
+		})
+	}
+
+	head, err := gitOutput(cloneDir, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to read clone HEAD: %v", err)
+	}
+	if origin, _ := gitOutput(cloneDir, "rev-parse", "origin/main"); origin != head {
+		t.Errorf("CompareUpstream moved origin/main to %s, want %s", origin, head)
+	}
+}
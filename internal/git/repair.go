@@ -0,0 +1,82 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// localPath returns the directory a repository URL names on this machine,
+// and false for remote URLs
+func localPath(url string) (string, bool) {
+	if rest, ok := strings.CutPrefix(url, "file://"); ok {
+		return rest, true
+	}
+	if strings.Contains(url, "://") {
+		return "", false
+	}
+	// scp-like host:path, unless it is a Windows drive
+	if i := strings.Index(url, ":"); i > 0 && !filepath.IsAbs(url) && !strings.Contains(url[:i], "/") {
+		return "", false
+	}
+	return url, true
+}
+
+// RepairUpstreamURL points the upstream submodule back at the local
+// repository .gitmodules names, after the project was moved or cloned to a
+// new path. Relative URLs are resolved from the project root, as they were
+// when the submodule was added, and written to the repository config and
+// the submodule's origin wherever those hold an absolute path that no longer
+// matches. It returns the URL written, or "" when there was nothing to fix
+// because the upstream is remote, not a submodule or already right.
+func RepairUpstreamURL() (string, error) {
+	out, err := exec.Command("git", "config", "-f", gitmodulesFile, "--get", "submodule.upstream.url").Output()
+	if err != nil {
+		return "", nil
+	}
+	dir, ok := localPath(strings.TrimSpace(string(out)))
+	if !ok {
+		return "", nil
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("upstream repository %s not found", dir)
+	}
+
+	repaired := ""
+	fix := func(args []string, key string) error {
+		out, err := exec.Command("git", append(args, "config", "--get", key)...).Output()
+		if err != nil {
+			// Not set, so git falls back to .gitmodules
+			return nil
+		}
+		current := strings.TrimSpace(string(out))
+		path, ok := localPath(current)
+		if !ok || !filepath.IsAbs(path) || filepath.Clean(path) == dir {
+			return nil
+		}
+		url := dir
+		if strings.HasPrefix(current, "file://") {
+			url = "file://" + filepath.ToSlash(dir)
+		}
+		if output, err := exec.Command("git", append(args, "config", key, url)...).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to set %s: %v, output: %s", key, err, output)
+		}
+		repaired = url
+		return nil
+	}
+	if err := fix(nil, "submodule.upstream.url"); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(".upstream", ".git")); err == nil {
+		if err := fix([]string{"-C", ".upstream"}, "remote.origin.url"); err != nil {
+			return "", err
+		}
+	}
+	return repaired, nil
+}
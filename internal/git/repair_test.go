@@ -0,0 +1,81 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalPath(t *testing.T) {
+	tests := []struct {
+		url   string
+		want  string
+		local bool
+	}{
+		{url: "../upstream", want: "../upstream", local: true},
+		{url: "/srv/git/upstream", want: "/srv/git/upstream", local: true},
+		{url: "file:///srv/git/upstream", want: "/srv/git/upstream", local: true},
+		{url: "https://github.com/example/repo.git"},
+		{url: "ssh://git@example.com/repo.git"},
+		{url: "git@github.com:example/repo.git"},
+	}
+	for _, tt := range tests {
+		got, local := localPath(tt.url)
+		if got != tt.want || local != tt.local {
+			t.Errorf("localPath(%q) = %q, %v, want %q, %v", tt.url, got, local, tt.want, tt.local)
+		}
+	}
+}
+
+func TestRepairUpstreamURL(t *testing.T) {
+	tmpDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	// Outside a submodule there is nothing to repair
+	if url, err := RepairUpstreamURL(); err != nil || url != "" {
+		t.Fatalf("RepairUpstreamURL() without .gitmodules = %q, %v", url, err)
+	}
+
+	// The upstream sits next to the project, which was moved from /old/project
+	upstream := filepath.Join(filepath.Dir(tmpDir), "upstream")
+	if err := os.MkdirAll(upstream, 0755); err != nil {
+		t.Fatalf("Failed to create upstream: %v", err)
+	}
+	rel := "../" + filepath.Base(upstream)
+	for _, args := range [][]string{
+		{"config", "-f", ".gitmodules", "submodule.upstream.url", rel},
+		{"config", "submodule.upstream.url", "/old/upstream"},
+	} {
+		if err := runGitCommand(tmpDir, args); err != nil {
+			t.Fatalf("Failed to run git %v: %v", args, err)
+		}
+	}
+
+	url, err := RepairUpstreamURL()
+	if err != nil {
+		t.Fatalf("RepairUpstreamURL() error = %v", err)
+	}
+	want, _ := filepath.Abs(rel)
+	if url != want {
+		t.Errorf("RepairUpstreamURL() = %q, want %q", url, want)
+	}
+	out, err := exec.Command("git", "config", "--get", "submodule.upstream.url").Output()
+	if err != nil || strings.TrimSpace(string(out)) != want {
+		t.Errorf("submodule.upstream.url = %q, %v, want %q", out, err, want)
+	}
+
+	// Once repaired there is nothing left to do
+	if url, err := RepairUpstreamURL(); err != nil || url != "" {
+		t.Errorf("RepairUpstreamURL() after repair = %q, %v", url, err)
+	}
+
+	// An upstream that moved too can't be found
+	if err := os.RemoveAll(upstream); err != nil {
+		t.Fatalf("Failed to remove upstream: %v", err)
+	}
+	if _, err := RepairUpstreamURL(); err == nil {
+		t.Error("RepairUpstreamURL() with a missing upstream succeeded")
+	}
+}
@@ -1,22 +1,35 @@
 package git
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"text/template"
+	"strings"
 
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
 )
 
-const gitmodTemplate = `[submodule "{{.Name}}"]
-	path = {{.Path}}
-	url = {{.URL}}
-	ignore = all
-`
+// SubmoduleOptions controls how the parent repository tracks the upstream
+// submodule in .gitmodules
+type SubmoduleOptions struct {
+	Ignore  string // all (default), dirty, untracked or none
+	Update  string // checkout, rebase, merge or none; git's default when empty
+	Branch  string // Branch followed by git submodule update --remote
+	Shallow bool   // Clone with depth 1 in git submodule update
+}
+
+// gitmodulesFile is where git reads submodule settings from
+const gitmodulesFile = ".gitmodules"
 
 // Repository manages Git operations for both main and upstream repositories
 type Repository struct {
@@ -26,7 +39,7 @@ type Repository struct {
 
 // InitMainRepository initializes the main repository if it doesn't exist
 func InitMainRepository() (*Repository, error) {
-	repo, err := git.PlainOpen(".")
+	repo, err := openMainRepository()
 	if err == git.ErrRepositoryNotExists {
 		repo, err = git.PlainInit(".", false)
 		if err != nil {
@@ -49,15 +62,51 @@ func InitMainRepository() (*Repository, error) {
 	return &Repository{mainRepo: repo}, nil
 }
 
-// AddUpstreamSubmodule adds the upstream repository as a submodule
-func (r *Repository) AddUpstreamSubmodule(url string) error {
-	// Create submodule spec
-	spec := config.Submodule{
-		Name: "upstream",
-		Path: ".upstream",
-		URL:  url,
+// openMainRepository opens the repository in the current directory, or the
+// one named by GIT_DIR and GIT_WORK_TREE when git-overlay runs as a git
+// subcommand with --git-dir or --work-tree. Linked worktrees share objects,
+// refs and config with the main worktree through their commondir.
+func openMainRepository() (*git.Repository, error) {
+	dir := os.Getenv("GIT_DIR")
+	if dir == "" {
+		return git.PlainOpenWithOptions(".", &git.PlainOpenOptions{EnableDotGitCommonDir: true})
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("GIT_DIR %s: %w", dir, err)
+	}
+	worktree := os.Getenv("GIT_WORK_TREE")
+	if worktree == "" {
+		worktree = "."
+	}
+	dotGit, err := dotGitFilesystem(dir)
+	if err != nil {
+		return nil, err
+	}
+	storage := filesystem.NewStorage(dotGit, cache.NewObjectLRUDefault())
+	return git.Open(storage, osfs.New(worktree))
+}
+
+// dotGitFilesystem returns the filesystem of the git directory dir. The git
+// directory of a linked worktree only holds its HEAD, index and submodules;
+// everything else is read from the directory named in its commondir file.
+func dotGitFilesystem(dir string) (billy.Filesystem, error) {
+	dotGit := osfs.New(dir)
+	data, err := os.ReadFile(filepath.Join(dir, "commondir"))
+	if os.IsNotExist(err) {
+		return dotGit, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read commondir: %w", err)
+	}
+	common := strings.TrimSpace(string(data))
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(dir, common)
 	}
+	return dotgit.NewRepositoryFilesystem(dotGit, osfs.New(common)), nil
+}
 
+// AddUpstreamSubmodule adds the upstream repository as a submodule, pulling
+// from mirrors in turn when url can't be reached
+func (r *Repository) AddUpstreamSubmodule(url string, opts SubmoduleOptions, mirrors ...string) error {
 	// Get worktree
 	wt, err := r.mainRepo.Worktree()
 	if err != nil {
@@ -65,20 +114,8 @@ func (r *Repository) AddUpstreamSubmodule(url string) error {
 	}
 
 	// Create/update .gitmodules file
-	gitmodulesFile := filepath.Join(wt.Filesystem.Root(), ".gitmodules")
-	f, err := os.OpenFile(gitmodulesFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to create .gitmodules: %w", err)
-	}
-
-	// Write submodule config using template
-	t := template.Must(template.New("gitmodule").Parse(gitmodTemplate))
-	if err := t.Execute(f, spec); err != nil {
-		return fmt.Errorf("failed to write .gitmodules: %w", err)
-	}
-
-	if err := f.Close(); err != nil {
-		return fmt.Errorf("failed to close .gitmodules: %w", err)
+	if err := writeGitmodule(filepath.Join(wt.Filesystem.Root(), gitmodulesFile), url, opts); err != nil {
+		return err
 	}
 
 	// Get submodule
@@ -87,8 +124,9 @@ func (r *Repository) AddUpstreamSubmodule(url string) error {
 		return fmt.Errorf("failed to get submodule: %w", err)
 	}
 
-	// Initialize submodule
-	if err := sub.Init(); err != nil {
+	// Initialize submodule. Another worktree of the repository may have
+	// registered it already.
+	if err := sub.Init(); err != nil && err != git.ErrSubmoduleAlreadyInitialized {
 		return fmt.Errorf("failed to init submodule: %w", err)
 	}
 
@@ -105,9 +143,15 @@ func (r *Repository) AddUpstreamSubmodule(url string) error {
 	}
 
 	// Pull changes
-	if err := subwt.Pull(&git.PullOptions{
-		RemoteName: "origin",
-		Progress:   os.Stdout,
+	if _, err := withMirrors(originURL(r.upstreamRepo), mirrors, func(url string) error {
+		return withFetchTimeout(func(ctx context.Context) error {
+			return subwt.PullContext(ctx, &git.PullOptions{
+				RemoteName: "origin",
+				RemoteURL:  url,
+				Depth:      fetchDepth(r.upstreamRepo),
+				Progress:   os.Stdout,
+			})
+		})
 	}); err != nil && err != git.NoErrAlreadyUpToDate {
 		return fmt.Errorf("failed to pull submodule: %w", err)
 	}
@@ -150,71 +194,320 @@ func (r *Repository) AddUpstreamSubmodule(url string) error {
 	return nil
 }
 
-// SyncUpstream updates the upstream repository to the specified ref
-func (r *Repository) SyncUpstream(ref string) error {
+// ConfigureUpstreamSubmodule rewrites the upstream section of .gitmodules to
+// match url and opts. Nothing is written when the upstream isn't a submodule.
+func ConfigureUpstreamSubmodule(url string, opts SubmoduleOptions) error {
+	if err := exec.Command("git", "config", "-f", gitmodulesFile, "--get", "submodule.upstream.path").Run(); err != nil {
+		return nil
+	}
+	return writeGitmodule(gitmodulesFile, url, opts)
+}
+
+// writeGitmodule sets the upstream submodule section of the .gitmodules file
+// at path, replacing earlier settings and removing ones no longer configured
+func writeGitmodule(path, url string, opts SubmoduleOptions) error {
+	ignore := opts.Ignore
+	if ignore == "" {
+		ignore = "all"
+	}
+	switch ignore {
+	case "all", "dirty", "untracked", "none":
+	default:
+		return fmt.Errorf("unsupported submodule.ignore: %s", ignore)
+	}
+	switch opts.Update {
+	case "", "checkout", "rebase", "merge", "none":
+	default:
+		return fmt.Errorf("unsupported submodule.update: %s", opts.Update)
+	}
+	shallow := ""
+	if opts.Shallow {
+		shallow = "true"
+	}
+
+	settings := []struct{ key, value string }{
+		{"path", ".upstream"},
+		{"url", url},
+		{"ignore", ignore},
+		{"update", opts.Update},
+		{"branch", opts.Branch},
+		{"shallow", shallow},
+	}
+	for _, setting := range settings {
+		key := "submodule.upstream." + setting.key
+		if setting.value == "" {
+			// Exit status 5 only means the key wasn't set
+			cmd := exec.Command("git", "config", "-f", path, "--unset-all", key)
+			if err := cmd.Run(); err != nil {
+				if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 5 {
+					return fmt.Errorf("failed to unset %s in .gitmodules: %w", key, err)
+				}
+			}
+			continue
+		}
+		cmd := exec.Command("git", "config", "-f", path, key, setting.value)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to write .gitmodules: %v, output: %s", err, output)
+		}
+	}
+	return nil
+}
+
+// SyncUpstream updates the upstream repository to the specified ref. A branch
+// whose history no longer contains the checked out commit is only followed
+// with acceptRewrite set. Mirrors are fetched from in turn when origin can't
+// be reached.
+func (r *Repository) SyncUpstream(ref string, acceptRewrite bool, mirrors ...string) error {
+	return r.SyncUpstreamAt(ref, "", acceptRewrite, mirrors...)
+}
+
+// SyncUpstreamAt is SyncUpstream checking out commit instead of ref's tip.
+// The commit must be the tip or in its history, so it is only ever a commit
+// the ref led to.
+func (r *Repository) SyncUpstreamAt(ref, commit string, acceptRewrite bool, mirrors ...string) error {
 	if r.upstreamRepo == nil {
 		var err error
-		r.upstreamRepo, err = git.PlainOpen(".upstream")
+		r.upstreamRepo, err = r.openUpstream()
 		if err != nil {
 			return fmt.Errorf("failed to open upstream repository: %w", err)
 		}
 	}
 
+	return checkoutRef(r.upstreamRepo, ref, commit, acceptRewrite, mirrors)
+}
+
+// openUpstream opens the upstream submodule checkout. A submodule recorded in
+// the repository but not checked out, as in a fresh clone or a newly added
+// linked worktree, is initialized first.
+func (r *Repository) openUpstream() (*git.Repository, error) {
+	repo, err := git.PlainOpen(".upstream")
+	if err != git.ErrRepositoryNotExists || r.mainRepo == nil {
+		return repo, err
+	}
+
+	wt, err := r.mainRepo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worktree: %w", err)
+	}
+	sub, err := wt.Submodule("upstream")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get submodule: %w", err)
+	}
+	if err := sub.Init(); err != nil && err != git.ErrSubmoduleAlreadyInitialized {
+		return nil, fmt.Errorf("failed to init submodule: %w", err)
+	}
+	return sub.Repository()
+}
+
+// SyncClone brings a plain clone of url in dir to ref, cloning it first if
+// dir does not exist yet. Clones are shallow; commands reading history
+// deepen them when they need to. Named upstreams are kept this way rather than as
+// submodules of the main repository. Mirrors are cloned or fetched from in
+// turn when url can't be reached.
+func SyncClone(dir, url, ref string, acceptRewrite bool, mirrors ...string) error {
+	return SyncCloneAt(dir, url, ref, "", acceptRewrite, mirrors...)
+}
+
+// SyncCloneAt is SyncClone checking out commit instead of ref's tip, as
+// SyncUpstreamAt does
+func SyncCloneAt(dir, url, ref, commit string, acceptRewrite bool, mirrors ...string) error {
+	repo, err := git.PlainOpen(dir)
+	if err == git.ErrRepositoryNotExists {
+		var from string
+		from, err = withMirrors(url, mirrors, func(from string) error {
+			return withFetchTimeout(func(ctx context.Context) error {
+				repo, err = git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+					URL:      from,
+					Depth:    1,
+					Progress: os.Stdout,
+				})
+				return err
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("failed to clone %s: %w", url, err)
+		}
+		// Like git with insteadOf, the clone records the URL as configured
+		if from != url && from == rewriteURL(url) {
+			if err := setOriginURL(repo, url); err != nil {
+				return err
+			}
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to open %s: %w", dir, err)
+	}
+
+	return checkoutRef(repo, ref, commit, acceptRewrite, mirrors)
+}
+
+// checkoutRef fetches origin, or the first of mirrors that can be reached,
+// and checks out ref as a remote branch, tag or hash. A commit other than ""
+// is checked out instead once it is found in ref's history.
+func checkoutRef(repo *git.Repository, ref, commit string, acceptRewrite bool, mirrors []string) error {
 	// Get worktree
-	wt, err := r.upstreamRepo.Worktree()
+	wt, err := repo.Worktree()
 	if err != nil {
 		return fmt.Errorf("failed to get worktree: %w", err)
 	}
 
-	// Fetch all refs
-	err = r.upstreamRepo.Fetch(&git.FetchOptions{
-		RemoteName: "origin",
-		Force:      true,
-		Progress:   os.Stdout,
-		RefSpecs: []config.RefSpec{
-			"+refs/heads/*:refs/remotes/origin/*",
-			"+refs/tags/*:refs/tags/*",
-		},
+	// A shallow clone fetches only the tips of origin's branches and tags
+	dir := wt.Filesystem.Root()
+	depth := fetchDepth(repo)
+
+	// Remember where the checkout and the branch were before fetching
+	var pinned, tracked plumbing.Hash
+	if head, err := repo.Head(); err == nil {
+		pinned = head.Hash()
+	}
+	if before, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", ref), true); err == nil {
+		tracked = before.Hash()
+	}
+
+	// Fetch all refs. A mirror's refs stand in for origin's.
+	url, err := withMirrors(originURL(repo), mirrors, func(url string) error {
+		return withFetchTimeout(func(ctx context.Context) error {
+			return repo.FetchContext(ctx, &git.FetchOptions{
+				RemoteName: "origin",
+				RemoteURL:  url,
+				Depth:      depth,
+				Force:      true,
+				Progress:   os.Stdout,
+				RefSpecs: []config.RefSpec{
+					"+refs/heads/*:refs/remotes/origin/*",
+					"+refs/tags/*:refs/tags/*",
+				},
+			})
+		})
 	})
 	if err != nil && err != git.NoErrAlreadyUpToDate {
 		return fmt.Errorf("failed to fetch upstream: %w", err)
 	}
 
-	// Pull changes
-	err = wt.Pull(&git.PullOptions{
-		RemoteName: "origin",
-		Force:      true,
-		Progress:   os.Stdout,
-	})
-	if err != nil && err != git.NoErrAlreadyUpToDate {
-		return fmt.Errorf("failed to pull upstream: %w", err)
+	// Check for a force-push before pulling moves anything. In a shallow
+	// clone the checked out commit may only be hidden by the shallow boundary.
+	rewritten := false
+	if after, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", ref), true); err == nil && isRewrite(repo, pinned, tracked, after.Hash()) && !ancestorAfterDeepening(dir, pinned, after.Hash()) {
+		rewritten = true
+		if !acceptRewrite {
+			// Put the branch back so the rewrite is detected again next time
+			name := plumbing.NewRemoteReferenceName("origin", ref)
+			if err := repo.Storer.SetReference(plumbing.NewHashReference(name, tracked)); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", name, err)
+			}
+			return fmt.Errorf("%w: %s was force-pushed and %s is no longer in its history; rerun with --accept-rewrite to move to %s", overlayerr.ErrHistoryRewritten, ref, pinned.String()[:7], after.Hash().String()[:7])
+		}
+		fmt.Fprintf(os.Stderr, "WARNING: upstream %s was force-pushed, moving from %s to rewritten history at %s\n", ref, pinned.String()[:7], after.Hash().String()[:7])
 	}
 
-	// Get remote reference first
-	remoteRef, err := r.upstreamRepo.Reference(plumbing.NewRemoteReferenceName("origin", ref), true)
-	if err == nil {
-		// Found as remote branch
-		err = wt.Checkout(&git.CheckoutOptions{
-			Hash:  remoteRef.Hash(),
-			Force: true,
+	// Pull changes. Rewritten history can't be pulled, a shallow clone lacks
+	// the history pulling compares, and a planned commit must be found in the
+	// ref's history before anything moves; all are checked out directly from
+	// the fetched refs below.
+	reindex(repo)
+	if !rewritten && depth == 0 && commit == "" {
+		err = withFetchTimeout(func(ctx context.Context) error {
+			return wt.PullContext(ctx, &git.PullOptions{
+				RemoteName: "origin",
+				RemoteURL:  url,
+				Force:      true,
+				Progress:   os.Stdout,
+			})
 		})
-		return err
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return fmt.Errorf("failed to pull upstream: %w", err)
+		}
 	}
 
-	// Try as tag
-	tagRef, err := r.upstreamRepo.Reference(plumbing.NewTagReferenceName(ref), true)
-	if err == nil {
-		err = wt.Checkout(&git.CheckoutOptions{
-			Hash:  tagRef.Hash(),
-			Force: true,
-		})
+	tip, err := refCommit(repo, dir, ref)
+	if err != nil {
 		return err
 	}
+	if commit != "" {
+		planned := plumbing.NewHash(commit)
+		if !isAncestor(repo, planned, tip) && !ancestorAfterDeepening(dir, planned, tip) {
+			return fmt.Errorf("%w: %s is not %s or in its history", overlayerr.ErrPlanDrift, commit, ref)
+		}
+		reindex(repo)
+		tip = planned
+	}
+	return wt.Checkout(&git.CheckoutOptions{
+		Hash:  tip,
+		Force: true,
+	})
+}
 
-	// Try as hash
+// refCommit resolves ref in the fetched repo in dir as a remote branch, tag
+// or hash
+func refCommit(repo *git.Repository, dir, ref string) (plumbing.Hash, error) {
+	// Get remote reference first
+	if remoteRef, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", ref), true); err == nil {
+		return remoteRef.Hash(), nil
+	}
+
+	// Try as tag, peeling an annotated tag to its commit
+	if tagRef, err := repo.Reference(plumbing.NewTagReferenceName(ref), true); err == nil {
+		if tag, err := repo.TagObject(tagRef.Hash()); err == nil {
+			if c, err := tag.Commit(); err == nil {
+				return c.Hash, nil
+			}
+		}
+		return tagRef.Hash(), nil
+	}
+
+	// Try as hash, which a shallow clone may have to fetch first
 	hash := plumbing.NewHash(ref)
+	if _, err := repo.CommitObject(hash); err != nil && plumbing.IsHash(ref) {
+		if err := fetchCommit(dir, ref); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to fetch %s: %w", ref, err)
+		}
+		reindex(repo)
+	}
+	if _, err := repo.CommitObject(hash); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("%w: %s is not a branch, tag or commit of the upstream", overlayerr.ErrRefNotFound, ref)
+	}
+	return hash, nil
+}
+
+// CheckoutCommit checks out commit in the clone in dir without fetching, to
+// put an upstream back where it was
+func CheckoutCommit(dir, commit string) error {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", dir, err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
 	return wt.Checkout(&git.CheckoutOptions{
-		Hash:  hash,
+		Hash:  plumbing.NewHash(commit),
 		Force: true,
 	})
 }
+
+// isRewrite reports whether the branch that contained pinned when it was last
+// fetched (at tracked) has moved to tip without it. A pinned commit the branch
+// never contained, such as after switching refs, is not a rewrite.
+func isRewrite(repo *git.Repository, pinned, tracked, tip plumbing.Hash) bool {
+	if pinned.IsZero() || tracked.IsZero() {
+		return false
+	}
+	return isAncestor(repo, pinned, tracked) && !isAncestor(repo, pinned, tip)
+}
+
+// isAncestor reports whether commit a is b or one of its ancestors
+func isAncestor(repo *git.Repository, a, b plumbing.Hash) bool {
+	if a == b {
+		return true
+	}
+	ca, err := repo.CommitObject(a)
+	if err != nil {
+		return false
+	}
+	cb, err := repo.CommitObject(b)
+	if err != nil {
+		return false
+	}
+	ok, err := ca.IsAncestor(cb)
+	return err == nil && ok
+}
@@ -1,9 +1,14 @@
 package git
 
 import (
+	"errors"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
 )
 
 func setupTestRepo(t *testing.T) (string, func()) {
@@ -109,10 +114,23 @@ func TestAddUpstreamSubmodule(t *testing.T) {
 		t.Fatalf("Failed to initialize repository: %v", err)
 	}
 
+	// A second commit leaves something for the shallow clone to leave out
+	if err := os.WriteFile(filepath.Join(upstreamDir, "second.txt"), []byte("second"), 0644); err != nil {
+		t.Fatalf("Failed to create second.txt: %v", err)
+	}
+	for _, args := range [][]string{{"add", "second.txt"}, {"commit", "-m", "Add second.txt"}} {
+		if err := runGitCommand(upstreamDir, args); err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+	}
+
 	// Add upstream submodule
-	if err := repo.AddUpstreamSubmodule(upstreamDir); err != nil {
+	if err := repo.AddUpstreamSubmodule(upstreamDir, SubmoduleOptions{}); err != nil {
 		t.Fatalf("Failed to add upstream submodule: %v", err)
 	}
+	if !isShallow(".upstream") {
+		t.Error("Expected the upstream submodule to be a shallow clone")
+	}
 
 	// Verify .upstream directory exists
 	if _, err := os.Stat(".upstream"); os.IsNotExist(err) {
@@ -152,7 +170,7 @@ func TestSyncUpstream(t *testing.T) {
 		t.Fatalf("Failed to initialize repository: %v", err)
 	}
 
-	if err := repo.AddUpstreamSubmodule(upstreamDir); err != nil {
+	if err := repo.AddUpstreamSubmodule(upstreamDir, SubmoduleOptions{}); err != nil {
 		t.Fatalf("Failed to add upstream submodule: %v", err)
 	}
 
@@ -172,7 +190,7 @@ func TestSyncUpstream(t *testing.T) {
 	}
 
 	// Sync upstream
-	if err := repo.SyncUpstream("main"); err != nil {
+	if err := repo.SyncUpstream("main", false); err != nil {
 		t.Fatalf("Failed to sync upstream: %v", err)
 	}
 
@@ -181,3 +199,273 @@ func TestSyncUpstream(t *testing.T) {
 		t.Error("Expected new.txt to exist in .upstream")
 	}
 }
+
+func TestSyncCloneHistoryRewrite(t *testing.T) {
+	tmpDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	upstreamDir := setupUpstreamRepo(t, tmpDir)
+	commit := func(name string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(upstreamDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		if err := runGitCommand(upstreamDir, []string{"add", name}); err != nil {
+			t.Fatalf("Failed to add %s: %v", name, err)
+		}
+		if err := runGitCommand(upstreamDir, []string{"commit", "-m", "Add " + name}); err != nil {
+			t.Fatalf("Failed to commit %s: %v", name, err)
+		}
+	}
+
+	commit("a.txt")
+	cloneDir := filepath.Join(tmpDir, "clone")
+	if err := SyncClone(cloneDir, upstreamDir, "main", false); err != nil {
+		t.Fatalf("Failed to clone upstream: %v", err)
+	}
+
+	// Fast-forwards are followed without complaint
+	commit("b.txt")
+	if err := SyncClone(cloneDir, upstreamDir, "main", false); err != nil {
+		t.Fatalf("SyncClone() after fast-forward error = %v", err)
+	}
+
+	// Drop the synced commit and force-push replacement history
+	if err := runGitCommand(upstreamDir, []string{"reset", "--hard", "HEAD~2"}); err != nil {
+		t.Fatalf("Failed to rewrite upstream: %v", err)
+	}
+	commit("c.txt")
+
+	err := SyncClone(cloneDir, upstreamDir, "main", false)
+	if !errors.Is(err, overlayerr.ErrHistoryRewritten) {
+		t.Fatalf("SyncClone() error = %v, want ErrHistoryRewritten", err)
+	}
+	if _, err := os.Stat(filepath.Join(cloneDir, "b.txt")); err != nil {
+		t.Errorf("Expected the checkout to stay put after a refused rewrite: %v", err)
+	}
+
+	// The rewrite is still refused on the next sync
+	if err := SyncClone(cloneDir, upstreamDir, "main", false); !errors.Is(err, overlayerr.ErrHistoryRewritten) {
+		t.Fatalf("second SyncClone() error = %v, want ErrHistoryRewritten", err)
+	}
+
+	if err := SyncClone(cloneDir, upstreamDir, "main", true); err != nil {
+		t.Fatalf("SyncClone() with acceptRewrite error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cloneDir, "c.txt")); err != nil {
+		t.Errorf("Expected the rewritten history to be checked out: %v", err)
+	}
+}
+
+func TestSyncCloneMirrors(t *testing.T) {
+	tmpDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	upstreamDir := setupUpstreamRepo(t, tmpDir)
+	missing := filepath.Join(tmpDir, "missing")
+
+	// An unreachable primary is cloned from the mirror instead
+	mirrorClone := filepath.Join(tmpDir, "mirror-clone")
+	if err := SyncClone(mirrorClone, missing, "main", false, upstreamDir); err != nil {
+		t.Fatalf("SyncClone() from mirror error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(mirrorClone, "test.txt")); err != nil {
+		t.Errorf("Expected the mirror to be checked out: %v", err)
+	}
+
+	// A clone whose origin went away fetches new commits from the mirror
+	cloneDir := filepath.Join(tmpDir, "clone")
+	if err := SyncClone(cloneDir, upstreamDir, "main", false); err != nil {
+		t.Fatalf("Failed to clone upstream: %v", err)
+	}
+	mirror := filepath.Join(tmpDir, "mirror")
+	if err := os.Rename(upstreamDir, mirror); err != nil {
+		t.Fatalf("Failed to move upstream: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(mirror, "b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatalf("Failed to create b.txt: %v", err)
+	}
+	for _, args := range [][]string{{"add", "b.txt"}, {"commit", "-m", "Add b.txt"}} {
+		if err := runGitCommand(mirror, args); err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+	}
+
+	if err := SyncClone(cloneDir, upstreamDir, "main", false); err == nil {
+		t.Fatal("SyncClone() without mirrors succeeded against a missing origin")
+	}
+	if err := SyncClone(cloneDir, upstreamDir, "main", false, missing, mirror); err != nil {
+		t.Fatalf("SyncClone() with mirrors error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cloneDir, "b.txt")); err != nil {
+		t.Errorf("Expected the mirror's new commit to be checked out: %v", err)
+	}
+}
+
+func TestWriteGitmodule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".gitmodules")
+	read := func(key string) string {
+		t.Helper()
+		out, err := exec.Command("git", "config", "-f", path, "--get", "submodule.upstream."+key).Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	if err := writeGitmodule(path, "https://example.com/a.git", SubmoduleOptions{}); err != nil {
+		t.Fatalf("writeGitmodule() error = %v", err)
+	}
+	if got := read("ignore"); got != "all" {
+		t.Errorf("ignore = %q, want all by default", got)
+	}
+
+	opts := SubmoduleOptions{Ignore: "dirty", Update: "rebase", Branch: "main", Shallow: true}
+	if err := writeGitmodule(path, "https://example.com/b.git", opts); err != nil {
+		t.Fatalf("writeGitmodule() error = %v", err)
+	}
+	want := map[string]string{"path": ".upstream", "url": "https://example.com/b.git", "ignore": "dirty", "update": "rebase", "branch": "main", "shallow": "true"}
+	for key, value := range want {
+		if got := read(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+
+	// Settings dropped from the config are removed again
+	if err := writeGitmodule(path, "https://example.com/b.git", SubmoduleOptions{}); err != nil {
+		t.Fatalf("writeGitmodule() error = %v", err)
+	}
+	for _, key := range []string{"update", "branch", "shallow"} {
+		if got := read(key); got != "" {
+			t.Errorf("%s = %q, want it unset", key, got)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read .gitmodules: %v", err)
+	}
+	if n := strings.Count(string(data), "[submodule"); n != 1 {
+		t.Errorf(".gitmodules has %d submodule sections, want 1:\n%s", n, data)
+	}
+
+	if err := writeGitmodule(path, "https://example.com/b.git", SubmoduleOptions{Ignore: "sometimes"}); err == nil {
+		t.Error("writeGitmodule() with an unknown ignore value succeeded")
+	}
+}
+
+func TestSyncCloneRefNotFound(t *testing.T) {
+	tmpDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	upstreamDir := setupUpstreamRepo(t, tmpDir)
+	err := SyncClone(filepath.Join(tmpDir, "clone"), upstreamDir, "no-such-branch", false)
+	if !errors.Is(err, overlayerr.ErrRefNotFound) {
+		t.Errorf("SyncClone() error = %v, want ErrRefNotFound", err)
+	}
+}
+
+func TestLinkedWorktree(t *testing.T) {
+	tests := []struct {
+		name      string
+		committed bool // The upstream submodule was committed before the worktree was added
+	}{
+		{name: "init in a linked worktree"},
+		{name: "sync in a new worktree of an initialized repository", committed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mainDir, cleanup := setupTestRepo(t)
+			defer cleanup()
+			upstreamDir := setupUpstreamRepo(t, t.TempDir())
+
+			if err := os.WriteFile("README", []byte("overlay\n"), 0644); err != nil {
+				t.Fatalf("Failed to write README: %v", err)
+			}
+			if tt.committed {
+				repo, err := InitMainRepository()
+				if err != nil {
+					t.Fatalf("Failed to initialize repository: %v", err)
+				}
+				if err := repo.AddUpstreamSubmodule(upstreamDir, SubmoduleOptions{}); err != nil {
+					t.Fatalf("Failed to add upstream submodule: %v", err)
+				}
+			}
+			if err := runGitCommand(mainDir, []string{"add", "-A"}); err != nil {
+				t.Fatalf("Failed to stage: %v", err)
+			}
+			if err := runGitCommand(mainDir, []string{"commit", "-m", "Initial commit"}); err != nil {
+				t.Fatalf("Failed to commit: %v", err)
+			}
+
+			worktree := filepath.Join(t.TempDir(), "worktree")
+			if err := runGitCommand(mainDir, []string{"worktree", "add", worktree}); err != nil {
+				t.Fatalf("Failed to add worktree: %v", err)
+			}
+			if err := os.Chdir(worktree); err != nil {
+				t.Fatalf("Failed to change to worktree: %v", err)
+			}
+
+			repo, err := InitMainRepository()
+			if err != nil {
+				t.Fatalf("InitMainRepository() in worktree error = %v", err)
+			}
+			if !tt.committed {
+				if err := repo.AddUpstreamSubmodule(upstreamDir, SubmoduleOptions{}); err != nil {
+					t.Fatalf("AddUpstreamSubmodule() in worktree error = %v", err)
+				}
+			}
+			if err := repo.SyncUpstream("main", false); err != nil {
+				t.Fatalf("SyncUpstream() in worktree error = %v", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(".upstream", "test.txt")); err != nil {
+				t.Errorf("Expected test.txt in the worktree's .upstream: %v", err)
+			}
+
+			// git itself must see the submodule as initialized in the worktree
+			out, err := exec.Command("git", "submodule", "status").Output()
+			if err != nil {
+				t.Fatalf("git submodule status failed: %v", err)
+			}
+			if status := strings.TrimSpace(string(out)); !strings.HasSuffix(strings.Fields(status)[1], ".upstream") || strings.HasPrefix(status, "-") {
+				t.Errorf("git submodule status = %q, want an initialized .upstream", status)
+			}
+
+			// Settings belong in the shared config, not a stray per-worktree one
+			if _, err := os.Stat(filepath.Join(mainDir, ".git", "worktrees", "worktree", "config")); err == nil {
+				t.Error("Expected no config file in the worktree's git directory")
+			}
+		})
+	}
+}
+
+func TestDotGitFilesystem(t *testing.T) {
+	common := t.TempDir()
+	worktreeDir := filepath.Join(common, "worktrees", "wt")
+	if err := os.MkdirAll(worktreeDir, 0755); err != nil {
+		t.Fatalf("Failed to create worktree git dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(common, "config"), []byte("[core]\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(worktreeDir, "commondir"), []byte("../..\n"), 0644); err != nil {
+		t.Fatalf("Failed to write commondir: %v", err)
+	}
+
+	fs, err := dotGitFilesystem(worktreeDir)
+	if err != nil {
+		t.Fatalf("dotGitFilesystem() error = %v", err)
+	}
+	if _, err := fs.Stat("config"); err != nil {
+		t.Errorf("Expected config to be read from the common directory: %v", err)
+	}
+
+	fs, err = dotGitFilesystem(common)
+	if err != nil {
+		t.Fatalf("dotGitFilesystem() without commondir error = %v", err)
+	}
+	if fs.Root() != common {
+		t.Errorf("Root() = %s, want %s", fs.Root(), common)
+	}
+}
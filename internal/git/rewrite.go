@@ -0,0 +1,82 @@
+package git
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// urlRewrites maps URL prefixes to their replacements, as set with SetURLRewrites
+var urlRewrites map[string]string
+
+// SetURLRewrites makes every later clone and fetch replace a URL prefix with
+// another, as git's url.<base>.insteadOf does. The URLs recorded in
+// .gitmodules and the upstream's remote config are left as configured.
+func SetURLRewrites(rewrites map[string]string) {
+	urlRewrites = rewrites
+}
+
+// rewriteURL applies the URL rewrites to url. Like git, the longest matching
+// prefix wins.
+func rewriteURL(url string) string {
+	match := ""
+	for from := range urlRewrites {
+		if from != "" && strings.HasPrefix(url, from) && len(from) > len(match) {
+			match = from
+		}
+	}
+	if match == "" {
+		return url
+	}
+	return urlRewrites[match] + strings.TrimPrefix(url, match)
+}
+
+// originURL returns the URL of repo's origin when a rewrite applies to it, or
+// empty so fetches use the configured remote as is
+func originURL(repo *git.Repository) string {
+	remote, err := repo.Remote("origin")
+	if err != nil || len(remote.Config().URLs) == 0 {
+		return ""
+	}
+	url := remote.Config().URLs[0]
+	if rewriteURL(url) == url {
+		return ""
+	}
+	return url
+}
+
+// setOriginURL points repo's origin at url
+func setOriginURL(repo *git.Repository, url string) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read repository config: %w", err)
+	}
+	remote, ok := cfg.Remotes["origin"]
+	if !ok {
+		return nil
+	}
+	remote.URLs = []string{url}
+	if err := repo.SetConfig(cfg); err != nil {
+		return fmt.Errorf("failed to set origin URL: %w", err)
+	}
+	return nil
+}
+
+// rewriteArgs passes the URL rewrites to the git command line as insteadOf
+// settings, for the commands run with gitOutput
+func rewriteArgs() []string {
+	froms := make([]string, 0, len(urlRewrites))
+	for from := range urlRewrites {
+		if from != "" {
+			froms = append(froms, from)
+		}
+	}
+	sort.Strings(froms)
+	var args []string
+	for _, from := range froms {
+		args = append(args, "-c", "url."+urlRewrites[from]+".insteadOf="+from)
+	}
+	return args
+}
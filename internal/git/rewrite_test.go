@@ -0,0 +1,89 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestRewriteURL(t *testing.T) {
+	SetURLRewrites(map[string]string{
+		"https://github.com/":      "git@github.com:",
+		"https://github.com/acme/": "git@github.corp:mirror/acme/",
+		"":                         "ignored",
+	})
+	defer SetURLRewrites(nil)
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://github.com/acme/app.git", want: "git@github.corp:mirror/acme/app.git"},
+		{url: "https://github.com/other/app.git", want: "git@github.com:other/app.git"},
+		{url: "https://gitlab.com/acme/app.git", want: "https://gitlab.com/acme/app.git"},
+		{url: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := rewriteURL(tt.url); got != tt.want {
+				t.Errorf("rewriteURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncCloneURLRewrites(t *testing.T) {
+	tmpDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	upstreamDir := setupUpstreamRepo(t, tmpDir)
+	url := "https://example.invalid/acme/upstream"
+	SetURLRewrites(map[string]string{"https://example.invalid/acme/": filepath.Dir(upstreamDir) + "/"})
+	defer SetURLRewrites(nil)
+
+	cloneDir := filepath.Join(tmpDir, "clone")
+	if err := SyncClone(cloneDir, url, "main", false); err != nil {
+		t.Fatalf("SyncClone() through a rewrite error = %v", err)
+	}
+
+	// The clone keeps the configured URL, so later fetches are rewritten too
+	repo, err := git.PlainOpen(cloneDir)
+	if err != nil {
+		t.Fatalf("Failed to open clone: %v", err)
+	}
+	remote, err := repo.Remote("origin")
+	if err != nil {
+		t.Fatalf("Failed to read origin: %v", err)
+	}
+	if got := remote.Config().URLs; len(got) != 1 || got[0] != url {
+		t.Errorf("origin URLs = %v, want %s", got, url)
+	}
+
+	if err := os.WriteFile(filepath.Join(upstreamDir, "b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatalf("Failed to create b.txt: %v", err)
+	}
+	for _, args := range [][]string{{"add", "b.txt"}, {"commit", "-m", "Add b.txt"}} {
+		if err := runGitCommand(upstreamDir, args); err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+	}
+
+	// git itself is given the rewrites as insteadOf settings
+	comparison, err := CompareUpstream(cloneDir, "main")
+	if err != nil {
+		t.Fatalf("CompareUpstream() through a rewrite error = %v", err)
+	}
+	if comparison.CommitsBehind != 1 {
+		t.Errorf("CommitsBehind = %d, want 1", comparison.CommitsBehind)
+	}
+
+	if err := SyncClone(cloneDir, url, "main", false); err != nil {
+		t.Fatalf("SyncClone() fetch through a rewrite error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cloneDir, "b.txt")); err != nil {
+		t.Errorf("Expected the new commit to be checked out: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+// TransportOptions limits the network use of clones, fetches and pulls
+type TransportOptions struct {
+	MaxBandwidth int64         // Bytes per second received over http(s), 0 for no limit
+	FetchTimeout time.Duration // Longest a single clone, fetch or pull may take, 0 for no limit
+}
+
+// transportOptions holds the options applied with SetTransportOptions
+var transportOptions TransportOptions
+
+// beforeFetch is the function set with SetBeforeFetch
+var beforeFetch func() error
+
+// SetBeforeFetch sets a function run right before every clone, fetch, pull
+// and remote listing, such as one providing credentials, so commands that
+// stay offline never run it
+func SetBeforeFetch(fn func() error) {
+	beforeFetch = fn
+}
+
+// prepareFetch runs the function set with SetBeforeFetch
+func prepareFetch() error {
+	if beforeFetch == nil {
+		return nil
+	}
+	return beforeFetch()
+}
+
+// fetchOutput is gitOutput for git commands that reach the remote
+func fetchOutput(dir string, args ...string) (string, error) {
+	if err := prepareFetch(); err != nil {
+		return "", err
+	}
+	return gitOutput(dir, args...)
+}
+
+// SetTransportOptions applies opts to every later clone, fetch and pull. The
+// bandwidth limit is shared by all connections, so upstreams synced in
+// parallel stay under it together.
+func SetTransportOptions(opts TransportOptions) {
+	transportOptions = opts
+
+	c := githttp.DefaultClient
+	if opts.MaxBandwidth > 0 {
+		limiter := &rateLimiter{rate: opts.MaxBandwidth}
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &throttledConn{Conn: conn, limiter: limiter}, nil
+		}
+		c = githttp.NewClient(&http.Client{Transport: transport})
+	}
+	client.InstallProtocol("http", c)
+	client.InstallProtocol("https", c)
+}
+
+// withFetchTimeout runs op with a context that ends after the fetch timeout
+func withFetchTimeout(op func(ctx context.Context) error) error {
+	if err := prepareFetch(); err != nil {
+		return err
+	}
+	if transportOptions.FetchTimeout <= 0 {
+		return op(context.Background())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), transportOptions.FetchTimeout)
+	defer cancel()
+	err := op(ctx)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s: %v", overlayerr.ErrFetchTimeout, transportOptions.FetchTimeout, err)
+	}
+	return err
+}
+
+// maxThrottledRead bounds a single read, so a slow rate is paced smoothly
+// instead of in large bursts
+const maxThrottledRead = 16 << 10
+
+// throttledConn is a connection whose reads are paced by a rateLimiter
+type throttledConn struct {
+	net.Conn
+	limiter *rateLimiter
+}
+
+// Read reads from the connection, then waits until the bytes read fit the rate
+func (c *throttledConn) Read(p []byte) (int, error) {
+	if len(p) > maxThrottledRead {
+		p = p[:maxThrottledRead]
+	}
+	n, err := c.Conn.Read(p)
+	c.limiter.wait(n)
+	return n, err
+}
+
+// rateLimiter paces reads across connections to a total rate. Idle time
+// isn't saved up, so there are no bursts above the rate.
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate int64     // Bytes per second
+	next time.Time // When the bytes read so far are paid for
+}
+
+// wait blocks until n more bytes fit the rate
+func (l *rateLimiter) wait(n int) {
+	if n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	until := l.next
+	l.mu.Unlock()
+	time.Sleep(time.Until(until))
+}
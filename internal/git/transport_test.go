@@ -0,0 +1,51 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := &rateLimiter{rate: 100 << 10}
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		l.wait(2 << 10)
+	}
+	// 20 KiB at 100 KiB/s takes 200ms
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("20 KiB at 100 KiB/s took %s, want about 200ms", elapsed)
+	}
+}
+
+func TestWithFetchTimeout(t *testing.T) {
+	defer SetTransportOptions(TransportOptions{})
+
+	SetTransportOptions(TransportOptions{FetchTimeout: 10 * time.Millisecond})
+	err := withFetchTimeout(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, overlayerr.ErrFetchTimeout) {
+		t.Errorf("withFetchTimeout() error = %v, want ErrFetchTimeout", err)
+	}
+
+	// Other failures and quick operations are passed through
+	want := errors.New("repository not found")
+	if err := withFetchTimeout(func(context.Context) error { return want }); err != want {
+		t.Errorf("withFetchTimeout() error = %v, want %v", err, want)
+	}
+
+	SetTransportOptions(TransportOptions{})
+	if err := withFetchTimeout(func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); ok {
+			return errors.New("deadline set without a timeout")
+		}
+		return nil
+	}); err != nil {
+		t.Errorf("withFetchTimeout() without a timeout error = %v", err)
+	}
+}
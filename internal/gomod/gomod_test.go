@@ -0,0 +1,36 @@
+package gomod
+
+import "testing"
+
+func TestProxy(t *testing.T) {
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{env: "", want: "https://proxy.golang.org"},
+		{env: "https://goproxy.example.com/,direct", want: "https://goproxy.example.com"},
+		{env: "direct", want: "https://proxy.golang.org"},
+		{env: "off|https://fallback.example.com", want: "https://fallback.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("GOPROXY", tt.env)
+			if got := Proxy(); got != tt.want {
+				t.Errorf("Proxy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSumDBKey(t *testing.T) {
+	t.Setenv("GOSUMDB", "off")
+	if _, err := sumDBKey(); err == nil {
+		t.Error("sumDBKey() expected error with GOSUMDB=off")
+	}
+
+	t.Setenv("GOSUMDB", "")
+	if key, err := sumDBKey(); err != nil || key != defaultSumDBKey {
+		t.Errorf("sumDBKey() = %q, %v, want default key", key, err)
+	}
+}
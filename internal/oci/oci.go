@@ -0,0 +1,317 @@
+package oci
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rjocoleman/git-overlay/internal/archive"
+)
+
+// Media types accepted for manifests
+const (
+	mediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex       = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	annotationTitle = "org.opencontainers.image.title"
+)
+
+// Scheme is the URL scheme used to talk to registries, overridable for tests
+var Scheme = "https"
+
+var client = &http.Client{Timeout: 10 * time.Minute}
+
+// Reference identifies an image or artifact in a registry
+type Reference struct {
+	Registry   string
+	Repository string
+}
+
+// ParseReference splits an image name such as ghcr.io/acme/bundle into registry
+// and repository, defaulting to Docker Hub like the docker CLI does
+func ParseReference(image string) Reference {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return Reference{Registry: parts[0], Repository: parts[1]}
+	}
+	if !strings.Contains(image, "/") {
+		image = "library/" + image
+	}
+	return Reference{Registry: "registry-1.docker.io", Repository: image}
+}
+
+// Descriptor points at a blob in the registry
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	} `json:"platform,omitempty"`
+}
+
+// manifest covers both image manifests and indexes
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Layers    []Descriptor `json:"layers"`
+	Manifests []Descriptor `json:"manifests"`
+}
+
+// registry is a client for a single repository
+type registry struct {
+	ref   Reference
+	token string
+}
+
+// Resolve returns the manifest digest that tag currently points at
+func Resolve(image, tag string) (string, error) {
+	r := &registry{ref: ParseReference(image)}
+	_, digest, err := r.manifest(tag)
+	return digest, err
+}
+
+// Pull extracts layers of ref (a tag or digest) into dest. layer selects a single
+// layer by index, title annotation or media type; when empty every layer is
+// extracted in order. It returns the resolved manifest digest.
+func Pull(image, tag, layer, dest string) (string, error) {
+	r := &registry{ref: ParseReference(image)}
+
+	m, digest, err := r.manifest(tag)
+	if err != nil {
+		return "", err
+	}
+
+	// Pick the manifest for this platform out of a multi-platform index
+	if len(m.Manifests) > 0 {
+		desc := selectPlatform(m.Manifests)
+		m, digest, err = r.manifest(desc.Digest)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	layers, err := selectLayers(m.Layers, layer)
+	if err != nil {
+		return "", err
+	}
+
+	for _, l := range layers {
+		if err := r.extractLayer(l, dest); err != nil {
+			return "", err
+		}
+	}
+	return digest, nil
+}
+
+// selectPlatform picks the index entry matching the host platform, falling back to the first
+func selectPlatform(manifests []Descriptor) Descriptor {
+	for _, m := range manifests {
+		if m.Platform != nil && m.Platform.OS == runtime.GOOS && m.Platform.Architecture == runtime.GOARCH {
+			return m
+		}
+	}
+	return manifests[0]
+}
+
+// selectLayers returns the layers chosen by selector
+func selectLayers(layers []Descriptor, selector string) ([]Descriptor, error) {
+	if selector == "" {
+		return layers, nil
+	}
+	if i, err := strconv.Atoi(selector); err == nil {
+		if i < 0 || i >= len(layers) {
+			return nil, fmt.Errorf("layer index %d out of range (%d layers)", i, len(layers))
+		}
+		return layers[i : i+1], nil
+	}
+	for _, l := range layers {
+		if l.Annotations[annotationTitle] == selector || l.MediaType == selector {
+			return []Descriptor{l}, nil
+		}
+	}
+	return nil, fmt.Errorf("no layer matches %q", selector)
+}
+
+// manifest fetches and decodes a manifest, returning it with its digest
+func (r *registry) manifest(reference string) (*manifest, string, error) {
+	resp, err := r.get("manifests/"+reference, strings.Join([]string{
+		mediaTypeOCIManifest, mediaTypeOCIIndex, mediaTypeDockerManifest, mediaTypeDockerList,
+	}, ", "))
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(data)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	if strings.HasPrefix(reference, "sha256:") && reference != digest {
+		return nil, "", fmt.Errorf("manifest digest mismatch: got %s, want %s", digest, reference)
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, "", fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return &m, digest, nil
+}
+
+// extractLayer downloads a layer, verifies its digest and applies it to dest
+// over the layers before it.
+// Non-tar blobs (e.g. ORAS file artifacts) are written out under their title.
+func (r *registry) extractLayer(layer Descriptor, dest string) error {
+	tmp, err := os.CreateTemp("", "git-overlay-layer-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	resp, err := r.get("blobs/"+layer.Digest, "")
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to download layer %s: %w", layer.Digest, err)
+	}
+	if got := "sha256:" + hex.EncodeToString(h.Sum(nil)); got != layer.Digest {
+		return fmt.Errorf("layer digest mismatch: got %s, want %s", got, layer.Digest)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	switch {
+	case strings.Contains(layer.MediaType, "tar+gzip") || strings.Contains(layer.MediaType, "tar.gzip"):
+		gz, err := gzip.NewReader(tmp)
+		if err != nil {
+			return fmt.Errorf("failed to read layer %s: %w", layer.Digest, err)
+		}
+		defer gz.Close()
+		return archive.ApplyLayer(gz, dest)
+	case strings.HasSuffix(layer.MediaType, "tar"):
+		return archive.ApplyLayer(tmp, dest)
+	}
+
+	title := layer.Annotations[annotationTitle]
+	if title == "" || filepath.IsAbs(title) || strings.Contains(title, "..") {
+		return fmt.Errorf("layer %s is not a tarball and has no usable title", layer.Digest)
+	}
+	return archive.ExtractFile(tmp, dest, title)
+}
+
+// get issues a registry API request, authenticating with a bearer token on demand
+func (r *registry) get(path, accept string) (*http.Response, error) {
+	u := fmt.Sprintf("%s://%s/v2/%s/%s", Scheme, r.ref.Registry, r.ref.Repository, path)
+
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if r.token != "" {
+			req.Header.Set("Authorization", "Bearer "+r.token)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if err := r.authenticate(challenge); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("registry request %s failed: %s", u, resp.Status)
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("registry request %s failed: unauthorized", u)
+}
+
+// authenticate obtains a bearer token for the challenge returned by the registry.
+// Credentials are taken from OCI_USERNAME and OCI_PASSWORD when set.
+func (r *registry) authenticate(challenge string) error {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return fmt.Errorf("unsupported registry authentication: %q", challenge)
+	}
+
+	params := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(part), "="); ok {
+			params[k] = strings.Trim(v, `"`)
+		}
+	}
+	if params["realm"] == "" {
+		return fmt.Errorf("registry authentication challenge has no realm")
+	}
+
+	q := url.Values{}
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + r.ref.Repository + ":pull"
+	}
+	q.Set("scope", scope)
+
+	req, err := http.NewRequest(http.MethodGet, params["realm"]+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if user := os.Getenv("OCI_USERNAME"); user != "" {
+		req.SetBasicAuth(user, os.Getenv("OCI_PASSWORD"))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to authenticate with registry: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to authenticate with registry: %s", resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("failed to parse registry token: %w", err)
+	}
+	r.token = body.Token
+	if r.token == "" {
+		r.token = body.AccessToken
+	}
+	return nil
+}
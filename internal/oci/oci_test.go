@@ -0,0 +1,116 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		image string
+		want  Reference
+	}{
+		{image: "ghcr.io/acme/bundle", want: Reference{Registry: "ghcr.io", Repository: "acme/bundle"}},
+		{image: "localhost:5000/bundle", want: Reference{Registry: "localhost:5000", Repository: "bundle"}},
+		{image: "acme/bundle", want: Reference{Registry: "registry-1.docker.io", Repository: "acme/bundle"}},
+		{image: "alpine", want: Reference{Registry: "registry-1.docker.io", Repository: "library/alpine"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := ParseReference(tt.image); got != tt.want {
+				t.Errorf("ParseReference() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPull(t *testing.T) {
+	// Build a gzipped tar layer and a plain file layer
+	var layer bytes.Buffer
+	gz := gzip.NewWriter(&layer)
+	tw := tar.NewWriter(gz)
+	content := []byte("key: value\n")
+	tw.WriteHeader(&tar.Header{Name: "config/app.yml", Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+	tw.Write(content)
+	tw.Close()
+	gz.Close()
+
+	file := []byte("plain file")
+	digest := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	blobs := map[string][]byte{
+		digest(layer.Bytes()): layer.Bytes(),
+		digest(file):          file,
+	}
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"mediaType": mediaTypeOCIManifest,
+		"layers": []Descriptor{
+			{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: digest(layer.Bytes()), Size: int64(layer.Len())},
+			{MediaType: "text/plain", Digest: digest(file), Size: int64(len(file)), Annotations: map[string]string{annotationTitle: "notes.txt"}},
+		},
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/acme/bundle/manifests/v1":
+			w.Write(manifest)
+		case strings.HasPrefix(r.URL.Path, "/v2/acme/bundle/blobs/"):
+			blob, ok := blobs[strings.TrimPrefix(r.URL.Path, "/v2/acme/bundle/blobs/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(blob)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	oldScheme := Scheme
+	Scheme = "http"
+	defer func() { Scheme = oldScheme }()
+
+	image := strings.TrimPrefix(server.URL, "http://") + "/acme/bundle"
+
+	dest := t.TempDir()
+	got, err := Pull(image, "v1", "", dest)
+	if err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+	if got != digest(manifest) {
+		t.Errorf("Pull() digest = %s, want %s", got, digest(manifest))
+	}
+
+	data, err := os.ReadFile(filepath.Join(dest, "config", "app.yml"))
+	if err != nil || string(data) != string(content) {
+		t.Errorf("Extracted layer content = %q, %v", string(data), err)
+	}
+	data, err = os.ReadFile(filepath.Join(dest, "notes.txt"))
+	if err != nil || string(data) != string(file) {
+		t.Errorf("File layer content = %q, %v", string(data), err)
+	}
+
+	// Selecting a single layer by title skips the others
+	dest = t.TempDir()
+	if _, err := Pull(image, "v1", "notes.txt", dest); err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "config")); !os.IsNotExist(err) {
+		t.Error("Unselected layer was extracted")
+	}
+}
@@ -0,0 +1,135 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rjocoleman/git-overlay/internal/archive"
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/gomod"
+	"github.com/rjocoleman/git-overlay/internal/oci"
+	"github.com/rjocoleman/git-overlay/internal/release"
+)
+
+func init() {
+	Register(config.UpstreamTypeRelease, newReleaseProvider)
+	Register(config.UpstreamTypeGoMod, newGoModProvider)
+	Register(config.UpstreamTypeOCI, newOCIProvider)
+}
+
+// releaseProvider downloads an asset attached to a GitHub or GitLab release
+type releaseProvider struct {
+	upstream config.UpstreamConfig
+}
+
+func newReleaseProvider(upstream config.UpstreamConfig) (UpstreamProvider, error) {
+	if upstream.Repo == "" {
+		return nil, fmt.Errorf("upstream.repo is required for release upstreams")
+	}
+	if upstream.Asset == "" {
+		return nil, fmt.Errorf("upstream.asset is required for release upstreams")
+	}
+	return &releaseProvider{upstream: upstream}, nil
+}
+
+func (p *releaseProvider) Resolve(ref string) (string, error) {
+	rel, err := release.Fetch(p.upstream.Host, p.upstream.Repo, ref)
+	if err != nil {
+		return "", err
+	}
+	return rel.Tag, nil
+}
+
+func (p *releaseProvider) Fetch(ref, dest string) error {
+	rel, err := release.Fetch(p.upstream.Host, p.upstream.Repo, ref)
+	if err != nil {
+		return err
+	}
+
+	asset, err := rel.FindAsset(p.upstream.Asset)
+	if err != nil {
+		return err
+	}
+
+	sum, err := rel.Checksum(asset)
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "git-overlay-release-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fmt.Printf("Downloading %s from release %s\n", asset.Name, rel.Tag)
+	archivePath := filepath.Join(tmpDir, asset.Name)
+	if err := release.Download(asset, archivePath, sum); err != nil {
+		return err
+	}
+
+	return archive.Extract(archivePath, dest, p.upstream.StripComponents)
+}
+
+// goModProvider downloads a module zip from the Go module proxy
+type goModProvider struct {
+	upstream config.UpstreamConfig
+}
+
+func newGoModProvider(upstream config.UpstreamConfig) (UpstreamProvider, error) {
+	if upstream.Module == "" {
+		return nil, fmt.Errorf("upstream.module is required for gomod upstreams")
+	}
+	return &goModProvider{upstream: upstream}, nil
+}
+
+func (p *goModProvider) Resolve(ref string) (string, error) {
+	return gomod.Resolve(p.upstream.Module, ref)
+}
+
+func (p *goModProvider) Fetch(ref, dest string) error {
+	version, err := gomod.Resolve(p.upstream.Module, ref)
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "git-overlay-gomod-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fmt.Printf("Downloading %s@%s from %s\n", p.upstream.Module, version, gomod.Proxy())
+	archivePath := filepath.Join(tmpDir, "module.zip")
+	strip, err := gomod.Download(p.upstream.Module, version, archivePath)
+	if err != nil {
+		return err
+	}
+
+	return archive.Extract(archivePath, dest, strip)
+}
+
+// ociProvider pulls image or artifact layers from an OCI registry
+type ociProvider struct {
+	upstream config.UpstreamConfig
+}
+
+func newOCIProvider(upstream config.UpstreamConfig) (UpstreamProvider, error) {
+	if upstream.Image == "" {
+		return nil, fmt.Errorf("upstream.image is required for oci upstreams")
+	}
+	return &ociProvider{upstream: upstream}, nil
+}
+
+func (p *ociProvider) Resolve(ref string) (string, error) {
+	return oci.Resolve(p.upstream.Image, ref)
+}
+
+func (p *ociProvider) Fetch(ref, dest string) error {
+	fmt.Printf("Pulling %s:%s\n", p.upstream.Image, ref)
+	if _, err := oci.Pull(p.upstream.Image, ref, p.upstream.Layer, dest); err != nil {
+		return fmt.Errorf("failed to pull %s: %w", p.upstream.Image, err)
+	}
+	return nil
+}
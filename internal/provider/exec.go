@@ -0,0 +1,77 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+	"github.com/rjocoleman/git-overlay/internal/git"
+	"gopkg.in/yaml.v3"
+)
+
+// execProvider delegates to an external git-overlay-provider-<name> binary.
+//
+// The binary is invoked as "<binary> resolve <ref>", printing the resolved
+// identifier on stdout, and "<binary> fetch <ref> <dest>", populating dest.
+// The upstream configuration is passed as JSON in GIT_OVERLAY_UPSTREAM, using
+// the same keys as .git-overlay.yml.
+type execProvider struct {
+	path     string
+	upstream config.UpstreamConfig
+}
+
+func (p *execProvider) Resolve(ref string) (string, error) {
+	out, err := p.run("resolve", ref)
+	if err != nil {
+		return "", err
+	}
+	id := strings.TrimSpace(out)
+	if id == "" {
+		return "", fmt.Errorf("%s resolve printed no identifier", p.path)
+	}
+	return id, nil
+}
+
+func (p *execProvider) Fetch(ref, dest string) error {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	_, err := p.run("fetch", ref, dest)
+	return err
+}
+
+// run executes the provider binary, passing stderr through to the user
+func (p *execProvider) run(args ...string) (string, error) {
+	upstream, err := encodeUpstream(p.upstream)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode upstream config: %w", err)
+	}
+
+	cmd := exec.Command(p.path, args...)
+	cmd.Env = append(git.UpstreamEnv(), "GIT_OVERLAY_UPSTREAM="+string(upstream))
+	cmd.Stderr = os.Stderr
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("provider %s %s failed: %w", p.path, args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// encodeUpstream renders the upstream config as JSON keyed like the YAML file
+func encodeUpstream(upstream config.UpstreamConfig) ([]byte, error) {
+	data, err := yaml.Marshal(upstream)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := yaml.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
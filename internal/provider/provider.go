@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"sync"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+// UpstreamProvider fetches upstream content that is not a git submodule
+type UpstreamProvider interface {
+	// Resolve returns a stable identifier (version, tag or digest) for ref
+	Resolve(ref string) (string, error)
+	// Fetch writes the upstream tree for ref into dest, which does not exist yet
+	Fetch(ref, dest string) error
+}
+
+// Factory creates a provider for an upstream configuration
+type Factory func(upstream config.UpstreamConfig) (UpstreamProvider, error)
+
+// ExecPrefix is the prefix of external provider binaries looked up on PATH
+const ExecPrefix = "git-overlay-provider-"
+
+var (
+	mu        sync.RWMutex
+	factories = map[string]Factory{}
+)
+
+// Register makes a provider available under an upstream type name
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	factories[name] = factory
+}
+
+// Registered returns the names of all built-in and registered providers
+func Registered() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	var names []string
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns the provider for upstream.Type, falling back to an external
+// git-overlay-provider-<type> binary on PATH
+func New(upstream config.UpstreamConfig) (UpstreamProvider, error) {
+	mu.RLock()
+	factory, ok := factories[upstream.Type]
+	mu.RUnlock()
+	if ok {
+		return factory(upstream)
+	}
+
+	path, err := exec.LookPath(ExecPrefix + upstream.Type)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported upstream type %q: no built-in provider and no %s%s on PATH", upstream.Type, ExecPrefix, upstream.Type)
+	}
+	return &execProvider{path: path, upstream: upstream}, nil
+}
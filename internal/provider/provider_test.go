@@ -0,0 +1,117 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/rjocoleman/git-overlay/internal/config"
+)
+
+func TestNewBuiltin(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream config.UpstreamConfig
+		wantErr  string
+	}{
+		{
+			name:     "release",
+			upstream: config.UpstreamConfig{Type: "release", Repo: "acme/sdk", Asset: "*.tar.gz"},
+		},
+		{
+			name:     "release missing asset",
+			upstream: config.UpstreamConfig{Type: "release", Repo: "acme/sdk"},
+			wantErr:  "upstream.asset is required",
+		},
+		{
+			name:     "gomod missing module",
+			upstream: config.UpstreamConfig{Type: "gomod"},
+			wantErr:  "upstream.module is required",
+		},
+		{
+			name:     "oci",
+			upstream: config.UpstreamConfig{Type: "oci", Image: "ghcr.io/acme/bundle"},
+		},
+		{
+			name:     "unknown",
+			upstream: config.UpstreamConfig{Type: "does-not-exist"},
+			wantErr:  "unsupported upstream type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PATH", t.TempDir())
+			_, err := New(tt.upstream)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("New() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("New() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExecProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script providers are not supported on windows")
+	}
+
+	binDir := t.TempDir()
+	script := `#!/bin/sh
+case "$1" in
+resolve) echo "resolved-$2" ;;
+fetch) printf '%s' "$GIT_OVERLAY_UPSTREAM" > "$3/upstream.json"; echo "$2" > "$3/ref" ;;
+*) exit 1 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(binDir, ExecPrefix+"custom"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write provider: %v", err)
+	}
+	t.Setenv("PATH", binDir)
+
+	p, err := New(config.UpstreamConfig{
+		Type:    "custom",
+		Ref:     "v1",
+		Options: map[string]string{"bucket": "assets"},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	id, err := p.Resolve("v1")
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if id != "resolved-v1" {
+		t.Errorf("Resolve() = %q, want %q", id, "resolved-v1")
+	}
+
+	dest := filepath.Join(t.TempDir(), "upstream")
+	if err := p.Fetch(id, dest); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	ref, err := os.ReadFile(filepath.Join(dest, "ref"))
+	if err != nil {
+		t.Fatalf("Failed to read fetched file: %v", err)
+	}
+	if strings.TrimSpace(string(ref)) != "resolved-v1" {
+		t.Errorf("fetched ref = %q, want %q", ref, "resolved-v1")
+	}
+
+	upstream, err := os.ReadFile(filepath.Join(dest, "upstream.json"))
+	if err != nil {
+		t.Fatalf("Failed to read upstream config: %v", err)
+	}
+	want := `{"options":{"bucket":"assets"},"ref":"v1","type":"custom"}`
+	if string(upstream) != want {
+		t.Errorf("GIT_OVERLAY_UPSTREAM = %s, want %s", upstream, want)
+	}
+}
@@ -0,0 +1,237 @@
+package release
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// API base URLs, overridable for tests and self-hosted instances
+var (
+	GitHubAPI = "https://api.github.com"
+	GitLabAPI = "https://gitlab.com/api/v4"
+)
+
+var client = &http.Client{Timeout: 5 * time.Minute}
+
+// Release is a published release and its downloadable assets
+type Release struct {
+	Tag    string
+	Assets []Asset
+}
+
+// Asset is a single file attached to a release
+type Asset struct {
+	Name   string
+	URL    string
+	Digest string // "sha256:<hex>" when the forge publishes one
+}
+
+// Fetch looks up a release by tag ("latest" for the newest) on github or gitlab
+func Fetch(host, repo, tag string) (*Release, error) {
+	switch host {
+	case "", "github":
+		return fetchGitHub(repo, tag)
+	case "gitlab":
+		return fetchGitLab(repo, tag)
+	default:
+		return nil, fmt.Errorf("unsupported release host: %s", host)
+	}
+}
+
+// fetchGitHub looks up a release through the GitHub REST API
+func fetchGitHub(repo, tag string) (*Release, error) {
+	endpoint := fmt.Sprintf("%s/repos/%s/releases/tags/%s", GitHubAPI, repo, url.PathEscape(tag))
+	if tag == "latest" {
+		endpoint = fmt.Sprintf("%s/repos/%s/releases/latest", GitHubAPI, repo)
+	}
+
+	var body struct {
+		TagName string `json:"tag_name"`
+		Assets  []struct {
+			Name               string `json:"name"`
+			BrowserDownloadURL string `json:"browser_download_url"`
+			Digest             string `json:"digest"`
+		} `json:"assets"`
+	}
+	if err := getJSON(endpoint, "GITHUB_TOKEN", "Bearer ", &body); err != nil {
+		return nil, err
+	}
+
+	rel := &Release{Tag: body.TagName}
+	for _, a := range body.Assets {
+		rel.Assets = append(rel.Assets, Asset{Name: a.Name, URL: a.BrowserDownloadURL, Digest: a.Digest})
+	}
+	return rel, nil
+}
+
+// fetchGitLab looks up a release through the GitLab REST API
+func fetchGitLab(repo, tag string) (*Release, error) {
+	endpoint := fmt.Sprintf("%s/projects/%s/releases/%s", GitLabAPI, url.PathEscape(repo), url.PathEscape(tag))
+	if tag == "latest" {
+		endpoint = fmt.Sprintf("%s/projects/%s/releases/permalink/latest", GitLabAPI, url.PathEscape(repo))
+	}
+
+	var body struct {
+		TagName string `json:"tag_name"`
+		Assets  struct {
+			Links []struct {
+				Name string `json:"name"`
+				URL  string `json:"url"`
+			} `json:"links"`
+		} `json:"assets"`
+	}
+	if err := getJSON(endpoint, "GITLAB_TOKEN", "Bearer ", &body); err != nil {
+		return nil, err
+	}
+
+	rel := &Release{Tag: body.TagName}
+	for _, l := range body.Assets.Links {
+		rel.Assets = append(rel.Assets, Asset{Name: l.Name, URL: l.URL})
+	}
+	return rel, nil
+}
+
+// getJSON fetches endpoint and decodes the JSON response into v
+func getJSON(endpoint, tokenEnv, scheme string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if token := os.Getenv(tokenEnv); token != "" {
+		req.Header.Set("Authorization", scheme+token)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch release: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch release from %s: %s", endpoint, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// FindAsset returns the single asset whose name matches the glob pattern
+func (r *Release) FindAsset(pattern string) (*Asset, error) {
+	var found *Asset
+	for i, a := range r.Assets {
+		ok, err := path.Match(pattern, a.Name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid asset pattern %q: %w", pattern, err)
+		}
+		if !ok {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("asset pattern %q matches both %s and %s", pattern, found.Name, a.Name)
+		}
+		found = &r.Assets[i]
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no asset in release %s matches %q", r.Tag, pattern)
+	}
+	return found, nil
+}
+
+// Checksum returns the expected SHA-256 of an asset, taken from the digest the
+// forge publishes or from a checksums file (e.g. checksums.txt, SHA256SUMS or
+// <asset>.sha256) attached to the same release
+func (r *Release) Checksum(asset *Asset) (string, error) {
+	if strings.HasPrefix(asset.Digest, "sha256:") {
+		return strings.TrimPrefix(asset.Digest, "sha256:"), nil
+	}
+
+	for _, a := range r.Assets {
+		name := strings.ToLower(a.Name)
+		if name != strings.ToLower(asset.Name)+".sha256" &&
+			!strings.Contains(name, "checksums") && !strings.Contains(name, "sha256sums") {
+			continue
+		}
+
+		sums, err := download(a.URL)
+		if err != nil {
+			return "", err
+		}
+		if sum := findChecksum(sums, asset.Name); sum != "" {
+			return sum, nil
+		}
+	}
+
+	return "", fmt.Errorf("release %s publishes no SHA-256 checksum for %s", r.Tag, asset.Name)
+}
+
+// findChecksum finds the checksum for name in sha256sum-style output. A file
+// holding a single bare hash is also accepted.
+func findChecksum(sums []byte, name string) string {
+	scanner := bufio.NewScanner(strings.NewReader(string(sums)))
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && strings.TrimPrefix(fields[len(fields)-1], "*") == name {
+			return strings.ToLower(fields[0])
+		}
+	}
+	if len(lines) == 1 && len(strings.Fields(lines[0])) == 1 {
+		return strings.ToLower(lines[0])
+	}
+	return ""
+}
+
+// download fetches a small file into memory
+func download(u string) ([]byte, error) {
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", u, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Download saves an asset to dst and verifies it against the expected SHA-256
+func Download(asset *Asset, dst, sha string) error {
+	resp, err := client.Get(asset.URL)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", asset.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s: %s", asset.Name, resp.Status)
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), resp.Body); err != nil {
+		return fmt.Errorf("failed to download %s: %w", asset.Name, err)
+	}
+
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, sha) {
+		return fmt.Errorf("checksum mismatch for %s: got sha256 %s, want %s", asset.Name, got, sha)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package release
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFetchAndDownload(t *testing.T) {
+	asset := []byte("sdk contents")
+	sum := sha256.Sum256(asset)
+	hexSum := hex.EncodeToString(sum[:])
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/acme/sdk/releases/tags/v1.0.0":
+			fmt.Fprintf(w, `{"tag_name":"v1.0.0","assets":[
+				{"name":"sdk-1.0.0.tar.gz","browser_download_url":"%[1]s/dl/sdk-1.0.0.tar.gz"},
+				{"name":"checksums.txt","browser_download_url":"%[1]s/dl/checksums.txt"}
+			]}`, server.URL)
+		case "/dl/sdk-1.0.0.tar.gz":
+			w.Write(asset)
+		case "/dl/checksums.txt":
+			fmt.Fprintf(w, "%s  sdk-1.0.0.tar.gz\n%s  other.zip\n", hexSum, hexSum[:10])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	oldAPI := GitHubAPI
+	GitHubAPI = server.URL
+	defer func() { GitHubAPI = oldAPI }()
+
+	rel, err := Fetch("github", "acme/sdk", "v1.0.0")
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	a, err := rel.FindAsset("sdk-*.tar.gz")
+	if err != nil {
+		t.Fatalf("FindAsset() error = %v", err)
+	}
+
+	got, err := rel.Checksum(a)
+	if err != nil {
+		t.Fatalf("Checksum() error = %v", err)
+	}
+	if got != hexSum {
+		t.Errorf("Checksum() = %s, want %s", got, hexSum)
+	}
+
+	dst := filepath.Join(t.TempDir(), a.Name)
+	if err := Download(a, dst, got); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	data, err := os.ReadFile(dst)
+	if err != nil || string(data) != string(asset) {
+		t.Errorf("Downloaded content = %q, %v", string(data), err)
+	}
+
+	// A tampered asset fails verification
+	if err := Download(a, dst, hexSum[:63]+"0"); err == nil {
+		t.Error("Download() expected checksum mismatch error")
+	}
+
+	// Releases without any checksum are rejected
+	bare := &Release{Tag: "v1.0.0", Assets: []Asset{*a}}
+	if _, err := bare.Checksum(a); err == nil {
+		t.Error("Checksum() expected error when release has no checksums")
+	}
+}
+
+func TestFindChecksum(t *testing.T) {
+	sums := []byte("abc123  one.zip\ndef456 *two.tar.gz\n")
+	if got := findChecksum(sums, "two.tar.gz"); got != "def456" {
+		t.Errorf("findChecksum() = %q, want def456", got)
+	}
+	if got := findChecksum([]byte("ABC123\n"), "anything"); got != "abc123" {
+		t.Errorf("findChecksum() = %q for bare hash, want abc123", got)
+	}
+	if got := findChecksum(sums, "missing.zip"); got != "" {
+		t.Errorf("findChecksum() = %q, want empty", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/rjocoleman/git-overlay/cmd"
+	"github.com/rjocoleman/git-overlay/pkg/overlayerr"
 )
 
 var (
@@ -18,6 +19,9 @@ func main() {
 	cmd.SetVersion(Version)
 	if err := cmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		if hint := overlayerr.Hint(err); hint != "" {
+			fmt.Fprintln(os.Stderr, "hint: "+hint)
+		}
+		os.Exit(cmd.ExitCode(err))
 	}
 }
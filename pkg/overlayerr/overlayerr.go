@@ -0,0 +1,92 @@
+// Package overlayerr defines the kinds of errors git-overlay reports. Errors
+// returned by git-overlay wrap one of these, so callers can tell them apart
+// with errors.Is and react to the kind rather than the message.
+package overlayerr
+
+import "errors"
+
+var (
+	// ErrSourceMissing is returned when a spec's source is not in the upstream
+	ErrSourceMissing = errors.New("source does not exist")
+	// ErrConflict is returned when a target exists that git-overlay doesn't own
+	ErrConflict = errors.New("target already exists")
+	// ErrRefNotFound is returned when an upstream ref is neither a branch, a tag
+	// nor a known commit
+	ErrRefNotFound = errors.New("upstream ref not found")
+	// ErrHistoryRewritten is returned when a branch upstream was force-pushed and
+	// the checked out commit is no longer part of its history
+	ErrHistoryRewritten = errors.New("upstream history was rewritten")
+	// ErrAbsolutePath is returned for absolute paths where relative ones are required
+	ErrAbsolutePath = errors.New("absolute paths are not allowed")
+	// ErrPathEscape is returned for paths that leave their base directory
+	ErrPathEscape = errors.New("path attempts to escape base directory")
+	// ErrChecksumMismatch is returned when the config doesn't match --config-sha256
+	ErrChecksumMismatch = errors.New("config checksum mismatch")
+	// ErrWrongDirectory is returned when git-overlay runs somewhere that isn't
+	// the root of a project
+	ErrWrongDirectory = errors.New("not a git-overlay project root")
+	// ErrInsufficientSpace is returned when copies wouldn't fit on the
+	// filesystem holding overlay/
+	ErrInsufficientSpace = errors.New("not enough free space")
+	// ErrCrossDevice is returned when hardlinks would have to cross filesystems
+	ErrCrossDevice = errors.New("hardlink across filesystems")
+	// ErrInterrupted is returned when Ctrl-C or SIGTERM stopped a run early
+	ErrInterrupted = errors.New("interrupted")
+	// ErrFetchTimeout is returned when a clone, fetch or pull takes longer
+	// than --fetch-timeout
+	ErrFetchTimeout = errors.New("fetch timed out")
+	// ErrPlanDrift is returned when apply finds the repository or upstream
+	// no longer as they were when the plan was made
+	ErrPlanDrift = errors.New("repository changed since the plan was made")
+	// ErrSecretFound is returned when secret_scan finds what looks like a
+	// secret in an upstream file about to be materialized
+	ErrSecretFound = errors.New("possible secret in upstream file")
+	// ErrLimitExceeded is returned when a run would link more files or content
+	// than limits allows
+	ErrLimitExceeded = errors.New("overlay limit exceeded")
+	// ErrLocked is returned when another git-overlay run holds the
+	// repository lock
+	ErrLocked = errors.New("repository is locked by another git-overlay run")
+	// ErrDirty is returned when init or sync finds uncommitted changes under
+	// overlay/ or to the files git-overlay maintains
+	ErrDirty = errors.New("uncommitted changes")
+	// ErrRefNotAllowed is returned when an upstream ref doesn't match any
+	// pattern in policies.allowed_refs
+	ErrRefNotAllowed = errors.New("upstream ref not allowed by policies.allowed_refs")
+)
+
+// hints pairs each error kind with what to do about it
+var hints = []struct {
+	kind error
+	hint string
+}{
+	{ErrConflict, "rerun with --force to replace files git-overlay doesn't manage yet"},
+	{ErrSourceMissing, "check the spec's path against the upstream, or mark the spec optional: true"},
+	{ErrRefNotFound, "check upstream.ref; 'git ls-remote <url>' lists the branches and tags"},
+	{ErrHistoryRewritten, "review the new upstream history, then rerun with --accept-rewrite"},
+	{ErrAbsolutePath, "use paths relative to the upstream and overlay/ roots"},
+	{ErrPathEscape, "use paths that stay inside the upstream and overlay/ roots"},
+	{ErrChecksumMismatch, "review the config, then update the expected --config-sha256"},
+	{ErrWrongDirectory, "run git-overlay from the project root or pass --config"},
+	{ErrInsufficientSpace, "free up space on the filesystem holding overlay/, or use link_mode: symlink or auto"},
+	{ErrCrossDevice, "use link_mode: auto or copy, or keep the upstream checkout on the filesystem holding overlay/"},
+	{ErrInterrupted, "the work done so far is recorded; rerun the command to finish"},
+	{ErrFetchTimeout, "raise --fetch-timeout, or add upstream mirrors that are closer"},
+	{ErrPlanDrift, "review what changed, then make a new plan with 'git-overlay plan --json'"},
+	{ErrSecretFound, "check the file upstream; add its path to secret_scan.allow if it is a false positive"},
+	{ErrLimitExceeded, "look for a spec matching more than intended, or raise limits in the config"},
+	{ErrLocked, "wait for the other run to finish; a lock left by a crashed run is removed once it goes stale"},
+	{ErrDirty, "commit or stash the changes first, or rerun with --allow-dirty"},
+	{ErrRefNotAllowed, "pick a released version matching policies.allowed_refs, or have the policy changed"},
+}
+
+// Hint returns a remediation hint for the first known error kind wrapped by
+// err, or "" if there is none
+func Hint(err error) string {
+	for _, h := range hints {
+		if errors.Is(err, h.kind) {
+			return h.hint
+		}
+	}
+	return ""
+}
@@ -0,0 +1,35 @@
+package overlayerr
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestHint(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "unknown", err: errors.New("boom"), want: ""},
+		{name: "nil", err: nil, want: ""},
+		{name: "direct", err: ErrConflict, want: Hint(ErrConflict)},
+		{name: "wrapped", err: fmt.Errorf("failed to rebuild links: %w", fmt.Errorf("%w: overlay/a", ErrConflict)), want: Hint(ErrConflict)},
+		{name: "joined", err: errors.Join(errors.New("boom"), fmt.Errorf("%w: main", ErrRefNotFound)), want: Hint(ErrRefNotFound)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Hint(tt.err); got != tt.want {
+				t.Errorf("Hint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for _, h := range hints {
+		if h.hint == "" {
+			t.Errorf("no hint for %v", h.kind)
+		}
+	}
+}